@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// publicPaths are served without the bearer token, so that load balancers
+// and orchestrators can probe the server
+var publicPaths = map[string]bool{
+	"/health": true,
+}
+
+// Server exposes operational endpoints such as metrics and management APIs
+// on a port separate from log ingestion
+type Server struct {
+	addr   string
+	token  string
+	mux    *http.ServeMux
+	server *http.Server
+	wg     sync.WaitGroup
+}
+
+// NewServer creates a new admin Server listening on addr with /debug/vars
+// metrics and a /health check registered. Requests to any path but those in
+// publicPaths must carry token as a bearer token; without a token they are
+// refused.
+func NewServer(addr, token string) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	s := &Server{
+		addr:  addr,
+		token: token,
+		mux:   mux,
+	}
+	s.server = &http.Server{
+		Addr:    addr,
+		Handler: http.HandlerFunc(s.authorize),
+	}
+	return s
+}
+
+// authorize lets requests to public paths through and checks the bearer
+// token of any other
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if publicPaths[r.URL.Path] {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	if s.token == "" {
+		http.Error(w, "The admin API requires admin.token to be configured", http.StatusForbidden)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Handle registers a handler for the given pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers a handler function for the given pattern
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Start begins serving admin requests
+func (s *Server) Start() error {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin server error: %v", err)
+		}
+	}()
+
+	log.Println("Admin server started on", s.addr)
+	return nil
+}
+
+// Stop shuts down the admin server
+func (s *Server) Stop() {
+	s.server.Close()
+	s.wg.Wait()
+	log.Println("Admin server stopped")
+}
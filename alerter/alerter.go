@@ -1,44 +1,93 @@
 package alerter
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"os"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/davidharvith/argos/analyzer"
 )
 
 // Alerter handles alert output and notification
 type Alerter struct {
-	alertChan <-chan analyzer.Alert
-	outputFile string
-	file      *os.File
-	mu        sync.Mutex
-	shutdown  chan struct{}
-	wg        sync.WaitGroup
+	alertChan  <-chan analyzer.Alert
+	sinks      []Sink
+	queues     []*sinkQueue
+	queueSize  int
+	circuit    *circuitConfig
+	routes     []route
+	dedup      *repeatCollapser
+	lifecycle  *alertLifecycle
+	silences   *silenceList
+	catalog    *serviceCatalog
+	resolveTTL time.Duration
+	console    consoleOutput
+	mu         sync.Mutex
+	shutdown   chan struct{}
+	wg         sync.WaitGroup
 }
 
 // NewAlerter creates a new Alerter instance
 func NewAlerter(alertChan <-chan analyzer.Alert, outputFile string) *Alerter {
-	return &Alerter{
-		alertChan:  alertChan,
-		outputFile: outputFile,
-		shutdown:   make(chan struct{}),
+	a := &Alerter{
+		alertChan: alertChan,
+		console:   consoleOutput{w: os.Stdout, format: formatPretty},
+		queueSize: defaultSinkQueueSize,
+		lifecycle: newAlertLifecycle(),
+		silences:  &silenceList{},
+		shutdown:  make(chan struct{}),
 	}
+	if outputFile != "" {
+		a.AddSink(&fileSink{label: "file", path: outputFile})
+	}
+	return a
 }
 
 // Start begins the alerter
 func (a *Alerter) Start() error {
-	// Open output file
-	var err error
-	if a.outputFile != "" {
-		a.file, err = os.OpenFile(a.outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to open output file: %w", err)
+	// Open output files
+	for _, s := range a.sinks {
+		if f, ok := s.(*fileSink); ok {
+			if err := f.open(); err != nil {
+				return err
+			}
+		}
+	}
+	
+	for _, s := range a.sinks {
+		if starter, ok := s.(SinkStarter); ok {
+			starter.Start()
+		}
+	}
+	
+	if a.circuit != nil && a.circuit.deadLetter != nil {
+		if err := a.circuit.deadLetter.open(); err != nil {
+			return err
+		}
+	}
+	
+	// Every sink sends its alerts from a queue of its own
+	a.queues = make([]*sinkQueue, len(a.sinks))
+	for i, s := range a.sinks {
+		a.queues[i] = newSinkQueue(s, a.queueSize)
+		if a.circuit != nil {
+			a.queues[i].breaker = newCircuitBreaker(s.Name(), a.circuit, a.queues[i].metrics, a.circuitChanged(i))
 		}
+		a.queues[i].start()
+	}
+	
+	if a.catalog != nil {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.catalog.watch(a.shutdown)
+		}()
+	}
+	
+	if a.resolveTTL > 0 {
+		a.wg.Add(1)
+		go a.autoResolve()
 	}
 	
 	a.wg.Add(1)
@@ -57,33 +106,41 @@ func (a *Alerter) processAlerts() {
 			if !ok {
 				return
 			}
-			a.outputAlert(alert)
+			a.outputAlert(alert, -1)
 		case <-a.shutdown:
 			return
 		}
 	}
 }
 
-// outputAlert formats and outputs an alert
-func (a *Alerter) outputAlert(alert analyzer.Alert) {
+// outputAlert formats and outputs an alert, to every sink it is routed to
+// but the one at index except, if any
+func (a *Alerter) outputAlert(alert analyzer.Alert, except int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	
-	alertJSON, err := json.MarshalIndent(alert, "", "  ")
-	if err != nil {
-		log.Printf("Failed to marshal alert: %v", err)
+	now := time.Now()
+	if a.catalog != nil {
+		a.catalog.enrich(&alert)
+	}
+	// Alerts silenced or collapsed below still keep their condition firing
+	a.lifecycle.seen(alert, now)
+	if a.silences.silenced(alert, now) {
+		return
+	}
+	if a.dedup != nil && !a.dedup.admit(&alert, now) {
 		return
 	}
+	a.lifecycle.observe(&alert, now)
 	
-	// Print to console
-	fmt.Printf("\n🚨 ALERT: %s (Severity: %s)\n", alert.Reason, alert.Severity)
-	fmt.Println(string(alertJSON))
-	fmt.Println(strings.Repeat("-", 80))
+	if err := a.console.print(alert); err != nil {
+		log.Printf("Failed to print alert: %v", err)
+	}
 	
-	// Write to file if configured
-	if a.file != nil {
-		a.file.Write(alertJSON)
-		a.file.Write([]byte("\n"))
+	for i, s := range a.sinks {
+		if i != except && a.routed(s, alert) {
+			a.queues[i].add(alert)
+		}
 	}
 }
 
@@ -92,8 +149,16 @@ func (a *Alerter) Stop() {
 	close(a.shutdown)
 	a.wg.Wait()
 	
-	if a.file != nil {
-		a.file.Close()
+	for _, q := range a.queues {
+		q.stop()
+	}
+	if a.circuit != nil && a.circuit.deadLetter != nil {
+		a.circuit.deadLetter.close()
+	}
+	for _, s := range a.sinks {
+		if stopper, ok := s.(SinkStopper); ok {
+			stopper.Stop()
+		}
 	}
 	
 	log.Println("Alerter stopped")
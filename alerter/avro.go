@@ -0,0 +1,67 @@
+package alerter
+
+import (
+	"encoding/json"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/hamba/avro/v2"
+)
+
+// alertAvroSchema is the Avro schema alerts are encoded with. The log and
+// metadata, whose fields vary, are carried as JSON.
+const alertAvroSchema = `{"type":"record","name":"Alert","namespace":"io.argos","fields":[` +
+	`{"name":"timestamp","type":"string"},` +
+	`{"name":"severity","type":"string"},` +
+	`{"name":"reason","type":"string"},` +
+	`{"name":"fingerprint","type":"string"},` +
+	`{"name":"score","type":"double"},` +
+	`{"name":"incident_id","type":["null","string"],"default":null},` +
+	`{"name":"source","type":"string"},` +
+	`{"name":"message","type":"string"},` +
+	`{"name":"log","type":"string"},` +
+	`{"name":"metadata","type":"string"}]}`
+
+// alertAvro is the parsed alert schema
+var alertAvro = avro.MustParse(alertAvroSchema)
+
+// avroAlert is an alert in the shape of alertAvroSchema
+type avroAlert struct {
+	Timestamp   string  `avro:"timestamp"`
+	Severity    string  `avro:"severity"`
+	Reason      string  `avro:"reason"`
+	Fingerprint string  `avro:"fingerprint"`
+	Score       float64 `avro:"score"`
+	IncidentID  *string `avro:"incident_id"`
+	Source      string  `avro:"source"`
+	Message     string  `avro:"message"`
+	Log         string  `avro:"log"`
+	Metadata    string  `avro:"metadata"`
+}
+
+// encodeAvroAlert encodes an alert in Avro binary encoding
+func encodeAvroAlert(alert analyzer.Alert) ([]byte, error) {
+	logJSON, err := json.Marshal(alert.Log)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(alert.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	record := avroAlert{
+		Timestamp:   alert.Timestamp,
+		Severity:    alert.Severity,
+		Reason:      alert.Reason,
+		Fingerprint: alert.Fingerprint,
+		Score:       alert.Score,
+		Source:      alert.Log.Source,
+		Message:     alert.Log.Message,
+		Log:         string(logJSON),
+		Metadata:    string(metadata),
+	}
+	if alert.IncidentID != "" {
+		record.IncidentID = &alert.IncidentID
+	}
+	return avro.Marshal(alertAvro, record)
+}
@@ -0,0 +1,43 @@
+package alerter
+
+import (
+	"testing"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/parser"
+	"github.com/hamba/avro/v2"
+)
+
+// TestEncodeAvroAlertRoundTrip checks that alerts decode with the alert
+// schema to what they were encoded from, with and without an incident
+func TestEncodeAvroAlertRoundTrip(t *testing.T) {
+	for _, incident := range []string{"", "inc-42"} {
+		alert := analyzer.Alert{
+			Timestamp:   "2024-03-01T09:00:00Z",
+			Severity:    "HIGH",
+			Reason:      "Error Spike",
+			Fingerprint: "3f2a9c",
+			Score:       87.5,
+			IncidentID:  incident,
+			Log:         parser.ParsedLog{Source: "web-1", Message: "connection refused"},
+			Metadata:    map[string]interface{}{"count": 12},
+		}
+		data, err := encodeAvroAlert(alert)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got avroAlert
+		if err := avro.Unmarshal(alertAvro, data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Timestamp != alert.Timestamp || got.Severity != alert.Severity || got.Reason != alert.Reason ||
+			got.Fingerprint != alert.Fingerprint || got.Score != alert.Score ||
+			got.Source != "web-1" || got.Message != "connection refused" || got.Metadata != `{"count":12}` {
+			t.Errorf("decoded %+v from %+v", got, alert)
+		}
+		if (got.IncidentID == nil) != (incident == "") || got.IncidentID != nil && *got.IncidentID != incident {
+			t.Errorf("incident %v, want %q", got.IncidentID, incident)
+		}
+	}
+}
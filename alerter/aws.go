@@ -0,0 +1,325 @@
+package alerter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// AWS sink defaults and limits
+const (
+	defaultAWSBatchWindow = time.Second
+	defaultAWSTimeout     = 30 * time.Second
+
+	// awsMaxBatch is the most messages SQS and SNS accept per batch, and
+	// awsMaxBatchBytes the largest total size of a batch
+	awsMaxBatch      = 10
+	awsMaxBatchBytes = 256 * 1024
+)
+
+// awsMessage is an alert encoded for SQS or SNS
+type awsMessage struct {
+	body     string
+	severity string
+	rule     string
+	group    string
+	dedupID  string
+}
+
+// sqsSink sends alerts to an SQS queue in batches, e.g. to trigger Lambda
+// functions. Credentials come from the default AWS credential chain.
+type sqsSink struct {
+	client   *sqs.Client
+	queueURL string
+	fifo     bool
+	body     alertTemplate
+	timeout  time.Duration
+	batcher  *alertBatcher
+}
+
+// snsSink publishes alerts to an SNS topic in batches. Credentials come
+// from the default AWS credential chain.
+type snsSink struct {
+	client   *sns.Client
+	topicARN string
+	fifo     bool
+	body     alertTemplate
+	timeout  time.Duration
+	batcher  *alertBatcher
+}
+
+// loadAWSConfig loads the AWS configuration from the environment, shared
+// configuration files and instance or task roles, in the order the SDK
+// looks for credentials
+func loadAWSConfig(region string, timeout time.Duration) (aws.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load aws configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// awsBatching returns the batch size and window of an AWS sink
+func awsBatching(size int, window config.Duration) (int, time.Duration) {
+	if size <= 0 || size > awsMaxBatch {
+		size = awsMaxBatch
+	}
+	if window <= 0 {
+		return size, defaultAWSBatchWindow
+	}
+	return size, time.Duration(window)
+}
+
+// newSQSSink creates a sink sending alerts to an SQS queue
+func newSQSSink(cfg config.SQS) (Sink, error) {
+	if cfg.QueueURL == "" {
+		return nil, errors.New("sqs queue_url is required")
+	}
+	s := &sqsSink{
+		queueURL: cfg.QueueURL,
+		fifo:     strings.HasSuffix(cfg.QueueURL, ".fifo"),
+		timeout:  time.Duration(cfg.Timeout),
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultAWSTimeout
+	}
+	var err error
+	if s.body, err = newAlertTemplate("sqs", cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	awsCfg, err := loadAWSConfig(cfg.Region, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	s.client = sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+	size, window := awsBatching(cfg.BatchSize, cfg.BatchWindow)
+	s.batcher = newAlertBatcher("sqs", size, window, s.flush)
+	return s, nil
+}
+
+// Name implements Sink
+func (s *sqsSink) Name() string {
+	return "sqs"
+}
+
+// Send adds an alert to the current batch
+func (s *sqsSink) Send(alert analyzer.Alert) error {
+	return s.batcher.add(alert)
+}
+
+// Start implements SinkStarter
+func (s *sqsSink) Start() {
+	s.batcher.start()
+}
+
+// Stop implements SinkStopper, sending the last batch
+func (s *sqsSink) Stop() {
+	s.batcher.stop()
+}
+
+// flush sends a batch of alerts to the queue
+func (s *sqsSink) flush(alerts []analyzer.Alert) error {
+	messages, err := awsMessages(alerts, s.body)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, chunk := range awsChunks(messages) {
+		entries := make([]sqstypes.SendMessageBatchRequestEntry, len(chunk))
+		for i, m := range chunk {
+			entries[i] = sqstypes.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(m.body),
+				MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+					"severity": {DataType: aws.String("String"), StringValue: aws.String(m.severity)},
+					"rule":     {DataType: aws.String("String"), StringValue: aws.String(m.rule)},
+				},
+			}
+			if s.fifo {
+				entries[i].MessageGroupId = aws.String(m.group)
+				entries[i].MessageDeduplicationId = aws.String(m.dedupID)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		out, err := s.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{QueueUrl: aws.String(s.queueURL), Entries: entries})
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(out.Failed) > 0 {
+			errs = append(errs, fmt.Errorf("%d of %d messages failed: %s", len(out.Failed), len(entries), aws.ToString(out.Failed[0].Message)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newSNSSink creates a sink publishing alerts to an SNS topic
+func newSNSSink(cfg config.SNS) (Sink, error) {
+	if cfg.TopicARN == "" {
+		return nil, errors.New("sns topic_arn is required")
+	}
+	s := &snsSink{
+		topicARN: cfg.TopicARN,
+		fifo:     strings.HasSuffix(cfg.TopicARN, ".fifo"),
+		timeout:  time.Duration(cfg.Timeout),
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultAWSTimeout
+	}
+	var err error
+	if s.body, err = newAlertTemplate("sns", cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	awsCfg, err := loadAWSConfig(cfg.Region, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	s.client = sns.NewFromConfig(awsCfg, func(o *sns.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+	size, window := awsBatching(cfg.BatchSize, cfg.BatchWindow)
+	s.batcher = newAlertBatcher("sns", size, window, s.flush)
+	return s, nil
+}
+
+// Name implements Sink
+func (s *snsSink) Name() string {
+	return "sns"
+}
+
+// Send adds an alert to the current batch
+func (s *snsSink) Send(alert analyzer.Alert) error {
+	return s.batcher.add(alert)
+}
+
+// Start implements SinkStarter
+func (s *snsSink) Start() {
+	s.batcher.start()
+}
+
+// Stop implements SinkStopper, publishing the last batch
+func (s *snsSink) Stop() {
+	s.batcher.stop()
+}
+
+// flush publishes a batch of alerts to the topic
+func (s *snsSink) flush(alerts []analyzer.Alert) error {
+	messages, err := awsMessages(alerts, s.body)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, chunk := range awsChunks(messages) {
+		entries := make([]snstypes.PublishBatchRequestEntry, len(chunk))
+		for i, m := range chunk {
+			entries[i] = snstypes.PublishBatchRequestEntry{
+				Id:      aws.String(strconv.Itoa(i)),
+				Message: aws.String(m.body),
+				MessageAttributes: map[string]snstypes.MessageAttributeValue{
+					"severity": {DataType: aws.String("String"), StringValue: aws.String(m.severity)},
+					"rule":     {DataType: aws.String("String"), StringValue: aws.String(m.rule)},
+				},
+			}
+			if s.fifo {
+				entries[i].MessageGroupId = aws.String(m.group)
+				entries[i].MessageDeduplicationId = aws.String(m.dedupID)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		out, err := s.client.PublishBatch(ctx, &sns.PublishBatchInput{TopicArn: aws.String(s.topicARN), PublishBatchRequestEntries: entries})
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(out.Failed) > 0 {
+			errs = append(errs, fmt.Errorf("%d of %d messages failed: %s", len(out.Failed), len(entries), aws.ToString(out.Failed[0].Message)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// awsMessages encodes alerts as messages, as JSON or rendered by the body
+// template. On FIFO queues and topics, alerts are grouped by fingerprint so
+// that the alerts of one rule and key stay in order, and deduplicated by
+// content.
+func awsMessages(alerts []analyzer.Alert, body alertTemplate) ([]awsMessage, error) {
+	messages := make([]awsMessage, 0, len(alerts))
+	for _, alert := range alerts {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		// Rendered bodies may be alike for distinct alerts, so the
+		// deduplication ID always comes from the JSON
+		sum := sha256.Sum256(data)
+		if body != nil {
+			if data, err = renderAlert(body, alert); err != nil {
+				return nil, err
+			}
+		}
+		group := alert.Fingerprint
+		if group == "" {
+			group = "argos"
+		}
+		messages = append(messages, awsMessage{
+			body:     string(data),
+			severity: alert.Severity,
+			rule:     alert.Reason,
+			group:    group,
+			dedupID:  hex.EncodeToString(sum[:]),
+		})
+	}
+	return messages, nil
+}
+
+// awsChunks splits messages into batches within the count and size limits
+// of SQS and SNS
+func awsChunks(messages []awsMessage) [][]awsMessage {
+	var chunks [][]awsMessage
+	var chunk []awsMessage
+	size := 0
+	for _, m := range messages {
+		if len(chunk) == awsMaxBatch || (len(chunk) > 0 && size+len(m.body) > awsMaxBatchBytes) {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, m)
+		size += len(m.body)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
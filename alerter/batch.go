@@ -0,0 +1,104 @@
+package alerter
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+)
+
+// alertBatcher collects the alerts of a sink and hands them to flush in
+// batches, once size alerts are collected or every window, and a last
+// time when stopped
+type alertBatcher struct {
+	sink   string
+	size   int
+	window time.Duration
+	flush  func([]analyzer.Alert) error
+
+	mu      sync.Mutex
+	alerts  []analyzer.Alert
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+// newAlertBatcher creates a batcher of the alerts of a sink
+func newAlertBatcher(sink string, size int, window time.Duration, flush func([]analyzer.Alert) error) *alertBatcher {
+	return &alertBatcher{
+		sink:    sink,
+		size:    size,
+		window:  window,
+		flush:   flush,
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// add adds an alert to the current batch, flushing it once full
+func (b *alertBatcher) add(alert analyzer.Alert) error {
+	b.mu.Lock()
+	b.alerts = append(b.alerts, alert)
+	var full []analyzer.Alert
+	if len(b.alerts) >= b.size {
+		full, b.alerts = b.alerts, nil
+	}
+	b.mu.Unlock()
+
+	if full != nil {
+		b.send(full)
+	}
+	return nil
+}
+
+// start flushes the current batch every window
+func (b *alertBatcher) start() {
+	go b.run()
+}
+
+// stop flushes the last batch
+func (b *alertBatcher) stop() {
+	close(b.stopped)
+	<-b.done
+}
+
+// run flushes the current batch every window, and once more on stop
+func (b *alertBatcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flushPending()
+		case <-b.stopped:
+			b.flushPending()
+			return
+		}
+	}
+}
+
+// flushPending flushes the current batch, if any
+func (b *alertBatcher) flushPending() {
+	b.mu.Lock()
+	alerts := b.alerts
+	b.alerts = nil
+	b.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	b.send(alerts)
+}
+
+// send flushes a batch, counting it in the metrics of the sink
+func (b *alertBatcher) send(alerts []analyzer.Alert) {
+	start := time.Now()
+	err := b.flush(alerts)
+	sinkMetricsFor(b.sink).flushDone(len(alerts), time.Since(start), err)
+	if err != nil {
+		log.Printf("Failed to send %d alerts to %s: %v", len(alerts), b.sink, err)
+	}
+}
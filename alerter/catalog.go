@@ -0,0 +1,199 @@
+package alerter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+)
+
+// catalogPollInterval is how often the service catalog file is checked for
+// changes
+const catalogPollInterval = 5 * time.Second
+
+// catalogService is the ownership of a service in the service catalog
+type catalogService struct {
+	// Service names the service, default its key in the catalog
+	Service string `json:"service"`
+
+	Team    string `json:"team"`
+	Slack   string `json:"slack"`
+	Runbook string `json:"runbook"`
+
+	// Runbooks holds the runbooks of particular rules, by rule name or ID,
+	// in place of Runbook
+	Runbooks map[string]string `json:"runbooks"`
+}
+
+// serviceCatalog maps alert sources to the services they belong to, by
+// source name or glob pattern such as checkout-*
+type serviceCatalog struct {
+	path string
+
+	mu       sync.RWMutex
+	modTime  time.Time
+	services map[string]catalogService
+
+	// patterns are the keys of services that are glob patterns, most
+	// specific (longest) first
+	patterns []string
+}
+
+// loadServiceCatalog reads a service catalog file
+func loadServiceCatalog(path string) (*serviceCatalog, error) {
+	c := &serviceCatalog{path: path}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads the catalog file, keeping the current services if it fails
+func (c *serviceCatalog) load() error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to read service catalog: %w", err)
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to read service catalog: %w", err)
+	}
+	var services map[string]catalogService
+	if err := json.Unmarshal(data, &services); err != nil {
+		return fmt.Errorf("failed to parse service catalog %s: %w", c.path, err)
+	}
+	var patterns []string
+	for key := range services {
+		if !strings.ContainsAny(key, `*?[\`) {
+			continue
+		}
+		if _, err := path.Match(key, ""); err != nil {
+			return fmt.Errorf("service catalog %s: invalid pattern %q", c.path, key)
+		}
+		patterns = append(patterns, key)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.services = services
+	c.patterns = patterns
+	c.modTime = info.ModTime()
+	return nil
+}
+
+// reload re-reads the catalog file if it changed since it was loaded
+func (c *serviceCatalog) reload() error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("failed to read service catalog: %w", err)
+	}
+	c.mu.RLock()
+	unchanged := info.ModTime().Equal(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	if err := c.load(); err != nil {
+		return err
+	}
+	log.Printf("Reloaded service catalog %s", c.path)
+	return nil
+}
+
+// watch polls the catalog file and reloads it when it changes, until
+// shutdown is closed
+func (c *serviceCatalog) watch(shutdown <-chan struct{}) {
+	ticker := time.NewTicker(catalogPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.reload(); err != nil {
+				log.Printf("Service catalog reload failed, keeping current services: %v", err)
+			}
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// lookup returns the service of a source and its key in the catalog, the
+// source itself or the most specific pattern matching it
+func (c *serviceCatalog) lookup(source string) (string, catalogService, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if s, ok := c.services[source]; ok {
+		return source, s, true
+	}
+	for _, p := range c.patterns {
+		if ok, _ := path.Match(p, source); ok {
+			return p, c.services[p], true
+		}
+	}
+	return "", catalogService{}, false
+}
+
+// enrich adds the service, team, Slack handle and runbook of an alert's
+// source to its metadata, leaving any the alert already has
+func (c *serviceCatalog) enrich(alert *analyzer.Alert) {
+	key, s, ok := c.lookup(alert.Log.Source)
+	if !ok {
+		return
+	}
+	runbook := s.Runbook
+	if r, ok := s.Runbooks[alert.Reason]; ok {
+		runbook = r
+	} else if r, ok := s.Runbooks[analyzer.RuleID(alert.Reason)]; ok {
+		runbook = r
+	}
+
+	metadata := make(map[string]interface{}, len(alert.Metadata)+4)
+	for k, v := range alert.Metadata {
+		metadata[k] = v
+	}
+	if s.Service != "" {
+		key = s.Service
+	}
+	for k, v := range map[string]string{"service": key, "team": s.Team, "slack": s.Slack, "runbook_url": runbook} {
+		if _, ok := metadata[k]; !ok && v != "" {
+			metadata[k] = v
+		}
+	}
+	alert.Metadata = metadata
+}
+
+// setCatalog enriches alerts with the ownership and runbooks of their
+// source from a service catalog file, reloaded when it changes
+func (a *Alerter) setCatalog(path string) error {
+	if path == "" {
+		a.catalog = nil
+		return nil
+	}
+	c, err := loadServiceCatalog(path)
+	if err != nil {
+		return err
+	}
+	a.catalog = c
+	return nil
+}
+
+// ReloadCatalog re-reads the service catalog file if it changed
+func (a *Alerter) ReloadCatalog() error {
+	if a.catalog == nil {
+		return nil
+	}
+	return a.catalog.reload()
+}
@@ -0,0 +1,276 @@
+package alerter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Circuit breaker defaults
+const (
+	defaultCircuitFailures = 5
+	defaultCircuitCooldown = time.Minute
+)
+
+// Circuit states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// circuitReason is the reason of the alerts raised when the circuit of a
+// sink opens, and resolved when it closes again
+const circuitReason = "Sink Circuit Open"
+
+// circuitConfig is the circuit breaking of every sink
+type circuitConfig struct {
+	failures   int
+	cooldown   time.Duration
+	deadLetter *deadLetterFile
+}
+
+// circuitBreaker stops sending to a sink that keeps failing. It is used
+// by the worker of the sink's queue alone.
+type circuitBreaker struct {
+	sink    string
+	cfg     *circuitConfig
+	metrics *sinkMetrics
+
+	// notify delivers the alerts raised when the circuit opens and closes
+	notify func(analyzer.Alert)
+
+	state     string
+	failed    int
+	lastErr   error
+	openUntil time.Time
+
+	// unsent counts the alerts not sent since the circuit opened
+	unsent int
+}
+
+// newCircuitBreaker creates the closed circuit of a sink
+func newCircuitBreaker(sink string, cfg *circuitConfig, metrics *sinkMetrics, notify func(analyzer.Alert)) *circuitBreaker {
+	b := &circuitBreaker{sink: sink, cfg: cfg, metrics: metrics, notify: notify}
+	b.setState(circuitClosed)
+	return b
+}
+
+// ready reports whether the next alert may be sent. While the circuit is
+// open, it waits for the cooldown to end unless alerts are dead-lettered,
+// giving up when done is closed; the alert sent after the cooldown tries
+// the sink again.
+func (b *circuitBreaker) ready(done <-chan struct{}) bool {
+	if b.state == circuitClosed {
+		return true
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		if b.cfg.deadLetter != nil {
+			return false
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-done:
+			return false
+		}
+	}
+	b.setState(circuitHalfOpen)
+	return true
+}
+
+// record records the outcome of a send, opening the circuit after too many
+// failures in a row or a failed retry, and closing it on success
+func (b *circuitBreaker) record(err error) {
+	if err == nil {
+		b.failed = 0
+		if b.state == circuitClosed {
+			return
+		}
+		log.Printf("Circuit of %s closed, %d alerts were not sent while open", b.sink, b.unsent)
+		b.setState(circuitClosed)
+		b.unsent = 0
+		b.notify(b.event())
+		return
+	}
+
+	b.failed++
+	b.lastErr = err
+	switch {
+	case b.state == circuitHalfOpen:
+		b.openUntil = time.Now().Add(b.cfg.cooldown)
+		b.setState(circuitOpen)
+		log.Printf("Circuit of %s still open, retrying in %s: %v", b.sink, b.cfg.cooldown, err)
+	case b.state == circuitClosed && b.failed >= b.cfg.failures:
+		b.openUntil = time.Now().Add(b.cfg.cooldown)
+		b.setState(circuitOpen)
+		b.metrics.circuitOpens.Add(1)
+		log.Printf("Circuit of %s opened after %d failed sends, retrying in %s: %v", b.sink, b.failed, b.cfg.cooldown, err)
+		b.notify(b.event())
+	}
+}
+
+// setAside dead-letters an alert not sent while the circuit is open, or
+// drops it when alerts are not dead-lettered
+func (b *circuitBreaker) setAside(alert analyzer.Alert) {
+	b.unsent++
+	if b.cfg.deadLetter == nil {
+		b.metrics.dropped.Add(1)
+		return
+	}
+	if err := b.cfg.deadLetter.write(b.sink, b.lastErr, alert); err != nil {
+		b.metrics.dropped.Add(1)
+		log.Printf("Failed to dead-letter alert for %s: %v", b.sink, err)
+		return
+	}
+	b.metrics.deadLettered.Add(1)
+}
+
+// stopped logs the alerts left unsent when the queue stopped with the
+// circuit open
+func (b *circuitBreaker) stopped() {
+	if b.state != circuitClosed && b.unsent > 0 {
+		log.Printf("Circuit of %s open at shutdown, %d alerts were not sent", b.sink, b.unsent)
+	}
+}
+
+// setState changes the state of the circuit, published with the metrics of
+// the sink
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	b.metrics.setCircuit(state)
+}
+
+// event returns the alert raised when the circuit opens, or resolving it
+// when the circuit closes
+func (b *circuitBreaker) event() analyzer.Alert {
+	now := time.Now()
+	h := fnv.New64a()
+	fmt.Fprintf(h, "circuit %s", b.sink)
+
+	metadata := map[string]interface{}{
+		"rule_name":      circuitReason,
+		"sink":           b.sink,
+		"circuit_status": b.state,
+	}
+	var message string
+	if b.state == circuitOpen {
+		message = fmt.Sprintf("Stopped sending alerts to %s for %s after %d failed sends: %v", b.sink, b.cfg.cooldown, b.failed, b.lastErr)
+		metadata["failures"] = b.failed
+		metadata["cooldown"] = b.cfg.cooldown.String()
+		metadata["error"] = b.lastErr.Error()
+	} else {
+		message = fmt.Sprintf("Sending alerts to %s again", b.sink)
+	}
+	return analyzer.Alert{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  "HIGH",
+		Reason:    circuitReason,
+		Log: parser.ParsedLog{
+			Timestamp: now.Format(time.RFC3339),
+			Level:     "ERROR",
+			Source:    "argos",
+			Message:   message,
+		},
+		Metadata:    metadata,
+		Fingerprint: fmt.Sprintf("%016x", h.Sum64()),
+	}
+}
+
+// deadLetterFile holds the alerts of sinks whose circuit is open, as JSON
+// Lines
+type deadLetterFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// deadLetter is a line of the dead letter file
+type deadLetter struct {
+	Time  string         `json:"time"`
+	Sink  string         `json:"sink"`
+	Error string         `json:"error,omitempty"`
+	Alert analyzer.Alert `json:"alert"`
+}
+
+// open opens the dead letter file for appending
+func (d *deadLetterFile) open() error {
+	f, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+	d.f = f
+	return nil
+}
+
+// write appends an alert not sent to a sink that failed with err
+func (d *deadLetterFile) write(sink string, err error, alert analyzer.Alert) error {
+	line := deadLetter{Time: time.Now().Format(time.RFC3339), Sink: sink, Alert: alert}
+	if err != nil {
+		line.Error = err.Error()
+	}
+	data, jsonErr := json.Marshal(line)
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, writeErr := d.f.Write(append(data, '\n'))
+	return writeErr
+}
+
+// close closes the dead letter file
+func (d *deadLetterFile) close() {
+	if d.f != nil {
+		d.f.Close()
+	}
+}
+
+// setCircuitBreaker pauses sinks that keep failing, if enabled
+func (a *Alerter) setCircuitBreaker(cfg config.CircuitBreaker) error {
+	if !cfg.Enabled {
+		a.circuit = nil
+		return nil
+	}
+	c := &circuitConfig{
+		failures: defaultCircuitFailures,
+		cooldown: defaultCircuitCooldown,
+	}
+	switch {
+	case cfg.Failures < 0:
+		return errors.New("circuit_breaker failures must not be negative")
+	case cfg.Failures > 0:
+		c.failures = cfg.Failures
+	}
+	switch {
+	case cfg.Cooldown < 0:
+		return errors.New("circuit_breaker cooldown must not be negative")
+	case cfg.Cooldown > 0:
+		c.cooldown = time.Duration(cfg.Cooldown)
+	}
+	if cfg.DeadLetter != "" {
+		c.deadLetter = &deadLetterFile{path: cfg.DeadLetter}
+	}
+	a.circuit = c
+	return nil
+}
+
+// circuitChanged returns the notify function of the circuit of the sink at
+// an index, delivering its alerts to every other sink
+func (a *Alerter) circuitChanged(sink int) func(analyzer.Alert) {
+	return func(alert analyzer.Alert) {
+		a.outputAlert(alert, sink)
+	}
+}
@@ -0,0 +1,182 @@
+package alerter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// ClickHouse defaults
+const (
+	defaultClickHouseURL         = "http://localhost:8123"
+	defaultClickHouseDatabase    = "default"
+	defaultClickHouseTable       = "argos_alerts"
+	defaultClickHouseBatchSize   = 10000
+	defaultClickHouseBatchWindow = 5 * time.Second
+	defaultClickHouseTimeout     = 10 * time.Second
+
+	// clickHouseTime is the time format ClickHouse parses into DateTime64
+	// by default
+	clickHouseTime = "2006-01-02 15:04:05.000"
+)
+
+// clickHouseIdentifier matches the database and table names accepted
+var clickHouseIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// clickHouseSchema creates the alert table, partitioned by month and
+// sorted for queries by rule and severity over time
+const clickHouseSchema = `CREATE TABLE IF NOT EXISTS %s (
+	time DateTime64(3, 'UTC'),
+	severity LowCardinality(String),
+	rule LowCardinality(String),
+	source LowCardinality(String),
+	message String,
+	score Float64,
+	fingerprint String,
+	incident_id String,
+	log String,
+	metadata String
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(time)
+ORDER BY (rule, severity, time)`
+
+// clickHouseRow is an alert as a row of the alert table
+type clickHouseRow struct {
+	Time        string  `json:"time"`
+	Severity    string  `json:"severity"`
+	Rule        string  `json:"rule"`
+	Source      string  `json:"source"`
+	Message     string  `json:"message"`
+	Score       float64 `json:"score"`
+	Fingerprint string  `json:"fingerprint"`
+	IncidentID  string  `json:"incident_id"`
+	Log         string  `json:"log"`
+	Metadata    string  `json:"metadata"`
+}
+
+// clickHouseSink inserts alerts into a ClickHouse table through its HTTP
+// interface, in large batches as ClickHouse favors
+type clickHouseSink struct {
+	client  *http.Client
+	url     string
+	table   string
+	header  http.Header
+	batcher *alertBatcher
+}
+
+// newClickHouseSink creates a sink inserting alerts into a ClickHouse table,
+// creating it if needed
+func newClickHouseSink(cfg config.ClickHouse) (Sink, error) {
+	database, table := cfg.Database, cfg.Table
+	if database == "" {
+		database = defaultClickHouseDatabase
+	}
+	if table == "" {
+		table = defaultClickHouseTable
+	}
+	for _, name := range []string{database, table} {
+		if !clickHouseIdentifier.MatchString(name) {
+			return nil, fmt.Errorf("invalid clickhouse name %q", name)
+		}
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = defaultClickHouseTimeout
+	}
+
+	s := &clickHouseSink{
+		client: &http.Client{Timeout: timeout},
+		url:    strings.TrimSuffix(cfg.URL, "/"),
+		table:  database + "." + table,
+		header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+	}
+	if s.url == "" {
+		s.url = defaultClickHouseURL
+	}
+	if cfg.Username != "" {
+		s.header.Set("X-ClickHouse-User", cfg.Username)
+		s.header.Set("X-ClickHouse-Key", cfg.Password)
+	}
+	if err := s.exec(fmt.Sprintf(clickHouseSchema, s.table), nil); err != nil {
+		return nil, fmt.Errorf("failed to create clickhouse table: %w", err)
+	}
+
+	size, window := cfg.BatchSize, time.Duration(cfg.BatchWindow)
+	if size <= 0 {
+		size = defaultClickHouseBatchSize
+	}
+	if window <= 0 {
+		window = defaultClickHouseBatchWindow
+	}
+	s.batcher = newAlertBatcher("clickhouse", size, window, s.flush)
+	return s, nil
+}
+
+// exec runs a query, with data following it in the request body
+func (s *clickHouseSink) exec(query string, data []byte) error {
+	body := append([]byte(query+"\n"), data...)
+	return sendHTTP(s.Name(), s.client, http.MethodPost, s.url+"/", s.header, body)
+}
+
+// Name implements Sink
+func (s *clickHouseSink) Name() string {
+	return "clickhouse"
+}
+
+// Send adds an alert to the current batch
+func (s *clickHouseSink) Send(alert analyzer.Alert) error {
+	return s.batcher.add(alert)
+}
+
+// Start implements SinkStarter
+func (s *clickHouseSink) Start() {
+	s.batcher.start()
+}
+
+// Stop implements SinkStopper, inserting the last batch
+func (s *clickHouseSink) Stop() {
+	s.batcher.stop()
+}
+
+// flush inserts a batch of alerts as JSONEachRow
+func (s *clickHouseSink) flush(alerts []analyzer.Alert) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, alert := range alerts {
+		at, err := time.Parse(time.RFC3339, alert.Timestamp)
+		if err != nil {
+			at = time.Now()
+		}
+		logJSON, err := json.Marshal(alert.Log)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		metadata, err := json.Marshal(alert.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		row := clickHouseRow{
+			Time:        at.UTC().Format(clickHouseTime),
+			Severity:    alert.Severity,
+			Rule:        alert.Reason,
+			Source:      alert.Log.Source,
+			Message:     alert.Log.Message,
+			Score:       alert.Score,
+			Fingerprint: alert.Fingerprint,
+			IncidentID:  alert.IncidentID,
+			Log:         string(logJSON),
+			Metadata:    string(metadata),
+		}
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+	}
+	return s.exec("INSERT INTO "+s.table+" FORMAT JSONEachRow", buf.Bytes())
+}
@@ -0,0 +1,176 @@
+package alerter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// Command defaults
+const (
+	defaultCommandConcurrency = 4
+	defaultCommandTimeout     = 30 * time.Second
+
+	// commandQueueSize bounds the alerts waiting for a command to finish
+	commandQueueSize = 100
+
+	// commandMaxOutput is how much of the output of a failed command is
+	// logged
+	commandMaxOutput = 512
+)
+
+// commandSink runs a command for every alert, with the alert as JSON on
+// its standard input, so that site specific automation can act on alerts.
+// Commands run in the background, at most concurrency at once.
+type commandSink struct {
+	label       string
+	argv        []string
+	env         []string
+	concurrency int
+	timeout     time.Duration
+	input       alertTemplate
+
+	queue chan analyzer.Alert
+	wg    sync.WaitGroup
+}
+
+// newCommandSink creates a sink running a command for alerts
+func newCommandSink(cfg config.Command) (Sink, error) {
+	if len(cfg.Command) == 0 || cfg.Command[0] == "" {
+		return nil, errors.New("command is required")
+	}
+	s := &commandSink{
+		label:       cfg.Name,
+		argv:        cfg.Command,
+		concurrency: cfg.Concurrency,
+		timeout:     time.Duration(cfg.Timeout),
+		queue:       make(chan analyzer.Alert, commandQueueSize),
+	}
+	if s.label == "" {
+		s.label = "command " + filepath.Base(cfg.Command[0])
+	}
+	if _, err := exec.LookPath(cfg.Command[0]); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.label, err)
+	}
+	if s.concurrency <= 0 {
+		s.concurrency = defaultCommandConcurrency
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultCommandTimeout
+	}
+	var err error
+	if s.input, err = newAlertTemplate(s.label, cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	// Only allowed variables reach the command, so that secrets in the
+	// environment of Argos do not leak into scripts
+	for _, name := range append([]string{"PATH"}, cfg.Env...) {
+		if value, ok := os.LookupEnv(name); ok {
+			s.env = append(s.env, name+"="+value)
+		}
+	}
+	return s, nil
+}
+
+// Name implements Sink
+func (s *commandSink) Name() string {
+	return s.label
+}
+
+// Send queues an alert for the command, failing when the commands fall
+// too far behind
+func (s *commandSink) Send(alert analyzer.Alert) error {
+	select {
+	case s.queue <- alert:
+		return nil
+	default:
+		return fmt.Errorf("%d alerts already waiting, dropping alert", commandQueueSize)
+	}
+}
+
+// Start implements SinkStarter, starting the workers running commands
+func (s *commandSink) Start() {
+	for i := 0; i < s.concurrency; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for alert := range s.queue {
+				if err := s.run(alert); err != nil {
+					sinkMetricsFor(s.Name()).failedLater(1, err)
+					log.Printf("Failed to send alert to %s: %v", s.Name(), err)
+				}
+			}
+		}()
+	}
+}
+
+// Stop implements SinkStopper, waiting for the queued alerts to be handled
+func (s *commandSink) Stop() {
+	close(s.queue)
+	s.wg.Wait()
+}
+
+// run runs the command for one alert. Besides the alert on standard input,
+// as JSON or rendered by the template, the command gets the main fields of
+// the alert as ARGOS_ environment variables.
+func (s *commandSink) run(alert analyzer.Alert) error {
+	var input []byte
+	var err error
+	if s.input != nil {
+		if input, err = renderAlert(s.input, alert); err != nil {
+			return err
+		}
+	} else if input, err = json.Marshal(alert); err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	status := "firing"
+	if resolves(alert) {
+		status = "ended"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.argv[0], s.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(append([]string(nil), s.env...),
+		"ARGOS_SEVERITY="+alert.Severity,
+		"ARGOS_RULE="+alert.Reason,
+		"ARGOS_SOURCE="+alert.Log.Source,
+		"ARGOS_FINGERPRINT="+alert.Fingerprint,
+		"ARGOS_INCIDENT="+alert.IncidentID,
+		"ARGOS_STATUS="+status,
+	)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Children left running by a killed command must not hold the worker
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("killed after %s", s.timeout)
+	}
+	if err != nil {
+		out := strings.TrimSpace(output.String())
+		if len(out) > commandMaxOutput {
+			out = "..." + out[len(out)-commandMaxOutput:]
+		}
+		if out != "" {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
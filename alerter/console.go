@@ -0,0 +1,132 @@
+package alerter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// formatLine prints an alert as one line of text
+const formatLine = "line"
+
+// Console color modes
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ANSI escapes for the severities printed in color
+var consoleColors = map[string]string{
+	"CRITICAL": "\033[1;31m",
+	"HIGH":     "\033[31m",
+	"MEDIUM":   "\033[33m",
+	"LOW":      "\033[36m",
+	"INFO":     "\033[2m",
+}
+
+const consoleReset = "\033[0m"
+
+// consoleOutput prints alerts of a minimum severity to the console
+type consoleOutput struct {
+	w           io.Writer
+	format      string
+	minSeverity int
+	color       bool
+}
+
+// newConsoleOutput creates the console output a configuration describes
+func newConsoleOutput(cfg config.Alerter) (consoleOutput, error) {
+	c := consoleOutput{w: os.Stdout, format: cfg.Console}
+	switch c.format {
+	case "":
+		c.format = formatPretty
+	case formatPretty, formatCompact, formatLine, formatNone:
+	default:
+		return c, fmt.Errorf("unknown console format %q (want pretty, compact, line or none)", c.format)
+	}
+
+	var err error
+	if c.minSeverity, err = minSeverity(cfg.ConsoleMinSeverity, "INFO"); err != nil {
+		return c, fmt.Errorf("invalid console_min_severity: %w", err)
+	}
+
+	switch cfg.ConsoleColor {
+	case "", colorAuto:
+		c.color = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	case colorAlways:
+		c.color = true
+	case colorNever:
+	default:
+		return c, fmt.Errorf("unknown console_color %q (want auto, always or never)", cfg.ConsoleColor)
+	}
+	return c, nil
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// print prints an alert in the console format, if severe enough
+func (c consoleOutput) print(alert analyzer.Alert) error {
+	if c.format == formatNone || severityRank(alert.Severity) < c.minSeverity {
+		return nil
+	}
+	switch c.format {
+	case formatPretty:
+		alertJSON, err := encodeAlert(alert, true)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.w, "\n🚨 ALERT: %s (Severity: %s)\n", alert.Reason, c.paint(alert.Severity))
+		fmt.Fprintln(c.w, string(alertJSON))
+		fmt.Fprintln(c.w, strings.Repeat("-", 80))
+	case formatCompact:
+		alertJSON, err := encodeAlert(alert, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.w, string(alertJSON))
+	case formatLine:
+		fmt.Fprintln(c.w, c.line(alert))
+	}
+	return nil
+}
+
+// line formats an alert as its time, severity, rule, source and message on
+// one line
+func (c consoleOutput) line(alert analyzer.Alert) string {
+	var b strings.Builder
+	if alert.Timestamp != "" {
+		b.WriteString(alert.Timestamp + " ")
+	}
+	b.WriteString(c.paint(alert.Severity))
+	b.WriteString(strings.Repeat(" ", max(len("CRITICAL")-len(alert.Severity), 0)+1))
+	b.WriteString(alert.Reason)
+	if alert.Log.Source != "" {
+		b.WriteString(" [" + alert.Log.Source + "]")
+	}
+	if msg := strings.Join(strings.Fields(alert.Log.Message), " "); msg != "" {
+		b.WriteString(": " + parser.Clip(msg, 200))
+	}
+	if id, ok := alert.Metadata["alert_id"].(string); ok {
+		b.WriteString(" (" + id + ")")
+	}
+	return b.String()
+}
+
+// paint colors a severity, when printing in color
+func (c consoleOutput) paint(severity string) string {
+	code, ok := consoleColors[severity]
+	if !c.color || !ok {
+		return severity
+	}
+	return code + severity + consoleReset
+}
@@ -0,0 +1,278 @@
+package alerter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Database defaults
+const (
+	defaultDatabaseBatchSize   = 100
+	defaultDatabaseBatchWindow = time.Second
+	defaultDatabaseTimeout     = 10 * time.Second
+)
+
+// databaseDialect holds what differs between the SQL of the databases
+type databaseDialect struct {
+	driver string
+	serial string
+	time   string
+
+	// numbered dialects take $1, $2, ... placeholders instead of ?
+	numbered bool
+}
+
+// databaseDialects are the supported databases, by configured driver
+var databaseDialects = map[string]databaseDialect{
+	"sqlite":   {driver: "sqlite3", serial: "INTEGER PRIMARY KEY AUTOINCREMENT", time: "TIMESTAMP"},
+	"postgres": {driver: "postgres", serial: "BIGSERIAL PRIMARY KEY", time: "TIMESTAMPTZ", numbered: true},
+}
+
+// databaseSchema creates the tables and indexes alerts are stored in, when
+// missing. Every alert is a row of alerts; fingerprints and incidents
+// count the alerts of each fingerprint and incident.
+var databaseSchema = []string{
+	`CREATE TABLE IF NOT EXISTS alerts (
+		id {{serial}},
+		time {{time}} NOT NULL,
+		severity TEXT NOT NULL,
+		rule TEXT NOT NULL,
+		source TEXT NOT NULL,
+		message TEXT NOT NULL,
+		score DOUBLE PRECISION NOT NULL,
+		fingerprint TEXT NOT NULL,
+		incident_id TEXT,
+		log TEXT NOT NULL,
+		metadata TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS alerts_time ON alerts (time)`,
+	`CREATE INDEX IF NOT EXISTS alerts_severity_time ON alerts (severity, time)`,
+	`CREATE INDEX IF NOT EXISTS alerts_rule_time ON alerts (rule, time)`,
+	`CREATE INDEX IF NOT EXISTS alerts_fingerprint ON alerts (fingerprint)`,
+	`CREATE INDEX IF NOT EXISTS alerts_incident ON alerts (incident_id)`,
+	`CREATE TABLE IF NOT EXISTS fingerprints (
+		fingerprint TEXT PRIMARY KEY,
+		rule TEXT NOT NULL,
+		source TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		first_seen {{time}} NOT NULL,
+		last_seen {{time}} NOT NULL,
+		alerts INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS fingerprints_last_seen ON fingerprints (last_seen)`,
+	`CREATE TABLE IF NOT EXISTS incidents (
+		id TEXT PRIMARY KEY,
+		severity TEXT NOT NULL,
+		severity_rank INTEGER NOT NULL,
+		first_seen {{time}} NOT NULL,
+		last_seen {{time}} NOT NULL,
+		alerts INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS incidents_last_seen ON incidents (last_seen)`,
+}
+
+// Statements storing an alert
+const (
+	insertAlertSQL = `INSERT INTO alerts
+		(time, severity, rule, source, message, score, fingerprint, incident_id, log, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	upsertFingerprintSQL = `INSERT INTO fingerprints
+		(fingerprint, rule, source, severity, first_seen, last_seen, alerts)
+		VALUES (?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT (fingerprint) DO UPDATE SET
+			severity = excluded.severity,
+			last_seen = excluded.last_seen,
+			alerts = fingerprints.alerts + 1`
+
+	// Incidents keep the most severe severity of their alerts
+	upsertIncidentSQL = `INSERT INTO incidents
+		(id, severity, severity_rank, first_seen, last_seen, alerts)
+		VALUES (?, ?, ?, ?, ?, 1)
+		ON CONFLICT (id) DO UPDATE SET
+			severity = CASE WHEN excluded.severity_rank > incidents.severity_rank
+				THEN excluded.severity ELSE incidents.severity END,
+			severity_rank = CASE WHEN excluded.severity_rank > incidents.severity_rank
+				THEN excluded.severity_rank ELSE incidents.severity_rank END,
+			last_seen = excluded.last_seen,
+			alerts = incidents.alerts + 1`
+)
+
+// databaseSink stores alerts in SQLite or PostgreSQL, in batches written
+// in one transaction each
+type databaseSink struct {
+	db      *sql.DB
+	dialect databaseDialect
+	timeout time.Duration
+	batcher *alertBatcher
+}
+
+// newDatabaseSink creates a sink storing alerts in a database, creating its
+// tables if needed
+func newDatabaseSink(cfg config.Database) (Sink, error) {
+	if cfg.DSN == "" {
+		return nil, errors.New("database dsn is required")
+	}
+	driver := cfg.Driver
+	if driver == "" {
+		driver = "sqlite"
+	}
+	dialect, ok := databaseDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver %q (want sqlite or postgres)", cfg.Driver)
+	}
+	s := &databaseSink{dialect: dialect, timeout: time.Duration(cfg.Timeout)}
+	if s.timeout <= 0 {
+		s.timeout = defaultDatabaseTimeout
+	}
+
+	var err error
+	s.db, err = sql.Open(dialect.driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if driver == "sqlite" {
+		// SQLite takes one writer at a time
+		s.db.SetMaxOpenConns(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.createSchema(ctx); err != nil {
+		s.db.Close()
+		return nil, err
+	}
+
+	size, window := cfg.BatchSize, time.Duration(cfg.BatchWindow)
+	if size <= 0 {
+		size = defaultDatabaseBatchSize
+	}
+	if window <= 0 {
+		window = defaultDatabaseBatchWindow
+	}
+	s.batcher = newAlertBatcher("database", size, window, s.flush)
+	return s, nil
+}
+
+// createSchema creates the tables and indexes that are missing
+func (s *databaseSink) createSchema(ctx context.Context) error {
+	replacer := strings.NewReplacer("{{serial}}", s.dialect.serial, "{{time}}", s.dialect.time)
+	for _, stmt := range databaseSchema {
+		if _, err := s.db.ExecContext(ctx, replacer.Replace(stmt)); err != nil {
+			return fmt.Errorf("failed to create database schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebind rewrites the ? placeholders of a statement for the dialect
+func (d databaseDialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Name implements Sink
+func (s *databaseSink) Name() string {
+	return "database"
+}
+
+// Send adds an alert to the current batch
+func (s *databaseSink) Send(alert analyzer.Alert) error {
+	return s.batcher.add(alert)
+}
+
+// Start implements SinkStarter
+func (s *databaseSink) Start() {
+	s.batcher.start()
+}
+
+// Stop implements SinkStopper, writing the last batch and closing the
+// database
+func (s *databaseSink) Stop() {
+	s.batcher.stop()
+	s.db.Close()
+}
+
+// flush stores a batch of alerts in one transaction
+func (s *databaseSink) flush(alerts []analyzer.Alert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertAlert, err := tx.PrepareContext(ctx, s.dialect.rebind(insertAlertSQL))
+	if err != nil {
+		return err
+	}
+	upsertFingerprint, err := tx.PrepareContext(ctx, s.dialect.rebind(upsertFingerprintSQL))
+	if err != nil {
+		return err
+	}
+	upsertIncident, err := tx.PrepareContext(ctx, s.dialect.rebind(upsertIncidentSQL))
+	if err != nil {
+		return err
+	}
+
+	for _, alert := range alerts {
+		at, err := time.Parse(time.RFC3339, alert.Timestamp)
+		if err != nil {
+			at = time.Now()
+		}
+		at = at.UTC()
+		logJSON, err := json.Marshal(alert.Log)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		metadata, err := json.Marshal(alert.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		var incident interface{}
+		if alert.IncidentID != "" {
+			incident = alert.IncidentID
+		}
+
+		if _, err := insertAlert.ExecContext(ctx, at, alert.Severity, alert.Reason, alert.Log.Source,
+			alert.Log.Message, alert.Score, alert.Fingerprint, incident, string(logJSON), string(metadata)); err != nil {
+			return err
+		}
+		if alert.Fingerprint != "" {
+			if _, err := upsertFingerprint.ExecContext(ctx, alert.Fingerprint, alert.Reason, alert.Log.Source,
+				alert.Severity, at, at); err != nil {
+				return err
+			}
+		}
+		if alert.IncidentID != "" {
+			if _, err := upsertIncident.ExecContext(ctx, alert.IncidentID, alert.Severity,
+				severityRank(alert.Severity), at, at); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,146 @@
+package alerter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// defaultRepeatTTL is how long repeats of a delivered alert are collapsed
+// when no TTL is configured
+const defaultRepeatTTL = 10 * time.Minute
+
+// repeatMemory is how long an alert that is no longer seen is remembered,
+// or the TTL if longer, so that repeats collapsed at the end of a burst
+// are still counted when the alert comes back
+const repeatMemory = time.Hour
+
+// defaultRepeatFields make up the fingerprint of an alert when no fields
+// are configured
+var defaultRepeatFields = []string{"source", "template"}
+
+// repeatFields are the alert fields a fingerprint can be made of
+var repeatFields = map[string]func(alert analyzer.Alert) string{
+	"source":   func(alert analyzer.Alert) string { return alert.Log.Source },
+	"rule":     func(alert analyzer.Alert) string { return alert.Reason },
+	"severity": func(alert analyzer.Alert) string { return alert.Severity },
+	"message":  func(alert analyzer.Alert) string { return alert.Log.Message },
+	"template": func(alert analyzer.Alert) string {
+		if alert.Log.TemplateID == "" {
+			return alert.Log.Message
+		}
+		return alert.Log.TemplateID
+	},
+	"key": func(alert analyzer.Alert) string {
+		if key, ok := alert.Metadata["key"]; ok {
+			return fmt.Sprint(key)
+		}
+		return ""
+	},
+}
+
+// repeatedAlert counts the sightings of a fingerprint. Severity is the
+// rank of the last alert delivered.
+type repeatedAlert struct {
+	first     time.Time
+	last      time.Time
+	delivered time.Time
+	count     int
+	severity  int
+}
+
+// repeatCollapser collapses alerts that look alike, whichever rule raised
+// them, into the first one delivered. Once the TTL since a delivery has
+// passed, the next repeat is delivered again, annotated with how often the
+// alert was seen since it first was. A repeat of higher severity than the
+// alert delivered is delivered at once, so an escalation is never
+// collapsed.
+type repeatCollapser struct {
+	ttl    time.Duration
+	memory time.Duration
+	fields []func(alert analyzer.Alert) string
+	seen   map[string]*repeatedAlert
+	pruned time.Time
+}
+
+// SetDedup collapses near-identical alerts within a TTL, before they are
+// delivered
+func (a *Alerter) SetDedup(cfg config.AlertDedup) error {
+	c := &repeatCollapser{ttl: time.Duration(cfg.TTL), seen: make(map[string]*repeatedAlert)}
+	if c.ttl <= 0 {
+		c.ttl = defaultRepeatTTL
+	}
+	c.memory = repeatMemory
+	if c.ttl > c.memory {
+		c.memory = c.ttl
+	}
+	names := cfg.Fields
+	if len(names) == 0 {
+		names = defaultRepeatFields
+	}
+	for _, name := range names {
+		field, ok := repeatFields[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("unknown dedup field %q (want source, rule, severity, message, template or key)", name)
+		}
+		c.fields = append(c.fields, field)
+	}
+	a.dedup = c
+	return nil
+}
+
+// admit records an alert and reports whether it is to be delivered. Alerts
+// announcing that a condition ended are always delivered, unrecorded.
+func (c *repeatCollapser) admit(alert *analyzer.Alert, now time.Time) bool {
+	if resolves(*alert) {
+		return true
+	}
+	c.prune(now)
+
+	h := fnv.New64a()
+	for _, field := range c.fields {
+		fmt.Fprintf(h, "%s\x00", field(*alert))
+	}
+	fp := fmt.Sprintf("%016x", h.Sum64())
+
+	r, ok := c.seen[fp]
+	if !ok {
+		c.seen[fp] = &repeatedAlert{first: now, last: now, delivered: now, count: 1, severity: severityRank(alert.Severity)}
+		return true
+	}
+	r.last = now
+	r.count++
+	severity := severityRank(alert.Severity)
+	if severity <= r.severity && now.Sub(r.delivered) < c.ttl {
+		return false
+	}
+	r.delivered = now
+	r.severity = severity
+
+	metadata := make(map[string]interface{}, len(alert.Metadata)+3)
+	for k, v := range alert.Metadata {
+		metadata[k] = v
+	}
+	metadata["seen_count"] = r.count
+	metadata["seen_since"] = r.first.Format(time.RFC3339)
+	metadata["seen"] = fmt.Sprintf("seen %d times since %s", r.count, r.first.Format("15:04"))
+	alert.Metadata = metadata
+	return true
+}
+
+// prune forgets, at most once a minute, the alerts no longer remembered
+func (c *repeatCollapser) prune(now time.Time) {
+	if now.Sub(c.pruned) < time.Minute {
+		return
+	}
+	c.pruned = now
+	for fp, r := range c.seen {
+		if now.Sub(r.last) > c.memory {
+			delete(c.seen, fp)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package alerter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// TestRepeatCollapserEscalation checks that a repeat of higher severity is
+// delivered within the TTL, and that repeats of it are collapsed again
+func TestRepeatCollapserEscalation(t *testing.T) {
+	a := &Alerter{}
+	if err := a.SetDedup(config.AlertDedup{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	alert := func(severity string) *analyzer.Alert {
+		return &analyzer.Alert{
+			Severity: severity,
+			Reason:   "Error Spike",
+			Log:      parser.ParsedLog{Source: "web-1", Message: "connection refused"},
+		}
+	}
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	steps := []struct {
+		severity string
+		want     bool
+	}{
+		{"MEDIUM", true},
+		{"MEDIUM", false},
+		{"HIGH", true},
+		{"HIGH", false},
+		{"MEDIUM", false},
+	}
+	for i, step := range steps {
+		now = now.Add(time.Second)
+		if got := a.dedup.admit(alert(step.severity), now); got != step.want {
+			t.Errorf("step %d: admit(%s) = %v, want %v", i, step.severity, got, step.want)
+		}
+	}
+}
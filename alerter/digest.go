@@ -0,0 +1,235 @@
+package alerter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Digest defaults
+const (
+	defaultDigestWindow    = 15 * time.Minute
+	defaultDigestMaxAlerts = 100
+
+	// digestReason is the rule of digest alerts
+	digestReason = "Alert Digest"
+)
+
+// digestGroup counts the alerts of one rule in a digest, by source
+type digestGroup struct {
+	Rule     string         `json:"rule"`
+	Severity string         `json:"severity"`
+	Count    int            `json:"count"`
+	Sources  []digestSource `json:"sources"`
+}
+
+// digestSource counts the alerts of one rule and source in a digest
+type digestSource struct {
+	Source string `json:"source"`
+	Count  int    `json:"count"`
+}
+
+// digestSink collects the alerts of a sink up to a severity and sends them
+// to it as one alert per window, grouped by rule and source
+type digestSink struct {
+	sink        Sink
+	maxSeverity int
+	batcher     *alertBatcher
+
+	// mu keeps digests and alerts sent right away from reaching the sink
+	// at once
+	mu sync.Mutex
+}
+
+// setDigests wraps the sinks named in the digests of the configuration
+func (a *Alerter) setDigests(digests []config.Digest) error {
+	for i, cfg := range digests {
+		if len(cfg.Sinks) == 0 {
+			return fmt.Errorf("digest %d names no sinks", i+1)
+		}
+		maxSeverity := severityRanks["CRITICAL"]
+		if cfg.MaxSeverity != "" {
+			var err error
+			if maxSeverity, err = minSeverity(cfg.MaxSeverity, ""); err != nil {
+				return fmt.Errorf("digest %d: %w", i+1, err)
+			}
+		}
+		window := time.Duration(cfg.Window)
+		if window <= 0 {
+			window = defaultDigestWindow
+		}
+		maxAlerts := cfg.MaxAlerts
+		if maxAlerts <= 0 {
+			maxAlerts = defaultDigestMaxAlerts
+		}
+
+		for _, name := range cfg.Sinks {
+			found := false
+			for j, s := range a.sinks {
+				if s.Name() != name {
+					continue
+				}
+				if _, ok := s.(*digestSink); ok {
+					return fmt.Errorf("digest %d: sink %q is in another digest", i+1, name)
+				}
+				d := &digestSink{sink: s, maxSeverity: maxSeverity}
+				d.batcher = newAlertBatcher(name, maxAlerts, window, d.flush)
+				a.sinks[j] = d
+				found = true
+			}
+			if !found {
+				return fmt.Errorf("digest %d: unknown sink %q", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Name implements Sink
+func (s *digestSink) Name() string {
+	return s.sink.Name()
+}
+
+// Send adds an alert to the digest, or sends it right away when it is more
+// severe than digests collect
+func (s *digestSink) Send(alert analyzer.Alert) error {
+	if severityRank(alert.Severity) > s.maxSeverity {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.sink.Send(alert)
+	}
+	return s.batcher.add(alert)
+}
+
+// Start implements SinkStarter
+func (s *digestSink) Start() {
+	if starter, ok := s.sink.(SinkStarter); ok {
+		starter.Start()
+	}
+	s.batcher.start()
+}
+
+// Stop implements SinkStopper, sending the last digest before stopping
+// the sink
+func (s *digestSink) Stop() {
+	s.batcher.stop()
+	if stopper, ok := s.sink.(SinkStopper); ok {
+		stopper.Stop()
+	}
+}
+
+// Update implements SinkUpdater for sinks that do
+func (s *digestSink) Update(update AlertUpdate) error {
+	if updater, ok := s.sink.(SinkUpdater); ok {
+		return updater.Update(update)
+	}
+	return nil
+}
+
+// flush sends the alerts of a window as one digest
+func (s *digestSink) flush(alerts []analyzer.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.Send(digestAlert(s.Name(), alerts))
+}
+
+// digestAlert summarizes alerts as one alert. It has the severity and score
+// of the most severe alert, the groups of alerts by rule and source under
+// the digest metadata, and a plain text summary as log message. Its source
+// is the one all alerts share, if any.
+func digestAlert(sink string, alerts []analyzer.Alert) analyzer.Alert {
+	groups := make(map[string]*digestGroup)
+	sources := make(map[string]map[string]int)
+	highest := alerts[0]
+	first, last := alerts[0].Timestamp, alerts[0].Timestamp
+	source := alerts[0].Log.Source
+	for _, alert := range alerts {
+		g, ok := groups[alert.Reason]
+		if !ok {
+			g = &digestGroup{Rule: alert.Reason, Severity: alert.Severity}
+			groups[alert.Reason] = g
+			sources[alert.Reason] = make(map[string]int)
+		}
+		g.Count++
+		if severityRank(alert.Severity) > severityRank(g.Severity) {
+			g.Severity = alert.Severity
+		}
+		sources[alert.Reason][alert.Log.Source]++
+		if alert.Log.Source != source {
+			source = ""
+		}
+
+		if severityRank(alert.Severity) > severityRank(highest.Severity) || (alert.Severity == highest.Severity && alert.Score > highest.Score) {
+			highest = alert
+		}
+		if alert.Timestamp < first {
+			first = alert.Timestamp
+		}
+		if alert.Timestamp > last {
+			last = alert.Timestamp
+		}
+	}
+
+	list := make([]digestGroup, 0, len(groups))
+	for rule, g := range groups {
+		for src, count := range sources[rule] {
+			g.Sources = append(g.Sources, digestSource{Source: src, Count: count})
+		}
+		sort.Slice(g.Sources, func(i, j int) bool {
+			if g.Sources[i].Count != g.Sources[j].Count {
+				return g.Sources[i].Count > g.Sources[j].Count
+			}
+			return g.Sources[i].Source < g.Sources[j].Source
+		})
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Rule < list[j].Rule
+	})
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%d alerts from %s to %s", len(alerts), first, last)
+	for _, g := range list {
+		fmt.Fprintf(&text, "\n%s (%s): %d", g.Rule, g.Severity, g.Count)
+		for _, src := range g.Sources {
+			name := src.Source
+			if name == "" {
+				name = "unknown source"
+			}
+			fmt.Fprintf(&text, "\n  %s: %d", name, src.Count)
+		}
+	}
+
+	now := time.Now()
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s %d", sink, now.UnixNano())
+	return analyzer.Alert{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  highest.Severity,
+		Reason:    digestReason,
+		Log: parser.ParsedLog{
+			Timestamp: last,
+			Level:     highest.Log.Level,
+			Source:    source,
+			Message:   text.String(),
+		},
+		Metadata: map[string]interface{}{
+			"digest": list,
+			"alerts": len(alerts),
+			"first":  first,
+			"last":   last,
+		},
+		Fingerprint: fmt.Sprintf("%016x", h.Sum64()),
+		Score:       highest.Score,
+	}
+}
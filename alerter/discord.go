@@ -0,0 +1,272 @@
+package alerter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Discord defaults
+const (
+	defaultDiscordUsername = "Argos"
+	defaultDiscordTimeout  = 10 * time.Second
+
+	// discordResolvedColor is the color of alerts announcing an end
+	discordResolvedColor = 0x388e3c
+
+	// discordMaxMessages bounds the posted messages remembered to be
+	// edited when their alert is acknowledged or resolved
+	discordMaxMessages = 1000
+)
+
+// Discord embed limits
+const (
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+	discordMaxFieldValue  = 1024
+)
+
+// discordMessage is a message posted through a Discord webhook
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// discordEmbed is the rich presentation of one alert
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Footer      *discordFooter `json:"footer,omitempty"`
+}
+
+// discordField is a name and value shown in an embed
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordFooter is the small text under an embed
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+// discordMessageID is the part of a posted message holding its ID
+type discordMessageID struct {
+	ID string `json:"id"`
+}
+
+// discordPost is the last message posted for a fingerprint
+type discordPost struct {
+	id    string
+	embed discordEmbed
+}
+
+// discordSink posts alerts to a Discord channel through a webhook, as
+// embeds colored by severity, and edits the last message of an alert when
+// it is acknowledged or resolved
+type discordSink struct {
+	url         string
+	username    string
+	description alertTemplate
+	client      *http.Client
+
+	mu    sync.Mutex
+	posts map[string]discordPost
+	order []string
+}
+
+// newDiscordSink creates a sink posting alerts to a Discord channel
+func newDiscordSink(cfg config.Discord) (Sink, error) {
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("discord webhook_url is required")
+	}
+	s := &discordSink{
+		url:      cfg.WebhookURL,
+		username: cfg.Username,
+		client:   &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		posts:    make(map[string]discordPost),
+	}
+	if s.username == "" {
+		s.username = defaultDiscordUsername
+	}
+	if s.client.Timeout <= 0 {
+		s.client.Timeout = defaultDiscordTimeout
+	}
+	var err error
+	if s.description, err = newAlertTemplate("discord", cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name implements Sink
+func (s *discordSink) Name() string {
+	return "discord"
+}
+
+// Send posts an alert as an embed
+func (s *discordSink) Send(alert analyzer.Alert) error {
+	embed := discordAlert(alert)
+	if s.description != nil {
+		description, err := renderAlert(s.description, alert)
+		if err != nil {
+			return err
+		}
+		embed.Description = parser.Clip(string(description), discordMaxDescription)
+	}
+	body, err := json.Marshal(discordMessage{Username: s.username, Embeds: []discordEmbed{embed}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal discord message: %w", err)
+	}
+	// wait makes Discord answer with the message, whose ID edits it
+	resp, err := requestHTTP(s.Name(), s.client, http.MethodPost, s.webhookURL("", url.Values{"wait": {"true"}}), http.Header{"Content-Type": {"application/json"}}, body)
+	if err != nil {
+		return err
+	}
+	var posted discordMessageID
+	if alert.Fingerprint != "" && json.Unmarshal(resp, &posted) == nil && posted.ID != "" {
+		s.remember(alert.Fingerprint, discordPost{id: posted.ID, embed: embed})
+	}
+	return nil
+}
+
+// remember keeps the last message posted for a fingerprint, forgetting the
+// oldest fingerprints beyond discordMaxMessages
+func (s *discordSink) remember(fingerprint string, post discordPost) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[fingerprint]; !ok {
+		s.order = append(s.order, fingerprint)
+		if len(s.order) > discordMaxMessages {
+			delete(s.posts, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	s.posts[fingerprint] = post
+}
+
+// Update implements SinkUpdater, editing the last message posted for the
+// alert to show who acknowledged or resolved it
+func (s *discordSink) Update(update AlertUpdate) error {
+	s.mu.Lock()
+	post, ok := s.posts[update.Fingerprint]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	embed := post.embed
+	embed.Fields = append([]discordField(nil), embed.Fields...)
+	name := "Acknowledged"
+	if update.Status == AlertResolved {
+		name = "Resolved"
+		embed.Color = discordResolvedColor
+	}
+	value := fmt.Sprintf("by %s at %s", update.User, update.Time.Format("15:04"))
+	if update.Comment != "" {
+		value += ": " + update.Comment
+	}
+	embed.Fields = append(embed.Fields, discordField{Name: name, Value: parser.Clip(value, discordMaxFieldValue)})
+
+	body, err := json.Marshal(discordMessage{Embeds: []discordEmbed{embed}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal discord message: %w", err)
+	}
+	if err := sendHTTP(s.Name(), s.client, http.MethodPatch, s.webhookURL("/messages/"+post.id, nil), http.Header{"Content-Type": {"application/json"}}, body); err != nil {
+		return err
+	}
+	s.remember(update.Fingerprint, discordPost{id: post.id, embed: embed})
+	return nil
+}
+
+// webhookURL returns the URL of the webhook with a path appended and query
+// parameters added, keeping those of the webhook such as thread_id
+func (s *discordSink) webhookURL(path string, params url.Values) string {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return s.url
+	}
+	u.Path += path
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// discordAlert presents an alert as an embed
+func discordAlert(alert analyzer.Alert) discordEmbed {
+	embed := discordEmbed{
+		Title:       parser.Clip(fmt.Sprintf("%s: %s", alert.Severity, alert.Reason), discordMaxTitle),
+		Description: "```\n" + parser.Clip(alert.Log.Message, discordMaxDescription-8) + "\n```",
+		Color:       discordColor(alert.Severity),
+		Timestamp:   alert.Timestamp,
+		Footer:      &discordFooter{Text: "Argos · " + alert.Fingerprint},
+	}
+	if alert.Log.Message == "" {
+		embed.Description = ""
+	}
+	if resolves(alert) {
+		embed.Title = parser.Clip("Ended: "+alert.Reason, discordMaxTitle)
+		embed.Color = discordResolvedColor
+	}
+
+	field := func(name string, value interface{}) {
+		v := fmt.Sprint(value)
+		if v == "" {
+			return
+		}
+		embed.Fields = append(embed.Fields, discordField{Name: name, Value: parser.Clip(v, discordMaxFieldValue), Inline: true})
+	}
+	field("Source", alert.Log.Source)
+	field("Score", fmt.Sprintf("%.0f", alert.Score))
+	if key, ok := alert.Metadata["key"]; ok {
+		field("Key", key)
+	}
+	if n, ok := alert.Metadata["occurrences"]; ok {
+		field("Occurrences", n)
+	}
+	if seen, ok := alert.Metadata["seen"]; ok {
+		field("Repeats", seen)
+	}
+	if alert.IncidentID != "" {
+		field("Incident", alert.IncidentID)
+	}
+	if team, ok := alert.Metadata["team"]; ok {
+		owner := fmt.Sprint(team)
+		if slack, ok := alert.Metadata["slack"]; ok {
+			owner += " (" + fmt.Sprint(slack) + ")"
+		}
+		field("Owner", owner)
+	}
+	if runbook, ok := alert.Metadata["runbook_url"]; ok {
+		field("Runbook", runbook)
+	}
+	return embed
+}
+
+// discordColor returns the embed color of a severity
+func discordColor(severity string) int {
+	color, ok := severityColors[strings.ToUpper(severity)]
+	if !ok {
+		color = severityColors["MEDIUM"]
+	}
+	n, _ := strconv.ParseInt(strings.TrimPrefix(color, "#"), 16, 32)
+	return int(n)
+}
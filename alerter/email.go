@@ -0,0 +1,260 @@
+package alerter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// Email defaults
+const (
+	defaultEmailPort     = 587
+	defaultEmailMaxBatch = 100
+	defaultEmailTimeout  = 30 * time.Second
+)
+
+// defaultEmailTemplate renders a table of the alerts of an email
+const defaultEmailTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; font-size: 14px;">
+{{if gt (len .Alerts) 1}}<p>{{len .Alerts}} alerts{{range $i, $r := .Rules}}{{if $i}},{{else}}:{{end}} {{$r.Count}} &times; {{$r.Rule}}{{end}}</p>{{end}}
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr style="text-align: left; background: #eee;"><th>Time</th><th>Severity</th><th>Rule</th><th>Source</th><th>Message</th><th>Score</th></tr>
+{{range .Alerts}}<tr style="border-top: 1px solid #ddd;">
+<td>{{.Timestamp}}</td>
+<td style="color: {{severityColor .Severity}}; font-weight: bold;">{{.Severity}}{{if resolved .}} (ended){{end}}</td>
+<td>{{.Reason}}</td>
+<td>{{.Log.Source}}{{with .Metadata.team}}<br><small>{{.}}</small>{{end}}</td>
+<td><code>{{truncate 500 .Log.Message}}</code>{{with .Metadata.seen}}<br><small>{{.}}</small>{{end}}{{with .Metadata.runbook_url}}<br><a href="{{.}}">Runbook</a>{{end}}</td>
+<td>{{printf "%.0f" .Score}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+// emailData is what the email template is executed with
+type emailData struct {
+	Alerts []analyzer.Alert
+	Rules  []ruleCount
+}
+
+// ruleCount is the number of alerts of one rule in an email
+type ruleCount struct {
+	Rule  string
+	Count int
+}
+
+// emailSink mails alerts through an SMTP server, one per email or batched
+// over a window into one email
+type emailSink struct {
+	host     string
+	port     int
+	tlsMode  string
+	username string
+	password string
+	from     string
+	to       []string
+	timeout  time.Duration
+	template *template.Template
+
+	// batcher collects alerts into one email when batching
+	batcher *alertBatcher
+}
+
+// newEmailSink creates a sink mailing alerts
+func newEmailSink(cfg config.Email) (Sink, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("email host, from and to are required")
+	}
+	s := &emailSink{
+		host:     cfg.Host,
+		port:     cfg.Port,
+		tlsMode:  strings.ToLower(cfg.TLS),
+		username: cfg.Username,
+		password: cfg.Password,
+		from:     cfg.From,
+		to:       cfg.To,
+		timeout:  time.Duration(cfg.Timeout),
+	}
+	if s.port == 0 {
+		s.port = defaultEmailPort
+	}
+	switch s.tlsMode {
+	case "":
+		s.tlsMode = "starttls"
+		if s.port == 465 {
+			s.tlsMode = "tls"
+		}
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("unknown email tls mode %q (want starttls, tls or none)", cfg.TLS)
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultEmailTimeout
+	}
+
+	text := defaultEmailTemplate
+	if cfg.Template != "" {
+		data, err := os.ReadFile(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email template: %w", err)
+		}
+		text = string(data)
+	}
+	var err error
+	s.template, err = template.New("email").Funcs(template.FuncMap(templateFuncs)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email template: %w", err)
+	}
+
+	if cfg.BatchWindow > 0 {
+		maxBatch := cfg.MaxBatch
+		if maxBatch <= 0 {
+			maxBatch = defaultEmailMaxBatch
+		}
+		s.batcher = newAlertBatcher("email", maxBatch, time.Duration(cfg.BatchWindow), s.mail)
+	}
+
+	return s, nil
+}
+
+// Name implements Sink
+func (s *emailSink) Name() string {
+	return "email"
+}
+
+// Send mails an alert, or adds it to the current batch when batching
+func (s *emailSink) Send(alert analyzer.Alert) error {
+	if s.batcher == nil {
+		return s.mail([]analyzer.Alert{alert})
+	}
+	return s.batcher.add(alert)
+}
+
+// Start implements SinkStarter, mailing batches every window
+func (s *emailSink) Start() {
+	if s.batcher != nil {
+		s.batcher.start()
+	}
+}
+
+// Stop implements SinkStopper, mailing the alerts of the last batch
+func (s *emailSink) Stop() {
+	if s.batcher != nil {
+		s.batcher.stop()
+	}
+}
+
+// mail renders alerts into one email and sends it
+func (s *emailSink) mail(alerts []analyzer.Alert) error {
+	counts := make(map[string]int)
+	highest := alerts[0].Severity
+	for _, alert := range alerts {
+		counts[alert.Reason]++
+		if severityRank(alert.Severity) > severityRank(highest) {
+			highest = alert.Severity
+		}
+	}
+	data := emailData{Alerts: alerts}
+	for rule, count := range counts {
+		data.Rules = append(data.Rules, ruleCount{Rule: rule, Count: count})
+	}
+	sort.Slice(data.Rules, func(i, j int) bool {
+		if data.Rules[i].Count != data.Rules[j].Count {
+			return data.Rules[i].Count > data.Rules[j].Count
+		}
+		return data.Rules[i].Rule < data.Rules[j].Rule
+	})
+
+	subject := fmt.Sprintf("[Argos] %s: %s on %s", alerts[0].Severity, alerts[0].Reason, alerts[0].Log.Source)
+	if len(alerts) > 1 {
+		subject = fmt.Sprintf("[Argos] %d alerts, highest %s", len(alerts), highest)
+	}
+	// Fields of the alert must not break the header
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	if err := s.template.Execute(&msg, data); err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+	return s.deliver(msg.Bytes())
+}
+
+// deliver sends a message through the SMTP server
+func (s *emailSink) deliver(msg []byte) error {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	dialer := &net.Dialer{Timeout: s.timeout}
+	tlsConfig := &tls.Config{ServerName: s.host}
+
+	var conn net.Conn
+	var err error
+	if s.tlsMode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	if s.tlsMode == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return fmt.Errorf("sender rejected: %w", err)
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return c.Quit()
+}
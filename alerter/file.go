@@ -0,0 +1,168 @@
+package alerter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// Alert output formats
+const (
+	// formatCompact writes an alert as JSON on one line, so that files are
+	// JSON Lines
+	formatCompact = "compact"
+	// formatPretty writes an alert as indented JSON
+	formatPretty = "pretty"
+	// formatNone writes nothing
+	formatNone = "none"
+)
+
+// fileSink appends alerts to a file as JSON Lines, indented JSON or
+// rendered by a template
+type fileSink struct {
+	label    string
+	path     string
+	pretty   bool
+	template alertTemplate
+	rotation *fileRotation
+	file     *os.File
+}
+
+// newFileSink creates a sink appending alerts to a file besides the output
+// file
+func newFileSink(cfg config.File) (Sink, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("file path is required")
+	}
+	s := &fileSink{label: cfg.Name, path: cfg.Path}
+	if s.label == "" {
+		s.label = "file " + cfg.Path
+	}
+	switch cfg.Format {
+	case "", formatCompact:
+	case formatPretty:
+		s.pretty = true
+	default:
+		return nil, fmt.Errorf("unknown %s format %q (want compact or pretty)", s.label, cfg.Format)
+	}
+	var err error
+	if s.template, err = newAlertTemplate(s.label, cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	if s.template != nil && cfg.Format != "" {
+		return nil, fmt.Errorf("%s sets both format and template", s.label)
+	}
+	if s.rotation, err = newFileRotation(cfg.Rotation); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.label, err)
+	}
+	return s, nil
+}
+
+// setOutput sets the console output, and the format and rotation of the
+// output file, removing it when its format is none
+func (a *Alerter) setOutput(cfg config.Alerter) error {
+	output := cfg.Output
+	rotation, err := newFileRotation(cfg.Rotation)
+	if err != nil {
+		return err
+	}
+	if a.console, err = newConsoleOutput(cfg); err != nil {
+		return err
+	}
+
+	switch output {
+	case "", formatCompact, formatPretty, formatNone:
+	default:
+		return fmt.Errorf("unknown output format %q (want compact, pretty or none)", output)
+	}
+	for i, s := range a.sinks {
+		f, ok := s.(*fileSink)
+		if !ok || f.label != "file" {
+			continue
+		}
+		if output == formatNone {
+			a.sinks = append(a.sinks[:i], a.sinks[i+1:]...)
+		} else {
+			f.pretty = output == formatPretty
+			f.rotation = rotation
+		}
+		break
+	}
+	return nil
+}
+
+// encodeAlert encodes an alert as compact or indented JSON
+func encodeAlert(alert analyzer.Alert, pretty bool) ([]byte, error) {
+	var data []byte
+	var err error
+	if pretty {
+		data, err = json.MarshalIndent(alert, "", "  ")
+	} else {
+		data, err = json.Marshal(alert)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	return data, nil
+}
+
+// open opens the file for appending
+func (s *fileSink) open() error {
+	var err error
+	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	if s.rotation != nil {
+		return s.resume()
+	}
+	return nil
+}
+
+// Name implements Sink
+func (s *fileSink) Name() string {
+	return s.label
+}
+
+// Send appends an alert to the file
+func (s *fileSink) Send(alert analyzer.Alert) error {
+	var data []byte
+	var err error
+	if s.template != nil {
+		data, err = renderAlert(s.template, alert)
+	} else {
+		data, err = encodeAlert(alert, s.pretty)
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	if s.rotation != nil {
+		if now := time.Now(); s.rotation.due(len(data), now) {
+			if err := s.rotate(now); err != nil {
+				return err
+			}
+		}
+	}
+	n, err := s.file.Write(data)
+	if s.rotation != nil {
+		s.rotation.size += int64(n)
+	}
+	return err
+}
+
+// Stop implements SinkStopper, closing the file and waiting for rotated
+// files to be cleaned up
+func (s *fileSink) Stop() {
+	s.file.Close()
+	if s.rotation != nil {
+		s.rotation.wg.Wait()
+	}
+}
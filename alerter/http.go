@@ -0,0 +1,59 @@
+package alerter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// httpAttempts is how many times a request is sent before giving up, as
+// long as the receiver answers with a rate limit or server error
+const httpAttempts = 3
+
+// sendHTTP sends a request of a sink with the given body, retrying with a
+// growing delay while the receiver is unreachable, rate limited or failing
+func sendHTTP(sink string, client *http.Client, method, url string, header http.Header, body []byte) error {
+	_, err := requestHTTP(sink, client, method, url, header, body)
+	return err
+}
+
+// requestHTTP sends a request like sendHTTP, returning the start of the
+// body of the response
+func requestHTTP(sink string, client *http.Client, method, url string, header http.Header, body []byte) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt < httpAttempts; attempt++ {
+		if attempt > 0 {
+			sinkMetricsFor(sink).retries.Add(1)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to send request: %w", err)
+			continue
+		}
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode < 300:
+			return message, nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("request failed: %s", resp.Status)
+			if message = bytes.TrimSpace(message); len(message) > 0 {
+				lastErr = fmt.Errorf("request failed: %s: %s", resp.Status, message)
+			}
+		default:
+			return nil, fmt.Errorf("request rejected: %s: %s", resp.Status, bytes.TrimSpace(message))
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,207 @@
+package alerter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/hamba/avro/v2/registry"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Kafka defaults
+const (
+	defaultKafkaClientID = "argos"
+	defaultKafkaTimeout  = 10 * time.Second
+)
+
+// kafkaAcks maps the configured acknowledgements to those of the client
+var kafkaAcks = map[string]kgo.Acks{
+	"":       kgo.LeaderAck(),
+	"leader": kgo.LeaderAck(),
+	"all":    kgo.AllISRAcks(),
+	"none":   kgo.NoAck(),
+}
+
+// kafkaSink publishes alerts to a Kafka topic as JSON or Avro records,
+// keyed by fingerprint by default so that the alerts of one rule and key
+// stay in order on one partition
+type kafkaSink struct {
+	producer *kgo.Client
+	key      string
+	format   string
+	value    alertTemplate
+	registry *registry.Client
+	topic    string
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	schemaID int32
+}
+
+// newKafkaSink creates a sink publishing alerts to a Kafka topic
+func newKafkaSink(cfg config.Kafka) (Sink, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, errors.New("kafka brokers and topic are required")
+	}
+	acks, ok := kafkaAcks[strings.ToLower(cfg.Acks)]
+	if !ok {
+		return nil, fmt.Errorf("unknown kafka acks %q (want leader, all or none)", cfg.Acks)
+	}
+	s := &kafkaSink{
+		key:     strings.ToLower(cfg.Key),
+		format:  strings.ToLower(cfg.Format),
+		topic:   cfg.Topic,
+		timeout: time.Duration(cfg.Timeout),
+	}
+	switch s.key {
+	case "":
+		s.key = "fingerprint"
+	case "fingerprint", "source", "rule", "none":
+	default:
+		return nil, fmt.Errorf("unknown kafka key %q (want fingerprint, source, rule or none)", cfg.Key)
+	}
+	switch s.format {
+	case "":
+		s.format = "json"
+	case "json", "avro":
+	default:
+		return nil, fmt.Errorf("unknown kafka format %q (want json or avro)", cfg.Format)
+	}
+	var err error
+	if s.value, err = newAlertTemplate("kafka", cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	if s.value != nil && s.format == "avro" {
+		return nil, errors.New("kafka template cannot be used with the avro format")
+	}
+
+	if s.timeout <= 0 {
+		s.timeout = defaultKafkaTimeout
+	}
+	if cfg.SchemaRegistry != "" {
+		s.registry, err = registry.NewClient(cfg.SchemaRegistry, registry.WithHTTPClient(&http.Client{Timeout: s.timeout}))
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka schema_registry: %w", err)
+		}
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = defaultKafkaClientID
+	}
+	// Alerts are sent one at a time as they come, so records are not held
+	// back to fill batches
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.DefaultProduceTopic(cfg.Topic),
+		kgo.ClientID(clientID),
+		kgo.RequiredAcks(acks),
+		kgo.ProducerLinger(0),
+		kgo.ProduceRequestTimeout(s.timeout),
+		kgo.RecordDeliveryTimeout(s.timeout),
+	}
+	// Idempotent writes need every in-sync replica to acknowledge
+	if acks != kgo.AllISRAcks() {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+	if cfg.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{}))
+	}
+	if s.producer, err = kgo.NewClient(opts...); err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+	return s, nil
+}
+
+// Name implements Sink
+func (s *kafkaSink) Name() string {
+	return "kafka"
+}
+
+// Send publishes an alert
+func (s *kafkaSink) Send(alert analyzer.Alert) error {
+	value, err := s.encode(alert)
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+	switch s.key {
+	case "fingerprint":
+		key = []byte(alert.Fingerprint)
+	case "source":
+		key = []byte(alert.Log.Source)
+	case "rule":
+		key = []byte(alert.Reason)
+	}
+	record := &kgo.Record{
+		Key:   key,
+		Value: value,
+		Headers: []kgo.RecordHeader{
+			{Key: "severity", Value: []byte(alert.Severity)},
+			{Key: "rule", Value: []byte(alert.Reason)},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.producer.ProduceSync(ctx, record).FirstErr(); err != nil {
+		return fmt.Errorf("failed to produce record: %w", err)
+	}
+	return nil
+}
+
+// encode encodes an alert in the configured format, or renders it with the
+// template. Avro records are framed in the schema registry wire format when
+// a registry is configured, registering the schema on first use.
+func (s *kafkaSink) encode(alert analyzer.Alert) ([]byte, error) {
+	if s.value != nil {
+		return renderAlert(s.value, alert)
+	}
+	if s.format == "json" {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := encodeAvroAlert(alert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode alert: %w", err)
+	}
+	if s.registry == nil {
+		return data, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Registering a schema already registered returns its existing ID
+	if s.schemaID == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		id, _, err := s.registry.CreateSchema(ctx, s.topic+"-value", alertAvroSchema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register schema: %w", err)
+		}
+		s.schemaID = int32(id)
+	}
+	framed := binary.BigEndian.AppendUint32([]byte{0}, uint32(s.schemaID))
+	return append(framed, data...), nil
+}
+
+// Stop implements SinkStopper, closing the connections to the brokers
+func (s *kafkaSink) Stop() {
+	s.producer.Close()
+}
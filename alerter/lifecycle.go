@@ -0,0 +1,372 @@
+package alerter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+)
+
+// Alert lifecycle statuses
+const (
+	AlertOpen     = "open"
+	AlertAcked    = "acked"
+	AlertResolved = "resolved"
+)
+
+// Lifecycle limits
+const (
+	// lifecycleExpiry is how long an alert that is no longer delivered
+	// stays open
+	lifecycleExpiry = 7 * 24 * time.Hour
+
+	// maxResolvedAlerts bounds the resolved alerts remembered
+	maxResolvedAlerts = 100
+)
+
+// errAlertNotFound is returned for unknown alert IDs and fingerprints
+var errAlertNotFound = errors.New("alert not found")
+
+// alertRecord is the lifecycle of the alerts of one fingerprint, from the
+// first one delivered until the fingerprint is resolved. A later alert of
+// the fingerprint opens a new lifecycle.
+type alertRecord struct {
+	ID          string `json:"id"`
+	Fingerprint string `json:"fingerprint"`
+	Rule        string `json:"rule"`
+	Source      string `json:"source,omitempty"`
+	Severity    string `json:"severity"`
+	Tenant      string `json:"tenant,omitempty"`
+	Status      string `json:"status"`
+	FirstSeen   string `json:"first_seen"`
+	LastSeen    string `json:"last_seen"`
+	Alerts      int    `json:"alerts"`
+
+	AckedBy    string `json:"acked_by,omitempty"`
+	AckedAt    string `json:"acked_at,omitempty"`
+	ResolvedBy string `json:"resolved_by,omitempty"`
+	ResolvedAt string `json:"resolved_at,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+
+	last     analyzer.Alert
+	lastSeen time.Time
+}
+
+// alertLifecycle tracks the open, acknowledged and recently resolved
+// alerts by fingerprint
+type alertLifecycle struct {
+	mu       sync.Mutex
+	active   map[string]*alertRecord
+	resolved []*alertRecord
+	pruned   time.Time
+
+	// feedback records acknowledgments and alerts resolved as noise in the
+	// effectiveness of their rule
+	feedback func(tenant, rule string, dismissed bool)
+}
+
+// newAlertLifecycle creates an empty lifecycle tracker
+func newAlertLifecycle() *alertLifecycle {
+	return &alertLifecycle{active: make(map[string]*alertRecord)}
+}
+
+// SetFeedback sets the function told about alerts acknowledged, or
+// resolved as noise, such as Tenants.RecordFeedback
+func (a *Alerter) SetFeedback(feedback func(tenant, rule string, dismissed bool)) {
+	a.lifecycle.mu.Lock()
+	defer a.lifecycle.mu.Unlock()
+	a.lifecycle.feedback = feedback
+}
+
+// observe records a delivered alert, annotating it with the ID and status
+// of its lifecycle. Alerts announcing that a condition ended resolve it.
+func (l *alertLifecycle) observe(alert *analyzer.Alert, now time.Time) {
+	if alert.Fingerprint == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	r, ok := l.active[alert.Fingerprint]
+	if resolves(*alert) {
+		if ok {
+			r.last = *alert
+			l.resolve(r, "argos", "", now)
+			annotateLifecycle(alert, r)
+		}
+		return
+	}
+	if !ok {
+		r = &alertRecord{
+			ID:          newID("alt"),
+			Fingerprint: alert.Fingerprint,
+			Rule:        alert.Reason,
+			Source:      alert.Log.Source,
+			Tenant:      alert.Log.Tenant,
+			Status:      AlertOpen,
+			FirstSeen:   now.Format(time.RFC3339),
+		}
+		l.active[alert.Fingerprint] = r
+	}
+	r.Severity = alert.Severity
+	r.Alerts++
+	r.LastSeen = now.Format(time.RFC3339)
+	r.lastSeen = now
+	r.last = *alert
+	annotateLifecycle(alert, r)
+}
+
+// seen records that the condition of an active alert still fires at now,
+// whether or not the alert is delivered
+func (l *alertLifecycle) seen(alert analyzer.Alert, now time.Time) {
+	if alert.Fingerprint == "" || resolves(alert) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.active[alert.Fingerprint]; ok {
+		r.LastSeen = now.Format(time.RFC3339)
+		r.lastSeen = now
+	}
+}
+
+// annotateLifecycle adds the lifecycle of an alert to its metadata
+func annotateLifecycle(alert *analyzer.Alert, r *alertRecord) {
+	metadata := make(map[string]interface{}, len(alert.Metadata)+3)
+	for k, v := range alert.Metadata {
+		metadata[k] = v
+	}
+	metadata["alert_id"] = r.ID
+	metadata["alert_status"] = r.Status
+	if r.AckedBy != "" {
+		metadata["acked_by"] = r.AckedBy
+	}
+	alert.Metadata = metadata
+}
+
+// newID returns a random ID, such as alt-3f9c2a1b7d4e for the prefix alt
+func newID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + "-" + hex.EncodeToString(b)
+}
+
+// find returns the active or resolved lifecycle with an ID or fingerprint
+func (l *alertLifecycle) find(id string) (*alertRecord, bool) {
+	if r, ok := l.active[id]; ok {
+		return r, true
+	}
+	for _, r := range l.active {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	for i := len(l.resolved) - 1; i >= 0; i-- {
+		if r := l.resolved[i]; r.ID == id || r.Fingerprint == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// resolve ends a lifecycle
+func (l *alertLifecycle) resolve(r *alertRecord, user, comment string, now time.Time) {
+	r.Status = AlertResolved
+	r.ResolvedBy = user
+	r.ResolvedAt = now.Format(time.RFC3339)
+	if comment != "" {
+		r.Comment = comment
+	}
+	delete(l.active, r.Fingerprint)
+	l.resolved = append(l.resolved, r)
+	if len(l.resolved) > maxResolvedAlerts {
+		l.resolved = l.resolved[len(l.resolved)-maxResolvedAlerts:]
+	}
+}
+
+// prune forgets, at most once a minute, the open alerts no longer
+// delivered
+func (l *alertLifecycle) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+	for fp, r := range l.active {
+		if now.Sub(r.lastSeen) > lifecycleExpiry {
+			delete(l.active, fp)
+		}
+	}
+}
+
+// transition acknowledges or resolves the alert with an ID or fingerprint,
+// returning the update to announce to sinks
+func (l *alertLifecycle) transition(id, status, user, comment string, noise bool, now time.Time) (alertRecord, AlertUpdate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r, ok := l.find(id)
+	if !ok {
+		return alertRecord{}, AlertUpdate{}, errAlertNotFound
+	}
+	if r.Status == AlertResolved {
+		return *r, AlertUpdate{}, fmt.Errorf("alert %s is already resolved", r.ID)
+	}
+	switch status {
+	case AlertAcked:
+		if r.Status == AlertAcked {
+			return *r, AlertUpdate{}, fmt.Errorf("alert %s is already acknowledged by %s", r.ID, r.AckedBy)
+		}
+		r.Status = AlertAcked
+		r.AckedBy = user
+		r.AckedAt = now.Format(time.RFC3339)
+		if comment != "" {
+			r.Comment = comment
+		}
+	case AlertResolved:
+		l.resolve(r, user, comment, now)
+	}
+	if l.feedback != nil && (status == AlertAcked || noise) {
+		l.feedback(r.Tenant, r.Rule, noise)
+	}
+
+	update := AlertUpdate{
+		ID:          r.ID,
+		Fingerprint: r.Fingerprint,
+		Status:      status,
+		User:        user,
+		Comment:     comment,
+		Time:        now,
+		Alert:       r.last,
+	}
+	return *r, update, nil
+}
+
+// list returns the open and acknowledged alerts, most recently seen first,
+// and the recently resolved ones, most recent first, of a status or all
+func (l *alertLifecycle) list(status string) []alertRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := []alertRecord{}
+	var active []alertRecord
+	for _, r := range l.active {
+		if status == "" || r.Status == status {
+			active = append(active, *r)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].lastSeen.After(active[j].lastSeen)
+	})
+	records = append(records, active...)
+	if status == "" || status == AlertResolved {
+		for i := len(l.resolved) - 1; i >= 0; i-- {
+			records = append(records, *l.resolved[i])
+		}
+	}
+	return records
+}
+
+// updateSinks announces an acknowledgment or resolution to the sinks that
+// reflect it
+func (a *Alerter) updateSinks(update AlertUpdate) {
+	for _, s := range a.sinks {
+		updater, ok := s.(SinkUpdater)
+		if !ok {
+			continue
+		}
+		if err := updater.Update(update); err != nil {
+			log.Printf("Failed to update alert %s in %s: %v", update.ID, s.Name(), err)
+		}
+	}
+}
+
+// HandleAlertStates serves GET requests for the open, acknowledged and
+// recently resolved alerts. The status query parameter narrows the list.
+func (a *Alerter) HandleAlertStates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", AlertOpen, AlertAcked, AlertResolved:
+	default:
+		http.Error(w, "status must be open, acked or resolved", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.lifecycle.list(status))
+}
+
+// HandleAlertState serves GET requests for the lifecycle of an alert, by
+// ID or fingerprint
+func (a *Alerter) HandleAlertState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.lifecycle.mu.Lock()
+	record, ok := a.lifecycle.find(r.PathValue("id"))
+	var found alertRecord
+	if ok {
+		found = *record
+	}
+	a.lifecycle.mu.Unlock()
+	if !ok {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// HandleAlertAction serves POST requests acknowledging (ack) or resolving
+// (resolve) an alert by ID or fingerprint. The user parameter names the
+// responder, comment adds a note, and noise=true on resolve records the
+// alert as noise in the effectiveness of its rule.
+func (a *Alerter) HandleAlertAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var status string
+	switch r.PathValue("action") {
+	case "ack":
+		status = AlertAcked
+	case "resolve":
+		status = AlertResolved
+	default:
+		http.Error(w, "Unknown action", http.StatusNotFound)
+		return
+	}
+	user := r.FormValue("user")
+	if user == "" {
+		http.Error(w, "user is required", http.StatusBadRequest)
+		return
+	}
+	noise, _ := strconv.ParseBool(r.FormValue("noise"))
+
+	record, update, err := a.lifecycle.transition(r.PathValue("id"), status, user, r.FormValue("comment"), noise, time.Now())
+	if errors.Is(err, errAlertNotFound) {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	a.updateSinks(update)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
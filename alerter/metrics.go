@@ -0,0 +1,161 @@
+package alerter
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+)
+
+// sinkMetrics counts the deliveries of one sink
+type sinkMetrics struct {
+	sent    atomic.Int64
+	failed  atomic.Int64
+	retries atomic.Int64
+	dropped atomic.Int64
+
+	deadLettered atomic.Int64
+	circuitOpens atomic.Int64
+
+	// deliveries, nanos and maxNanos time sends and batch flushes
+	deliveries atomic.Int64
+	nanos      atomic.Int64
+	maxNanos   atomic.Int64
+
+	mu          sync.Mutex
+	queue       chan analyzer.Alert
+	circuit     string
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+// sinkStats maps sink names to their metrics, published at /debug/vars
+// under "alerter_sinks"
+var sinkStats sync.Map
+
+func init() {
+	expvar.Publish("alerter_sinks", expvar.Func(publishSinkStats))
+}
+
+// sinkMetricsFor returns the metrics of a sink, creating them on first use
+func sinkMetricsFor(name string) *sinkMetrics {
+	if m, ok := sinkStats.Load(name); ok {
+		return m.(*sinkMetrics)
+	}
+	m, _ := sinkStats.LoadOrStore(name, &sinkMetrics{})
+	return m.(*sinkMetrics)
+}
+
+// setQueue sets the queue of the sink, whose length is published
+func (m *sinkMetrics) setQueue(queue chan analyzer.Alert) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = queue
+}
+
+// setCircuit sets the state of the sink's circuit breaker
+func (m *sinkMetrics) setCircuit(state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.circuit = state
+}
+
+// sendDone records a send of an alert that took elapsed and failed with
+// err, if not nil
+func (m *sinkMetrics) sendDone(elapsed time.Duration, err error) {
+	m.timed(elapsed)
+	if err == nil {
+		m.sent.Add(1)
+	} else {
+		m.failed.Add(1)
+	}
+	m.finished(err)
+}
+
+// flushDone records a flush of a batch of alerts, already counted as sent
+// when the sink took them, that took elapsed and failed with err, if not
+// nil
+func (m *sinkMetrics) flushDone(alerts int, elapsed time.Duration, err error) {
+	m.timed(elapsed)
+	if err != nil {
+		m.failed.Add(int64(alerts))
+	}
+	m.finished(err)
+}
+
+// timed records the latency of a send or flush
+func (m *sinkMetrics) timed(elapsed time.Duration) {
+	m.deliveries.Add(1)
+	m.nanos.Add(int64(elapsed))
+	for {
+		max := m.maxNanos.Load()
+		if int64(elapsed) <= max || m.maxNanos.CompareAndSwap(max, int64(elapsed)) {
+			return
+		}
+	}
+}
+
+// finished records the time and error of the last delivery
+func (m *sinkMetrics) finished(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.lastSuccess = time.Now()
+		return
+	}
+	m.lastFailure = time.Now()
+	m.lastError = err.Error()
+}
+
+// failedLater records alerts accepted by a sink that it then failed to
+// deliver, such as alerts queued for a command
+func (m *sinkMetrics) failedLater(alerts int, err error) {
+	m.failed.Add(int64(alerts))
+	m.finished(err)
+}
+
+// publishSinkStats returns the delivery counts, latencies, last failure
+// and circuit of every sink
+func publishSinkStats() interface{} {
+	stats := make(map[string]interface{})
+	sinkStats.Range(func(name, value interface{}) bool {
+		m := value.(*sinkMetrics)
+		deliveries := m.deliveries.Load()
+		avg := 0.0
+		if deliveries > 0 {
+			avg = float64(m.nanos.Load()) / float64(deliveries) / 1e6
+		}
+		s := map[string]interface{}{
+			"sent":           m.sent.Load(),
+			"failed":         m.failed.Load(),
+			"retries":        m.retries.Load(),
+			"dropped":        m.dropped.Load(),
+			"avg_latency_ms": avg,
+			"max_latency_ms": float64(m.maxNanos.Load()) / 1e6,
+		}
+		m.mu.Lock()
+		if m.queue != nil {
+			s["queue_length"] = len(m.queue)
+			s["queue_capacity"] = cap(m.queue)
+		}
+		if m.circuit != "" {
+			s["circuit"] = m.circuit
+			s["circuit_opens"] = m.circuitOpens.Load()
+			s["dead_lettered"] = m.deadLettered.Load()
+		}
+		if !m.lastSuccess.IsZero() {
+			s["last_success"] = m.lastSuccess.Format(time.RFC3339)
+		}
+		if !m.lastFailure.IsZero() {
+			s["last_failure"] = m.lastFailure.Format(time.RFC3339)
+			s["last_error"] = m.lastError
+		}
+		m.mu.Unlock()
+		stats[name.(string)] = s
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,144 @@
+package alerter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/nats-io/nats.go"
+)
+
+// NATS defaults
+const (
+	defaultNATSSubject = "argos.alerts.{{lower .Severity}}.{{token .Reason}}"
+	defaultNATSTimeout = 10 * time.Second
+)
+
+// natsSink publishes alerts on NATS subjects derived from the alert, by
+// default its severity and rule, so that services can subscribe to the
+// classes of alerts they react to, e.g. argos.alerts.high.>
+type natsSink struct {
+	conn    *nats.Conn
+	subject *template.Template
+	payload alertTemplate
+	timeout time.Duration
+}
+
+// newNATSSink creates a sink publishing alerts to NATS
+func newNATSSink(cfg config.NATS) (Sink, error) {
+	subject := cfg.Subject
+	if subject == "" {
+		subject = defaultNATSSubject
+	}
+	s := &natsSink{timeout: time.Duration(cfg.Timeout)}
+	var err error
+	s.subject, err = template.New("subject").Funcs(templateFuncs).Funcs(template.FuncMap{"token": subjectToken}).Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nats subject template: %w", err)
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultNATSTimeout
+	}
+	if s.payload, err = newAlertTemplate("nats", cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+
+	url := cfg.URL
+	if url == "" {
+		url = nats.DefaultURL
+	}
+	opts := []nats.Option{
+		nats.Name("argos"),
+		nats.Timeout(s.timeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("NATS disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("NATS reconnected to %s", nc.ConnectedUrl())
+		}),
+	}
+	switch {
+	case cfg.Credentials != "":
+		opts = append(opts, nats.UserCredentials(cfg.Credentials))
+	case cfg.Token != "":
+		opts = append(opts, nats.Token(cfg.Token))
+	case cfg.Username != "":
+		opts = append(opts, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+	s.conn, err = nats.Connect(url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	return s, nil
+}
+
+// Name implements Sink
+func (s *natsSink) Name() string {
+	return "nats"
+}
+
+// Send publishes an alert on its subject, as JSON or rendered by the
+// template
+func (s *natsSink) Send(alert analyzer.Alert) error {
+	var subject bytes.Buffer
+	if err := s.subject.Execute(&subject, alert); err != nil {
+		return fmt.Errorf("failed to render subject: %w", err)
+	}
+	if subject.Len() == 0 {
+		return errors.New("empty subject")
+	}
+	var data []byte
+	var err error
+	if s.payload != nil {
+		if data, err = renderAlert(s.payload, alert); err != nil {
+			return err
+		}
+	} else if data, err = json.Marshal(alert); err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	return s.conn.Publish(subject.String(), data)
+}
+
+// Stop implements SinkStopper, flushing the alerts not yet written before
+// closing the connection
+func (s *natsSink) Stop() {
+	if err := s.conn.FlushTimeout(s.timeout); err != nil && s.conn.IsConnected() {
+		log.Printf("Failed to flush alerts to nats: %v", err)
+	}
+	s.conn.Close()
+}
+
+// subjectToken turns a value such as a rule name into a single subject
+// token, lower case with runs of characters other than letters and digits
+// replaced by an underscore, e.g. "Error Code 5xx" to error_code_5xx
+func subjectToken(s string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
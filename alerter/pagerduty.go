@@ -0,0 +1,224 @@
+package alerter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// PagerDuty defaults
+const (
+	defaultPagerDutyURL     = "https://events.pagerduty.com/v2/enqueue"
+	defaultPagerDutyTimeout = 10 * time.Second
+
+	// pagerDutyMaxSummary is the longest summary PagerDuty accepts
+	pagerDutyMaxSummary = 1024
+)
+
+// pagerDutySeverities maps alert severities to PagerDuty ones
+var pagerDutySeverities = map[string]string{
+	"CRITICAL": "critical",
+	"HIGH":     "error",
+	"MEDIUM":   "warning",
+	"LOW":      "info",
+	"INFO":     "info",
+}
+
+// pagerDutyEvent is an event of the PagerDuty Events API v2
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Client      string            `json:"client,omitempty"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+}
+
+// pagerDutyLink is a link shown on a PagerDuty alert
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+// pagerDutyPayload describes the alert of a trigger event
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// pagerDutySink triggers PagerDuty incidents for severe alerts and resolves
+// them when their alerts end. Events are deduplicated by the alert
+// fingerprint, so repeats of the same rule and key update one incident.
+type pagerDutySink struct {
+	url        string
+	routingKey string
+	summary    alertTemplate
+	client     *http.Client
+	mu         sync.Mutex
+
+	// incidents holds the fingerprints triggered for each open Argos
+	// incident, which are resolved with it
+	incidents map[string][]string
+}
+
+// newPagerDutySink creates a sink sending alerts to PagerDuty through the
+// Events API v2
+func newPagerDutySink(cfg config.PagerDuty) (Sink, error) {
+	if cfg.RoutingKey == "" {
+		return nil, errors.New("pagerduty routing_key is required")
+	}
+	s := &pagerDutySink{
+		url:        cfg.URL,
+		routingKey: cfg.RoutingKey,
+		client:     &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		incidents:  make(map[string][]string),
+	}
+	if s.url == "" {
+		s.url = defaultPagerDutyURL
+	}
+	if s.client.Timeout <= 0 {
+		s.client.Timeout = defaultPagerDutyTimeout
+	}
+	var err error
+	if s.summary, err = newAlertTemplate("pagerduty", cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name implements Sink
+func (s *pagerDutySink) Name() string {
+	return "pagerduty"
+}
+
+// Send triggers or resolves the PagerDuty alert of an alert's fingerprint.
+// An incident resolving resolves every fingerprint triggered within it.
+func (s *pagerDutySink) Send(alert analyzer.Alert) error {
+	if alert.Metadata["incident_status"] == "resolved" {
+		s.mu.Lock()
+		keys := s.incidents[alert.IncidentID]
+		delete(s.incidents, alert.IncidentID)
+		s.mu.Unlock()
+
+		var errs []error
+		for _, key := range keys {
+			if err := s.post(pagerDutyEvent{RoutingKey: s.routingKey, EventAction: "resolve", DedupKey: key}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	if alert.Fingerprint == "" {
+		return nil
+	}
+	if resolves(alert) {
+		return s.post(pagerDutyEvent{RoutingKey: s.routingKey, EventAction: "resolve", DedupKey: alert.Fingerprint})
+	}
+
+	if alert.IncidentID != "" {
+		s.mu.Lock()
+		keys := s.incidents[alert.IncidentID]
+		known := false
+		for _, key := range keys {
+			known = known || key == alert.Fingerprint
+		}
+		if !known {
+			s.incidents[alert.IncidentID] = append(keys, alert.Fingerprint)
+		}
+		s.mu.Unlock()
+	}
+	payload := pagerDutyAlert(alert)
+	if s.summary != nil {
+		summary, err := renderAlert(s.summary, alert)
+		if err != nil {
+			return err
+		}
+		payload.Summary = parser.Clip(strings.TrimSpace(string(summary)), pagerDutyMaxSummary)
+	}
+	event := pagerDutyEvent{
+		RoutingKey:  s.routingKey,
+		EventAction: "trigger",
+		DedupKey:    alert.Fingerprint,
+		Client:      "Argos",
+		Payload:     payload,
+	}
+	if runbook, ok := alert.Metadata["runbook_url"].(string); ok {
+		event.Links = []pagerDutyLink{{Href: runbook, Text: "Runbook"}}
+	}
+	return s.post(event)
+}
+
+// Update implements SinkUpdater, acknowledging or resolving the PagerDuty
+// alert of the fingerprint
+func (s *pagerDutySink) Update(update AlertUpdate) error {
+	if update.Fingerprint == "" {
+		return nil
+	}
+	action := "acknowledge"
+	if update.Status == AlertResolved {
+		action = "resolve"
+	}
+	return s.post(pagerDutyEvent{RoutingKey: s.routingKey, EventAction: action, DedupKey: update.Fingerprint})
+}
+
+// pagerDutyAlert describes an alert as a PagerDuty trigger payload
+func pagerDutyAlert(alert analyzer.Alert) *pagerDutyPayload {
+	summary := alert.Reason
+	if alert.Log.Message != "" {
+		summary += ": " + alert.Log.Message
+	}
+	summary = parser.Clip(summary, pagerDutyMaxSummary)
+	source := alert.Log.Source
+	if source == "" {
+		source = "argos"
+	}
+	severity, ok := pagerDutySeverities[strings.ToUpper(alert.Severity)]
+	if !ok {
+		severity = "warning"
+	}
+
+	details := make(map[string]interface{}, len(alert.Metadata)+4)
+	for k, v := range alert.Metadata {
+		details[k] = v
+	}
+	details["severity"] = alert.Severity
+	details["score"] = alert.Score
+	details["log"] = alert.Log
+	if alert.IncidentID != "" {
+		details["incident_id"] = alert.IncidentID
+	}
+
+	return &pagerDutyPayload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      severity,
+		Timestamp:     alert.Timestamp,
+		Class:         alert.Reason,
+		CustomDetails: details,
+	}
+}
+
+// post sends an event to PagerDuty
+func (s *pagerDutySink) post(event pagerDutyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pagerduty event: %w", err)
+	}
+	if err := sendHTTP(s.Name(), s.client, http.MethodPost, s.url, http.Header{"Content-Type": {"application/json"}}, body); err != nil {
+		return fmt.Errorf("pagerduty %s event: %w", event.EventAction, err)
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package alerter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+)
+
+// Alert query limits
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// alertQuery selects stored alerts. Zero fields match every alert.
+type alertQuery struct {
+	since       time.Time
+	until       time.Time
+	severities  map[string]bool
+	rule        string
+	source      string
+	fingerprint string
+
+	// text is matched, case-insensitively, within the message, rule and
+	// source
+	text string
+
+	limit  int
+	offset int
+}
+
+// alertStore is a sink whose alerts can be queried
+type alertStore interface {
+	// query returns the alerts matching a query, newest first, and whether
+	// more follow
+	query(q alertQuery) ([]analyzer.Alert, bool, error)
+}
+
+// alertPage is a page of the alerts matching a query
+type alertPage struct {
+	Alerts []analyzer.Alert `json:"alerts"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+	More   bool             `json:"more"`
+}
+
+// store returns where alerts are queried: the database sink if enabled,
+// otherwise the output file
+func (a *Alerter) store() alertStore {
+	var file alertStore
+	for _, s := range a.sinks {
+		if d, ok := s.(*digestSink); ok {
+			s = d.sink
+		}
+		switch s := s.(type) {
+		case *databaseSink:
+			return s
+		case *fileSink:
+			if s.label == "file" {
+				file = s
+			}
+		}
+	}
+	return file
+}
+
+// HandleAlerts serves GET requests for stored alerts, newest first. The
+// since and until query parameters bound the time of alerts, as RFC 3339
+// times or durations before now; severity (a comma separated list) or
+// min_severity, rule, source and fingerprint select alerts, and q matches
+// text in the message, rule or source. limit and offset page through the
+// alerts.
+func (a *Alerter) HandleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	store := a.store()
+	if store == nil {
+		http.Error(w, "No alert storage is configured", http.StatusNotFound)
+		return
+	}
+
+	q, err := parseAlertQuery(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alerts, more, err := store.query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if alerts == nil {
+		alerts = []analyzer.Alert{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alertPage{Alerts: alerts, Offset: q.offset, Limit: q.limit, More: more})
+}
+
+// parseAlertQuery reads an alert query from the parameters of a request
+func parseAlertQuery(r *http.Request, now time.Time) (alertQuery, error) {
+	params := r.URL.Query()
+	q := alertQuery{
+		rule:        params.Get("rule"),
+		source:      params.Get("source"),
+		fingerprint: params.Get("fingerprint"),
+		text:        strings.ToLower(params.Get("q")),
+		limit:       defaultQueryLimit,
+	}
+
+	var err error
+	if q.since, err = parseQueryTime(params.Get("since"), now); err != nil {
+		return q, fmt.Errorf("invalid since: %w", err)
+	}
+	if q.until, err = parseQueryTime(params.Get("until"), now); err != nil {
+		return q, fmt.Errorf("invalid until: %w", err)
+	}
+
+	if s := params.Get("severity"); s != "" {
+		q.severities = make(map[string]bool)
+		for _, sev := range strings.Split(s, ",") {
+			sev = strings.ToUpper(strings.TrimSpace(sev))
+			if _, ok := severityRanks[sev]; !ok {
+				return q, fmt.Errorf("unknown severity %q", sev)
+			}
+			q.severities[sev] = true
+		}
+	}
+	if s := params.Get("min_severity"); s != "" {
+		if q.severities != nil {
+			return q, errors.New("severity and min_severity cannot be combined")
+		}
+		rank, err := minSeverity(s, "")
+		if err != nil {
+			return q, err
+		}
+		q.severities = make(map[string]bool)
+		for sev, r := range severityRanks {
+			if r >= rank {
+				q.severities[sev] = true
+			}
+		}
+	}
+
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return q, errors.New("limit must be a positive number")
+		}
+		q.limit = min(n, maxQueryLimit)
+	}
+	if s := params.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, errors.New("offset must be a number")
+		}
+		q.offset = n
+	}
+	return q, nil
+}
+
+// parseQueryTime parses an RFC 3339 time, or a duration before now
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// matches reports whether an alert, at the given time, is selected by the
+// query
+func (q alertQuery) matches(alert analyzer.Alert, at time.Time) bool {
+	if !q.since.IsZero() && at.Before(q.since) {
+		return false
+	}
+	if !q.until.IsZero() && !at.Before(q.until) {
+		return false
+	}
+	if q.severities != nil && !q.severities[alert.Severity] {
+		return false
+	}
+	if (q.rule != "" && alert.Reason != q.rule) ||
+		(q.source != "" && alert.Log.Source != q.source) ||
+		(q.fingerprint != "" && alert.Fingerprint != q.fingerprint) {
+		return false
+	}
+	if q.text != "" &&
+		!strings.Contains(strings.ToLower(alert.Log.Message), q.text) &&
+		!strings.Contains(strings.ToLower(alert.Reason), q.text) &&
+		!strings.Contains(strings.ToLower(alert.Log.Source), q.text) {
+		return false
+	}
+	return true
+}
+
+// query implements alertStore by scanning the file and its rotated files,
+// keeping the newest matches. Files rotated before since are skipped.
+func (s *fileSink) query(q alertQuery) ([]analyzer.Alert, bool, error) {
+	paths := []string{s.path}
+	if backups, err := s.backups(); err == nil {
+		for _, b := range backups {
+			if !q.since.IsZero() && b.time.Before(q.since) {
+				break
+			}
+			paths = append(paths, b.path)
+		}
+	}
+
+	// The newest offset+limit+1 matches are kept, oldest first
+	keep := q.offset + q.limit + 1
+	var matches []analyzer.Alert
+	for i := len(paths) - 1; i >= 0; i-- {
+		err := scanAlertFile(paths[i], func(alert analyzer.Alert) {
+			at, err := time.Parse(time.RFC3339, alert.Timestamp)
+			if err != nil || !q.matches(alert, at) {
+				return
+			}
+			matches = append(matches, alert)
+			if len(matches) > 2*keep {
+				matches = append(matches[:0], matches[len(matches)-keep:]...)
+			}
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+	}
+
+	var page []analyzer.Alert
+	for i := len(matches) - 1 - q.offset; i >= 0 && len(page) < q.limit; i-- {
+		page = append(page, matches[i])
+	}
+	return page, len(matches) > q.offset+q.limit, nil
+}
+
+// scanAlertFile calls fn with every alert of a file of JSON alerts, gzipped
+// or not. A truncated last alert, still being written, ends the scan.
+func scanAlertFile(path string, fn func(alert analyzer.Alert)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	dec := json.NewDecoder(r)
+	for {
+		var alert analyzer.Alert
+		err := dec.Decode(&alert)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		fn(alert)
+	}
+}
+
+// query implements alertStore with a query on the alerts table
+func (s *databaseSink) query(q alertQuery) ([]analyzer.Alert, bool, error) {
+	var where []string
+	var args []interface{}
+	if !q.since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.since.UTC())
+	}
+	if !q.until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, q.until.UTC())
+	}
+	if q.severities != nil {
+		marks := make([]string, 0, len(q.severities))
+		for sev := range q.severities {
+			marks = append(marks, "?")
+			args = append(args, sev)
+		}
+		where = append(where, "severity IN ("+strings.Join(marks, ", ")+")")
+	}
+	for column, value := range map[string]string{"rule": q.rule, "source": q.source, "fingerprint": q.fingerprint} {
+		if value != "" {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if q.text != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q.text) + "%"
+		where = append(where, `(LOWER(message) LIKE ? ESCAPE '\' OR LOWER(rule) LIKE ? ESCAPE '\' OR LOWER(source) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	query := "SELECT time, severity, rule, score, fingerprint, incident_id, log, metadata FROM alerts"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, q.limit+1, q.offset)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []analyzer.Alert
+	for rows.Next() {
+		var alert analyzer.Alert
+		var at time.Time
+		var incident *string
+		var logJSON, metadata string
+		if err := rows.Scan(&at, &alert.Severity, &alert.Reason, &alert.Score, &alert.Fingerprint, &incident, &logJSON, &metadata); err != nil {
+			return nil, false, fmt.Errorf("failed to query alerts: %w", err)
+		}
+		alert.Timestamp = at.UTC().Format(time.RFC3339)
+		if incident != nil {
+			alert.IncidentID = *incident
+		}
+		if err := json.Unmarshal([]byte(logJSON), &alert.Log); err != nil {
+			return nil, false, fmt.Errorf("failed to read alert log: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &alert.Metadata); err != nil {
+			return nil, false, fmt.Errorf("failed to read alert metadata: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	if len(alerts) > q.limit {
+		return alerts[:q.limit], true, nil
+	}
+	return alerts, false, nil
+}
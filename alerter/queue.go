@@ -0,0 +1,110 @@
+package alerter
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+)
+
+// Sink queue defaults
+const (
+	defaultSinkQueueSize = 1000
+
+	// dropLogInterval is the least time between logs of alerts dropped by
+	// one sink
+	dropLogInterval = 10 * time.Second
+)
+
+// sinkQueue hands the alerts of a sink to a worker of its own, so that a
+// slow or unreachable sink delays only its own alerts. Alerts arriving
+// while the queue is full are dropped.
+type sinkQueue struct {
+	sink    Sink
+	alerts  chan analyzer.Alert
+	metrics *sinkMetrics
+	wg      sync.WaitGroup
+
+	// breaker, if not nil, pauses the sink while it keeps failing
+	breaker *circuitBreaker
+
+	// done is closed when the queue stops
+	done chan struct{}
+
+	mu       sync.Mutex
+	closed   bool
+	dropped  int
+	loggedAt time.Time
+}
+
+// newSinkQueue creates the queue of a sink, holding up to size alerts
+func newSinkQueue(s Sink, size int) *sinkQueue {
+	q := &sinkQueue{
+		sink:    s,
+		alerts:  make(chan analyzer.Alert, size),
+		metrics: sinkMetricsFor(s.Name()),
+		done:    make(chan struct{}),
+	}
+	q.metrics.setQueue(q.alerts)
+	return q
+}
+
+// start starts the worker sending the queued alerts, one at a time
+func (q *sinkQueue) start() {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for alert := range q.alerts {
+			if q.breaker != nil && !q.breaker.ready(q.done) {
+				q.breaker.setAside(alert)
+				continue
+			}
+			start := time.Now()
+			err := q.sink.Send(alert)
+			q.metrics.sendDone(time.Since(start), err)
+			if err != nil {
+				log.Printf("Failed to send alert to %s: %v", q.sink.Name(), err)
+			}
+			if q.breaker != nil {
+				q.breaker.record(err)
+			}
+		}
+		if q.breaker != nil {
+			q.breaker.stopped()
+		}
+	}()
+}
+
+// add queues an alert, or drops it when the queue is full or stopped
+func (q *sinkQueue) add(alert analyzer.Alert) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		q.metrics.dropped.Add(1)
+		return
+	}
+	select {
+	case q.alerts <- alert:
+		return
+	default:
+	}
+	q.metrics.dropped.Add(1)
+	q.dropped++
+	if now := time.Now(); now.Sub(q.loggedAt) >= dropLogInterval {
+		log.Printf("Alert queue of %s is full, dropped %d alerts", q.sink.Name(), q.dropped)
+		q.dropped = 0
+		q.loggedAt = now
+	}
+}
+
+// stop sends the alerts left in the queue and stops the worker. Alerts
+// left while the sink's circuit is open are not sent.
+func (q *sinkQueue) stop() {
+	q.mu.Lock()
+	q.closed = true
+	close(q.done)
+	close(q.alerts)
+	q.mu.Unlock()
+	q.wg.Wait()
+}
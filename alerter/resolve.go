@@ -0,0 +1,74 @@
+package alerter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// defaultResolveTTL is how long an alert has to stop firing before it is
+// resolved
+const defaultResolveTTL = 30 * time.Minute
+
+// stale resolves the open and acknowledged alerts none of whose
+// fingerprint fired for ttl, returning the alerts announcing their
+// resolution. Alerts of open circuits resolve when the circuit closes.
+func (l *alertLifecycle) stale(now time.Time, ttl time.Duration) []analyzer.Alert {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var resolved []analyzer.Alert
+	for _, r := range l.active {
+		if now.Sub(r.lastSeen) < ttl || r.last.Reason == circuitReason {
+			continue
+		}
+		l.resolve(r, "argos", fmt.Sprintf("not firing for %s", ttl), now)
+
+		alert := r.last
+		alert.Timestamp = now.Format(time.RFC3339)
+		annotateLifecycle(&alert, r)
+		alert.Metadata["last_seen"] = r.LastSeen
+		alert.Metadata["resolved_at"] = r.ResolvedAt
+		resolved = append(resolved, alert)
+	}
+	return resolved
+}
+
+// setAutoResolve resolves alerts that stopped firing, if enabled
+func (a *Alerter) setAutoResolve(cfg config.AutoResolve) error {
+	if !cfg.Enabled {
+		a.resolveTTL = 0
+		return nil
+	}
+	switch {
+	case cfg.TTL < 0:
+		return errors.New("auto_resolve ttl must not be negative")
+	case cfg.TTL == 0:
+		a.resolveTTL = defaultResolveTTL
+	default:
+		a.resolveTTL = time.Duration(cfg.TTL)
+	}
+	return nil
+}
+
+// autoResolve periodically resolves the alerts that stopped firing and
+// delivers their resolution, until shutdown
+func (a *Alerter) autoResolve() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(max(min(a.resolveTTL/10, time.Minute), time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, alert := range a.lifecycle.stale(now, a.resolveTTL) {
+				a.outputAlert(alert, -1)
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package alerter
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+)
+
+// backupTimeFormat is the time in the names of rotated files, which sort
+// by the time they were rotated
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// fileRotation rotates an alert file by size and age, and keeps the rotated
+// files, optionally gzipped, within a count and age
+type fileRotation struct {
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+
+	// size and started are the size of the current file and when it was
+	// started
+	size    int64
+	started time.Time
+
+	// mu keeps cleanups of rotated files from running at once
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+// backupFile is a rotated file
+type backupFile struct {
+	path string
+	time time.Time
+}
+
+// newFileRotation returns the rotation of a file, or nil when the file is
+// not rotated
+func newFileRotation(cfg config.Rotation) (*fileRotation, error) {
+	if cfg.MaxSize < 0 || cfg.MaxBackups < 0 {
+		return nil, errors.New("rotation max_size and max_backups cannot be negative")
+	}
+	if cfg.MaxSize == 0 && cfg.Interval <= 0 {
+		if cfg.MaxBackups > 0 || cfg.MaxAge > 0 || cfg.Compress {
+			return nil, errors.New("rotation needs a max_size or interval")
+		}
+		return nil, nil
+	}
+	return &fileRotation{
+		maxSize:    int64(cfg.MaxSize) << 20,
+		interval:   time.Duration(cfg.Interval),
+		maxBackups: cfg.MaxBackups,
+		maxAge:     time.Duration(cfg.MaxAge),
+		compress:   cfg.Compress,
+	}, nil
+}
+
+// due reports whether the file is to be rotated before n more bytes are
+// written to it. Empty files are never rotated.
+func (r *fileRotation) due(n int, now time.Time) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.interval > 0 && now.Sub(r.started) >= r.interval
+}
+
+// resume picks up the rotation of a file just opened, and cleans up the
+// rotated files. A file that is not empty was started when the last one was
+// rotated, if any.
+func (s *fileSink) resume() error {
+	r := s.rotation
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	r.size = info.Size()
+	r.started = time.Now()
+	if backups, err := s.backups(); err == nil && len(backups) > 0 && r.size > 0 {
+		r.started = backups[0].time
+	}
+	s.cleanup()
+	return nil
+}
+
+// rotate renames the file after the time it is rotated at and opens a new
+// one in its place
+func (s *fileSink) rotate(now time.Time) error {
+	s.file.Close()
+	ext := filepath.Ext(s.path)
+	backup := strings.TrimSuffix(s.path, ext) + "-" + now.UTC().Format(backupTimeFormat) + ext
+	renameErr := os.Rename(s.path, backup)
+	if err := s.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("failed to rotate output file: %w", renameErr)
+	}
+	return nil
+}
+
+// cleanup compresses and removes rotated files in the background
+func (s *fileSink) cleanup() {
+	r := s.rotation
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err := s.cleanBackups(time.Now()); err != nil {
+			log.Printf("Failed to clean up rotated %s files: %v", s.path, err)
+		}
+	}()
+}
+
+// cleanBackups removes the rotated files beyond the count and age kept,
+// and compresses the others
+func (s *fileSink) cleanBackups(now time.Time) error {
+	r := s.rotation
+	backups, err := s.backups()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, b := range backups {
+		if (r.maxBackups > 0 && i >= r.maxBackups) || (r.maxAge > 0 && now.Sub(b.time) > r.maxAge) {
+			if err := os.Remove(b.path); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if r.compress && !strings.HasSuffix(b.path, ".gz") {
+			if err := compressFile(b.path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backups lists the rotated files, newest first
+func (s *fileSink) backups() ([]backupFile, error) {
+	ext := filepath.Ext(s.path)
+	prefix := strings.TrimSuffix(filepath.Base(s.path), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(s.path))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(filepath.Dir(s.path), name), time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+	return backups, nil
+}
+
+// compressFile gzips a file, replacing it with the compressed one
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	return os.Remove(path)
+}
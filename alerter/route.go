@@ -0,0 +1,145 @@
+package alerter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// route delivers the alerts of some severities, rules and labels to a set
+// of sinks
+type route struct {
+	severities map[int]bool
+	rules      []string
+	labels     map[string]string
+	stop       bool
+	sinks      map[Sink]bool
+}
+
+// SetRoutes routes alerts to sinks by severity, rule and label. Every route
+// matching an alert delivers it to its sinks, up to the first matching
+// route that stops; sinks that no route names receive no alerts. Without
+// routes, every sink receives every alert.
+// Routes name sinks by their Name: the built-in ones are named by their
+// type, e.g. pagerduty or kafka, or by their configured name for sinks
+// configured in lists such as webhooks; the output file is file.
+func (a *Alerter) SetRoutes(routes []config.Route) error {
+	named := make(map[string]Sink)
+	for _, s := range a.sinks {
+		if _, ok := named[s.Name()]; ok {
+			// Sinks sharing a name cannot be routed to
+			named[s.Name()] = nil
+			continue
+		}
+		named[s.Name()] = s
+	}
+
+	a.routes = nil
+	for i, cfg := range routes {
+		if len(cfg.Sinks) == 0 {
+			return fmt.Errorf("route %d names no sinks", i+1)
+		}
+		if len(cfg.Severities) > 0 && cfg.MinSeverity != "" {
+			return fmt.Errorf("route %d sets both severities and min_severity", i+1)
+		}
+		r := route{
+			severities: make(map[int]bool),
+			rules:      cfg.Rules,
+			labels:     cfg.Labels,
+			stop:       cfg.Stop,
+			sinks:      make(map[Sink]bool),
+		}
+		for _, p := range cfg.Rules {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("route %d: invalid rule pattern %q", i+1, p)
+			}
+		}
+		for name, p := range cfg.Labels {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("route %d: invalid pattern %q for label %s", i+1, p, name)
+			}
+		}
+		for _, severity := range cfg.Severities {
+			rank, ok := severityRanks[strings.ToUpper(severity)]
+			if !ok {
+				return fmt.Errorf("route %d: unknown severity %q", i+1, severity)
+			}
+			r.severities[rank] = true
+		}
+		if len(cfg.Severities) == 0 {
+			lowest, err := minSeverity(cfg.MinSeverity, "INFO")
+			if err != nil {
+				return fmt.Errorf("route %d: %w", i+1, err)
+			}
+			for _, rank := range severityRanks {
+				r.severities[rank] = rank >= lowest
+			}
+		}
+		for _, name := range cfg.Sinks {
+			s, ok := named[name]
+			if !ok {
+				return fmt.Errorf("route %d: unknown sink %q", i+1, name)
+			}
+			if s == nil {
+				return fmt.Errorf("route %d: more than one sink is named %q", i+1, name)
+			}
+			r.sinks[s] = true
+		}
+		a.routes = append(a.routes, r)
+	}
+	return nil
+}
+
+// routed reports whether an alert is to be delivered to a sink
+func (a *Alerter) routed(s Sink, alert analyzer.Alert) bool {
+	if len(a.routes) == 0 {
+		return true
+	}
+	for _, r := range a.routes {
+		if !r.matches(alert) {
+			continue
+		}
+		if r.sinks[s] {
+			return true
+		}
+		if r.stop {
+			return false
+		}
+	}
+	return false
+}
+
+// matches reports whether an alert is of the route's severities, rules and
+// labels
+func (r route) matches(alert analyzer.Alert) bool {
+	if !r.severities[severityRank(alert.Severity)] {
+		return false
+	}
+	if len(r.rules) > 0 && !matchAny(r.rules, alert.Reason) && !matchAny(r.rules, analyzer.RuleID(alert.Reason)) {
+		return false
+	}
+	for name, p := range r.labels {
+		value, ok := alertLabel(alert, name)
+		if !ok || !matchAny([]string{p}, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// alertLabel returns a label of the rule that raised an alert
+func alertLabel(alert analyzer.Alert, name string) (string, bool) {
+	switch labels := alert.Metadata["labels"].(type) {
+	case map[string]string:
+		value, ok := labels[name]
+		return value, ok
+	case map[string]interface{}:
+		// Labels of alerts decoded from JSON
+		value, ok := labels[name].(string)
+		return value, ok
+	}
+	return "", false
+}
@@ -0,0 +1,156 @@
+package alerter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// S3 defaults
+const (
+	defaultS3Prefix        = "argos/alerts"
+	defaultS3FlushInterval = 5 * time.Minute
+	defaultS3MaxAlerts     = 10000
+)
+
+// s3Sink archives alerts to S3 as gzipped JSON Lines objects, under keys
+// partitioned by the date and hour of the alerts, e.g.
+// argos/alerts/dt=2024-03-01/hour=09/alerts-20240301T091500Z-1a2b3c4d.json.gz,
+// which Athena and similar engines read as partitions. Credentials come
+// from the default AWS credential chain.
+type s3Sink struct {
+	client  *s3.Client
+	bucket  string
+	prefix  string
+	timeout time.Duration
+	batcher *alertBatcher
+}
+
+// newS3Sink creates a sink archiving alerts to an S3 bucket
+func newS3Sink(cfg config.S3) (Sink, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	s := &s3Sink{
+		bucket:  cfg.Bucket,
+		prefix:  strings.Trim(cfg.Prefix, "/"),
+		timeout: time.Duration(cfg.Timeout),
+	}
+	if s.prefix == "" {
+		s.prefix = defaultS3Prefix
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultAWSTimeout
+	}
+	awsCfg, err := loadAWSConfig(cfg.Region, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	s.client = s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.PathStyle
+	})
+
+	interval, maxAlerts := time.Duration(cfg.FlushInterval), cfg.MaxAlerts
+	if interval <= 0 {
+		interval = defaultS3FlushInterval
+	}
+	if maxAlerts <= 0 {
+		maxAlerts = defaultS3MaxAlerts
+	}
+	s.batcher = newAlertBatcher("s3", maxAlerts, interval, s.flush)
+	return s, nil
+}
+
+// Name implements Sink
+func (s *s3Sink) Name() string {
+	return "s3"
+}
+
+// Send adds an alert to the current batch
+func (s *s3Sink) Send(alert analyzer.Alert) error {
+	return s.batcher.add(alert)
+}
+
+// Start implements SinkStarter
+func (s *s3Sink) Start() {
+	s.batcher.start()
+}
+
+// Stop implements SinkStopper, writing the last batch
+func (s *s3Sink) Stop() {
+	s.batcher.stop()
+}
+
+// flush writes a batch of alerts as one object per hour they fall in
+func (s *s3Sink) flush(alerts []analyzer.Alert) error {
+	now := time.Now().UTC()
+	partitions := make(map[string][]analyzer.Alert)
+	for _, alert := range alerts {
+		at, err := time.Parse(time.RFC3339, alert.Timestamp)
+		if err != nil {
+			at = now
+		}
+		partition := at.UTC().Format("dt=2006-01-02/hour=15")
+		partitions[partition] = append(partitions[partition], alert)
+	}
+	names := make([]string, 0, len(partitions))
+	for partition := range partitions {
+		names = append(names, partition)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, partition := range names {
+		if err := s.put(partition, partitions[partition], now); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", partition, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// put writes the alerts of a partition as one object
+func (s *s3Sink) put(partition string, alerts []analyzer.Alert, now time.Time) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, alert := range alerts {
+		if err := enc.Encode(alert); err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress alerts: %w", err)
+	}
+
+	// The random suffix keeps objects written at once, e.g. by several
+	// instances, apart
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	key := fmt.Sprintf("%s/%s/alerts-%s-%s.json.gz", s.prefix, partition, now.Format("20060102T150405Z"), hex.EncodeToString(suffix))
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("application/gzip"),
+	})
+	return err
+}
@@ -0,0 +1,253 @@
+package alerter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// silence mutes the alerts it matches until it expires
+type silence struct {
+	ID         string            `json:"id"`
+	Rules      []string          `json:"rules,omitempty"`
+	Sources    []string          `json:"sources,omitempty"`
+	Severities []string          `json:"severities,omitempty"`
+	Tenants    []string          `json:"tenants,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CreatedBy  string            `json:"created_by,omitempty"`
+	Comment    string            `json:"comment,omitempty"`
+	CreatedAt  string            `json:"created_at"`
+	ExpiresAt  string            `json:"expires_at,omitempty"`
+	Silenced   int64             `json:"silenced"`
+
+	expires time.Time
+}
+
+// silenceList is the set of silences in effect
+type silenceList struct {
+	mu       sync.Mutex
+	silences []*silence
+}
+
+// newSilence validates a silence, created at now
+func newSilence(cfg config.AlertSilence, now time.Time) (*silence, error) {
+	s := &silence{
+		ID:        newID("sil"),
+		Rules:     cfg.Rules,
+		Sources:   cfg.Sources,
+		Tenants:   cfg.Tenants,
+		Metadata:  cfg.Metadata,
+		CreatedBy: cfg.CreatedBy,
+		Comment:   cfg.Comment,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	if len(cfg.Rules)+len(cfg.Sources)+len(cfg.Severities)+len(cfg.Tenants)+len(cfg.Metadata) == 0 {
+		return nil, errors.New("silence matches every alert; set rules, sources, severities, tenants or metadata")
+	}
+	for _, patterns := range [][]string{cfg.Rules, cfg.Sources, cfg.Tenants} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q", p)
+			}
+		}
+	}
+	for key, p := range cfg.Metadata {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q for metadata %s", p, key)
+		}
+	}
+	for _, severity := range cfg.Severities {
+		severity = strings.ToUpper(severity)
+		if _, ok := severityRanks[severity]; !ok {
+			return nil, fmt.Errorf("unknown severity %q", severity)
+		}
+		s.Severities = append(s.Severities, severity)
+	}
+
+	switch {
+	case cfg.Expires != "" && cfg.Duration > 0:
+		return nil, errors.New("silence sets both expires and duration")
+	case cfg.Expires != "":
+		expires, err := time.Parse(time.RFC3339, cfg.Expires)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires: %w", err)
+		}
+		s.expires = expires
+	case cfg.Duration > 0:
+		s.expires = now.Add(time.Duration(cfg.Duration))
+	}
+	if !s.expires.IsZero() {
+		if !s.expires.After(now) {
+			return nil, errors.New("silence has already expired")
+		}
+		s.ExpiresAt = s.expires.Format(time.RFC3339)
+	}
+	return s, nil
+}
+
+// matches reports whether the silence covers an alert
+func (s *silence) matches(alert analyzer.Alert) bool {
+	if len(s.Rules) > 0 && !matchAny(s.Rules, alert.Reason) && !matchAny(s.Rules, analyzer.RuleID(alert.Reason)) {
+		return false
+	}
+	if len(s.Sources) > 0 && !matchAny(s.Sources, alert.Log.Source) {
+		return false
+	}
+	if len(s.Tenants) > 0 && !matchAny(s.Tenants, alert.Log.Tenant) {
+		return false
+	}
+	if len(s.Severities) > 0 && !matchAny(s.Severities, alert.Severity) {
+		return false
+	}
+	for key, p := range s.Metadata {
+		value, ok := alert.Metadata[key]
+		if !ok || !matchAny([]string{p}, fmt.Sprint(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether a value matches any of the glob patterns
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// add puts a silence in effect
+func (l *silenceList) add(s *silence) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.silences = append(l.silences, s)
+}
+
+// expire drops the silences expired at now. The caller holds l.mu.
+func (l *silenceList) expire(now time.Time) {
+	kept := l.silences[:0]
+	for _, s := range l.silences {
+		if s.expires.IsZero() || now.Before(s.expires) {
+			kept = append(kept, s)
+		}
+	}
+	clear(l.silences[len(kept):])
+	l.silences = kept
+}
+
+// silenced reports whether a silence covers an alert, counting it against
+// the first such silence
+func (l *silenceList) silenced(alert analyzer.Alert, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.silences) == 0 {
+		return false
+	}
+	l.expire(now)
+	for _, s := range l.silences {
+		if s.matches(alert) {
+			s.Silenced++
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the silences in effect at now
+func (l *silenceList) list(now time.Time) []silence {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(now)
+	silences := make([]silence, 0, len(l.silences))
+	for _, s := range l.silences {
+		silences = append(silences, *s)
+	}
+	return silences
+}
+
+// remove ends the silence with an ID, returning it as expired at now
+func (l *silenceList) remove(id string, now time.Time) (silence, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, s := range l.silences {
+		if s.ID == id {
+			l.silences = append(l.silences[:i], l.silences[i+1:]...)
+			removed := *s
+			removed.ExpiresAt = now.Format(time.RFC3339)
+			return removed, true
+		}
+	}
+	return silence{}, false
+}
+
+// setSilences puts the configured silences in effect
+func (a *Alerter) setSilences(silences []config.AlertSilence) error {
+	now := time.Now()
+	for i, cfg := range silences {
+		s, err := newSilence(cfg, now)
+		if err != nil {
+			return fmt.Errorf("silence %d: %w", i+1, err)
+		}
+		a.silences.add(s)
+	}
+	return nil
+}
+
+// HandleSilences serves GET requests for the silences in effect, and POST
+// requests adding one, with the silence as a JSON object in the body in
+// the format of the configuration. created_by is required.
+func (a *Alerter) HandleSilences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.silences.list(time.Now()))
+	case http.MethodPost:
+		var cfg config.AlertSilence
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, "Invalid silence: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if cfg.CreatedBy == "" {
+			http.Error(w, "created_by is required", http.StatusBadRequest)
+			return
+		}
+		s, err := newSilence(cfg, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		created := *s
+		a.silences.add(s)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleSilence serves DELETE requests ending a silence by ID
+func (a *Alerter) HandleSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, ok := a.silences.remove(r.PathValue("id"), time.Now())
+	if !ok {
+		http.Error(w, "Silence not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,312 @@
+package alerter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// Sink delivers alerts to a system other than the console. Send is called
+// for one alert at a time, from a goroutine of the sink's own fed by a
+// bounded queue, so that a slow sink delays only its own alerts.
+type Sink interface {
+	// Name identifies the sink in logs and routes
+	Name() string
+
+	// Send delivers an alert
+	Send(alert analyzer.Alert) error
+}
+
+// SinkStarter is implemented by sinks that run in the background, started
+// with the alerter
+type SinkStarter interface {
+	Start()
+}
+
+// SinkStopper is implemented by sinks holding alerts or connections, stopped
+// once the alerter has processed its last alert
+type SinkStopper interface {
+	Stop()
+}
+
+// SinkUpdater is implemented by sinks that reflect the acknowledgment and
+// resolution of alerts they delivered, such as PagerDuty incidents
+type SinkUpdater interface {
+	Update(update AlertUpdate) error
+}
+
+// AlertUpdate announces that a responder acknowledged or resolved an alert
+type AlertUpdate struct {
+	// ID is the lifecycle of the alert, from its first delivery to its
+	// resolution, and Fingerprint the rule and key it is about
+	ID          string
+	Fingerprint string
+
+	// Status is AlertAcked or AlertResolved
+	Status  string
+	User    string
+	Comment string
+	Time    time.Time
+
+	// Alert is the last alert delivered with the fingerprint
+	Alert analyzer.Alert
+}
+
+// SinkFactory builds the sinks of a registered kind from the alerter
+// configuration, returning none when the kind is not enabled. Sinks
+// registered outside this package read their settings from cfg.Sinks under
+// their registered name.
+type SinkFactory func(cfg config.Alerter) ([]Sink, error)
+
+// sinkRegistry holds the registered sink factories in order of
+// registration, which is the order sinks receive alerts in
+var sinkRegistry = struct {
+	mu        sync.Mutex
+	names     []string
+	factories map[string]SinkFactory
+}{factories: make(map[string]SinkFactory)}
+
+// RegisterSink makes a kind of sink available to ConfigureSinks. It panics
+// when the name is taken, and is meant to be called from init functions.
+func RegisterSink(name string, factory SinkFactory) {
+	sinkRegistry.mu.Lock()
+	defer sinkRegistry.mu.Unlock()
+
+	if factory == nil {
+		panic("alerter: RegisterSink factory is nil")
+	}
+	if _, ok := sinkRegistry.factories[name]; ok {
+		panic("alerter: RegisterSink called twice for " + name)
+	}
+	sinkRegistry.names = append(sinkRegistry.names, name)
+	sinkRegistry.factories[name] = factory
+}
+
+// RegisteredSinks returns the names of the registered kinds of sinks in
+// order of registration
+func RegisteredSinks() []string {
+	sinkRegistry.mu.Lock()
+	defer sinkRegistry.mu.Unlock()
+
+	return append([]string(nil), sinkRegistry.names...)
+}
+
+// registerBuiltin registers a built-in sink kind building at most one sink
+func registerBuiltin(name string, build func(cfg config.Alerter) (Sink, error)) {
+	RegisterSink(name, func(cfg config.Alerter) ([]Sink, error) {
+		s, err := build(cfg)
+		if err != nil || s == nil {
+			return nil, err
+		}
+		return []Sink{s}, nil
+	})
+}
+
+func init() {
+	registerBuiltin("pagerduty", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.PagerDuty.Enabled {
+			return nil, nil
+		}
+		return newPagerDutySink(cfg.PagerDuty)
+	})
+	registerBuiltin("email", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.Email.Enabled {
+			return nil, nil
+		}
+		return newEmailSink(cfg.Email)
+	})
+	registerBuiltin("discord", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.Discord.Enabled {
+			return nil, nil
+		}
+		return newDiscordSink(cfg.Discord)
+	})
+	registerBuiltin("kafka", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.Kafka.Enabled {
+			return nil, nil
+		}
+		return newKafkaSink(cfg.Kafka)
+	})
+	registerBuiltin("nats", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.NATS.Enabled {
+			return nil, nil
+		}
+		return newNATSSink(cfg.NATS)
+	})
+	registerBuiltin("sqs", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.SQS.Enabled {
+			return nil, nil
+		}
+		return newSQSSink(cfg.SQS)
+	})
+	registerBuiltin("sns", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.SNS.Enabled {
+			return nil, nil
+		}
+		return newSNSSink(cfg.SNS)
+	})
+	registerBuiltin("snmp", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.SNMP.Enabled {
+			return nil, nil
+		}
+		return newSNMPSink(cfg.SNMP)
+	})
+	registerBuiltin("database", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.Database.Enabled {
+			return nil, nil
+		}
+		return newDatabaseSink(cfg.Database)
+	})
+	registerBuiltin("clickhouse", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.ClickHouse.Enabled {
+			return nil, nil
+		}
+		return newClickHouseSink(cfg.ClickHouse)
+	})
+	registerBuiltin("s3", func(cfg config.Alerter) (Sink, error) {
+		if !cfg.S3.Enabled {
+			return nil, nil
+		}
+		return newS3Sink(cfg.S3)
+	})
+	RegisterSink("webhooks", func(cfg config.Alerter) ([]Sink, error) {
+		var sinks []Sink
+		for _, c := range cfg.Webhooks {
+			s, err := newWebhookSink(c)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		}
+		return sinks, nil
+	})
+	RegisterSink("commands", func(cfg config.Alerter) ([]Sink, error) {
+		var sinks []Sink
+		for _, c := range cfg.Commands {
+			s, err := newCommandSink(c)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		}
+		return sinks, nil
+	})
+	RegisterSink("files", func(cfg config.Alerter) ([]Sink, error) {
+		var sinks []Sink
+		for _, c := range cfg.Files {
+			s, err := newFileSink(c)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		}
+		return sinks, nil
+	})
+}
+
+// ConfigureSinks builds the sinks enabled in the configuration, built-in
+// and registered alike, and sets up their digests and routes. It must be called
+// before Start.
+func (a *Alerter) ConfigureSinks(cfg config.Alerter) error {
+	if err := a.setOutput(cfg); err != nil {
+		return err
+	}
+	if cfg.QueueSize > 0 {
+		a.queueSize = cfg.QueueSize
+	}
+	if err := a.setCircuitBreaker(cfg.CircuitBreaker); err != nil {
+		return err
+	}
+	for _, name := range RegisteredSinks() {
+		sinkRegistry.mu.Lock()
+		factory := sinkRegistry.factories[name]
+		sinkRegistry.mu.Unlock()
+
+		sinks, err := factory(cfg)
+		if err != nil {
+			return err
+		}
+		for _, s := range sinks {
+			a.AddSink(s)
+		}
+	}
+	// Routes, digests and metrics tell sinks apart by name
+	names := make(map[string]bool, len(a.sinks))
+	for _, s := range a.sinks {
+		if names[s.Name()] {
+			return fmt.Errorf("more than one sink is named %q, set a distinct name for each", s.Name())
+		}
+		names[s.Name()] = true
+	}
+	if err := a.setDigests(cfg.Digests); err != nil {
+		return err
+	}
+	if err := a.setSilences(cfg.Silences); err != nil {
+		return err
+	}
+	if err := a.setCatalog(cfg.Catalog); err != nil {
+		return err
+	}
+	if err := a.setAutoResolve(cfg.AutoResolve); err != nil {
+		return err
+	}
+	return a.SetRoutes(cfg.Routes)
+}
+
+// AddSink adds a sink built outside the configuration, after those already
+// configured. It must be called before Start, and before SetRoutes for
+// routes to name it.
+func (a *Alerter) AddSink(s Sink) {
+	a.sinks = append(a.sinks, s)
+}
+
+// severityRanks orders alert severities from least to most severe
+var severityRanks = map[string]int{
+	"INFO":     0,
+	"LOW":      1,
+	"MEDIUM":   2,
+	"HIGH":     3,
+	"CRITICAL": 4,
+}
+
+// severityColors are the colors severities are shown in
+var severityColors = map[string]string{
+	"CRITICAL": "#8b0000",
+	"HIGH":     "#d32f2f",
+	"MEDIUM":   "#f57c00",
+	"LOW":      "#1976d2",
+	"INFO":     "#616161",
+}
+
+// severityRank returns the rank of a severity, treating unknown ones as
+// MEDIUM
+func severityRank(severity string) int {
+	if r, ok := severityRanks[strings.ToUpper(severity)]; ok {
+		return r
+	}
+	return severityRanks["MEDIUM"]
+}
+
+// minSeverity parses a configured minimum severity, returning the rank of
+// def when it is empty
+func minSeverity(severity, def string) (int, error) {
+	if severity == "" {
+		return severityRank(def), nil
+	}
+	r, ok := severityRanks[strings.ToUpper(severity)]
+	if !ok {
+		return 0, fmt.Errorf("unknown severity %q", severity)
+	}
+	return r, nil
+}
+
+// resolves reports whether an alert announces that the condition it is
+// about has ended, rather than that it is firing
+func resolves(alert analyzer.Alert) bool {
+	return alert.Metadata["dedup_status"] == "ended" || alert.Metadata["incident_status"] == "resolved" ||
+		alert.Metadata["circuit_status"] == circuitClosed || alert.Metadata["alert_status"] == AlertResolved
+}
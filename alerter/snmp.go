@@ -0,0 +1,211 @@
+package alerter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+	"github.com/gosnmp/gosnmp"
+)
+
+// SNMP defaults
+const (
+	defaultSNMPPort      = 162
+	defaultSNMPCommunity = "public"
+	defaultSNMPTimeout   = 5 * time.Second
+
+	// defaultSNMPOID is the root of the Argos MIB, mibs/ARGOS-MIB.txt, in
+	// the Net-SNMP playpen
+	defaultSNMPOID = "1.3.6.1.4.1.8072.9999.9999.1"
+)
+
+// Notifications of the Argos MIB, under argosNotifications (root.0)
+const (
+	snmpAlertFiring = 1
+	snmpAlertEnded  = 2
+)
+
+// Objects of the Argos MIB, under argosAlertObjects (root.1)
+const (
+	snmpAlertSeverity = iota + 1
+	snmpAlertRule
+	snmpAlertSource
+	snmpAlertMessage
+	snmpAlertScore
+	snmpAlertFingerprint
+	snmpAlertIncident
+	snmpAlertKey
+	snmpAlertTime
+)
+
+// snmpMaxString is the longest DisplayString
+const snmpMaxString = 255
+
+// snmpSysUpTime and snmpTrapOID are the OIDs leading the variables of v2c
+// notifications
+const (
+	snmpSysUpTime = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOID   = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+// snmpSink sends alerts as traps of the Argos MIB, for alarm consoles that
+// are driven by SNMP traps
+type snmpSink struct {
+	client  *gosnmp.GoSNMP
+	oid     string
+	inform  bool
+	agent   string
+	message alertTemplate
+	started time.Time
+}
+
+// newSNMPSink creates a sink sending alerts as SNMP traps
+func newSNMPSink(cfg config.SNMP) (Sink, error) {
+	if cfg.Target == "" {
+		return nil, errors.New("snmp target is required")
+	}
+	host, port, err := net.SplitHostPort(cfg.Target)
+	if err != nil {
+		host, port = cfg.Target, strconv.Itoa(defaultSNMPPort)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snmp target port %q", port)
+	}
+
+	s := &snmpSink{
+		client: &gosnmp.GoSNMP{
+			Target:    host,
+			Port:      uint16(portNum),
+			Transport: "udp",
+			Community: cfg.Community,
+			Timeout:   time.Duration(cfg.Timeout),
+			Retries:   cfg.Retries,
+			MaxOids:   gosnmp.MaxOids,
+		},
+		oid:     strings.TrimPrefix(cfg.OID, "."),
+		inform:  cfg.Inform,
+		agent:   cfg.AgentAddress,
+		started: time.Now(),
+	}
+	switch cfg.Version {
+	case "", "2c":
+		s.client.Version = gosnmp.Version2c
+	case "1":
+		s.client.Version = gosnmp.Version1
+		if s.inform {
+			return nil, errors.New("snmp informs need version 2c")
+		}
+	default:
+		return nil, fmt.Errorf("unknown snmp version %q (want 1 or 2c)", cfg.Version)
+	}
+	if s.client.Community == "" {
+		s.client.Community = defaultSNMPCommunity
+	}
+	if s.client.Timeout <= 0 {
+		s.client.Timeout = defaultSNMPTimeout
+	}
+	if s.oid == "" {
+		s.oid = defaultSNMPOID
+	}
+	if s.message, err = newAlertTemplate("snmp", cfg.AlertFormat); err != nil {
+		return nil, err
+	}
+	for _, part := range strings.Split(s.oid, ".") {
+		if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid snmp oid %q", cfg.OID)
+		}
+	}
+
+	if err := s.client.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to open snmp socket: %w", err)
+	}
+	if s.agent == "" {
+		if addr, ok := s.client.Conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() != nil {
+			s.agent = addr.IP.String()
+		} else {
+			s.agent = "0.0.0.0"
+		}
+	}
+	return s, nil
+}
+
+// Name implements Sink
+func (s *snmpSink) Name() string {
+	return "snmp"
+}
+
+// Send sends an alert as an argosAlertFiring trap, or argosAlertEnded for
+// alerts announcing that a condition ended
+func (s *snmpSink) Send(alert analyzer.Alert) error {
+	notification := snmpAlertFiring
+	if resolves(alert) {
+		notification = snmpAlertEnded
+	}
+	// sysUpTime is in hundredths of a second since the sink was enabled
+	uptime := uint32(time.Since(s.started) / (10 * time.Millisecond))
+
+	message := alert.Log.Message
+	if s.message != nil {
+		text, err := renderAlert(s.message, alert)
+		if err != nil {
+			return err
+		}
+		message = strings.TrimSpace(string(text))
+	}
+	trap := gosnmp.SnmpTrap{Variables: s.variables(alert, message), IsInform: s.inform}
+	if s.client.Version == gosnmp.Version1 {
+		// RFC 3584: the enterprise is the root and the specific trap the
+		// last identifier of the notification
+		trap.Enterprise = s.oid
+		trap.AgentAddress = s.agent
+		trap.GenericTrap = 6
+		trap.SpecificTrap = notification
+		trap.Timestamp = uint(uptime)
+	} else {
+		trap.Variables = append([]gosnmp.SnmpPDU{
+			{Name: snmpSysUpTime, Type: gosnmp.TimeTicks, Value: uptime},
+			{Name: snmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: fmt.Sprintf("%s.0.%d", s.oid, notification)},
+		}, trap.Variables...)
+	}
+	_, err := s.client.SendTrap(trap)
+	return err
+}
+
+// variables returns the objects of the Argos MIB describing an alert
+func (s *snmpSink) variables(alert analyzer.Alert, message string) []gosnmp.SnmpPDU {
+	object := func(id int) string {
+		return fmt.Sprintf("%s.1.%d.0", s.oid, id)
+	}
+	str := func(id int, value string) gosnmp.SnmpPDU {
+		return gosnmp.SnmpPDU{Name: object(id), Type: gosnmp.OctetString, Value: parser.Clip(value, snmpMaxString)}
+	}
+
+	key := ""
+	if k, ok := alert.Metadata["key"]; ok {
+		key = fmt.Sprint(k)
+	}
+	return []gosnmp.SnmpPDU{
+		{Name: object(snmpAlertSeverity), Type: gosnmp.Integer, Value: severityRank(alert.Severity) + 1},
+		str(snmpAlertRule, alert.Reason),
+		str(snmpAlertSource, alert.Log.Source),
+		str(snmpAlertMessage, message),
+		{Name: object(snmpAlertScore), Type: gosnmp.Integer, Value: int(math.Round(math.Max(0, math.Min(100, alert.Score))))},
+		str(snmpAlertFingerprint, alert.Fingerprint),
+		str(snmpAlertIncident, alert.IncidentID),
+		str(snmpAlertKey, key),
+		str(snmpAlertTime, alert.Timestamp),
+	}
+}
+
+// Stop implements SinkStopper, closing the socket
+func (s *snmpSink) Stop() {
+	s.client.Conn.Close()
+}
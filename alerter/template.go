@@ -0,0 +1,90 @@
+package alerter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// templateFuncs are the functions available to alert templates
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"truncate": func(n int, s string) string {
+		return parser.Truncate(s, n)
+	},
+	"resolved": resolves,
+	"join": func(sep string, v []string) string {
+		return strings.Join(v, sep)
+	},
+	"formatTime": func(layout, ts string) string {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return ts
+		}
+		return t.Format(layout)
+	},
+	"severityColor": func(severity string) string {
+		return severityColors[strings.ToUpper(severity)]
+	},
+}
+
+// alertTemplate renders alerts, as a text or HTML template
+type alertTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// newAlertTemplate parses the template of a sink, returning nil when none
+// is configured
+func newAlertTemplate(sink string, cfg config.AlertFormat) (alertTemplate, error) {
+	text := cfg.Template
+	if cfg.TemplateFile != "" {
+		if text != "" {
+			return nil, fmt.Errorf("%s sets both template and template_file", sink)
+		}
+		data, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s template: %w", sink, err)
+		}
+		text = string(data)
+	}
+	if text == "" {
+		return nil, nil
+	}
+
+	if cfg.HTML {
+		t, err := htmltemplate.New(sink).Funcs(htmltemplate.FuncMap(templateFuncs)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", sink, err)
+		}
+		return t, nil
+	}
+	t, err := template.New(sink).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", sink, err)
+	}
+	return t, nil
+}
+
+// renderAlert executes a template with an alert
+func renderAlert(t alertTemplate, alert analyzer.Alert) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, alert); err != nil {
+		return nil, fmt.Errorf("failed to render alert: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+package alerter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+)
+
+// defaultWebhookTimeout bounds each webhook request when no timeout is
+// configured
+const defaultWebhookTimeout = 10 * time.Second
+
+// webhookSignatureHeader carries the HMAC-SHA256 signature of a webhook
+// body, like GitHub's X-Hub-Signature-256
+const webhookSignatureHeader = "X-Argos-Signature"
+
+// webhookSink sends alerts to an HTTP endpoint, with a body rendered from
+// a template so that any tool accepting HTTP requests can receive them
+type webhookSink struct {
+	label  string
+	url    string
+	method string
+	header http.Header
+	body   *template.Template
+	secret []byte
+	client *http.Client
+}
+
+// newWebhookSink creates a sink sending alerts to an HTTP endpoint
+func newWebhookSink(cfg config.Webhook) (Sink, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webhook url is required")
+	}
+	s := &webhookSink{
+		label:  cfg.Name,
+		url:    cfg.URL,
+		method: strings.ToUpper(cfg.Method),
+		header: make(http.Header),
+		secret: []byte(cfg.Secret),
+		client: &http.Client{Timeout: time.Duration(cfg.Timeout)},
+	}
+	if s.label == "" {
+		s.label = "webhook " + cfg.URL
+	}
+	if s.method == "" {
+		s.method = http.MethodPost
+	}
+	for name, value := range cfg.Headers {
+		s.header.Set(name, value)
+	}
+	if s.header.Get("Content-Type") == "" {
+		s.header.Set("Content-Type", "application/json")
+	}
+	if cfg.Body != "" {
+		var err error
+		s.body, err = template.New(s.label).Funcs(templateFuncs).Parse(cfg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body template of %s: %w", s.label, err)
+		}
+	}
+	if s.client.Timeout <= 0 {
+		s.client.Timeout = defaultWebhookTimeout
+	}
+	return s, nil
+}
+
+// Name implements Sink
+func (s *webhookSink) Name() string {
+	return s.label
+}
+
+// Send renders the body of an alert and sends it to the endpoint
+func (s *webhookSink) Send(alert analyzer.Alert) error {
+	var body []byte
+	if s.body == nil {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		body = data
+	} else {
+		var buf bytes.Buffer
+		if err := s.body.Execute(&buf, alert); err != nil {
+			return fmt.Errorf("failed to render body: %w", err)
+		}
+		body = buf.Bytes()
+	}
+	header := s.header
+	if len(s.secret) > 0 {
+		header = header.Clone()
+		header.Set(webhookSignatureHeader, signWebhook(s.secret, body))
+	}
+	return sendHTTP(s.Name(), s.client, s.method, s.url, header, body)
+}
+
+// signWebhook returns the signature of a body: sha256= followed by the hex
+// HMAC-SHA256 of the body keyed with the secret
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
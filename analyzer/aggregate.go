@@ -0,0 +1,328 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// Aggregator defaults
+const (
+	defaultAggregateWindow = 5 * time.Minute
+
+	// aggregateMaxHits bounds the detections kept per key, and
+	// aggregateMaxValues the distinct values listed in an alert
+	aggregateMaxHits   = 1000
+	aggregateMaxValues = 20
+
+	// aggregatePruneInterval is how often idle keys are dropped
+	aggregatePruneInterval = time.Minute
+)
+
+// AggregatorSpec turns a rule into an aggregator, fed by the detections of
+// the rules naming it in their aggregate field instead of alerting on
+// them. Type "count" fires once Threshold detections share a key within
+// the window, "distinct" once Threshold distinct values of Field (default
+// "rule", the name of the detecting rule) do, and "sequence" once rules
+// named in Steps detect in that order for a key.
+type AggregatorSpec struct {
+	Type      string   `json:"type"`
+	Threshold int      `json:"threshold"`
+	Field     string   `json:"field"`
+	Steps     []string `json:"steps"`
+}
+
+// aggregateHit is one detection fed to an aggregator
+type aggregateHit struct {
+	at    time.Time
+	rule  string
+	value string
+}
+
+// aggregateKey is what an aggregator has seen of one key
+type aggregateKey struct {
+	hits    []aggregateHit
+	fired   bool
+	step    int
+	started time.Time
+	lastLog parser.ParsedLog
+}
+
+// aggregator collects detections of other rules per key and alerts on
+// them as a whole, e.g. when three different rules flag the same source
+// within five minutes
+type aggregator struct {
+	name      string
+	severity  string
+	kind      string
+	keyField  string
+	field     string
+	window    time.Duration
+	threshold int
+	steps     []string
+	mu        sync.Mutex
+	keys      map[string]*aggregateKey
+	lastPrune time.Time
+}
+
+// compileAggregatorRule compiles a rule spec declaring an aggregator
+func compileAggregatorRule(spec RuleSpec) (Rule, error) {
+	if len(spec.Match) > 0 || spec.Script != "" || len(spec.Sequence) > 0 || spec.Threshold > 0 || spec.SpikeFactor > 0 || spec.Distinct != "" || spec.Counter != "" || spec.Percentile != nil || len(spec.Join) > 0 || spec.Heartbeat != nil || spec.AutoThreshold != nil || spec.Suppress || spec.Aggregate != "" {
+		return Rule{}, fmt.Errorf("aggregators only take a key, a window and their aggregator settings")
+	}
+
+	severity := strings.ToUpper(spec.Severity)
+	if severity == "" {
+		severity = "HIGH"
+	}
+
+	cfg := spec.Aggregator
+	ag := &aggregator{
+		name:      spec.Name,
+		severity:  severity,
+		kind:      strings.ToLower(cfg.Type),
+		keyField:  spec.Key,
+		field:     cfg.Field,
+		window:    time.Duration(spec.Window),
+		threshold: cfg.Threshold,
+		steps:     cfg.Steps,
+		keys:      make(map[string]*aggregateKey),
+	}
+	if ag.window <= 0 {
+		ag.window = defaultAggregateWindow
+	}
+	switch ag.kind {
+	case "count", "distinct":
+		if ag.threshold <= 0 {
+			return Rule{}, fmt.Errorf("%s aggregators need a threshold", ag.kind)
+		}
+		if len(ag.steps) > 0 {
+			return Rule{}, fmt.Errorf("only sequence aggregators take steps")
+		}
+		if ag.kind == "distinct" && ag.field == "" {
+			ag.field = "rule"
+		}
+	case "sequence":
+		if len(ag.steps) < 2 {
+			return Rule{}, fmt.Errorf("sequence aggregators need at least two steps")
+		}
+		if ag.threshold > 0 || ag.field != "" {
+			return Rule{}, fmt.Errorf("sequence aggregators only take steps")
+		}
+	default:
+		return Rule{}, fmt.Errorf("unknown aggregator type %q", cfg.Type)
+	}
+
+	return Rule{
+		Name:     spec.Name,
+		Severity: severity,
+		Window:   ag.window,
+		Weight:   spec.Weight,
+		Priority: spec.Priority,
+		KeyField: spec.Key,
+		Check: func(parser.ParsedLog) bool {
+			return false
+		},
+		aggregator: ag,
+	}, nil
+}
+
+// linkAggregators points the rules that feed an aggregator at it, checking
+// that sequence steps name rules that feed their aggregator
+func linkAggregators(rules []Rule, specs []RuleSpec) error {
+	aggregators := make(map[string]*aggregator)
+	for _, rule := range rules {
+		if rule.aggregator != nil {
+			aggregators[rule.Name] = rule.aggregator
+		}
+	}
+
+	feeders := make(map[*aggregator]map[string]bool)
+	for i, spec := range specs {
+		if spec.Aggregate == "" {
+			continue
+		}
+		ag, ok := aggregators[spec.Aggregate]
+		if !ok {
+			return fmt.Errorf("rule %q: unknown aggregator %q", spec.Name, spec.Aggregate)
+		}
+		rules[i].feeds = ag
+		if feeders[ag] == nil {
+			feeders[ag] = make(map[string]bool)
+		}
+		feeders[ag][spec.Name] = true
+	}
+
+	for name, ag := range aggregators {
+		for _, step := range ag.steps {
+			if !feeders[ag][step] {
+				return fmt.Errorf("rule %q: step %q is not a rule feeding the aggregator", name, step)
+			}
+		}
+	}
+	return nil
+}
+
+// add feeds a detection of a rule to the aggregator at now and returns
+// the alerts it raises
+func (ag *aggregator) add(rule string, alert Alert, now time.Time) []Alert {
+	key := keyValue(alert.Log, ag.keyField)
+	value := rule
+	if ag.field != "" && ag.field != "rule" {
+		value = keyValue(alert.Log, ag.field)
+	}
+
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	if now.Sub(ag.lastPrune) >= aggregatePruneInterval {
+		ag.prune(now)
+	}
+
+	k, ok := ag.keys[key]
+	if !ok {
+		k = &aggregateKey{}
+		ag.keys[key] = k
+	}
+	k.hits = append(k.hits, aggregateHit{at: now, rule: rule, value: value})
+	k.trim(now, ag.window)
+	k.lastLog = alert.Log
+
+	if ag.kind == "sequence" {
+		return ag.advance(key, k, rule, now)
+	}
+
+	n := len(k.hits)
+	if ag.kind == "distinct" {
+		n = len(k.distinct())
+	}
+	if n < ag.threshold {
+		k.fired = false
+		return nil
+	}
+	if k.fired {
+		return nil
+	}
+	k.fired = true
+
+	metadata := ag.metadata(key, k)
+	metadata["threshold"] = ag.threshold
+	if ag.kind == "distinct" {
+		values := k.distinct()
+		metadata["distinct"] = len(values)
+		metadata["values"] = values[:min(len(values), aggregateMaxValues)]
+	}
+	return []Alert{ag.alert(k, now, metadata)}
+}
+
+// advance moves a key through the steps of a sequence aggregator
+func (ag *aggregator) advance(key string, k *aggregateKey, rule string, now time.Time) []Alert {
+	if k.step > 0 && now.Sub(k.started) > ag.window {
+		k.step = 0
+	}
+	if rule != ag.steps[k.step] {
+		return nil
+	}
+	if k.step == 0 {
+		k.started = now
+	}
+	k.step++
+	if k.step < len(ag.steps) {
+		return nil
+	}
+
+	k.step = 0
+	metadata := ag.metadata(key, k)
+	metadata["steps"] = ag.steps
+	metadata["started"] = k.started.Format(time.RFC3339)
+	metadata["duration"] = now.Sub(k.started).Round(time.Millisecond).String()
+	return []Alert{ag.alert(k, now, metadata)}
+}
+
+// metadata returns what every aggregator alert reports about a key
+func (ag *aggregator) metadata(key string, k *aggregateKey) map[string]interface{} {
+	rules := make(map[string]bool)
+	for _, hit := range k.hits {
+		rules[hit.rule] = true
+	}
+	return map[string]interface{}{
+		"rule_name":  ag.name,
+		"aggregator": ag.kind,
+		"key":        key,
+		"window":     ag.window.String(),
+		"detections": len(k.hits),
+		"rules":      setKeys(rules),
+	}
+}
+
+// alert builds an aggregator alert on the latest log fed for a key
+func (ag *aggregator) alert(k *aggregateKey, now time.Time, metadata map[string]interface{}) Alert {
+	return Alert{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  ag.severity,
+		Reason:    ag.name,
+		Log:       k.lastLog,
+		Metadata:  metadata,
+	}
+}
+
+// trim drops detections that fell out of the window, and the oldest ones
+// beyond the bound
+func (k *aggregateKey) trim(now time.Time, window time.Duration) {
+	drop := 0
+	for drop < len(k.hits) && now.Sub(k.hits[drop].at) > window {
+		drop++
+	}
+	drop = max(drop, len(k.hits)-aggregateMaxHits)
+	if drop > 0 {
+		k.hits = append(k.hits[:0], k.hits[drop:]...)
+	}
+}
+
+// distinct returns the distinct values of a key's detections, sorted
+func (k *aggregateKey) distinct() []string {
+	values := make(map[string]bool)
+	for _, hit := range k.hits {
+		values[hit.value] = true
+	}
+	return setKeys(values)
+}
+
+// prune drops keys without detections in the window or a sequence in
+// progress
+func (ag *aggregator) prune(now time.Time) {
+	for key, k := range ag.keys {
+		k.trim(now, ag.window)
+		if len(k.hits) == 0 && (k.step == 0 || now.Sub(k.started) > ag.window) {
+			delete(ag.keys, key)
+		}
+	}
+	ag.lastPrune = now
+}
+
+// feed hands an alert of a rule to the aggregator it feeds instead of
+// sending it, and sends what the aggregator raises, returning false on
+// shutdown
+func (a *Analyzer) feed(rules []Rule, rule Rule, alert Alert, now time.Time) bool {
+	for _, target := range rules {
+		if target.aggregator != rule.feeds {
+			continue
+		}
+		if a.isDisabled(target.ID) {
+			return true
+		}
+		for _, out := range target.aggregator.add(rule.Name, alert, now) {
+			a.scorer.score(&out, target.weight())
+			a.enrich(target, &out, now)
+			ruleMetricsFor(target.Name).alerts.Add(1)
+			if !a.send(out, now) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
@@ -2,12 +2,17 @@ package analyzer
 
 import (
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/davidharvith/argos/parser"
 )
 
+// windowPruneInterval is how often idle window counters are dropped
+const windowPruneInterval = 10 * time.Second
+
 // Alert represents a detected anomaly
 type Alert struct {
 	Timestamp string                 `json:"timestamp"`
@@ -15,37 +20,178 @@ type Alert struct {
 	Reason    string                 `json:"reason"`
 	Log       parser.ParsedLog       `json:"log"`
 	Metadata  map[string]interface{} `json:"metadata"`
+	
+	// Fingerprint identifies the rule and key the alert is about, so that
+	// repeats of the same alert can be recognized
+	Fingerprint string `json:"fingerprint"`
+	
+	// Score ranks the alert from 0 to 100 by rule weight, frequency,
+	// novelty and source criticality
+	Score float64 `json:"score"`
+	
+	// IncidentID is the incident the alert was grouped into, when
+	// incident correlation is enabled
+	IncidentID string `json:"incident_id,omitempty"`
 }
 
 // Rule defines an anomaly detection rule
 type Rule struct {
+	ID        string
 	Name      string
 	Check     func(parser.ParsedLog) bool
 	Severity  string
+	Window    time.Duration
+	
+	// Weight is the base score of the rule's alerts, by default derived
+	// from its severity
+	Weight    float64
+	
+	// Threshold, when positive, makes the rule fire only once at least
+	// Threshold matches share a key within Window. KeyField names the field
+	// the matches are grouped by and defaults to source; matches without
+	// the field are not counted.
+	Threshold int
+	KeyField  string
+	
+	// SpikeFactor, when positive, makes the rule fire when a key's count in
+	// the current Window exceeds the previous window's count by this factor.
+	// Threshold then sets the minimum count for a spike.
+	SpikeFactor float64
+	
+	// SketchError, when positive, counts matches of all keys in a
+	// Count-Min Sketch instead of one counter per key, bounding memory for
+	// high-cardinality keys such as client IPs. Counts may overestimate by
+	// up to SketchError times the matches in the window, with probability
+	// SketchConfidence.
+	SketchError      float64
+	SketchConfidence float64
+	
+	// DistinctField, when set, makes the rule count the distinct values of
+	// this field per key instead of matches, estimated with HyperLogLog.
+	// The rule fires when the count reaches Threshold, or with SpikeFactor
+	// when it exceeds the previous window's by that factor.
+	DistinctField string
+	
+	// Priority orders evaluation, higher first; rules of equal priority keep
+	// their order. Stop ends evaluation of further rules for a log once this
+	// rule matches it.
+	Priority int
+	Stop     bool
+	
+	// Suppress marks an allow-list rule. Logs it matches are checked before
+	// any other rule and raise no alerts, from rules or detectors.
+	Suppress bool
+	
+	// Evaluate, when set, is used instead of Check by rules that raise
+	// their own alerts, such as scripted rules. It reports whether the rule
+	// matched and returns any additional alerts it emitted.
+	Evaluate  func(parser.ParsedLog, time.Time) (bool, []Alert)
+	
+	// Enrich runs on every alert of the rule before it is sent, adding
+	// context to its metadata
+	Enrich []Enricher
+	
+	// Labels are added to the rule's alerts as the labels metadata
+	Labels map[string]string
+	
+	// recentLogs is how many recent lines per source the rule's enrichers
+	// need
+	recentLogs int
+	
+	// sequence is the state machine of a sequence rule, kept so that its
+	// progress can be saved across restarts
+	sequence *sequenceRule
+	
+	// percentile is the per-key state of a percentile rule, kept so that
+	// its quantiles can be reported
+	percentile *percentileRule
+	
+	// auto, when set, tunes Threshold from the history of window counts
+	auto *autoThresholdConfig
+	
+	// heartbeat is the state of a heartbeat rule, checked periodically for
+	// heartbeats that are overdue
+	heartbeat *heartbeatRule
+	
+	// aggregator is the state of an aggregator rule, and feeds the
+	// aggregator the rule's detections go to instead of alerting
+	aggregator *aggregator
+	feeds      *aggregator
+}
+
+// key returns the value a rule groups its matches by
+func (r Rule) key(log parser.ParsedLog) string {
+	return keyValue(log, r.KeyField)
+}
+
+// weight returns the base score of the rule's alerts
+func (r Rule) weight() float64 {
+	if r.Weight > 0 {
+		return r.Weight
+	}
+	return severityWeight(r.Severity)
+}
+
+// evaluate runs a rule against a log seen at now
+func (r Rule) evaluate(log parser.ParsedLog, now time.Time) (bool, []Alert) {
+	if r.Evaluate != nil {
+		return r.Evaluate(log, now)
+	}
+	return r.Check(log), nil
 }
 
 // Analyzer processes parsed logs and detects anomalies
 type Analyzer struct {
-	inputChan    <-chan parser.ParsedLog
-	alertChan    chan<- Alert
-	rules        []Rule
-	bloomFilter  *BloomFilter
-	windowCount  map[string]int
-	windowMutex  sync.RWMutex
-	windowSize   time.Duration
-	shutdown     chan struct{}
-	wg           sync.WaitGroup
+	inputChan     <-chan []parser.ParsedLog
+	alertChan     chan<- Alert
+	rules         atomic.Pointer[[]Rule]
+	rulesPath     string
+	configRules   []Rule
+	disabled      atomic.Pointer[map[string]bool]
+	overridesPath string
+	overridesMu   sync.Mutex
+	bloomFilter   *BloomFilter
+	bloomMutex    sync.Mutex
+	windows       map[string]map[string]*slidingCounter
+	spikes        map[string]map[string]*spikeCounter
+	sketches      map[string]*slidingSketch
+	distincts     map[string]map[string]*distinctCounter
+	thresholds    map[string]*autoThreshold
+	windowMutex   sync.RWMutex
+	windowSize    time.Duration
+	detectors     []Detector
+	shards        []chan []parser.ParsedLog
+	shardKey      string
+	dedup         *alertDeduper
+	suppressor    *alertSuppressor
+	sampler       *alertSampler
+	tally         ruleTally
+	incidents     *incidentCorrelator
+	summary       *summaryCollector
+	maintenance   *maintenanceSchedule
+	recent        recentLogs
+	scorer        scorer
+	statePath     string
+	stateInterval time.Duration
+	replayClock   replayClock
+	shutdown      chan struct{}
+	wg            sync.WaitGroup
 }
 
 // NewAnalyzer creates a new Analyzer instance
-func NewAnalyzer(inputChan <-chan parser.ParsedLog, alertChan chan<- Alert) *Analyzer {
+func NewAnalyzer(inputChan <-chan []parser.ParsedLog, alertChan chan<- Alert) *Analyzer {
 	a := &Analyzer{
 		inputChan:   inputChan,
 		alertChan:   alertChan,
 		bloomFilter: NewBloomFilter(100000, 3),
-		windowCount: make(map[string]int),
+		windows:     make(map[string]map[string]*slidingCounter),
+		spikes:      make(map[string]map[string]*spikeCounter),
+		sketches:    make(map[string]*slidingSketch),
+		distincts:   make(map[string]map[string]*distinctCounter),
+		thresholds:  make(map[string]*autoThreshold),
 		windowSize:  time.Minute,
 		shutdown:    make(chan struct{}),
+		tally:       ruleTally{rules: make(map[string]*ruleEffectiveness)},
 	}
 	
 	// Initialize default rules
@@ -56,7 +202,13 @@ func NewAnalyzer(inputChan <-chan parser.ParsedLog, alertChan chan<- Alert) *Ana
 
 // initializeRules sets up the default anomaly detection rules
 func (a *Analyzer) initializeRules() {
-	a.rules = []Rule{
+	a.SetRules(BuiltinRules())
+}
+
+// BuiltinRules returns the rules used when no rules file is configured
+func BuiltinRules() []Rule {
+	security, _ := keywordListNamed("security")
+	return []Rule{
 		{
 			Name: "Critical Error Level",
 			Check: func(log parser.ParsedLog) bool {
@@ -74,12 +226,9 @@ func (a *Analyzer) initializeRules() {
 		{
 			Name: "Suspicious Keywords",
 			Check: func(log parser.ParsedLog) bool {
-				suspiciousWords := []string{"attack", "breach", "unauthorized", "exploit", "malicious"}
 				for _, kw := range log.Keywords {
-					for _, sw := range suspiciousWords {
-						if kw == sw {
-							return true
-						}
+					if security.contains(kw) {
+						return true
 					}
 				}
 				return false
@@ -91,16 +240,98 @@ func (a *Analyzer) initializeRules() {
 			Check: func(log parser.ParsedLog) bool {
 				return log.Level == "ERROR"
 			},
-			Severity: "MEDIUM",
+			Severity:  "MEDIUM",
+			Threshold: 10,
 		},
 	}
 }
 
+// SetRules atomically replaces the active rule set, e.g. with rules loaded
+// by LoadRules, ordered by priority. Window counters of rules that keep
+// their name are preserved.
+func (a *Analyzer) SetRules(rules []Rule) {
+	sorted := append([]Rule(nil), rules...)
+	for i := range sorted {
+		if sorted[i].ID == "" {
+			sorted[i].ID = RuleID(sorted[i].Name)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	
+	// Keep as many recent lines as the most demanding enricher needs
+	depth := 0
+	for _, rule := range sorted {
+		depth = max(depth, rule.recentLogs)
+	}
+	a.recent.setDepth(depth)
+	
+	// Reloaded heartbeat rules keep the heartbeats seen so far
+	if previous := a.rules.Load(); previous != nil {
+		for _, rule := range sorted {
+			if rule.heartbeat == nil {
+				continue
+			}
+			for _, old := range *previous {
+				if old.Name == rule.Name && old.heartbeat != nil && old.heartbeat != rule.heartbeat {
+					rule.heartbeat.inherit(old.heartbeat)
+				}
+			}
+		}
+	}
+	a.rules.Store(&sorted)
+}
+
+// Rules returns the active rule set
+func (a *Analyzer) Rules() []Rule {
+	return *a.rules.Load()
+}
+
+// ruleWindow returns the counting window of a rule
+func (a *Analyzer) ruleWindow(rule Rule) time.Duration {
+	if rule.Window > 0 {
+		return rule.Window
+	}
+	return a.windowSize
+}
+
 // Start begins the analyzer
 func (a *Analyzer) Start() {
-	a.wg.Add(2)
+	a.wg.Add(4)
 	go a.analyze()
 	go a.cleanupWindow()
+	go a.checkPercentiles()
+	go a.checkHeartbeats()
+	if len(a.detectors) > 0 {
+		a.startDetectors()
+		a.wg.Add(1)
+		go a.runDetectors()
+	}
+	for _, shard := range a.shards {
+		a.wg.Add(1)
+		go a.work(shard)
+	}
+	if a.dedup != nil {
+		a.wg.Add(1)
+		go a.flushDedup()
+	}
+	if a.sampler != nil {
+		a.wg.Add(1)
+		go a.flushSampling()
+	}
+	if a.incidents != nil {
+		a.wg.Add(1)
+		go a.flushIncidents()
+	}
+	if a.summary != nil {
+		a.wg.Add(1)
+		go a.sendSummaries()
+	}
+	if a.rulesPath != "" {
+		a.wg.Add(1)
+		go a.watchRules()
+	}
 	log.Println("Analyzer started")
 }
 
@@ -108,71 +339,400 @@ func (a *Analyzer) Start() {
 func (a *Analyzer) analyze() {
 	defer a.wg.Done()
 	
+	// Snapshots are taken between batches
+	var snapshots <-chan time.Time
+	if a.statePath != "" {
+		ticker := time.NewTicker(a.stateInterval)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
+	
 	for {
 		select {
-		case logEntry, ok := <-a.inputChan:
+		case batch, ok := <-a.inputChan:
 			if !ok {
 				return
 			}
-			a.processLog(logEntry)
+			if !a.process(batch) {
+				return
+			}
+		case <-snapshots:
+			if err := a.saveState(); err != nil {
+				log.Printf("Failed to save analyzer state: %v", err)
+			}
 		case <-a.shutdown:
 			return
 		}
 	}
 }
 
-// processLog checks a log against all rules and generates alerts
+// processLog feeds a log to the detectors and checks it against all rules
 func (a *Analyzer) processLog(logEntry parser.ParsedLog) {
-	for _, rule := range a.rules {
-		if rule.Check(logEntry) {
-			// Check if we've seen similar patterns recently
-			bloomKey := rule.Name + ":" + logEntry.Source
-			isKnownPattern := a.bloomFilter.Contains(bloomKey)
-			a.bloomFilter.Add(bloomKey)
-			
-			// Track frequency in time window
-			a.windowMutex.Lock()
-			countKey := rule.Name + ":" + logEntry.Source
-			a.windowCount[countKey]++
-			count := a.windowCount[countKey]
-			a.windowMutex.Unlock()
-			
-			// Create alert
-			alert := Alert{
-				Timestamp: time.Now().Format(time.RFC3339),
-				Severity:  rule.Severity,
-				Reason:    rule.Name,
-				Log:       logEntry,
-				Metadata: map[string]interface{}{
-					"is_known_pattern": isKnownPattern,
-					"count_in_window":  count,
-					"rule_name":        rule.Name,
-				},
+	metrics.Add(metricProcessed, 1)
+	a.ProcessAt(logEntry, time.Now())
+}
+
+// replayClock is when the periodic checks last ran on replayed time
+type replayClock struct {
+	detectors   time.Time
+	heartbeats  time.Time
+	percentiles time.Time
+}
+
+// TickAt runs the periodic checks of a live analyzer on replayed time:
+// detector ticks, missed heartbeats and ended percentile windows, each once
+// its interval has passed since it last ran. Offline replays call it before
+// each ProcessAt. The first call counts heartbeats from now.
+func (a *Analyzer) TickAt(now time.Time) {
+	c := &a.replayClock
+	if c.heartbeats.IsZero() {
+		for _, rule := range a.Rules() {
+			if rule.heartbeat != nil {
+				rule.heartbeat.startAt(now)
 			}
-			
-			select {
-			case a.alertChan <- alert:
-			case <-a.shutdown:
+		}
+		c.detectors, c.heartbeats, c.percentiles = now, now, now
+	}
+	if now.Sub(c.detectors) >= detectorTick {
+		c.detectors = now
+		if !a.tickDetectors(now) {
+			return
+		}
+	}
+	if now.Sub(c.heartbeats) >= heartbeatCheckInterval {
+		c.heartbeats = now
+		if !a.heartbeatsDue(now) {
+			return
+		}
+	}
+	if now.Sub(c.percentiles) >= percentileCheckInterval {
+		c.percentiles = now
+		a.percentilesDue(now)
+	}
+}
+
+// ProcessAt checks a log as if it arrived at now, so recorded logs can be
+// replayed offline on their own timestamps. Alerts are sent to the alert
+// channel, which the caller must drain.
+func (a *Analyzer) ProcessAt(logEntry parser.ParsedLog, now time.Time) {
+	rules := a.Rules()
+	suppressed := a.isSuppressed(rules, logEntry)
+	a.recent.add(logEntry, now)
+	if a.summary != nil {
+		a.summary.observe(logEntry, now)
+	}
+	
+	// Detectors see suppressed logs too, so baselines stay accurate
+	for _, d := range a.detectors {
+		alerts := d.Observe(logEntry, now)
+		if suppressed {
+			continue
+		}
+		for _, alert := range alerts {
+			if !a.send(alert, now) {
+				return
+			}
+		}
+	}
+	if suppressed {
+		return
+	}
+	
+	for _, rule := range rules {
+		if rule.Suppress || rule.aggregator != nil || a.isDisabled(rule.ID) {
+			continue
+		}
+		stats := ruleMetricsFor(rule.Name)
+		start := time.Now()
+		matched, emitted := rule.evaluate(logEntry, now)
+		stats.nanos.Add(int64(time.Since(start)))
+		stats.evaluations.Add(1)
+		stats.alerts.Add(int64(len(emitted)))
+		for _, alert := range emitted {
+			if rule.feeds != nil {
+				if !a.feed(rules, rule, alert, now) {
+					return
+				}
+				continue
+			}
+			weight := severityWeight(alert.Severity)
+			if rule.Weight > 0 {
+				weight = rule.Weight
+			}
+			a.scorer.score(&alert, weight)
+			a.enrich(rule, &alert, now)
+			if !a.send(alert, now) {
 				return
 			}
 		}
+		if !matched {
+			if rule.Stop && len(emitted) > 0 {
+				return
+			}
+			continue
+		}
+		stats.matches.Add(1)
+		
+		// Track frequency and decide whether the rule fires
+		key := rule.key(logEntry)
+		var metadata map[string]interface{}
+		var fire bool
+		switch {
+		case key == "" && rule.KeyField != "":
+			// Logs without the key field have nothing to be counted under
+		case rule.DistinctField != "":
+			metadata, fire = a.trackDistinct(rule, key, keyValue(logEntry, rule.DistinctField), now)
+		default:
+			if rule.auto != nil {
+				rule.Threshold = a.autoThreshold(rule).observe(rule.Name, key, logEntry.RepeatCount, now, a.ruleWindow(rule))
+			}
+			metadata, fire = a.track(rule, key, logEntry.RepeatCount, now)
+			if fire && rule.auto != nil {
+				metadata["auto_threshold"] = true
+			}
+		}
+		if !fire {
+			if rule.Stop {
+				return
+			}
+			continue
+		}
+		
+		// Check if we've seen similar patterns recently
+		bloomKey := rule.Name + ":" + key
+		a.bloomMutex.Lock()
+		isKnownPattern := a.bloomFilter.Contains(bloomKey)
+		a.bloomFilter.Add(bloomKey)
+		a.bloomMutex.Unlock()
+		
+		// Create alert
+		alert := Alert{
+			Timestamp: now.Format(time.RFC3339),
+			Severity:  rule.Severity,
+			Reason:    rule.Name,
+			Log:       logEntry,
+			Metadata:  metadata,
+		}
+		alert.Metadata["is_known_pattern"] = isKnownPattern
+		alert.Metadata["rule_name"] = rule.Name
+		if rule.feeds != nil {
+			if !a.feed(rules, rule, alert, now) || rule.Stop {
+				return
+			}
+			continue
+		}
+		a.scorer.score(&alert, rule.weight())
+		a.enrich(rule, &alert, now)
+		stats.alerts.Add(1)
+		
+		if !a.send(alert, now) || rule.Stop {
+			return
+		}
+	}
+}
+
+// isSuppressed reports whether any enabled suppression rule matches a log
+func (a *Analyzer) isSuppressed(rules []Rule, logEntry parser.ParsedLog) bool {
+	for _, rule := range rules {
+		if rule.Suppress && !a.isDisabled(rule.ID) && rule.Check(logEntry) {
+			a.tally.suppressed(rule.Name)
+			return true
+		}
+	}
+	return false
+}
+
+// track counts a rule match in the rule's window and reports whether the
+// rule fires, along with the counts to attach to the alert
+func (a *Analyzer) track(rule Rule, key string, n int, now time.Time) (map[string]interface{}, bool) {
+	window := a.ruleWindow(rule)
+	
+	a.windowMutex.Lock()
+	defer a.windowMutex.Unlock()
+	
+	if rule.SpikeFactor > 0 {
+		counters, ok := a.spikes[rule.Name]
+		if !ok {
+			counters = make(map[string]*spikeCounter)
+			a.spikes[rule.Name] = counters
+		}
+		counter, ok := counters[key]
+		if !ok || counter.window != window {
+			counter = newSpikeCounter(window, now)
+			counters[key] = counter
+		}
+		current, previous := counter.add(now, n)
+		
+		// Fire once per window, when the count first exceeds the limit
+		limit := rule.SpikeFactor * float64(max(previous, 1))
+		if float64(current) <= limit || float64(current-n) > limit || current < rule.Threshold {
+			return nil, false
+		}
+		return map[string]interface{}{
+			"count_in_window": current,
+			"previous_count":  previous,
+			"spike_factor":    rule.SpikeFactor,
+			"window":          window.String(),
+			"key":             key,
+		}, true
+	}
+	
+	var count int
+	if rule.SketchError > 0 {
+		sketch, ok := a.sketches[rule.Name]
+		if !ok || sketch.window != window {
+			sketch = newSlidingSketch(window, rule.SketchError, rule.SketchConfidence, now)
+			a.sketches[rule.Name] = sketch
+		}
+		count = sketch.add(key, now, n)
+	} else {
+		counters, ok := a.windows[rule.Name]
+		if !ok {
+			counters = make(map[string]*slidingCounter)
+			a.windows[rule.Name] = counters
+		}
+		counter, ok := counters[key]
+		if !ok || counter.window != window {
+			counter = newSlidingCounter(window, now)
+			counters[key] = counter
+		}
+		count = counter.add(now, n)
+	}
+	
+	// Threshold rules fire when the count crosses the threshold and re-arm
+	// once it decays below it again
+	if rule.Threshold > 0 && (count < rule.Threshold || count-n >= rule.Threshold) {
+		return nil, false
+	}
+	
+	metadata := map[string]interface{}{
+		"count_in_window": count,
+	}
+	if rule.SketchError > 0 {
+		metadata["approximate"] = true
+	}
+	if rule.Threshold > 0 {
+		metadata["threshold"] = rule.Threshold
+		metadata["window"] = window.String()
+		metadata["key"] = key
+	}
+	return metadata, true
+}
+
+// send fingerprints an alert raised at now and delivers it unless a
+// maintenance window covers it or it repeats one that is already firing,
+// returning false on shutdown
+func (a *Analyzer) send(alert Alert, now time.Time) bool {
+	if alert.Fingerprint == "" {
+		alert.Fingerprint = fingerprint(alert)
+	}
+	if alert.Score == 0 {
+		a.scorer.score(&alert, severityWeight(alert.Severity))
+	}
+	if a.maintenance != nil && a.maintenance.silences(alert, now) {
+		a.tally.fired(alert.Reason, now, true)
+		metrics.Add(metricSilenced, 1)
+		return true
+	}
+	if a.summary != nil {
+		a.summary.fired(alert.Reason)
+	}
+	withheld := (a.suppressor != nil && !a.suppressor.admit(&alert, now)) ||
+		(a.dedup != nil && !a.dedup.admit(&alert, now))
+	if !withheld && a.sampler != nil && !a.sampler.admit(&alert, now) {
+		withheld = true
+		metrics.Add(metricSampled, 1)
+	}
+	a.tally.fired(alert.Reason, now, withheld)
+	if withheld {
+		return true
+	}
+	return a.deliver(alert, now)
+}
+
+// deliver groups an alert raised at now into its incident and hands it to
+// the alerter, returning false on shutdown
+func (a *Analyzer) deliver(alert Alert, now time.Time) bool {
+	if a.incidents != nil && alert.IncidentID == "" && !a.incidents.assign(&alert, now) {
+		return true
+	}
+	
+	select {
+	case a.alertChan <- alert:
+		metrics.Add(metricAlerts, 1)
+		return true
+	case <-a.shutdown:
+		metrics.Add(metricDropped, 1)
+		return false
 	}
 }
 
-// cleanupWindow periodically resets the time window counters
+// cleanupWindow periodically drops window counters that have decayed to
+// zero, and counters of rules that were removed
 func (a *Analyzer) cleanupWindow() {
 	defer a.wg.Done()
 	
-	ticker := time.NewTicker(a.windowSize)
+	ticker := time.NewTicker(windowPruneInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
-		case <-ticker.C:
+		case now := <-ticker.C:
+			active := make(map[string]bool)
+			sketched := make(map[string]bool)
+			tuned := make(map[string]bool)
+			for _, rule := range a.Rules() {
+				active[rule.Name] = true
+				sketched[rule.Name] = rule.SketchError > 0
+				tuned[rule.Name] = rule.auto != nil
+			}
+			
 			a.windowMutex.Lock()
-			a.windowCount = make(map[string]int)
+			for name, counters := range a.windows {
+				if !active[name] {
+					delete(a.windows, name)
+					continue
+				}
+				for key, counter := range counters {
+					if counter.count(now) == 0 {
+						delete(counters, key)
+					}
+				}
+			}
+			for name, counters := range a.spikes {
+				if !active[name] {
+					delete(a.spikes, name)
+					continue
+				}
+				for key, counter := range counters {
+					if counter.idle(now) {
+						delete(counters, key)
+					}
+				}
+			}
+			for name := range a.thresholds {
+				if !tuned[name] {
+					delete(a.thresholds, name)
+				}
+			}
+			for name := range a.sketches {
+				if !sketched[name] {
+					delete(a.sketches, name)
+				}
+			}
+			for name, counters := range a.distincts {
+				if !active[name] {
+					delete(a.distincts, name)
+					continue
+				}
+				for key, counter := range counters {
+					if counter.idle(now) {
+						delete(counters, key)
+					}
+				}
+			}
 			a.windowMutex.Unlock()
-			log.Println("Window counters reset")
+			a.recent.prune(now)
 		case <-a.shutdown:
 			return
 		}
@@ -183,5 +743,11 @@ func (a *Analyzer) cleanupWindow() {
 func (a *Analyzer) Stop() {
 	close(a.shutdown)
 	a.wg.Wait()
+	if a.statePath != "" {
+		if err := a.saveState(); err != nil {
+			log.Printf("Failed to save analyzer state: %v", err)
+		}
+	}
+	a.stopDetectors()
 	log.Println("Analyzer stopped")
 }
@@ -0,0 +1,237 @@
+package analyzer
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Auto threshold defaults
+const (
+	defaultAutoQuantile   = 0.995
+	defaultAutoHistory    = 7 * 24 * time.Hour
+	defaultAutoRecompute  = time.Hour
+	defaultAutoMinSamples = 100
+
+	// autoThresholdSlots is the number of digests the history is split
+	// into, the oldest being dropped as the history moves on
+	autoThresholdSlots = 24
+
+	// autoThresholdMaxKeys bounds the keys counted per window
+	autoThresholdMaxKeys = 10000
+)
+
+// autoThresholdConfig is how a threshold rule derives its threshold
+type autoThresholdConfig struct {
+	quantile   float64
+	history    time.Duration
+	recompute  time.Duration
+	min        int
+	minSamples int
+}
+
+// compileAutoThreshold applies the defaults of an auto threshold spec
+func compileAutoThreshold(spec *AutoThresholdSpec) (*autoThresholdConfig, error) {
+	cfg := &autoThresholdConfig{
+		quantile:   spec.Quantile,
+		history:    time.Duration(spec.History),
+		recompute:  time.Duration(spec.Recompute),
+		min:        spec.Min,
+		minSamples: spec.MinSamples,
+	}
+	if cfg.quantile == 0 {
+		cfg.quantile = defaultAutoQuantile
+	}
+	if cfg.quantile <= 0 || cfg.quantile >= 1 {
+		return nil, fmt.Errorf("auto threshold quantile must be between 0 and 1, e.g. 0.995")
+	}
+	if cfg.history <= 0 {
+		cfg.history = defaultAutoHistory
+	}
+	if cfg.recompute <= 0 {
+		cfg.recompute = defaultAutoRecompute
+	}
+	if cfg.min <= 0 {
+		cfg.min = 1
+	}
+	if cfg.minSamples <= 0 {
+		cfg.minSamples = defaultAutoMinSamples
+	}
+	return cfg, nil
+}
+
+// autoThreshold learns the distribution of a rule's per-key window counts
+// and sets the threshold just above the configured quantile of it. The
+// history is kept as a ring of digests, so counts older than the history
+// age out a slot at a time.
+type autoThreshold struct {
+	config      autoThresholdConfig
+	mu          sync.Mutex
+	threshold   int
+	counts      map[string]int
+	windowStart time.Time
+	slots       []*tDigest
+	head        int
+	slotStart   time.Time
+	computed    time.Time
+}
+
+// autoThresholdState is a saved autoThreshold
+type autoThresholdState struct {
+	Threshold int           `json:"threshold"`
+	Slots     []digestState `json:"slots"`
+	Head      int           `json:"head"`
+	SlotStart time.Time     `json:"slot_start"`
+	Computed  time.Time     `json:"computed"`
+}
+
+// newAutoThreshold starts learning from the rule's configured threshold
+func newAutoThreshold(cfg autoThresholdConfig, initial int) *autoThreshold {
+	t := &autoThreshold{
+		config:    cfg,
+		threshold: initial,
+		counts:    make(map[string]int),
+		slots:     make([]*tDigest, autoThresholdSlots),
+	}
+	for i := range t.slots {
+		t.slots[i] = newTDigest(0)
+	}
+	return t
+}
+
+// observe counts n matches of a key at now, closing the window when it has
+// passed, and returns the current threshold
+func (t *autoThreshold) observe(rule, key string, n int, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.windowStart.IsZero() {
+		t.windowStart = now
+	}
+	if t.slotStart.IsZero() {
+		t.slotStart = now
+		t.computed = now
+	}
+	if now.Sub(t.windowStart) >= window {
+		t.rotate(now)
+		for _, count := range t.counts {
+			t.slots[t.head].add(float64(count))
+		}
+		clear(t.counts)
+		t.windowStart = now
+	}
+	if _, ok := t.counts[key]; ok || len(t.counts) < autoThresholdMaxKeys {
+		t.counts[key] += n
+	}
+	if now.Sub(t.computed) >= t.config.recompute {
+		t.compute(rule)
+		t.computed = now
+	}
+	return t.threshold
+}
+
+// rotate moves to the slot covering now, dropping slots that fell out of
+// the history
+func (t *autoThreshold) rotate(now time.Time) {
+	slot := t.config.history / autoThresholdSlots
+	for i := 0; i < autoThresholdSlots && now.Sub(t.slotStart) >= slot; i++ {
+		t.head = (t.head + 1) % autoThresholdSlots
+		t.slots[t.head] = newTDigest(0)
+		t.slotStart = t.slotStart.Add(slot)
+	}
+	if now.Sub(t.slotStart) >= slot {
+		t.slotStart = now
+	}
+}
+
+// compute sets the threshold from the quantile of the counts in the
+// history, once there are enough of them
+func (t *autoThreshold) compute(rule string) {
+	merged := newTDigest(0)
+	for _, slot := range t.slots {
+		merged.merge(slot)
+	}
+	if merged.count < float64(t.config.minSamples) {
+		return
+	}
+
+	threshold := int(math.Floor(merged.quantile(t.config.quantile))) + 1
+	if threshold < t.config.min {
+		threshold = t.config.min
+	}
+	if threshold != t.threshold {
+		log.Printf("Rule %s threshold tuned from %d to %d (%s of %.0f windows)", rule, t.threshold, threshold, quantileName(t.config.quantile), merged.count)
+		t.threshold = threshold
+	}
+}
+
+// save returns the learned history and threshold
+func (t *autoThreshold) save() autoThresholdState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := autoThresholdState{
+		Threshold: t.threshold,
+		Head:      t.head,
+		SlotStart: t.slotStart,
+		Computed:  t.computed,
+	}
+	for _, slot := range t.slots {
+		s.Slots = append(s.Slots, slot.save())
+	}
+	return s
+}
+
+// restore loads a saved history, ignoring one of a different shape
+func (t *autoThreshold) restore(s autoThresholdState) {
+	if len(s.Slots) != autoThresholdSlots || s.Head < 0 || s.Head >= autoThresholdSlots {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, slot := range s.Slots {
+		t.slots[i] = restoreTDigest(slot, 0)
+	}
+	t.threshold = s.Threshold
+	t.head = s.Head
+	t.slotStart = s.SlotStart
+	t.computed = s.Computed
+}
+
+// autoThreshold returns the learned threshold of a rule, starting over
+// when the rule's auto threshold settings changed
+func (a *Analyzer) autoThreshold(rule Rule) *autoThreshold {
+	a.windowMutex.Lock()
+	defer a.windowMutex.Unlock()
+
+	t, ok := a.thresholds[rule.Name]
+	if !ok || t.config != *rule.auto {
+		t = newAutoThreshold(*rule.auto, rule.Threshold)
+		a.thresholds[rule.Name] = t
+	}
+	return t
+}
+
+// currentThreshold returns the threshold a rule fires at, as tuned so far
+// for rules with an auto threshold
+func (a *Analyzer) currentThreshold(rule Rule) int {
+	if rule.auto == nil {
+		return rule.Threshold
+	}
+
+	a.windowMutex.RLock()
+	t, ok := a.thresholds[rule.Name]
+	a.windowMutex.RUnlock()
+	if !ok {
+		return rule.Threshold
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.threshold
+}
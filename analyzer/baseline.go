@@ -0,0 +1,342 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Baseline detector defaults
+const (
+	defaultBaselineTraining  = time.Hour
+	defaultBaselineInterval  = time.Minute
+	defaultBaselineTolerance = 3.0
+
+	// baselineMinDropRate is the learned rate below which drops are ignored
+	baselineMinDropRate = 5.0
+
+	// baselineLevelShift is how far a level's share of an interval may rise
+	// above its learned share, and baselineMinLevelCount the interval volume
+	// needed before shares are compared
+	baselineLevelShift    = 0.3
+	baselineMinLevelCount = 5
+)
+
+// sourceBaseline is what was learned about one source, plus the counts of
+// the interval in progress
+type sourceBaseline struct {
+	learned   bool
+	total     int
+	rate      float64
+	levels    map[string]int
+	templates map[string]bool
+	count     int
+	current   map[string]int
+	lastLog   parser.ParsedLog
+}
+
+// baselineDetector learns per-source rates, level distributions and common
+// templates during a training period, then alerts on deviations from them
+type baselineDetector struct {
+	training  time.Duration
+	interval  time.Duration
+	tolerance float64
+	severity  string
+	mu        sync.Mutex
+	sources   map[string]*sourceBaseline
+	trainEnd  time.Time
+	trained   bool
+	lastRoll  time.Time
+}
+
+// newBaselineDetector creates a baseline detector from its configuration
+func newBaselineDetector(cfg config.Baseline) *baselineDetector {
+	d := &baselineDetector{
+		training:  time.Duration(cfg.TrainingPeriod),
+		interval:  time.Duration(cfg.Interval),
+		tolerance: cfg.Tolerance,
+		severity:  strings.ToUpper(cfg.Severity),
+		sources:   make(map[string]*sourceBaseline),
+	}
+	if d.training <= 0 {
+		d.training = defaultBaselineTraining
+	}
+	if d.interval <= 0 {
+		d.interval = defaultBaselineInterval
+	}
+	if d.tolerance <= 1 {
+		d.tolerance = defaultBaselineTolerance
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+
+	now := time.Now()
+	d.trainEnd = now.Add(d.training)
+	d.lastRoll = now
+	log.Printf("Learning baselines until %s", d.trainEnd.Format(time.RFC3339))
+	return d
+}
+
+// Observe learns from a log during training and afterwards flags logs from
+// sources or with templates that were never seen while learning
+func (d *baselineDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sources[logEntry.Source]
+	if !ok {
+		s = &sourceBaseline{
+			levels:    make(map[string]int),
+			templates: make(map[string]bool),
+			current:   make(map[string]int),
+		}
+		d.sources[logEntry.Source] = s
+	}
+	s.count += logEntry.RepeatCount
+	s.current[logEntry.Level] += logEntry.RepeatCount
+	s.lastLog = logEntry
+
+	if !d.trained {
+		s.total += logEntry.RepeatCount
+		s.levels[logEntry.Level] += logEntry.RepeatCount
+		s.templates[logEntry.TemplateID] = true
+		return nil
+	}
+
+	if !ok {
+		// Report a new source once and never compare it to a baseline
+		s.templates[logEntry.TemplateID] = true
+		return []Alert{d.alert("Baseline Unknown Source", logEntry, now, map[string]interface{}{
+			"source": logEntry.Source,
+		})}
+	}
+	if logEntry.TemplateID != "" && !s.templates[logEntry.TemplateID] {
+		s.templates[logEntry.TemplateID] = true
+		return []Alert{d.alert("Baseline Unknown Template", logEntry, now, map[string]interface{}{
+			"source":      logEntry.Source,
+			"template_id": logEntry.TemplateID,
+			"template":    logEntry.Template,
+		})}
+	}
+	return nil
+}
+
+// Tick finishes training once the period is over and, after that, compares
+// every closed interval to the learned baselines
+func (d *baselineDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.trained {
+		if now.Before(d.trainEnd) {
+			return nil
+		}
+		d.finishTraining(now)
+		return nil
+	}
+
+	if now.Sub(d.lastRoll) < d.interval {
+		return nil
+	}
+	d.lastRoll = now
+
+	var alerts []Alert
+	for source, s := range d.sources {
+		if s.learned {
+			alerts = append(alerts, d.compare(source, s, now)...)
+		}
+		s.count = 0
+		s.current = make(map[string]int)
+	}
+	return alerts
+}
+
+// finishTraining turns the training counts into baselines
+func (d *baselineDetector) finishTraining(now time.Time) {
+	intervals := float64(d.training) / float64(d.interval)
+	if intervals < 1 {
+		intervals = 1
+	}
+	for _, s := range d.sources {
+		s.learned = true
+		s.rate = float64(s.total) / intervals
+		s.count = 0
+		s.current = make(map[string]int)
+	}
+	d.trained = true
+	d.lastRoll = now
+	log.Printf("Baselines learned for %d sources", len(d.sources))
+}
+
+// compare checks one source's closed interval against its baseline
+func (d *baselineDetector) compare(source string, s *sourceBaseline, now time.Time) []Alert {
+	var alerts []Alert
+
+	count := float64(s.count)
+	expected := s.rate
+	if expected < 1 {
+		expected = 1
+	}
+	switch {
+	case count > expected*d.tolerance:
+		alerts = append(alerts, d.alert("Baseline Rate Deviation", s.lastLog, now, map[string]interface{}{
+			"source":    source,
+			"direction": "spike",
+			"count":     s.count,
+			"baseline":  s.rate,
+			"interval":  d.interval.String(),
+		}))
+	case s.rate >= baselineMinDropRate && count < s.rate/d.tolerance:
+		alerts = append(alerts, d.alert("Baseline Rate Deviation", s.lastLog, now, map[string]interface{}{
+			"source":    source,
+			"direction": "drop",
+			"count":     s.count,
+			"baseline":  s.rate,
+			"interval":  d.interval.String(),
+		}))
+	}
+
+	if s.count < baselineMinLevelCount || s.total == 0 {
+		return alerts
+	}
+	levels := make([]string, 0, len(s.current))
+	for level := range s.current {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		share := float64(s.current[level]) / count
+		learned := float64(s.levels[level]) / float64(s.total)
+		if share-learned > baselineLevelShift {
+			alerts = append(alerts, d.alert("Baseline Level Deviation", s.lastLog, now, map[string]interface{}{
+				"source":         source,
+				"level":          level,
+				"share":          share,
+				"baseline_share": learned,
+				"interval":       d.interval.String(),
+			}))
+		}
+	}
+	return alerts
+}
+
+// alert builds a baseline deviation alert
+func (d *baselineDetector) alert(name string, logEntry parser.ParsedLog, now time.Time, metadata map[string]interface{}) Alert {
+	metadata["detector"] = "baseline"
+	return detectorAlert(name, d.severity, logEntry, now, metadata)
+}
+
+// baseline implements baseliner with the learned rate and level shares of
+// the log's source
+func (d *baselineDetector) baseline(logEntry parser.ParsedLog) (map[string]interface{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sources[logEntry.Source]
+	if !ok || !s.learned {
+		return nil, false
+	}
+	values := map[string]interface{}{
+		"baseline_rate":     s.rate,
+		"baseline_interval": d.interval.String(),
+	}
+	if s.total > 0 {
+		values["baseline_level_share"] = float64(s.levels[logEntry.Level]) / float64(s.total)
+	}
+	return values, true
+}
+
+// baselineState is the saved state of a baseline detector
+type baselineState struct {
+	Trained  bool                     `json:"trained"`
+	TrainEnd time.Time                `json:"train_end"`
+	Sources  map[string]savedBaseline `json:"sources"`
+}
+
+// savedBaseline is the saved baseline of one source
+type savedBaseline struct {
+	Learned   bool           `json:"learned"`
+	Total     int            `json:"total"`
+	Rate      float64        `json:"rate"`
+	Levels    map[string]int `json:"levels"`
+	Templates []string       `json:"templates"`
+}
+
+// stateKey implements stateful
+func (d *baselineDetector) stateKey() string {
+	return "baseline"
+}
+
+// saveState returns what has been learned about every source
+func (d *baselineDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := baselineState{
+		Trained:  d.trained,
+		TrainEnd: d.trainEnd,
+		Sources:  make(map[string]savedBaseline, len(d.sources)),
+	}
+	for source, s := range d.sources {
+		saved := savedBaseline{
+			Learned: s.learned,
+			Total:   s.total,
+			Rate:    s.rate,
+			Levels:  make(map[string]int, len(s.levels)),
+		}
+		for level, n := range s.levels {
+			saved.Levels[level] = n
+		}
+		for template := range s.templates {
+			saved.Templates = append(saved.Templates, template)
+		}
+		sort.Strings(saved.Templates)
+		state.Sources[source] = saved
+	}
+	return state
+}
+
+// restoreState reloads learned baselines. An unfinished training period
+// resumes with its original end; the interval in progress starts over.
+func (d *baselineDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var state baselineState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.trained = state.Trained
+	d.trainEnd = state.TrainEnd
+	d.lastRoll = now
+	for source, saved := range state.Sources {
+		s := &sourceBaseline{
+			learned:   saved.Learned,
+			total:     saved.Total,
+			rate:      saved.Rate,
+			levels:    make(map[string]int),
+			templates: make(map[string]bool),
+			current:   make(map[string]int),
+			lastLog:   parser.ParsedLog{Source: source},
+		}
+		for level, n := range saved.Levels {
+			s.levels[level] = n
+		}
+		for _, template := range saved.Templates {
+			s.templates[template] = true
+		}
+		d.sources[source] = s
+	}
+	if !d.trained {
+		log.Printf("Resuming baseline learning until %s", d.trainEnd.Format(time.RFC3339))
+	}
+	return nil
+}
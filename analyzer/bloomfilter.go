@@ -1,6 +1,7 @@
 package analyzer
 
 import (
+	"fmt"
 	"hash/fnv"
 )
 
@@ -53,3 +54,26 @@ func (bf *BloomFilter) Clear() {
 		bf.bits[i] = false
 	}
 }
+
+// MarshalBinary packs the filter's bits into bytes
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, (bf.size+7)/8)
+	for i, set := range bf.bits {
+		if set {
+			data[i/8] |= 1 << (i % 8)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores bits packed by MarshalBinary into a filter of
+// the same size
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	if uint(len(data)) != (bf.size+7)/8 {
+		return fmt.Errorf("bloom filter of %d bytes does not fit size %d", len(data), bf.size)
+	}
+	for i := range bf.bits {
+		bf.bits[i] = data[i/8]&(1<<(i%8)) != 0
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Brute-force detector defaults
+const (
+	defaultBruteWindow           = 5 * time.Minute
+	defaultBruteFailureThreshold = 10
+	defaultBruteSprayThreshold   = 10
+
+	// brutePruneInterval is how often idle counters are dropped
+	brutePruneInterval = time.Minute
+)
+
+// Default phrases recognizing auth outcomes in SSH, web and IdP logs
+var (
+	defaultAuthFailurePhrases = []string{
+		"failed password", "authentication failure", "authentication failed",
+		"login failed", "failed login", "invalid credentials", "invalid password",
+		"incorrect password", "invalid user", "access denied", "mfa failed",
+	}
+	defaultAuthSuccessPhrases = []string{
+		"accepted password", "accepted publickey", "login successful",
+		"login success", "authentication succeeded", "successfully authenticated",
+		"logged in",
+	}
+)
+
+// userFields are the extracted fields a username is taken from
+var userFields = []string{"user", "username", "user_name", "login", "account"}
+
+// userPatterns find a username in free text, e.g. sshd's
+// "Failed password for invalid user admin from 10.0.0.1"
+var userPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bfor (?:invalid user |user )?([\w.@-]+) from\b`),
+	regexp.MustCompile(`(?i)\buser(?:name)?[=: ]+["']?([\w.@-]+)`),
+}
+
+// bruteForceDetector counts auth failures and successes per source IP and
+// username. It alerts on many failures for one account (brute force), on
+// failures across many accounts from one IP (password spraying), and on a
+// success following a brute-force attempt.
+type bruteForceDetector struct {
+	window     time.Duration
+	failLimit  int
+	sprayLimit int
+	failures   []string
+	successes  []string
+	severity   string
+	mu         sync.Mutex
+	counters   map[string]*slidingCounter
+	sprays     map[string]*distinctSet
+	sprayed    map[string]bool
+	lastPrune  time.Time
+}
+
+// newBruteForceDetector creates a brute-force detector from its configuration
+func newBruteForceDetector(cfg config.BruteForce) *bruteForceDetector {
+	d := &bruteForceDetector{
+		window:     time.Duration(cfg.Window),
+		failLimit:  cfg.FailureThreshold,
+		sprayLimit: cfg.SprayThreshold,
+		failures:   lowerAll(cfg.FailurePhrases),
+		successes:  lowerAll(cfg.SuccessPhrases),
+		severity:   strings.ToUpper(cfg.Severity),
+		counters:   make(map[string]*slidingCounter),
+		sprays:     make(map[string]*distinctSet),
+		sprayed:    make(map[string]bool),
+		lastPrune:  time.Now(),
+	}
+	if d.window <= 0 {
+		d.window = defaultBruteWindow
+	}
+	if d.failLimit <= 0 {
+		d.failLimit = defaultBruteFailureThreshold
+	}
+	if d.sprayLimit <= 0 {
+		d.sprayLimit = defaultBruteSprayThreshold
+	}
+	if len(d.failures) == 0 {
+		d.failures = defaultAuthFailurePhrases
+	}
+	if len(d.successes) == 0 {
+		d.successes = defaultAuthSuccessPhrases
+	}
+	if d.severity == "" {
+		d.severity = "HIGH"
+	}
+	return d
+}
+
+// Observe classifies a log as an auth failure or success and updates the
+// counters of its IP and username
+func (d *bruteForceDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	message := strings.ToLower(logEntry.Message)
+	failed := containsAny(message, d.failures)
+	succeeded := !failed && containsAny(message, d.successes)
+	if !failed && !succeeded {
+		return nil
+	}
+
+	ip := logEntry.IP
+	user := authUser(logEntry)
+	if ip == "" && user == "" {
+		return nil
+	}
+	key := ip + "|" + user
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counter, ok := d.counters[key]
+	if !ok {
+		counter = newSlidingCounter(d.window, now)
+		d.counters[key] = counter
+	}
+
+	if succeeded {
+		count := counter.count(now)
+		if count < d.failLimit {
+			return nil
+		}
+		delete(d.counters, key)
+		return []Alert{d.alert("Brute Force Success", "CRITICAL", logEntry, now, ip, user, map[string]interface{}{
+			"failures": count,
+		})}
+	}
+
+	var alerts []Alert
+	count := counter.add(now, logEntry.RepeatCount)
+	if count >= d.failLimit && count-logEntry.RepeatCount < d.failLimit {
+		alerts = append(alerts, d.alert("Brute Force Attempt", d.severity, logEntry, now, ip, user, map[string]interface{}{
+			"failures": count,
+		}))
+	}
+
+	if ip != "" && user != "" {
+		users, ok := d.sprays[ip]
+		if !ok {
+			users = newDistinctSet(d.window, now)
+			d.sprays[ip] = users
+		}
+		distinct := users.add(user, now)
+		if distinct < d.sprayLimit {
+			delete(d.sprayed, ip)
+		} else if !d.sprayed[ip] {
+			d.sprayed[ip] = true
+			alerts = append(alerts, d.alert("Password Spraying", d.severity, logEntry, now, ip, "", map[string]interface{}{
+				"distinct_users": distinct,
+			}))
+		}
+	}
+	return alerts
+}
+
+// Tick drops idle counters
+func (d *bruteForceDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) < brutePruneInterval {
+		return nil
+	}
+	d.lastPrune = now
+
+	for key, counter := range d.counters {
+		if counter.count(now) == 0 {
+			delete(d.counters, key)
+		}
+	}
+	for ip, users := range d.sprays {
+		if users.count(now) == 0 {
+			delete(d.sprays, ip)
+			delete(d.sprayed, ip)
+		}
+	}
+	return nil
+}
+
+// alert builds a brute-force alert
+func (d *bruteForceDetector) alert(name, severity string, logEntry parser.ParsedLog, now time.Time, ip, user string, metadata map[string]interface{}) Alert {
+	metadata["detector"] = "bruteforce"
+	metadata["ip"] = ip
+	if user != "" {
+		metadata["user"] = user
+	}
+	metadata["window"] = d.window.String()
+	return detectorAlert(name, severity, logEntry, now, metadata)
+}
+
+// authUser returns the username of an auth log, from extracted fields or
+// the message text
+func authUser(logEntry parser.ParsedLog) string {
+	for _, field := range userFields {
+		if user, ok := logEntry.Fields[field].(string); ok && user != "" {
+			return user
+		}
+	}
+	for _, re := range userPatterns {
+		if m := re.FindStringSubmatch(logEntry.Message); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// containsAny reports whether s contains any of the phrases
+func containsAny(s string, phrases []string) bool {
+	for _, phrase := range phrases {
+		if strings.Contains(s, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerAll returns the strings lowercased
+func lowerAll(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(v)
+	}
+	return out
+}
@@ -0,0 +1,238 @@
+package analyzer
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// hllPrecision is the number of hash bits selecting a HyperLogLog register.
+// 2^12 registers take 4 KB and give a standard error of about 1.6%.
+const hllPrecision = 12
+
+// hllRegisters is the number of registers of each HyperLogLog
+const hllRegisters = 1 << hllPrecision
+
+// hyperLogLog estimates the number of distinct values added to it in fixed
+// memory
+type hyperLogLog struct {
+	registers []uint8
+}
+
+// newHyperLogLog creates an empty estimator
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+// add records a value
+func (h *hyperLogLog) add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+
+	register := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[register] {
+		h.registers[register] = rank
+	}
+}
+
+// merge folds the values of other into h
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// reset forgets every value
+func (h *hyperLogLog) reset() {
+	clear(h.registers)
+}
+
+// estimate returns the approximate number of distinct values, using linear
+// counting while many registers are still empty
+func (h *hyperLogLog) estimate() int {
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// mix64 spreads the bits of a hash so that short, similar values such as
+// IP addresses land in different registers
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb3fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// distinctCounter estimates the distinct values seen for one key of a
+// distinct rule. With a spike factor it compares consecutive fixed windows;
+// otherwise it covers a sliding window of buckets.
+type distinctCounter struct {
+	window     time.Duration
+	bucketSize time.Duration
+	buckets    []*hyperLogLog
+	head       int
+	headStart  time.Time
+	previous   int
+	fired      bool
+}
+
+// newDistinctCounter creates a counter covering the given window. Spike
+// counters use a single bucket per window.
+func newDistinctCounter(window time.Duration, spike bool, now time.Time) *distinctCounter {
+	n := windowBuckets
+	if spike {
+		n = 1
+	}
+	bucketSize := window / time.Duration(n)
+	if bucketSize <= 0 {
+		bucketSize = time.Millisecond
+	}
+	c := &distinctCounter{
+		window:     window,
+		bucketSize: bucketSize,
+		buckets:    make([]*hyperLogLog, n),
+		headStart:  now.Truncate(bucketSize),
+	}
+	for i := range c.buckets {
+		c.buckets[i] = newHyperLogLog()
+	}
+	return c
+}
+
+// advance rotates the ring up to now, clearing buckets that fell out of
+// the window. A single-bucket counter remembers the estimate of the window
+// it closes, or zero if a whole window passed without values.
+func (c *distinctCounter) advance(now time.Time) {
+	steps := int(now.Sub(c.headStart) / c.bucketSize)
+	if steps <= 0 {
+		return
+	}
+	if len(c.buckets) == 1 {
+		c.previous = 0
+		if steps == 1 {
+			c.previous = c.buckets[0].estimate()
+		}
+		c.fired = false
+	}
+	if steps > len(c.buckets) {
+		steps = len(c.buckets)
+	}
+	for i := 0; i < steps; i++ {
+		c.head = (c.head + 1) % len(c.buckets)
+		c.buckets[c.head].reset()
+	}
+	c.headStart = now.Truncate(c.bucketSize)
+}
+
+// add records a value at now and returns the estimated distinct count of
+// the window
+func (c *distinctCounter) add(value string, now time.Time) int {
+	c.advance(now)
+	c.buckets[c.head].add(value)
+	return c.count(now)
+}
+
+// count returns the estimated distinct count of the window ending at now
+func (c *distinctCounter) count(now time.Time) int {
+	c.advance(now)
+	if len(c.buckets) == 1 {
+		return c.buckets[0].estimate()
+	}
+	union := newHyperLogLog()
+	for _, b := range c.buckets {
+		union.merge(b)
+	}
+	return union.estimate()
+}
+
+// trackDistinct counts a value of a distinct rule for its key and reports
+// whether the rule fires, along with the counts to attach to the alert.
+// Threshold rules fire when the estimate reaches the threshold and re-arm
+// once it falls below; spike rules fire once per window.
+func (a *Analyzer) trackDistinct(rule Rule, key, value string, now time.Time) (map[string]interface{}, bool) {
+	if value == "" {
+		return nil, false
+	}
+	window := a.ruleWindow(rule)
+	spike := rule.SpikeFactor > 0
+
+	a.windowMutex.Lock()
+	defer a.windowMutex.Unlock()
+
+	counters, ok := a.distincts[rule.Name]
+	if !ok {
+		counters = make(map[string]*distinctCounter)
+		a.distincts[rule.Name] = counters
+	}
+	counter, ok := counters[key]
+	if !ok || counter.window != window || (len(counter.buckets) == 1) != spike {
+		counter = newDistinctCounter(window, spike, now)
+		counters[key] = counter
+	}
+	count := counter.add(value, now)
+
+	metadata := map[string]interface{}{
+		"distinct_field": rule.DistinctField,
+		"distinct_count": count,
+		"window":         window.String(),
+		"key":            key,
+		"approximate":    true,
+	}
+	if spike {
+		limit := rule.SpikeFactor * float64(max(counter.previous, 1))
+		if counter.fired || float64(count) <= limit || count < rule.Threshold {
+			return nil, false
+		}
+		counter.fired = true
+		metadata["previous_count"] = counter.previous
+		metadata["spike_factor"] = rule.SpikeFactor
+		return metadata, true
+	}
+
+	if count < rule.Threshold {
+		counter.fired = false
+		return nil, false
+	}
+	if counter.fired {
+		return nil, false
+	}
+	counter.fired = true
+	metadata["threshold"] = rule.Threshold
+	return metadata, true
+}
+
+// idle reports whether the counter holds no values at now
+func (c *distinctCounter) idle(now time.Time) bool {
+	c.advance(now)
+	if c.previous > 0 {
+		return false
+	}
+	for _, b := range c.buckets {
+		for _, r := range b.registers {
+			if r != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package analyzer
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Change-point detector defaults
+const (
+	defaultChangeInterval   = time.Minute
+	defaultChangeDelta      = 0.1
+	defaultChangeThreshold  = 5.0
+	defaultChangeMinSamples = 5
+
+	// changeMinEvents is the interval volume needed for an error ratio sample
+	changeMinEvents = 10
+
+	// Floors for the scale deviations are measured against, so that sources
+	// at or near zero do not produce huge relative changes
+	changeVolumeFloor = 1.0
+	changeRatioFloor  = 0.01
+)
+
+// pageHinkley is a two-sided Page-Hinkley test over one series. Deviations
+// are measured relative to the running mean so that one threshold suits
+// series of any magnitude.
+type pageHinkley struct {
+	mean    float64
+	samples int
+	up      float64
+	upMin   float64
+	down    float64
+	downMax float64
+}
+
+// add folds a sample into the test and returns +1 or -1 when a sustained
+// upward or downward shift has been detected, after which the test restarts
+// from the new level
+func (ph *pageHinkley) add(x, floor, delta, threshold float64, minSamples int) int {
+	if ph.samples < minSamples {
+		ph.samples++
+		ph.mean += (x - ph.mean) / float64(ph.samples)
+		return 0
+	}
+
+	dev := (x - ph.mean) / math.Max(ph.mean, floor)
+	ph.up += dev - delta
+	ph.upMin = math.Min(ph.upMin, ph.up)
+	ph.down += dev + delta
+	ph.downMax = math.Max(ph.downMax, ph.down)
+
+	ph.samples++
+	ph.mean += (x - ph.mean) / float64(ph.samples)
+
+	shift := 0
+	switch {
+	case ph.up-ph.upMin > threshold:
+		shift = 1
+	case ph.downMax-ph.down > threshold:
+		shift = -1
+	}
+	if shift != 0 {
+		*ph = pageHinkley{mean: x, samples: 1}
+	}
+	return shift
+}
+
+// changeSource is the change-point state of one source
+type changeSource struct {
+	volume  pageHinkley
+	errors  pageHinkley
+	count   int
+	errored int
+	lastLog parser.ParsedLog
+}
+
+// changePointDetector watches per-source volume and error ratio for
+// sustained level shifts, such as a deploy that doubled the error rate,
+// rather than instantaneous spikes
+type changePointDetector struct {
+	interval   time.Duration
+	delta      float64
+	threshold  float64
+	minSamples int
+	severity   string
+	mu         sync.Mutex
+	sources    map[string]*changeSource
+	lastRoll   time.Time
+}
+
+// newChangePointDetector creates a change-point detector from its configuration
+func newChangePointDetector(cfg config.ChangePoint) *changePointDetector {
+	d := &changePointDetector{
+		interval:   time.Duration(cfg.Interval),
+		delta:      cfg.Delta,
+		threshold:  cfg.Threshold,
+		minSamples: cfg.MinSamples,
+		severity:   strings.ToUpper(cfg.Severity),
+		sources:    make(map[string]*changeSource),
+		lastRoll:   time.Now(),
+	}
+	if d.interval <= 0 {
+		d.interval = defaultChangeInterval
+	}
+	if d.delta <= 0 {
+		d.delta = defaultChangeDelta
+	}
+	if d.threshold <= 0 {
+		d.threshold = defaultChangeThreshold
+	}
+	if d.minSamples <= 0 {
+		d.minSamples = defaultChangeMinSamples
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	return d
+}
+
+// Observe counts a log toward its source's current interval
+func (d *changePointDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sources[logEntry.Source]
+	if !ok {
+		s = &changeSource{}
+		d.sources[logEntry.Source] = s
+	}
+	s.count += logEntry.RepeatCount
+	if isErrorLevel(logEntry.Level) {
+		s.errored += logEntry.RepeatCount
+	}
+	s.lastLog = logEntry
+	return nil
+}
+
+// Tick closes the current interval once it has elapsed and feeds each
+// source's volume and error ratio to its tests
+func (d *changePointDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastRoll) < d.interval {
+		return nil
+	}
+	d.lastRoll = now
+
+	var alerts []Alert
+	for source, s := range d.sources {
+		before := s.volume.mean
+		x := float64(s.count)
+		if shift := s.volume.add(x, changeVolumeFloor, d.delta, d.threshold, d.minSamples); shift != 0 {
+			alerts = append(alerts, d.alert(source, "volume", shift, before, x, s.lastLog, now))
+		}
+
+		if s.count >= changeMinEvents {
+			before := s.errors.mean
+			ratio := float64(s.errored) / x
+			if shift := s.errors.add(ratio, changeRatioFloor, d.delta, d.threshold, d.minSamples); shift != 0 {
+				alerts = append(alerts, d.alert(source, "error_ratio", shift, before, ratio, s.lastLog, now))
+			}
+		}
+
+		s.count = 0
+		s.errored = 0
+
+		// Forget sources that have settled at silence
+		if x == 0 && s.volume.mean < 0.01 {
+			delete(d.sources, source)
+		}
+	}
+	return alerts
+}
+
+// alert builds a change-point alert
+func (d *changePointDetector) alert(source, metric string, shift int, before, after float64, logEntry parser.ParsedLog, now time.Time) Alert {
+	direction := "increase"
+	if shift < 0 {
+		direction = "decrease"
+	}
+	return detectorAlert("Change Point Detected", d.severity, logEntry, now, map[string]interface{}{
+		"detector":  "changepoint",
+		"source":    source,
+		"metric":    metric,
+		"direction": direction,
+		"before":    before,
+		"after":     after,
+		"interval":  d.interval.String(),
+	})
+}
+
+// isErrorLevel reports whether a log level denotes an error
+func isErrorLevel(level string) bool {
+	switch strings.ToUpper(level) {
+	case "ERROR", "CRITICAL", "FATAL":
+		return true
+	}
+	return false
+}
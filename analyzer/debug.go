@@ -0,0 +1,246 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// defaultDebugLimit is how many keys of each rule a debug view lists
+const defaultDebugLimit = 100
+
+// DebugState is a view of the analyzer's internal state for explaining why
+// an alert did or did not fire: the window counters and sequence progress
+// of every rule, the bloom filter of known patterns and, for a key, what
+// the detectors learned about it
+type DebugState struct {
+	Time  string      `json:"time"`
+	Key   string      `json:"key,omitempty"`
+	Rules []RuleDebug `json:"rules"`
+	Bloom BloomStats  `json:"bloom"`
+
+	// Baselines holds what detectors learned about the key as a source,
+	// and Detectors the full models of stateful detectors when asked for
+	Baselines map[string]interface{}     `json:"baselines,omitempty"`
+	Detectors map[string]json.RawMessage `json:"detectors,omitempty"`
+}
+
+// RuleDebug is the state one rule keeps per key. Counts are the matches in
+// the current window, or distinct values for distinct rules; Previous are
+// the counts of the previous window of spike rules.
+type RuleDebug struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Window    string `json:"window"`
+	Threshold int    `json:"threshold,omitempty"`
+
+	// Keys is the number of keys tracked, of which at most the limit with
+	// the highest counts are listed
+	Keys     int            `json:"keys"`
+	Counts   map[string]int `json:"counts,omitempty"`
+	Previous map[string]int `json:"previous,omitempty"`
+
+	Sequence   map[string]SequenceDebug `json:"sequence,omitempty"`
+	Heartbeats map[string]string        `json:"heartbeats,omitempty"`
+
+	// KnownPattern reports whether the rule already alerted for the key,
+	// as far as the bloom filter knows
+	KnownPattern *bool `json:"known_pattern,omitempty"`
+}
+
+// SequenceDebug is the progress of one key through a sequence rule
+type SequenceDebug struct {
+	Step    int    `json:"step"`
+	Steps   int    `json:"steps"`
+	Count   int    `json:"count"`
+	Started string `json:"started"`
+}
+
+// BloomStats describes the fill of the bloom filter of known patterns
+type BloomStats struct {
+	Size           uint    `json:"size"`
+	HashCount      uint    `json:"hash_count"`
+	BitsSet        int     `json:"bits_set"`
+	FillRatio      float64 `json:"fill_ratio"`
+	EstimatedItems int     `json:"estimated_items"`
+	FalsePositive  float64 `json:"false_positive_rate"`
+}
+
+// stats returns the fill of the filter and its resulting false positive
+// rate
+func (bf *BloomFilter) stats() BloomStats {
+	set := 0
+	for _, bit := range bf.bits {
+		if bit {
+			set++
+		}
+	}
+	s := BloomStats{Size: bf.size, HashCount: bf.hashCount, BitsSet: set}
+	if bf.size == 0 {
+		return s
+	}
+	s.FillRatio = float64(set) / float64(bf.size)
+	s.FalsePositive = math.Pow(s.FillRatio, float64(bf.hashCount))
+	if set < int(bf.size) && bf.hashCount > 0 {
+		s.EstimatedItems = int(math.Round(-float64(bf.size) / float64(bf.hashCount) * math.Log(1-s.FillRatio)))
+	}
+	return s
+}
+
+// Debug returns the internal state of the analyzer at now, limited to the
+// rule with the given name or ID and to one key when they are not empty.
+// At most limit keys are listed per rule.
+func (a *Analyzer) Debug(key, rule string, limit int, detectors bool, now time.Time) DebugState {
+	if limit <= 0 {
+		limit = defaultDebugLimit
+	}
+	state := DebugState{Time: now.Format(time.RFC3339), Key: key, Rules: []RuleDebug{}}
+
+	for _, r := range a.Rules() {
+		if rule != "" && r.Name != rule && r.ID != rule {
+			continue
+		}
+		rd := RuleDebug{
+			ID:        r.ID,
+			Name:      r.Name,
+			Enabled:   !a.isDisabled(r.ID),
+			Window:    a.ruleWindow(r).String(),
+			Threshold: a.currentThreshold(r),
+		}
+		a.debugCounters(&rd, r, key, limit, now)
+		if r.sequence != nil {
+			rd.Sequence = make(map[string]SequenceDebug)
+			for k, p := range r.sequence.saveProgress() {
+				if key == "" || k == key {
+					rd.Sequence[k] = SequenceDebug{Step: p.Step, Steps: len(r.sequence.steps), Count: p.Count, Started: p.Started.Format(time.RFC3339)}
+				}
+			}
+			rd.Keys = len(rd.Sequence)
+		}
+		if r.heartbeat != nil {
+			rd.Heartbeats = make(map[string]string)
+			for k, seen := range r.heartbeat.save().Seen {
+				if key == "" || k == key {
+					rd.Heartbeats[k] = seen.Format(time.RFC3339)
+				}
+			}
+			rd.Keys = len(rd.Heartbeats)
+		}
+		if key != "" {
+			a.bloomMutex.Lock()
+			known := a.bloomFilter.Contains(r.Name + ":" + key)
+			a.bloomMutex.Unlock()
+			rd.KnownPattern = &known
+		}
+		state.Rules = append(state.Rules, rd)
+	}
+
+	a.bloomMutex.Lock()
+	state.Bloom = a.bloomFilter.stats()
+	a.bloomMutex.Unlock()
+
+	if key != "" {
+		baselines := make(map[string]interface{})
+		for _, d := range a.detectors {
+			if b, ok := d.(baseliner); ok {
+				if values, ok := b.baseline(parser.ParsedLog{Source: key}); ok {
+					for k, v := range values {
+						baselines[k] = v
+					}
+				}
+			}
+		}
+		if len(baselines) > 0 {
+			state.Baselines = baselines
+		}
+	}
+	if detectors {
+		state.Detectors = make(map[string]json.RawMessage)
+		for _, d := range a.detectors {
+			if s, ok := d.(stateful); ok {
+				if data, err := json.Marshal(s.saveState()); err == nil {
+					state.Detectors[s.stateKey()] = data
+				}
+			}
+		}
+	}
+	return state
+}
+
+// debugCounters fills in the window counters a rule keeps per key
+func (a *Analyzer) debugCounters(rd *RuleDebug, rule Rule, key string, limit int, now time.Time) {
+	counts := make(map[string]int)
+	var previous map[string]int
+
+	// Reading counters advances them, so the write lock is needed
+	a.windowMutex.Lock()
+	for k, c := range a.windows[rule.Name] {
+		if key == "" || k == key {
+			counts[k] = c.count(now)
+		}
+	}
+	if spikes, ok := a.spikes[rule.Name]; ok {
+		previous = make(map[string]int)
+		for k, c := range spikes {
+			if key == "" || k == key {
+				c.advance(now)
+				counts[k], previous[k] = c.current, c.previous
+			}
+		}
+	}
+	for k, c := range a.distincts[rule.Name] {
+		if key == "" || k == key {
+			counts[k] = c.count(now)
+		}
+	}
+	if sketch, ok := a.sketches[rule.Name]; ok && key != "" {
+		counts[key] = sketch.add(key, now, 0)
+	}
+	a.windowMutex.Unlock()
+
+	rd.Keys = len(counts)
+	if len(counts) == 0 {
+		return
+	}
+	rd.Counts = make(map[string]int, min(len(counts), limit))
+	for _, entry := range topCounts(counts, limit, "key") {
+		k := entry["key"].(string)
+		rd.Counts[k] = counts[k]
+		if previous != nil {
+			if rd.Previous == nil {
+				rd.Previous = make(map[string]int)
+			}
+			rd.Previous[k] = previous[k]
+		}
+	}
+}
+
+// HandleDebug serves GET requests for the internal state of the analyzer.
+// The key and rule query parameters narrow the view, limit bounds the keys
+// listed per rule and detectors=true adds the models of the detectors.
+func (a *Analyzer) HandleDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	detectors, _ := strconv.ParseBool(query.Get("detectors"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Debug(query.Get("key"), query.Get("rule"), limit, detectors, time.Now()))
+}
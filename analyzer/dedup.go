@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// defaultDedupUpdate is how often a deduplicated alert that keeps firing is
+// re-sent with its updated counts
+const defaultDedupUpdate = 5 * time.Minute
+
+// firingAlert is the state of a deduplicated alert
+type firingAlert struct {
+	latest   Alert
+	first    time.Time
+	last     time.Time
+	count    int
+	sent     time.Time
+	sentSeen int
+}
+
+// alertDeduper folds repeats of an alert with the same fingerprint within a
+// window into the first one. While repeats keep arriving, an update carrying
+// the occurrence count is sent every update interval, and a final update is
+// sent once the window passes with unreported occurrences.
+type alertDeduper struct {
+	window time.Duration
+	update time.Duration
+	mu     sync.Mutex
+	firing map[string]*firingAlert
+}
+
+// newAlertDeduper creates an alert deduper
+func newAlertDeduper(window, update time.Duration) *alertDeduper {
+	if update <= 0 {
+		update = defaultDedupUpdate
+	}
+	return &alertDeduper{
+		window: window,
+		update: update,
+		firing: make(map[string]*firingAlert),
+	}
+}
+
+// EnableDedup folds repeated alerts of the same rule and key within window
+// into one, re-sending it with updated counts every update interval
+func (a *Analyzer) EnableDedup(window, update time.Duration) {
+	a.dedup = newAlertDeduper(window, update)
+}
+
+// fingerprint identifies the rule and key an alert is about
+func fingerprint(alert Alert) string {
+	key, ok := alert.Metadata["key"]
+	if !ok {
+		key = alert.Log.Source
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%v", alert.Reason, key)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// admit records an alert and reports whether it should be sent now, which
+// is only the case for the first occurrence within the window
+func (d *alertDeduper) admit(alert *Alert, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if f, ok := d.firing[alert.Fingerprint]; ok && now.Sub(f.last) <= d.window {
+		f.latest = *alert
+		f.last = now
+		f.count++
+		return false
+	}
+
+	d.firing[alert.Fingerprint] = &firingAlert{
+		latest:   *alert,
+		first:    now,
+		last:     now,
+		count:    1,
+		sent:     now,
+		sentSeen: 1,
+	}
+	alert.Metadata["occurrences"] = 1
+	alert.Metadata["first_seen"] = now.Format(time.RFC3339)
+	alert.Metadata["last_seen"] = now.Format(time.RFC3339)
+	return true
+}
+
+// due returns the updates to send at now and forgets alerts whose window
+// has passed
+func (d *alertDeduper) due(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var updates []Alert
+	for fp, f := range d.firing {
+		expired := now.Sub(f.last) > d.window
+		if expired {
+			delete(d.firing, fp)
+		}
+		// An alert that was never repeated needs no update; one that was
+		// always gets its end announced, so that sinks can resolve it
+		if f.count == 1 || (!expired && (f.count == f.sentSeen || now.Sub(f.sent) < d.update)) {
+			continue
+		}
+
+		status := "still_firing"
+		if expired {
+			status = "ended"
+		}
+		alert := f.latest
+		alert.Timestamp = now.Format(time.RFC3339)
+		alert.Metadata = make(map[string]interface{}, len(f.latest.Metadata)+4)
+		for k, v := range f.latest.Metadata {
+			alert.Metadata[k] = v
+		}
+		alert.Metadata["occurrences"] = f.count
+		alert.Metadata["first_seen"] = f.first.Format(time.RFC3339)
+		alert.Metadata["last_seen"] = f.last.Format(time.RFC3339)
+		alert.Metadata["dedup_status"] = status
+		updates = append(updates, alert)
+
+		f.sent = now
+		f.sentSeen = f.count
+	}
+	return updates
+}
+
+// flushDedup periodically sends updates for deduplicated alerts
+func (a *Analyzer) flushDedup() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, alert := range a.dedup.due(now) {
+				if !a.deliver(alert, now) {
+					return
+				}
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package analyzer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// detectorTick is how often detectors are given a chance to emit alerts
+// that are not triggered by an incoming log
+const detectorTick = time.Second
+
+// Detector is a stateful anomaly detector fed every log alongside the
+// rules. Implementations must be safe for concurrent Observe and Tick
+// calls.
+type Detector interface {
+	// Observe records a log and returns any alerts it triggers
+	Observe(log parser.ParsedLog, now time.Time) []Alert
+
+	// Tick is called periodically and returns time-based alerts
+	Tick(now time.Time) []Alert
+}
+
+// DetectorStarter is implemented by detectors with background work to
+// start along with the analyzer
+type DetectorStarter interface {
+	Start()
+}
+
+// DetectorStopper is implemented by detectors holding resources to release
+// once the analyzer has stopped and saved its state
+type DetectorStopper interface {
+	Stop()
+}
+
+// DetectorFactory builds the detectors of a registered kind from the
+// analyzer configuration, returning none when the kind is not enabled.
+// Detectors registered outside this package read their settings from
+// cfg.Detectors under their registered name.
+type DetectorFactory func(cfg config.Analyzer) ([]Detector, error)
+
+// detectorRegistry holds the registered detector factories in order of
+// registration, which is the order detectors see logs in
+var detectorRegistry = struct {
+	mu        sync.Mutex
+	names     []string
+	factories map[string]DetectorFactory
+}{factories: make(map[string]DetectorFactory)}
+
+// RegisterDetector makes a kind of detector available to
+// ConfigureDetectors. It panics when the name is taken, and is meant to be
+// called from init functions.
+func RegisterDetector(name string, factory DetectorFactory) {
+	detectorRegistry.mu.Lock()
+	defer detectorRegistry.mu.Unlock()
+
+	if factory == nil {
+		panic("analyzer: RegisterDetector factory is nil")
+	}
+	if _, ok := detectorRegistry.factories[name]; ok {
+		panic("analyzer: RegisterDetector called twice for " + name)
+	}
+	detectorRegistry.names = append(detectorRegistry.names, name)
+	detectorRegistry.factories[name] = factory
+}
+
+// RegisteredDetectors returns the names of the registered kinds of
+// detectors in order of registration
+func RegisteredDetectors() []string {
+	detectorRegistry.mu.Lock()
+	defer detectorRegistry.mu.Unlock()
+
+	return append([]string(nil), detectorRegistry.names...)
+}
+
+// registerBuiltin registers a built-in detector kind building at most one
+// detector
+func registerBuiltin(name string, build func(cfg config.Analyzer) (Detector, error)) {
+	RegisterDetector(name, func(cfg config.Analyzer) ([]Detector, error) {
+		d, err := build(cfg)
+		if err != nil || d == nil {
+			return nil, err
+		}
+		return []Detector{d}, nil
+	})
+}
+
+func init() {
+	registerBuiltin("ewma", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.EWMA.Enabled {
+			return nil, nil
+		}
+		return newEWMADetector(cfg.EWMA), nil
+	})
+	registerBuiltin("baseline", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Baseline.Enabled {
+			return nil, nil
+		}
+		return newBaselineDetector(cfg.Baseline), nil
+	})
+	registerBuiltin("change_point", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.ChangePoint.Enabled {
+			return nil, nil
+		}
+		return newChangePointDetector(cfg.ChangePoint), nil
+	})
+	registerBuiltin("rare", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Rare.Enabled {
+			return nil, nil
+		}
+		return newRareDetector(cfg.Rare), nil
+	})
+	registerBuiltin("silence", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Silence.Enabled {
+			return nil, nil
+		}
+		return newSilenceDetector(cfg.Silence), nil
+	})
+	registerBuiltin("brute_force", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.BruteForce.Enabled {
+			return nil, nil
+		}
+		return newBruteForceDetector(cfg.BruteForce), nil
+	})
+	registerBuiltin("scan", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Scan.Enabled {
+			return nil, nil
+		}
+		return newScanDetector(cfg.Scan), nil
+	})
+	registerBuiltin("impossible_travel", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.ImpossibleTravel.Enabled {
+			return nil, nil
+		}
+		return newTravelDetector(cfg.ImpossibleTravel), nil
+	})
+	registerBuiltin("threat_intel", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.ThreatIntel.Enabled {
+			return nil, nil
+		}
+		d, err := newThreatIntelDetector(cfg.ThreatIntel)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	})
+	registerBuiltin("entropy", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Entropy.Enabled {
+			return nil, nil
+		}
+		d, err := newEntropyDetector(cfg.Entropy)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	})
+	registerBuiltin("templates", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Templates.Enabled {
+			return nil, nil
+		}
+		return newTemplateDetector(cfg.Templates), nil
+	})
+	registerBuiltin("format_drift", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.FormatDrift.Enabled {
+			return nil, nil
+		}
+		return newDriftDetector(cfg.FormatDrift), nil
+	})
+	registerBuiltin("level_drift", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.LevelDrift.Enabled {
+			return nil, nil
+		}
+		return newLevelDriftDetector(cfg.LevelDrift), nil
+	})
+	registerBuiltin("inter_arrival", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.InterArrival.Enabled {
+			return nil, nil
+		}
+		return newInterArrivalDetector(cfg.InterArrival), nil
+	})
+	registerBuiltin("markov", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Markov.Enabled {
+			return nil, nil
+		}
+		return newMarkovDetector(cfg.Markov), nil
+	})
+	registerBuiltin("outliers", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.Outliers.Enabled {
+			return nil, nil
+		}
+		d, err := newOutlierDetector(cfg.Outliers)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	})
+	registerBuiltin("top_k", func(cfg config.Analyzer) (Detector, error) {
+		if !cfg.TopK.Enabled {
+			return nil, nil
+		}
+		return newTopKDetector(cfg.TopK), nil
+	})
+	RegisterDetector("models", func(cfg config.Analyzer) ([]Detector, error) {
+		var detectors []Detector
+		for _, m := range cfg.Models {
+			d, err := newModelDetector(m, cfg.ONNXRuntime)
+			if err != nil {
+				return nil, err
+			}
+			detectors = append(detectors, d)
+		}
+		return detectors, nil
+	})
+}
+
+// ConfigureDetectors builds the detectors enabled in the configuration,
+// built-in and registered alike. It must be called before Start.
+func (a *Analyzer) ConfigureDetectors(cfg config.Analyzer) error {
+	for _, name := range RegisteredDetectors() {
+		detectorRegistry.mu.Lock()
+		factory := detectorRegistry.factories[name]
+		detectorRegistry.mu.Unlock()
+
+		detectors, err := factory(cfg)
+		if err != nil {
+			return err
+		}
+		a.detectors = append(a.detectors, detectors...)
+	}
+	return nil
+}
+
+// AddDetector adds a detector built outside the configuration, after those
+// already configured. It must be called before Start.
+func (a *Analyzer) AddDetector(d Detector) {
+	a.detectors = append(a.detectors, d)
+}
+
+// startDetectors calls the start hook of every detector that has one
+func (a *Analyzer) startDetectors() {
+	for _, d := range a.detectors {
+		if s, ok := d.(DetectorStarter); ok {
+			s.Start()
+		}
+	}
+}
+
+// stopDetectors calls the stop hook of every detector that has one
+func (a *Analyzer) stopDetectors() {
+	for _, d := range a.detectors {
+		if s, ok := d.(DetectorStopper); ok {
+			s.Stop()
+		}
+	}
+}
+
+// runDetectors periodically ticks every detector and forwards its alerts
+func (a *Analyzer) runDetectors() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(detectorTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if !a.tickDetectors(now) {
+				return
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
+
+// tickDetectors ticks every detector at now and forwards its alerts,
+// returning false on shutdown
+func (a *Analyzer) tickDetectors(now time.Time) bool {
+	for _, d := range a.detectors {
+		for _, alert := range d.Tick(now) {
+			if !a.send(alert, now) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// keyValue returns the value of a field used to group events, defaulting
+// to the source
+func keyValue(log parser.ParsedLog, field string) string {
+	if field == "" || field == "source" {
+		return log.Source
+	}
+	value, ok := log.Lookup(field)
+	if !ok {
+		return ""
+	}
+	if values := valueStrings(value); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// detectorAlert builds an alert raised by a detector
+func detectorAlert(name, severity string, log parser.ParsedLog, now time.Time, metadata map[string]interface{}) Alert {
+	metadata["rule_name"] = name
+	return Alert{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  severity,
+		Reason:    name,
+		Log:       log,
+		Metadata:  metadata,
+	}
+}
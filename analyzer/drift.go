@@ -0,0 +1,278 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Format drift detector defaults
+const (
+	defaultDriftInterval   = 5 * time.Minute
+	defaultDriftMinLogs    = 20
+	defaultDriftMinSamples = 5
+	defaultDriftShift      = 0.5
+	defaultDriftParseDrop  = 0.2
+
+	// driftAlpha is the smoothing factor of the learned shape
+	driftAlpha = 0.1
+
+	// driftBins is the number of histogram bins of message lengths, by
+	// powers of two, and of field counts
+	driftBins = 17
+)
+
+// logShape summarizes the shape of a source's logs: histograms of message
+// length and field count, and the share of logs parsed without errors
+type logShape struct {
+	Lengths [driftBins]float64 `json:"lengths"`
+	Fields  [driftBins]float64 `json:"fields"`
+	Parsed  float64            `json:"parsed"`
+}
+
+// driftSource is the learned and current shape of one source
+type driftSource struct {
+	learned  logShape
+	samples  int
+	current  logShape
+	count    int
+	drifting bool
+	lastLog  parser.ParsedLog
+}
+
+// driftDetector learns the usual shape of each source's logs and alerts
+// when it changes abruptly, which usually means a bad deploy or a
+// misconfigured log shipper
+type driftDetector struct {
+	interval   time.Duration
+	minLogs    int
+	minSamples int
+	shift      float64
+	parseDrop  float64
+	severity   string
+	mu         sync.Mutex
+	sources    map[string]*driftSource
+	lastRoll   time.Time
+}
+
+// newDriftDetector creates a format drift detector from its configuration
+func newDriftDetector(cfg config.FormatDrift) *driftDetector {
+	d := &driftDetector{
+		interval:   time.Duration(cfg.Interval),
+		minLogs:    cfg.MinLogs,
+		minSamples: cfg.MinSamples,
+		shift:      cfg.Shift,
+		parseDrop:  cfg.ParseDrop,
+		severity:   strings.ToUpper(cfg.Severity),
+		sources:    make(map[string]*driftSource),
+		lastRoll:   time.Now(),
+	}
+	if d.interval <= 0 {
+		d.interval = defaultDriftInterval
+	}
+	if d.minLogs <= 0 {
+		d.minLogs = defaultDriftMinLogs
+	}
+	if d.minSamples <= 0 {
+		d.minSamples = defaultDriftMinSamples
+	}
+	if d.shift <= 0 || d.shift > 1 {
+		d.shift = defaultDriftShift
+	}
+	if d.parseDrop <= 0 || d.parseDrop > 1 {
+		d.parseDrop = defaultDriftParseDrop
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	return d
+}
+
+// Observe adds a log to its source's shape for the current interval
+func (d *driftDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sources[logEntry.Source]
+	if !ok {
+		s = &driftSource{}
+		d.sources[logEntry.Source] = s
+	}
+	s.current.Lengths[min(bits.Len(uint(len(logEntry.Message))), driftBins-1)]++
+	s.current.Fields[min(len(logEntry.Fields), driftBins-1)]++
+	if logEntry.ParseErrors == 0 {
+		s.current.Parsed++
+	}
+	s.count++
+	s.lastLog = logEntry
+	return nil
+}
+
+// Tick closes the current interval once it has elapsed, comparing each
+// source's shape to the learned one before folding it in
+func (d *driftDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastRoll) < d.interval {
+		return nil
+	}
+	d.lastRoll = now
+
+	var alerts []Alert
+	for source, s := range d.sources {
+		if s.count < d.minLogs {
+			if s.count == 0 && s.samples == 0 {
+				delete(d.sources, source)
+			}
+			s.current, s.count = logShape{}, 0
+			continue
+		}
+
+		current := s.current.normalize(s.count)
+		if s.samples >= d.minSamples {
+			changes, metadata := d.compare(s.learned, current)
+			if len(changes) > 0 && !s.drifting {
+				metadata["source"] = source
+				metadata["changes"] = changes
+				metadata["detector"] = "format_drift"
+				metadata["description"] = fmt.Sprintf("log format of %s changed: %s", source, strings.Join(changes, "; "))
+				alerts = append(alerts, detectorAlert("Log Format Drift", d.severity, s.lastLog, now, metadata))
+			}
+			s.drifting = len(changes) > 0
+		}
+
+		if s.samples == 0 {
+			s.learned = current
+		} else {
+			s.learned.blend(current, driftAlpha)
+		}
+		s.samples++
+		s.current, s.count = logShape{}, 0
+	}
+	return alerts
+}
+
+// compare describes how a shape differs from the learned one
+func (d *driftDetector) compare(learned, current logShape) ([]string, map[string]interface{}) {
+	var changes []string
+	metadata := make(map[string]interface{})
+
+	if dist := totalVariation(learned.Fields, current.Fields); dist > d.shift {
+		before, after := histogramMean(learned.Fields, false), histogramMean(current.Fields, false)
+		changes = append(changes, fmt.Sprintf("fields per log %.1f -> %.1f", before, after))
+		metadata["field_count_distance"] = dist
+		metadata["field_count_before"] = before
+		metadata["field_count_after"] = after
+	}
+	if dist := totalVariation(learned.Lengths, current.Lengths); dist > d.shift {
+		before, after := histogramMean(learned.Lengths, true), histogramMean(current.Lengths, true)
+		changes = append(changes, fmt.Sprintf("typical message length %.0f -> %.0f bytes", before, after))
+		metadata["length_distance"] = dist
+		metadata["length_before"] = before
+		metadata["length_after"] = after
+	}
+	if learned.Parsed-current.Parsed > d.parseDrop {
+		changes = append(changes, fmt.Sprintf("parse success %.0f%% -> %.0f%%", learned.Parsed*100, current.Parsed*100))
+		metadata["parse_success_before"] = learned.Parsed
+		metadata["parse_success_after"] = current.Parsed
+	}
+	return changes, metadata
+}
+
+// normalize turns counts over n logs into shares
+func (s logShape) normalize(n int) logShape {
+	for i := range s.Lengths {
+		s.Lengths[i] /= float64(n)
+		s.Fields[i] /= float64(n)
+	}
+	s.Parsed /= float64(n)
+	return s
+}
+
+// blend moves a shape toward another by the smoothing factor
+func (s *logShape) blend(other logShape, alpha float64) {
+	for i := range s.Lengths {
+		s.Lengths[i] += alpha * (other.Lengths[i] - s.Lengths[i])
+		s.Fields[i] += alpha * (other.Fields[i] - s.Fields[i])
+	}
+	s.Parsed += alpha * (other.Parsed - s.Parsed)
+}
+
+// totalVariation returns the distance between two distributions, from 0
+// for identical to 1 for disjoint
+func totalVariation(a, b [driftBins]float64) float64 {
+	dist := 0.0
+	for i := range a {
+		dist += math.Abs(a[i] - b[i])
+	}
+	return dist / 2
+}
+
+// histogramMean approximates the mean of a distribution from its bins.
+// Length bins are powers of two and are represented by their midpoint.
+func histogramMean(h [driftBins]float64, powers bool) float64 {
+	mean := 0.0
+	for i, share := range h {
+		value := float64(i)
+		if powers && i > 0 {
+			value = 1.5 * math.Ldexp(1, i-1)
+		}
+		mean += share * value
+	}
+	return mean
+}
+
+// savedDrift is the saved learned shape of one source
+type savedDrift struct {
+	Learned logShape `json:"learned"`
+	Samples int      `json:"samples"`
+}
+
+// stateKey implements stateful
+func (d *driftDetector) stateKey() string {
+	return "format_drift"
+}
+
+// saveState returns the learned shape of every source
+func (d *driftDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sources := make(map[string]savedDrift, len(d.sources))
+	for source, s := range d.sources {
+		if s.samples > 0 {
+			sources[source] = savedDrift{Learned: s.learned, Samples: s.samples}
+		}
+	}
+	return sources
+}
+
+// restoreState reloads learned shapes. The interval in progress starts
+// over.
+func (d *driftDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var sources map[string]savedDrift
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for source, saved := range sources {
+		d.sources[source] = &driftSource{
+			learned: saved.Learned,
+			samples: saved.Samples,
+			lastLog: parser.ParsedLog{Source: source},
+		}
+	}
+	d.lastRoll = now
+	return nil
+}
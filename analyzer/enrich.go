@@ -0,0 +1,235 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// Enrichment defaults
+const (
+	defaultRecentLogs = 5
+	maxRecentLogs     = 50
+
+	// recentMaxSources bounds the sources whose recent logs are kept, and
+	// recentIdle is how long a quiet source's logs are kept
+	recentMaxSources = 10000
+	recentIdle       = time.Hour
+)
+
+// Enricher adds context to an alert of a rule before it is sent, so the
+// alert carries what a responder needs without opening other tools
+type Enricher func(a *Analyzer, rule Rule, alert *Alert, now time.Time)
+
+// EnrichSpec names a built-in enricher of a rule: "recent_logs" attaches
+// the last Count lines (default 5) from the alert's source, "window_rate"
+// the rate of matches per second in the rule's window, and "baseline" the
+// learned rates of the EWMA and baseline detectors for the alert's key.
+type EnrichSpec struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// baseliner is implemented by detectors that learn a normal rate a log can
+// be compared to
+type baseliner interface {
+	// baseline returns what was learned about the log's key, if anything
+	baseline(log parser.ParsedLog) (map[string]interface{}, bool)
+}
+
+// compileEnrich applies the enrichers of a rule spec
+func compileEnrich(rule *Rule, spec RuleSpec) error {
+	if (len(spec.Enrich) > 0 || len(spec.Labels) > 0) && spec.Suppress {
+		return fmt.Errorf("suppression rules raise no alerts to enrich")
+	}
+	for name := range spec.Labels {
+		if name == "" {
+			return fmt.Errorf("label without a name")
+		}
+	}
+	rule.Labels = spec.Labels
+	for _, e := range spec.Enrich {
+		switch e.Type {
+		case "recent_logs":
+			count := e.Count
+			if count <= 0 {
+				count = defaultRecentLogs
+			}
+			if count > maxRecentLogs {
+				return fmt.Errorf("recent_logs count must be at most %d", maxRecentLogs)
+			}
+			rule.recentLogs = max(rule.recentLogs, count)
+			rule.Enrich = append(rule.Enrich, enrichRecentLogs(count))
+		case "window_rate":
+			rule.Enrich = append(rule.Enrich, enrichWindowRate)
+		case "baseline":
+			rule.Enrich = append(rule.Enrich, enrichBaseline)
+		default:
+			return fmt.Errorf("unknown enrichment %q", e.Type)
+		}
+	}
+	return nil
+}
+
+// enrich runs the enrichers of a rule on one of its alerts and adds its
+// labels
+func (a *Analyzer) enrich(rule Rule, alert *Alert, now time.Time) {
+	if len(rule.Enrich) == 0 && len(rule.Labels) == 0 {
+		return
+	}
+	if alert.Metadata == nil {
+		alert.Metadata = make(map[string]interface{})
+	}
+	if len(rule.Labels) > 0 {
+		alert.Metadata["labels"] = rule.Labels
+	}
+	for _, e := range rule.Enrich {
+		e(a, rule, alert, now)
+	}
+}
+
+// enrichRecentLogs attaches up to count of the latest lines from the
+// alert's source, oldest first
+func enrichRecentLogs(count int) Enricher {
+	return func(a *Analyzer, rule Rule, alert *Alert, now time.Time) {
+		if lines := a.RecentLogs(alert.Log.Source, count); len(lines) > 0 {
+			alert.Metadata["recent_logs"] = lines
+		}
+	}
+}
+
+// enrichWindowRate attaches the per-second rate of the count the rule
+// fired on
+func enrichWindowRate(a *Analyzer, rule Rule, alert *Alert, now time.Time) {
+	count, ok := alert.Metadata["count_in_window"].(int)
+	if !ok {
+		return
+	}
+	window := a.ruleWindow(rule)
+	rate := float64(count) / window.Seconds()
+	alert.Metadata["window_rate"] = math.Round(rate*1000) / 1000
+}
+
+// enrichBaseline attaches the learned rates of the alert's key from every
+// detector that learns one
+func enrichBaseline(a *Analyzer, rule Rule, alert *Alert, now time.Time) {
+	baselines := make(map[string]interface{})
+	for _, d := range a.detectors {
+		b, ok := d.(baseliner)
+		if !ok {
+			continue
+		}
+		if values, ok := b.baseline(alert.Log); ok {
+			for k, v := range values {
+				baselines[k] = v
+			}
+		}
+	}
+	if len(baselines) > 0 {
+		alert.Metadata["baseline"] = baselines
+	}
+}
+
+// recentLines is a ring of the latest lines of one source
+type recentLines struct {
+	lines    []string
+	next     int
+	full     bool
+	lastSeen time.Time
+}
+
+// recentLogs keeps the latest lines of every source for the recent_logs
+// enrichment
+type recentLogs struct {
+	mu      sync.Mutex
+	depth   int
+	sources map[string]*recentLines
+}
+
+// setDepth changes how many lines are kept per source, starting over when
+// it changes
+func (r *recentLogs) setDepth(depth int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if depth != r.depth {
+		r.depth = depth
+		r.sources = make(map[string]*recentLines)
+	}
+}
+
+// add records a log line of a source
+func (r *recentLogs) add(log parser.ParsedLog, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.depth == 0 {
+		return
+	}
+	s, ok := r.sources[log.Source]
+	if !ok {
+		if len(r.sources) >= recentMaxSources {
+			return
+		}
+		s = &recentLines{lines: make([]string, r.depth)}
+		r.sources[log.Source] = s
+	}
+	s.lines[s.next] = formatRecentLine(log)
+	s.next = (s.next + 1) % len(s.lines)
+	s.full = s.full || s.next == 0
+	s.lastSeen = now
+}
+
+// latest returns up to n of the latest lines of a source, oldest first
+func (r *recentLogs) latest(source string, n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sources[source]
+	if !ok {
+		return nil
+	}
+	size := s.next
+	if s.full {
+		size = len(s.lines)
+	}
+	n = min(n, size)
+	lines := make([]string, 0, n)
+	for i := n; i > 0; i-- {
+		lines = append(lines, s.lines[(s.next-i+len(s.lines))%len(s.lines)])
+	}
+	return lines
+}
+
+// prune forgets sources that have been quiet for a while
+func (r *recentLogs) prune(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for source, s := range r.sources {
+		if now.Sub(s.lastSeen) > recentIdle {
+			delete(r.sources, source)
+		}
+	}
+}
+
+// formatRecentLine renders a log as a single line
+func formatRecentLine(log parser.ParsedLog) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{log.Timestamp, log.Level, log.Message} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// RecentLogs returns up to n of the latest lines from a source, oldest
+// first. Lines are only kept while a rule enriches its alerts with them.
+func (a *Analyzer) RecentLogs(source string, n int) []string {
+	return a.recent.latest(source, n)
+}
@@ -0,0 +1,194 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Entropy detector defaults
+const (
+	defaultEntropyMinLength = 16
+	defaultEntropyThreshold = 4.2
+
+	// entropyAlertTTL is how long a token that raised an alert stays
+	// quiet, and entropyMaxTokens bounds how many such tokens are kept
+	entropyAlertTTL  = time.Hour
+	entropyMaxTokens = 10000
+
+	// entropyMaxTokenLen truncates tokens quoted in alerts
+	entropyMaxTokenLen = 128
+)
+
+// uuidPattern matches canonical UUIDs, which are random by design
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// entropyDetector flags unusually random strings in messages or fields,
+// such as DGA domains, encoded payloads or random tokens in URL paths, by
+// their Shannon entropy in bits per character
+type entropyDetector struct {
+	fields    []string
+	minLength int
+	threshold float64
+	sources   map[string]float64
+	ignore    []*regexp.Regexp
+	severity  string
+	mu        sync.Mutex
+	alerted   map[string]time.Time
+	lastPrune time.Time
+}
+
+// newEntropyDetector creates an entropy detector from its configuration
+func newEntropyDetector(cfg config.Entropy) (*entropyDetector, error) {
+	d := &entropyDetector{
+		fields:    cfg.Fields,
+		minLength: cfg.MinLength,
+		threshold: cfg.Threshold,
+		sources:   cfg.Sources,
+		severity:  strings.ToUpper(cfg.Severity),
+		alerted:   make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+	if len(d.fields) == 0 {
+		d.fields = []string{"message"}
+	}
+	if d.minLength <= 0 {
+		d.minLength = defaultEntropyMinLength
+	}
+	if d.threshold <= 0 {
+		d.threshold = defaultEntropyThreshold
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	for _, pattern := range cfg.Ignore {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("entropy ignore pattern %q: %w", pattern, err)
+		}
+		d.ignore = append(d.ignore, re)
+	}
+	return d, nil
+}
+
+// Observe scans the configured fields of a log for high-entropy tokens
+func (d *entropyDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	threshold := d.threshold
+	if t, ok := d.sources[logEntry.Source]; ok {
+		threshold = t
+	}
+
+	var alerts []Alert
+	for _, field := range d.fields {
+		text := keyValue(logEntry, field)
+		for _, token := range entropyTokens(text, d.minLength) {
+			if d.ignored(token, logEntry) {
+				continue
+			}
+			entropy := shannonEntropy(token)
+			if entropy <= threshold || !d.firstAlert(token, now) {
+				continue
+			}
+			quoted := parser.Truncate(token, entropyMaxTokenLen)
+			alerts = append(alerts, detectorAlert("High Entropy String", d.severity, logEntry, now, map[string]interface{}{
+				"detector":  "entropy",
+				"field":     field,
+				"token":     quoted,
+				"length":    len(token),
+				"entropy":   math.Round(entropy*100) / 100,
+				"threshold": threshold,
+			}))
+		}
+	}
+	return alerts
+}
+
+// Tick forgets tokens whose alert is older than the TTL
+func (d *entropyDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) < time.Minute {
+		return nil
+	}
+	d.lastPrune = now
+	for token, at := range d.alerted {
+		if now.Sub(at) > entropyAlertTTL {
+			delete(d.alerted, token)
+		}
+	}
+	return nil
+}
+
+// ignored reports whether a token is an identifier expected to be random
+func (d *entropyDetector) ignored(token string, logEntry parser.ParsedLog) bool {
+	if token == logEntry.TraceID || token == logEntry.SpanID || token == logEntry.RequestID {
+		return true
+	}
+	if uuidPattern.MatchString(token) {
+		return true
+	}
+	for _, re := range d.ignore {
+		if re.MatchString(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstAlert records an alert for token and reports whether none was
+// raised for it within the TTL
+func (d *entropyDetector) firstAlert(token string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if at, ok := d.alerted[token]; ok && now.Sub(at) <= entropyAlertTTL {
+		return false
+	}
+	if len(d.alerted) >= entropyMaxTokens {
+		return true
+	}
+	d.alerted[token] = now
+	return true
+}
+
+// entropyTokens splits text into runs of letters, digits and the symbols
+// of common encodings that are at least minLength long. Dots and slashes
+// separate tokens, so each label of a domain and each segment of a path is
+// scored on its own.
+func entropyTokens(text string, minLength int) []string {
+	tokens := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '_' && r != '-'
+	})
+	long := tokens[:0]
+	for _, token := range tokens {
+		token = strings.Trim(token, "+-_")
+		if len(token) >= minLength {
+			long = append(long, token)
+		}
+	}
+	return long
+}
+
+// shannonEntropy returns the entropy of a string in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
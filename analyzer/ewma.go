@@ -0,0 +1,209 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// EWMA detector defaults
+const (
+	defaultEWMAInterval   = time.Minute
+	defaultEWMAAlpha      = 0.3
+	defaultEWMAThreshold  = 3.0
+	defaultEWMAMinSamples = 5
+
+	// ewmaMinStdDev keeps z-scores finite for perfectly steady keys
+	ewmaMinStdDev = 1.0
+)
+
+// ewmaStats is the exponentially weighted rate model of one key
+type ewmaStats struct {
+	mean     float64
+	variance float64
+	samples  int
+	count    int
+	lastLog  parser.ParsedLog
+}
+
+// ewmaDetector keeps an exponentially weighted mean and variance of the
+// event rate per key and alerts when an interval's count deviates from the
+// mean by more than the configured number of standard deviations
+type ewmaDetector struct {
+	key        string
+	interval   time.Duration
+	alpha      float64
+	threshold  float64
+	minSamples int
+	severity   string
+	mu         sync.Mutex
+	stats      map[string]*ewmaStats
+	lastRoll   time.Time
+}
+
+// newEWMADetector creates an EWMA detector from its configuration
+func newEWMADetector(cfg config.EWMA) *ewmaDetector {
+	d := &ewmaDetector{
+		key:        cfg.Key,
+		interval:   time.Duration(cfg.Interval),
+		alpha:      cfg.Alpha,
+		threshold:  cfg.Threshold,
+		minSamples: cfg.MinSamples,
+		severity:   strings.ToUpper(cfg.Severity),
+		stats:      make(map[string]*ewmaStats),
+		lastRoll:   time.Now(),
+	}
+	if d.interval <= 0 {
+		d.interval = defaultEWMAInterval
+	}
+	if d.alpha <= 0 || d.alpha > 1 {
+		d.alpha = defaultEWMAAlpha
+	}
+	if d.threshold <= 0 {
+		d.threshold = defaultEWMAThreshold
+	}
+	if d.minSamples <= 0 {
+		d.minSamples = defaultEWMAMinSamples
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	return d
+}
+
+// Observe counts a log toward the current interval of its key
+func (d *ewmaDetector) Observe(log parser.ParsedLog, now time.Time) []Alert {
+	key := keyValue(log, d.key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.stats[key]
+	if !ok {
+		s = &ewmaStats{}
+		d.stats[key] = s
+	}
+	s.count += log.RepeatCount
+	s.lastLog = log
+	return nil
+}
+
+// Tick closes the current interval once it has elapsed, scoring each key's
+// count against its model before folding it in
+func (d *ewmaDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastRoll) < d.interval {
+		return nil
+	}
+	d.lastRoll = now
+
+	var alerts []Alert
+	for key, s := range d.stats {
+		x := float64(s.count)
+
+		if s.samples >= d.minSamples {
+			stddev := math.Max(math.Sqrt(s.variance), ewmaMinStdDev)
+			z := (x - s.mean) / stddev
+			if math.Abs(z) > d.threshold {
+				direction := "spike"
+				if z < 0 {
+					direction = "drop"
+				}
+				alerts = append(alerts, detectorAlert("EWMA Rate Anomaly", d.severity, s.lastLog, now, map[string]interface{}{
+					"detector":  "ewma",
+					"key":       key,
+					"direction": direction,
+					"count":     s.count,
+					"mean":      s.mean,
+					"stddev":    stddev,
+					"z_score":   z,
+					"interval":  d.interval.String(),
+				}))
+			}
+		}
+
+		// Fold the interval into the exponentially weighted model
+		if s.samples == 0 {
+			s.mean = x
+		} else {
+			diff := x - s.mean
+			incr := d.alpha * diff
+			s.mean += incr
+			s.variance = (1 - d.alpha) * (s.variance + diff*incr)
+		}
+		s.samples++
+		s.count = 0
+
+		// Forget keys that have gone quiet for good
+		if s.mean < 0.01 && x == 0 {
+			delete(d.stats, key)
+		}
+	}
+
+	return alerts
+}
+
+// baseline implements baseliner with the rate model of the log's key, once
+// it has seen enough intervals
+func (d *ewmaDetector) baseline(log parser.ParsedLog) (map[string]interface{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.stats[keyValue(log, d.key)]
+	if !ok || s.samples < d.minSamples {
+		return nil, false
+	}
+	return map[string]interface{}{
+		"ewma_mean":     s.mean,
+		"ewma_stddev":   math.Max(math.Sqrt(s.variance), ewmaMinStdDev),
+		"ewma_interval": d.interval.String(),
+	}, true
+}
+
+// ewmaModel is the saved model of one key
+type ewmaModel struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Samples  int     `json:"samples"`
+}
+
+// stateKey implements stateful
+func (d *ewmaDetector) stateKey() string {
+	return "ewma"
+}
+
+// saveState returns the model of every key
+func (d *ewmaDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	models := make(map[string]ewmaModel, len(d.stats))
+	for key, s := range d.stats {
+		models[key] = ewmaModel{Mean: s.mean, Variance: s.variance, Samples: s.samples}
+	}
+	return models
+}
+
+// restoreState reloads saved models. The interval in progress starts over.
+func (d *ewmaDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var models map[string]ewmaModel
+	if err := json.Unmarshal(data, &models); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, m := range models {
+		d.stats[key] = &ewmaStats{mean: m.Mean, variance: m.Variance, samples: m.Samples}
+	}
+	d.lastRoll = now
+	return nil
+}
@@ -0,0 +1,119 @@
+package analyzer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// featureColumn fills its columns of a feature vector from a log
+type featureColumn struct {
+	field     string
+	transform string
+	values    map[string]int
+	buckets   int
+	def       float64
+}
+
+// featureMap turns logs into fixed-width feature vectors for models
+type featureMap struct {
+	columns []featureColumn
+	width   int
+	names   []string
+}
+
+// compileFeatures validates a feature mapping and computes its width
+func compileFeatures(features []config.Feature) (*featureMap, error) {
+	if len(features) == 0 {
+		return nil, fmt.Errorf("no features")
+	}
+
+	m := &featureMap{}
+	for _, f := range features {
+		if f.Field == "" {
+			return nil, fmt.Errorf("feature without a field")
+		}
+		col := featureColumn{field: f.Field, transform: f.Transform, def: f.Default}
+		switch f.Transform {
+		case "", "value":
+			col.transform = "value"
+			m.names = append(m.names, f.Field)
+		case "length":
+			m.names = append(m.names, f.Field+":length")
+		case "one_hot":
+			if len(f.Values) == 0 {
+				return nil, fmt.Errorf("one_hot feature %s needs values", f.Field)
+			}
+			col.values = make(map[string]int, len(f.Values))
+			for i, v := range f.Values {
+				col.values[v] = i
+				m.names = append(m.names, f.Field+"="+v)
+			}
+		case "hash":
+			if f.Buckets <= 0 {
+				return nil, fmt.Errorf("hash feature %s needs buckets", f.Field)
+			}
+			col.buckets = f.Buckets
+			for i := 0; i < f.Buckets; i++ {
+				m.names = append(m.names, fmt.Sprintf("%s#%d", f.Field, i))
+			}
+		default:
+			return nil, fmt.Errorf("feature %s: unknown transform %q", f.Field, f.Transform)
+		}
+		m.columns = append(m.columns, col)
+	}
+	m.width = len(m.names)
+	return m, nil
+}
+
+// extract appends the feature vector of a log to dst
+func (m *featureMap) extract(dst []float32, log parser.ParsedLog) []float32 {
+	for _, col := range m.columns {
+		raw, ok := log.Lookup(col.field)
+		text := ""
+		if values := valueStrings(raw); ok && len(values) > 0 {
+			text = values[0]
+		}
+
+		switch col.transform {
+		case "value":
+			x, ok := toFloat(raw)
+			if !ok || math.IsNaN(x) || math.IsInf(x, 0) {
+				x = col.def
+			}
+			dst = append(dst, float32(x))
+		case "length":
+			dst = append(dst, float32(len(text)))
+		case "one_hot":
+			start := len(dst)
+			dst = append(dst, make([]float32, len(col.values))...)
+			if i, ok := col.values[text]; ok {
+				dst[start+i] = 1
+			}
+		case "hash":
+			start := len(dst)
+			dst = append(dst, make([]float32, col.buckets)...)
+			if text != "" {
+				h := fnv.New32a()
+				h.Write([]byte(text))
+				dst[start+int(h.Sum32()%uint32(col.buckets))] = 1
+			}
+		}
+	}
+	return dst
+}
+
+// named returns the non-zero columns of a feature vector keyed by name,
+// for alerts
+func (m *featureMap) named(vector []float32) map[string]float64 {
+	named := make(map[string]float64)
+	for i, x := range vector {
+		if x != 0 {
+			named[m.names[i]] = float64(x)
+		}
+	}
+	return named
+}
@@ -0,0 +1,283 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// Heartbeat rule defaults
+const (
+	defaultHeartbeatGrace = time.Minute
+
+	// heartbeatCheckInterval is how often heartbeats are checked for being
+	// overdue
+	heartbeatCheckInterval = 5 * time.Second
+)
+
+// heartbeatKey is when one key last sent its heartbeat
+type heartbeatKey struct {
+	lastSeen time.Time
+	lastLog  parser.ParsedLog
+	missed   bool
+}
+
+// heartbeatRule expects a matching log at least every period from each
+// key, e.g. a backup job's completion message, and alerts when one is
+// overdue. Until any key has been seen the rule as a whole is expected
+// from when it started.
+type heartbeatRule struct {
+	name     string
+	severity string
+	keyField string
+	check    func(parser.ParsedLog) bool
+	every    time.Duration
+	grace    time.Duration
+	mu       sync.Mutex
+	started  time.Time
+	resumed  time.Time
+	restored bool
+	keys     map[string]*heartbeatKey
+	missed   bool
+}
+
+// heartbeatState is the saved progress of a heartbeat rule
+type heartbeatState struct {
+	Started time.Time            `json:"started"`
+	Seen    map[string]time.Time `json:"seen"`
+}
+
+// compileHeartbeatRule compiles a rule spec expecting a regular heartbeat
+func compileHeartbeatRule(spec RuleSpec) (Rule, error) {
+	if len(spec.Match) == 0 {
+		return Rule{}, fmt.Errorf("no match conditions")
+	}
+	if spec.Heartbeat.Every <= 0 {
+		return Rule{}, fmt.Errorf("heartbeat needs an every period")
+	}
+	check, err := compileMatch(spec.Match)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	severity := strings.ToUpper(spec.Severity)
+	if severity == "" {
+		severity = "HIGH"
+	}
+
+	now := time.Now()
+	hr := &heartbeatRule{
+		name:     spec.Name,
+		severity: severity,
+		keyField: spec.Key,
+		check:    check,
+		every:    time.Duration(spec.Heartbeat.Every),
+		grace:    time.Duration(spec.Heartbeat.Grace),
+		started:  now,
+		resumed:  now,
+		keys:     make(map[string]*heartbeatKey),
+	}
+	if hr.grace <= 0 {
+		hr.grace = defaultHeartbeatGrace
+	}
+
+	return Rule{
+		Name:      spec.Name,
+		Severity:  severity,
+		Window:    hr.every,
+		Weight:    spec.Weight,
+		Priority:  spec.Priority,
+		Stop:      spec.Stop,
+		KeyField:  spec.Key,
+		Evaluate:  hr.evaluate,
+		heartbeat: hr,
+	}, nil
+}
+
+// evaluate records a heartbeat from the log's key. Heartbeats raise no
+// alerts when they arrive, only when they do not.
+func (hr *heartbeatRule) evaluate(logEntry parser.ParsedLog, now time.Time) (bool, []Alert) {
+	if !hr.check(logEntry) {
+		return false, nil
+	}
+	key := keyValue(logEntry, hr.keyField)
+
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	k, ok := hr.keys[key]
+	if !ok {
+		k = &heartbeatKey{}
+		hr.keys[key] = k
+	}
+	if now.After(k.lastSeen) {
+		k.lastSeen = now
+	}
+	k.lastLog = logEntry
+	k.missed = false
+	return false, nil
+}
+
+// due returns alerts for heartbeats that are overdue at now. A heartbeat
+// is overdue once its period and the grace period have passed, counting
+// from startup at the earliest, so that logs buffered while Argos was down
+// can catch up before a missed heartbeat is reported.
+func (hr *heartbeatRule) due(now time.Time) []Alert {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	var alerts []Alert
+	if len(hr.keys) == 0 {
+		if !hr.missed && hr.overdue(hr.started, now) {
+			hr.missed = true
+			alerts = append(alerts, hr.alert("", hr.started, parser.ParsedLog{}, now, true))
+		}
+		return alerts
+	}
+	for key, k := range hr.keys {
+		if !k.missed && hr.overdue(k.lastSeen, now) {
+			k.missed = true
+			alerts = append(alerts, hr.alert(key, k.lastSeen, k.lastLog, now, false))
+		}
+	}
+	return alerts
+}
+
+// overdue reports whether a heartbeat last seen at lastSeen is overdue
+func (hr *heartbeatRule) overdue(lastSeen, now time.Time) bool {
+	deadline := lastSeen.Add(hr.every)
+	if deadline.Before(hr.resumed) {
+		deadline = hr.resumed
+	}
+	return now.Sub(deadline) >= hr.grace
+}
+
+// alert builds a missed heartbeat alert
+func (hr *heartbeatRule) alert(key string, lastSeen time.Time, logEntry parser.ParsedLog, now time.Time, never bool) Alert {
+	metadata := map[string]interface{}{
+		"rule_name": hr.name,
+		"every":     hr.every.String(),
+		"overdue":   now.Sub(lastSeen.Add(hr.every)).Round(time.Second).String(),
+	}
+	if never {
+		metadata["never_seen"] = true
+		metadata["expected_since"] = lastSeen.Format(time.RFC3339)
+	} else {
+		metadata["key"] = key
+		metadata["last_seen"] = lastSeen.Format(time.RFC3339)
+	}
+	if hr.restored && lastSeen.Add(hr.every).Before(hr.resumed) {
+		metadata["missed_while_down"] = true
+	}
+	return Alert{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  hr.severity,
+		Reason:    hr.name,
+		Log:       logEntry,
+		Metadata:  metadata,
+	}
+}
+
+// inherit carries the heartbeats seen by the previous version of a
+// reloaded rule over
+func (hr *heartbeatRule) inherit(old *heartbeatRule) {
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	hr.started, hr.resumed, hr.restored = old.started, old.resumed, old.restored
+	hr.missed = old.missed
+	for key, k := range old.keys {
+		copied := *k
+		hr.keys[key] = &copied
+	}
+}
+
+// save returns when the rule started and when each key was last seen
+func (hr *heartbeatRule) save() heartbeatState {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	s := heartbeatState{Started: hr.started, Seen: make(map[string]time.Time, len(hr.keys))}
+	for key, k := range hr.keys {
+		s.Seen[key] = k.lastSeen
+	}
+	return s
+}
+
+// restore resumes saved heartbeats after a restart at now
+func (hr *heartbeatRule) restore(s heartbeatState, now time.Time) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	if !s.Started.IsZero() {
+		hr.started = s.Started
+	}
+	hr.resumed = now
+	hr.restored = true
+	for key, seen := range s.Seen {
+		k := &heartbeatKey{lastSeen: seen}
+		if hr.keyField == "" || hr.keyField == "source" {
+			k.lastLog = parser.ParsedLog{Source: key}
+		}
+		hr.keys[key] = k
+	}
+}
+
+// checkHeartbeats periodically raises alerts for overdue heartbeats
+func (a *Analyzer) checkHeartbeats() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(heartbeatCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if !a.heartbeatsDue(now) {
+				return
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
+
+// heartbeatsDue raises alerts for the heartbeats overdue at now, returning
+// false on shutdown
+func (a *Analyzer) heartbeatsDue(now time.Time) bool {
+	rules := a.Rules()
+	for _, rule := range rules {
+		if rule.heartbeat == nil || a.isDisabled(rule.ID) {
+			continue
+		}
+		for _, alert := range rule.heartbeat.due(now) {
+			if rule.feeds != nil {
+				if !a.feed(rules, rule, alert, now) {
+					return false
+				}
+				continue
+			}
+			a.scorer.score(&alert, rule.weight())
+			a.enrich(rule, &alert, now)
+			ruleMetricsFor(rule.Name).alerts.Add(1)
+			if !a.send(alert, now) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// startAt counts heartbeats from now rather than from when the rule was
+// loaded
+func (hr *heartbeatRule) startAt(now time.Time) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.started = now
+	hr.resumed = now
+}
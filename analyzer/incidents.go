@@ -0,0 +1,325 @@
+package analyzer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+)
+
+// Incident correlation defaults
+const (
+	defaultIncidentWindow   = 10 * time.Minute
+	defaultIncidentEvidence = 100
+
+	// incidentHistory is how many resolved incidents are kept for the API
+	incidentHistory = 100
+)
+
+// defaultIncidentFields are the fields alerts are correlated by when none
+// are configured
+var defaultIncidentFields = []string{"source", "ip", "template_id"}
+
+// Incident is a group of related alerts with its own lifecycle: it opens
+// with its first alert and resolves once no alert has joined it for the
+// correlation window
+type Incident struct {
+	ID         string   `json:"id"`
+	Status     string   `json:"status"`
+	Severity   string   `json:"severity"`
+	Score      float64  `json:"score"`
+	Opened     string   `json:"opened"`
+	Updated    string   `json:"updated"`
+	Resolved   string   `json:"resolved,omitempty"`
+	AlertCount int      `json:"alert_count"`
+	Rules      []string `json:"rules"`
+
+	// Keys are the field values that tied the alerts together, such as
+	// ip=10.0.0.1
+	Keys []string `json:"keys"`
+
+	// Evidence holds the most recent alerts of the incident
+	Evidence []Alert `json:"evidence,omitempty"`
+}
+
+// openIncident is an incident still accepting alerts
+type openIncident struct {
+	Incident
+	opened time.Time
+	last   time.Time
+}
+
+// incidentCorrelator groups alerts that share a correlation field value
+// and arrive within the window of each other into incidents
+type incidentCorrelator struct {
+	window      time.Duration
+	by          []string
+	collapse    bool
+	maxEvidence int
+	mu          sync.Mutex
+	open        map[string]*openIncident
+	index       map[string]string
+	resolved    []Incident
+}
+
+// EnableIncidents groups related alerts into incidents. Every alert leaving
+// the analyzer then carries the ID of its incident, and a summary alert is
+// sent when an incident resolves.
+func (a *Analyzer) EnableIncidents(cfg config.Incidents) {
+	c := &incidentCorrelator{
+		window:      time.Duration(cfg.Window),
+		by:          cfg.By,
+		collapse:    cfg.Collapse,
+		maxEvidence: cfg.MaxEvidence,
+		open:        make(map[string]*openIncident),
+		index:       make(map[string]string),
+	}
+	if c.window <= 0 {
+		c.window = defaultIncidentWindow
+	}
+	if len(c.by) == 0 {
+		c.by = defaultIncidentFields
+	}
+	if c.maxEvidence <= 0 {
+		c.maxEvidence = defaultIncidentEvidence
+	}
+	a.incidents = c
+}
+
+// assign adds an alert to the incident it correlates with, or opens a new
+// one, and reports whether the alert should be delivered
+func (c *incidentCorrelator) assign(alert *Alert, now time.Time) bool {
+	var keys []string
+	for _, field := range c.by {
+		if value := keyValue(alert.Log, field); value != "" {
+			keys = append(keys, field+"="+value)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Join the most recently active incident sharing a key
+	var inc *openIncident
+	for _, key := range keys {
+		candidate, ok := c.open[c.index[key]]
+		if ok && now.Sub(candidate.last) <= c.window && (inc == nil || candidate.last.After(inc.last)) {
+			inc = candidate
+		}
+	}
+
+	status := "correlated"
+	if inc == nil {
+		status = "opened"
+		inc = &openIncident{
+			Incident: Incident{
+				ID:       newIncidentID(),
+				Status:   "open",
+				Severity: alert.Severity,
+				Opened:   now.Format(time.RFC3339),
+			},
+			opened: now,
+		}
+		c.open[inc.ID] = inc
+	}
+
+	inc.last = now
+	inc.Updated = now.Format(time.RFC3339)
+	inc.AlertCount++
+	if severityWeight(alert.Severity) > severityWeight(inc.Severity) {
+		inc.Severity = alert.Severity
+	}
+	if alert.Score > inc.Score {
+		inc.Score = alert.Score
+	}
+	if !contains(inc.Rules, alert.Reason) {
+		inc.Rules = append(inc.Rules, alert.Reason)
+	}
+	for _, key := range keys {
+		if !contains(inc.Keys, key) {
+			inc.Keys = append(inc.Keys, key)
+		}
+		c.index[key] = inc.ID
+	}
+
+	// The metadata map may be shared with the deduper, so write to a copy
+	metadata := make(map[string]interface{}, len(alert.Metadata)+2)
+	for k, v := range alert.Metadata {
+		metadata[k] = v
+	}
+	metadata["incident_status"] = status
+	metadata["incident_alerts"] = inc.AlertCount
+	alert.Metadata = metadata
+	alert.IncidentID = inc.ID
+
+	inc.Evidence = append(inc.Evidence, *alert)
+	if len(inc.Evidence) > c.maxEvidence {
+		inc.Evidence = inc.Evidence[1:]
+	}
+	return status == "opened" || !c.collapse
+}
+
+// due resolves incidents that have been quiet for the window and returns
+// their summary alerts
+func (c *incidentCorrelator) due(now time.Time) []Alert {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var summaries []Alert
+	for id, inc := range c.open {
+		if now.Sub(inc.last) <= c.window {
+			continue
+		}
+		delete(c.open, id)
+		for _, key := range inc.Keys {
+			if c.index[key] == id {
+				delete(c.index, key)
+			}
+		}
+
+		inc.Status = "resolved"
+		inc.Resolved = now.Format(time.RFC3339)
+		c.resolved = append(c.resolved, inc.Incident)
+		if len(c.resolved) > incidentHistory {
+			c.resolved = c.resolved[1:]
+		}
+
+		last := inc.Evidence[len(inc.Evidence)-1]
+		summaries = append(summaries, Alert{
+			Timestamp:   now.Format(time.RFC3339),
+			Severity:    inc.Severity,
+			Reason:      "Incident Resolved",
+			Log:         last.Log,
+			Fingerprint: id,
+			Score:       inc.Score,
+			IncidentID:  id,
+			Metadata: map[string]interface{}{
+				"rule_name":       "Incident Resolved",
+				"incident_status": "resolved",
+				"incident_alerts": inc.AlertCount,
+				"rules":           inc.Rules,
+				"keys":            inc.Keys,
+				"opened":          inc.Opened,
+				"duration":        inc.last.Sub(inc.opened).Round(time.Second).String(),
+			},
+		})
+	}
+	return summaries
+}
+
+// list returns open incidents, newest first, then recently resolved ones,
+// without their evidence
+func (c *incidentCorrelator) list() []Incident {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	incidents := make([]Incident, 0, len(c.open)+len(c.resolved))
+	for _, inc := range c.open {
+		incidents = append(incidents, inc.Incident)
+	}
+	sort.Slice(incidents, func(i, j int) bool { return incidents[i].Opened > incidents[j].Opened })
+	for i := len(c.resolved) - 1; i >= 0; i-- {
+		incidents = append(incidents, c.resolved[i])
+	}
+	for i := range incidents {
+		incidents[i].Evidence = nil
+	}
+	return incidents
+}
+
+// get returns an open or recently resolved incident with its evidence
+func (c *incidentCorrelator) get(id string) (Incident, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if inc, ok := c.open[id]; ok {
+		incident := inc.Incident
+		incident.Evidence = append([]Alert(nil), inc.Evidence...)
+		return incident, true
+	}
+	for _, inc := range c.resolved {
+		if inc.ID == id {
+			return inc, true
+		}
+	}
+	return Incident{}, false
+}
+
+// flushIncidents periodically resolves quiet incidents
+func (a *Analyzer) flushIncidents() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, alert := range a.incidents.due(now) {
+				if !a.deliver(alert, now) {
+					return
+				}
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
+
+// newIncidentID returns a random incident ID
+func newIncidentID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "inc-" + hex.EncodeToString(b)
+}
+
+// contains reports whether a list holds a value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleIncidents serves GET requests for open and recently resolved
+// incidents
+func (a *Analyzer) HandleIncidents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.incidents == nil {
+		http.Error(w, "Incident correlation is not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.incidents.list())
+}
+
+// HandleIncident serves GET requests for one incident with its evidence
+func (a *Analyzer) HandleIncident(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.incidents == nil {
+		http.Error(w, "Incident correlation is not enabled", http.StatusNotFound)
+		return
+	}
+
+	incident, ok := a.incidents.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Incident not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(incident)
+}
@@ -0,0 +1,318 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Inter-arrival detector defaults
+const (
+	defaultInterArrivalMinSamples = 50
+	defaultInterArrivalWindow     = 10
+	defaultInterArrivalThreshold  = 3.0
+	defaultInterArrivalMinStall   = time.Minute
+	defaultInterArrivalMaxKeys    = 10000
+
+	// interArrivalAlpha is the smoothing factor of the learned gap
+	// distribution
+	interArrivalAlpha = 0.02
+
+	// interArrivalMinStd floors the standard deviation of the learned log
+	// gap, so that keys arriving like clockwork do not alert on jitter
+	interArrivalMinStd = 0.25
+
+	// interArrivalMinGap floors gaps, since the log of zero is undefined
+	interArrivalMinGap = time.Millisecond
+
+	// interArrivalIdle is how long a key may go unseen before it is
+	// forgotten
+	interArrivalIdle = 24 * time.Hour
+)
+
+// defaultInterArrivalFields are the fields logs are keyed by when none are
+// configured
+var defaultInterArrivalFields = []string{"source", "template_id"}
+
+// Inter-arrival states of a key
+const (
+	arrivalNormal = iota
+	arrivalBurst
+	arrivalSlow
+	arrivalStalled
+)
+
+// interArrivalKey is the learned and recent gaps between logs of one key.
+// Gaps are modeled by the mean and variance of their logarithm, as they
+// span orders of magnitude.
+type interArrivalKey struct {
+	mean     float64
+	variance float64
+	samples  int
+	last     time.Time
+	recent   []float64
+	next     int
+	state    int
+	lastLog  parser.ParsedLog
+}
+
+// interArrivalDetector learns the usual time between consecutive logs of
+// each key, such as a source and template, and alerts when recent gaps
+// become much shorter (a burst, e.g. a retry storm) or longer (a slowdown,
+// e.g. a stalled consumer), which rate-per-minute windows smear out
+type interArrivalDetector struct {
+	by         []string
+	minSamples int
+	window     int
+	threshold  float64
+	minStall   time.Duration
+	maxKeys    int
+	severity   string
+	mu         sync.Mutex
+	keys       map[string]*interArrivalKey
+}
+
+// newInterArrivalDetector creates an inter-arrival detector from its
+// configuration
+func newInterArrivalDetector(cfg config.InterArrival) *interArrivalDetector {
+	d := &interArrivalDetector{
+		by:         cfg.By,
+		minSamples: cfg.MinSamples,
+		window:     cfg.Window,
+		threshold:  cfg.Threshold,
+		minStall:   time.Duration(cfg.MinStall),
+		maxKeys:    cfg.MaxKeys,
+		severity:   strings.ToUpper(cfg.Severity),
+		keys:       make(map[string]*interArrivalKey),
+	}
+	if len(d.by) == 0 {
+		d.by = defaultInterArrivalFields
+	}
+	if d.minSamples <= 0 {
+		d.minSamples = defaultInterArrivalMinSamples
+	}
+	if d.window <= 0 {
+		d.window = defaultInterArrivalWindow
+	}
+	if d.threshold <= 0 {
+		d.threshold = defaultInterArrivalThreshold
+	}
+	if d.minStall <= 0 {
+		d.minStall = defaultInterArrivalMinStall
+	}
+	if d.maxKeys <= 0 {
+		d.maxKeys = defaultInterArrivalMaxKeys
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	return d
+}
+
+// key returns the key a log is tracked under
+func (d *interArrivalDetector) key(logEntry parser.ParsedLog) string {
+	values := make([]string, len(d.by))
+	for i, field := range d.by {
+		values[i] = keyValue(logEntry, field)
+	}
+	return strings.Join(values, "|")
+}
+
+// Observe records the gap since the previous log of the same key and
+// judges the recent gaps against the learned ones
+func (d *interArrivalDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	key := d.key(logEntry)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k, ok := d.keys[key]
+	if !ok {
+		if len(d.keys) >= d.maxKeys {
+			return nil
+		}
+		d.keys[key] = &interArrivalKey{last: now, lastLog: logEntry}
+		return nil
+	}
+
+	// A log standing for repeats spreads its gap over them
+	gap := now.Sub(k.last) / time.Duration(logEntry.RepeatCount)
+	k.last = now
+	k.lastLog = logEntry
+	lg := math.Log(max(gap, interArrivalMinGap).Seconds())
+
+	if len(k.recent) < d.window {
+		k.recent = append(k.recent, lg)
+	} else {
+		k.recent[k.next] = lg
+		k.next = (k.next + 1) % d.window
+	}
+
+	var alerts []Alert
+	if k.samples >= d.minSamples && len(k.recent) == d.window {
+		recent := 0.0
+		for _, v := range k.recent {
+			recent += v
+		}
+		recent /= float64(len(k.recent))
+		z := (recent - k.mean) / k.std()
+
+		state := arrivalNormal
+		if z <= -d.threshold {
+			state = arrivalBurst
+		} else if z >= d.threshold {
+			state = arrivalSlow
+		}
+		// A slowdown right after a stall is the same episode
+		if state != arrivalNormal && state != k.state && !(state == arrivalSlow && k.state == arrivalStalled) {
+			alerts = append(alerts, d.alert(key, k, state, math.Exp(recent), z, now))
+		}
+		if state != arrivalSlow || k.state != arrivalStalled {
+			k.state = state
+		}
+	}
+
+	// Outlying gaps are clipped before they are learned, and the spread is
+	// only learned while the key behaves, so that a burst does not widen
+	// the learned distribution; a lasting change still moves the mean
+	if k.samples == 0 {
+		k.mean = lg
+	} else {
+		limit := d.threshold * k.std()
+		diff := math.Max(-limit, math.Min(lg-k.mean, limit))
+		k.mean += interArrivalAlpha * diff
+		if k.state == arrivalNormal {
+			k.variance = (1 - interArrivalAlpha) * (k.variance + interArrivalAlpha*diff*diff)
+		}
+	}
+	k.samples++
+	return alerts
+}
+
+// Tick alerts on keys that have gone silent for far longer than their
+// usual gap, which Observe cannot see until the next log arrives, and
+// forgets keys idle for a day
+func (d *interArrivalDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var alerts []Alert
+	for key, k := range d.keys {
+		open := now.Sub(k.last)
+		if open > interArrivalIdle {
+			delete(d.keys, key)
+			continue
+		}
+		if k.samples < d.minSamples || k.state == arrivalStalled || open < d.minStall {
+			continue
+		}
+		z := (math.Log(open.Seconds()) - k.mean) / k.std()
+		if z >= d.threshold {
+			k.state = arrivalStalled
+			alerts = append(alerts, d.alert(key, k, arrivalStalled, open.Seconds(), z, now))
+		}
+	}
+	return alerts
+}
+
+// std returns the floored standard deviation of a key's learned log gap
+func (k *interArrivalKey) std() float64 {
+	return math.Max(math.Sqrt(k.variance), interArrivalMinStd)
+}
+
+// alert builds an inter-arrival alert for a key whose recent gap, in
+// seconds, departs from the usual one
+func (d *interArrivalDetector) alert(key string, k *interArrivalKey, state int, gap, z float64, now time.Time) Alert {
+	usual := math.Exp(k.mean)
+	name := "Inter-Arrival Slowdown"
+	if state == arrivalBurst {
+		name = "Inter-Arrival Burst"
+	}
+	description := fmt.Sprintf("logs of %s arrive every %s, usually every %s", key, secondsDuration(gap), secondsDuration(usual))
+	if state == arrivalStalled {
+		description = fmt.Sprintf("no log of %s for %s, usually every %s", key, secondsDuration(gap), secondsDuration(usual))
+	}
+
+	return detectorAlert(name, d.severity, k.lastLog, now, map[string]interface{}{
+		"detector":    "inter_arrival",
+		"key":         key,
+		"gap":         secondsDuration(gap).String(),
+		"usual_gap":   secondsDuration(usual).String(),
+		"z_score":     z,
+		"stalled":     state == arrivalStalled,
+		"samples":     k.samples,
+		"last_seen":   k.last.Format(time.RFC3339),
+		"description": description,
+	})
+}
+
+// secondsDuration converts seconds to a duration rounded for display
+func secondsDuration(seconds float64) time.Duration {
+	d := time.Duration(seconds * float64(time.Second))
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second)
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// savedInterArrival is the saved learned gap distribution of one key
+type savedInterArrival struct {
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"`
+	Samples  int       `json:"samples"`
+	Last     time.Time `json:"last"`
+}
+
+// stateKey implements stateful
+func (d *interArrivalDetector) stateKey() string {
+	return "inter_arrival"
+}
+
+// saveState returns the learned gap distribution of every key
+func (d *interArrivalDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := make(map[string]savedInterArrival, len(d.keys))
+	for key, k := range d.keys {
+		if k.samples == 0 {
+			continue
+		}
+		keys[key] = savedInterArrival{Mean: k.mean, Variance: k.variance, Samples: k.samples, Last: k.last}
+	}
+	return keys
+}
+
+// restoreState reloads learned gap distributions. The gap spanning the
+// restart is not learned, and the recent gaps start over.
+func (d *interArrivalDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var keys map[string]savedInterArrival
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, saved := range keys {
+		if now.Sub(saved.Last) > interArrivalIdle {
+			continue
+		}
+		d.keys[key] = &interArrivalKey{
+			mean:     saved.Mean,
+			variance: saved.Variance,
+			samples:  saved.Samples,
+			last:     now,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// Join rule defaults
+const (
+	defaultJoinWindow = 2 * time.Minute
+
+	// joinPruneInterval is how often keys without recent matches are dropped
+	joinPruneInterval = time.Minute
+)
+
+// joinHit is a number of matches of a join part at one time
+type joinHit struct {
+	at     time.Time
+	count  int
+	source string
+}
+
+// joinPart is a compiled part of a join rule
+type joinPart struct {
+	name  string
+	check func(parser.ParsedLog) bool
+	count int
+}
+
+// joinState holds the recent matches of every part for one key, oldest
+// first, trimmed to what is needed to reach each part's count
+type joinState struct {
+	hits [][]joinHit
+}
+
+// joinRule fires when every one of its parts has matched within the
+// window, whatever order the matches come in. The parts usually select
+// logs of different sources, so that problems showing up across several
+// services at once raise one alert, e.g. a 5xx spike of the payment API
+// together with connection errors of the database proxy. With a key, only
+// logs sharing its value are joined.
+type joinRule struct {
+	name      string
+	severity  string
+	keyField  string
+	window    time.Duration
+	parts     []joinPart
+	mu        sync.Mutex
+	states    map[string]*joinState
+	lastPrune time.Time
+}
+
+// compileJoinRule compiles a rule spec with join parts
+func compileJoinRule(spec RuleSpec) (Rule, error) {
+	if spec.Script != "" || len(spec.Sequence) > 0 || spec.Distinct != "" || spec.Threshold > 0 || spec.SpikeFactor > 0 || spec.Counter != "" || len(spec.Match) > 0 {
+		return Rule{}, fmt.Errorf("join rules only take join parts, a key and a window")
+	}
+	if len(spec.Join) < 2 {
+		return Rule{}, fmt.Errorf("join rules need at least two parts")
+	}
+
+	severity := strings.ToUpper(spec.Severity)
+	if severity == "" {
+		severity = "MEDIUM"
+	}
+
+	jr := &joinRule{
+		name:     spec.Name,
+		severity: severity,
+		keyField: spec.Key,
+		window:   time.Duration(spec.Window),
+		states:   make(map[string]*joinState),
+	}
+	if jr.window <= 0 {
+		jr.window = defaultJoinWindow
+	}
+
+	for i, part := range spec.Join {
+		if len(part.Match) == 0 {
+			return Rule{}, fmt.Errorf("join part %d has no match conditions", i+1)
+		}
+		check, err := compileMatch(part.Match)
+		if err != nil {
+			return Rule{}, fmt.Errorf("join part %d: %w", i+1, err)
+		}
+		name := part.Name
+		if name == "" {
+			name = fmt.Sprintf("part %d", i+1)
+		}
+		count := part.Count
+		if count <= 0 {
+			count = 1
+		}
+		jr.parts = append(jr.parts, joinPart{name: name, check: check, count: count})
+	}
+
+	return Rule{
+		Name:     spec.Name,
+		Severity: severity,
+		Window:   jr.window,
+		Weight:   spec.Weight,
+		Priority: spec.Priority,
+		Stop:     spec.Stop,
+		KeyField: spec.Key,
+		Evaluate: jr.evaluate,
+	}, nil
+}
+
+// evaluate records the parts a log matches at now, raising an alert once
+// every part has enough matches within the window
+func (jr *joinRule) evaluate(logEntry parser.ParsedLog, now time.Time) (bool, []Alert) {
+	key := ""
+	if jr.keyField != "" {
+		key = keyValue(logEntry, jr.keyField)
+	}
+
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if now.Sub(jr.lastPrune) >= joinPruneInterval {
+		jr.prune(now)
+	}
+
+	state := jr.states[key]
+	matched := false
+	for i, part := range jr.parts {
+		if !part.check(logEntry) {
+			continue
+		}
+		if state == nil {
+			state = &joinState{hits: make([][]joinHit, len(jr.parts))}
+			jr.states[key] = state
+		}
+		state.hits[i] = append(state.hits[i], joinHit{at: now, count: logEntry.RepeatCount, source: logEntry.Source})
+		matched = true
+	}
+	if !matched {
+		return false, nil
+	}
+
+	counts := make(map[string]int, len(jr.parts))
+	first := now
+	for i, part := range jr.parts {
+		n := state.trim(i, now.Add(-jr.window), part.count)
+		if n < part.count {
+			return false, nil
+		}
+		counts[part.name] = n
+		if state.hits[i][0].at.Before(first) {
+			first = state.hits[i][0].at
+		}
+	}
+
+	sources := make(map[string][]string, len(jr.parts))
+	for i, part := range jr.parts {
+		for _, hit := range state.hits[i] {
+			if !contains(sources[part.name], hit.source) {
+				sources[part.name] = append(sources[part.name], hit.source)
+			}
+		}
+	}
+	delete(jr.states, key)
+
+	metadata := map[string]interface{}{
+		"rule_name": jr.name,
+		"window":    jr.window.String(),
+		"counts":    counts,
+		"sources":   sources,
+		"started":   first.Format(time.RFC3339),
+		"duration":  now.Sub(first).Round(time.Millisecond).String(),
+	}
+	if jr.keyField != "" {
+		metadata["key"] = key
+	}
+	return false, []Alert{{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  jr.severity,
+		Reason:    jr.name,
+		Log:       logEntry,
+		Metadata:  metadata,
+	}}
+}
+
+// trim drops matches of a part older than since and those not needed to
+// reach its count, returning the count of those left
+func (s *joinState) trim(part int, since time.Time, count int) int {
+	hits := s.hits[part]
+	total := 0
+	for _, hit := range hits {
+		total += hit.count
+	}
+	for len(hits) > 0 && (hits[0].at.Before(since) || total-hits[0].count >= count) {
+		total -= hits[0].count
+		hits = hits[1:]
+	}
+	s.hits[part] = hits
+	return total
+}
+
+// prune drops keys with no matches within the window
+func (jr *joinRule) prune(now time.Time) {
+	since := now.Add(-jr.window)
+	for key, state := range jr.states {
+		active := false
+		for _, hits := range state.hits {
+			if len(hits) > 0 && !hits[len(hits)-1].at.Before(since) {
+				active = true
+				break
+			}
+		}
+		if !active {
+			delete(jr.states, key)
+		}
+	}
+	jr.lastPrune = now
+}
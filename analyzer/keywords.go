@@ -0,0 +1,186 @@
+package analyzer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultSecurityKeywords is the "security" keyword list unless a file
+// replaces it
+var defaultSecurityKeywords = []string{"attack", "breach", "unauthorized", "exploit", "malicious"}
+
+// keywordList is a named set of words, loaded from a file and swapped
+// atomically when the file changes, so rules compiled against it always
+// see the current words
+type keywordList struct {
+	name    string
+	path    string
+	words   atomic.Pointer[map[string]bool]
+	modTime time.Time
+}
+
+// keywordLists holds the keyword lists shared by all rules and tenants
+var keywordLists = struct {
+	mu    sync.Mutex
+	lists map[string]*keywordList
+}{lists: make(map[string]*keywordList)}
+
+func init() {
+	security := &keywordList{name: "security"}
+	security.set(defaultSecurityKeywords)
+	keywordLists.lists[security.name] = security
+}
+
+// set replaces the words of the list
+func (l *keywordList) set(words []string) {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[strings.ToLower(w)] = true
+	}
+	l.words.Store(&set)
+}
+
+// contains reports whether a word is on the list
+func (l *keywordList) contains(word string) bool {
+	return (*l.words.Load())[word]
+}
+
+// matchesAny reports whether any word of the values is on the list. Values
+// are split into words the way the parser extracts keywords.
+func (l *keywordList) matchesAny(values []string) bool {
+	words := *l.words.Load()
+	for _, value := range values {
+		for _, word := range strings.Fields(value) {
+			if words[strings.ToLower(strings.Trim(word, ".,;:!?"))] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// load reads the list's file, one word per line with # comments
+func (l *keywordList) load() error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read keyword list %s: %w", l.name, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read keyword list %s: %w", l.name, err)
+	}
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line != "" {
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read keyword list %s: %w", l.name, err)
+	}
+
+	l.set(words)
+	l.modTime = info.ModTime()
+	log.Printf("Loaded %d keywords into list %s from %s", len(words), l.name, l.path)
+	return nil
+}
+
+// LoadKeywordLists loads keyword lists from files by name, e.g. "payment"
+// from payment.txt. A "security" file replaces the built-in security words
+// used by the Suspicious Keywords rule. Lists must be loaded before the
+// rules that use them are compiled.
+func LoadKeywordLists(files map[string]string) error {
+	keywordLists.mu.Lock()
+	defer keywordLists.mu.Unlock()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l, ok := keywordLists.lists[name]
+		if !ok {
+			l = &keywordList{name: name}
+			l.set(nil)
+		}
+		l.path = files[name]
+		if err := l.load(); err != nil {
+			return err
+		}
+		keywordLists.lists[name] = l
+	}
+	return nil
+}
+
+// ReloadKeywordLists re-reads the keyword list files that changed since
+// they were loaded. Lists that fail to load keep their words.
+func ReloadKeywordLists() error {
+	keywordLists.mu.Lock()
+	defer keywordLists.mu.Unlock()
+
+	var errs []error
+	for _, l := range keywordLists.lists {
+		if l.path == "" {
+			continue
+		}
+		info, err := os.Stat(l.path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read keyword list %s: %w", l.name, err))
+			continue
+		}
+		if info.ModTime().Equal(l.modTime) {
+			continue
+		}
+		if err := l.load(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WatchKeywordLists polls the keyword list files and reloads them when
+// they change, until shutdown is closed
+func WatchKeywordLists(shutdown <-chan struct{}) {
+	ticker := time.NewTicker(rulesPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ReloadKeywordLists(); err != nil {
+				log.Printf("Keyword list reload failed, keeping current words: %v", err)
+			}
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// keywordListNamed returns a loaded keyword list
+func keywordListNamed(name string) (*keywordList, error) {
+	keywordLists.mu.Lock()
+	defer keywordLists.mu.Unlock()
+
+	l, ok := keywordLists.lists[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown keyword list %q", name)
+	}
+	return l, nil
+}
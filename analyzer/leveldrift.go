@@ -0,0 +1,264 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Level drift detector defaults
+const (
+	defaultLevelDriftInterval   = time.Minute
+	defaultLevelDriftMinLogs    = 20
+	defaultLevelDriftMinSamples = 10
+	defaultLevelDriftShift      = 0.3
+
+	// levelDriftAlpha is the smoothing factor of the learned distribution
+	levelDriftAlpha = 0.1
+)
+
+// levelNames are the level groups a distribution is kept over, so that
+// spellings such as WARN and WARNING count alike
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR", "CRITICAL", "OTHER"}
+
+// levelMix is the share of logs at each level group
+type levelMix [len(levelNames)]float64
+
+// levelDriftSource is the learned and current level mix of one source
+type levelDriftSource struct {
+	learned  levelMix
+	samples  int
+	current  levelMix
+	count    int
+	drifting bool
+	lastLog  parser.ParsedLog
+}
+
+// levelDriftDetector learns the usual mix of log levels of each source and
+// alerts when it shifts, such as the share of errors climbing while info
+// logs dry up, which often precedes user-visible failures
+type levelDriftDetector struct {
+	interval   time.Duration
+	minLogs    int
+	minSamples int
+	shift      float64
+	severity   string
+	mu         sync.Mutex
+	sources    map[string]*levelDriftSource
+	lastRoll   time.Time
+}
+
+// newLevelDriftDetector creates a level drift detector from its
+// configuration
+func newLevelDriftDetector(cfg config.LevelDrift) *levelDriftDetector {
+	d := &levelDriftDetector{
+		interval:   time.Duration(cfg.Interval),
+		minLogs:    cfg.MinLogs,
+		minSamples: cfg.MinSamples,
+		shift:      cfg.Shift,
+		severity:   strings.ToUpper(cfg.Severity),
+		sources:    make(map[string]*levelDriftSource),
+		lastRoll:   time.Now(),
+	}
+	if d.interval <= 0 {
+		d.interval = defaultLevelDriftInterval
+	}
+	if d.minLogs <= 0 {
+		d.minLogs = defaultLevelDriftMinLogs
+	}
+	if d.minSamples <= 0 {
+		d.minSamples = defaultLevelDriftMinSamples
+	}
+	if d.shift <= 0 || d.shift > 1 {
+		d.shift = defaultLevelDriftShift
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	return d
+}
+
+// levelGroup returns the index of the level group a level belongs to
+func levelGroup(level string) int {
+	switch strings.ToUpper(level) {
+	case "DEBUG", "TRACE":
+		return 0
+	case "INFO", "NOTICE":
+		return 1
+	case "WARN", "WARNING":
+		return 2
+	case "ERROR", "ERR":
+		return 3
+	case "CRITICAL", "CRIT", "FATAL", "ALERT", "EMERG", "EMERGENCY", "PANIC":
+		return 4
+	}
+	return 5
+}
+
+// Observe counts a log toward its source's level mix for the current
+// interval
+func (d *levelDriftDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sources[logEntry.Source]
+	if !ok {
+		s = &levelDriftSource{}
+		d.sources[logEntry.Source] = s
+	}
+	s.current[levelGroup(logEntry.Level)] += float64(logEntry.RepeatCount)
+	s.count += logEntry.RepeatCount
+	s.lastLog = logEntry
+	return nil
+}
+
+// Tick closes the current interval once it has elapsed, comparing each
+// source's level mix to the learned one before folding it in
+func (d *levelDriftDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastRoll) < d.interval {
+		return nil
+	}
+	d.lastRoll = now
+
+	var alerts []Alert
+	for source, s := range d.sources {
+		if s.count < d.minLogs {
+			if s.count == 0 && s.samples == 0 {
+				delete(d.sources, source)
+			}
+			s.current, s.count = levelMix{}, 0
+			continue
+		}
+
+		current := s.current
+		for i := range current {
+			current[i] /= float64(s.count)
+		}
+		if s.samples >= d.minSamples {
+			dist := s.learned.distance(current)
+			if dist > d.shift && !s.drifting {
+				alerts = append(alerts, d.alert(source, s, current, dist, now))
+			}
+			s.drifting = dist > d.shift
+		}
+
+		if s.samples == 0 {
+			s.learned = current
+		} else {
+			for i := range s.learned {
+				s.learned[i] += levelDriftAlpha * (current[i] - s.learned[i])
+			}
+		}
+		s.samples++
+		s.current, s.count = levelMix{}, 0
+	}
+	return alerts
+}
+
+// alert builds a level drift alert describing the levels whose share moved
+// the most
+func (d *levelDriftDetector) alert(source string, s *levelDriftSource, current levelMix, dist float64, now time.Time) Alert {
+	before := make(map[string]float64)
+	after := make(map[string]float64)
+	var moved []int
+	for i, name := range levelNames {
+		if s.learned[i] > 0 || current[i] > 0 {
+			before[name] = math.Round(s.learned[i]*1000) / 1000
+			after[name] = math.Round(current[i]*1000) / 1000
+			moved = append(moved, i)
+		}
+	}
+	sort.SliceStable(moved, func(i, j int) bool {
+		return math.Abs(current[moved[i]]-s.learned[moved[i]]) > math.Abs(current[moved[j]]-s.learned[moved[j]])
+	})
+
+	var changes []string
+	for _, i := range moved[:min(len(moved), 2)] {
+		changes = append(changes, fmt.Sprintf("%s %.0f%% -> %.0f%%", levelNames[i], s.learned[i]*100, current[i]*100))
+	}
+	return detectorAlert("Log Level Drift", d.severity, s.lastLog, now, map[string]interface{}{
+		"detector":     "level_drift",
+		"source":       source,
+		"distance":     dist,
+		"levels_now":   after,
+		"levels_usual": before,
+		"logs":         s.count,
+		"interval":     d.interval.String(),
+		"description":  fmt.Sprintf("log levels of %s shifted: %s", source, strings.Join(changes, "; ")),
+	})
+}
+
+// distance returns the total variation distance between two level mixes,
+// from 0 for identical to 1 for disjoint
+func (m levelMix) distance(other levelMix) float64 {
+	dist := 0.0
+	for i := range m {
+		dist += math.Abs(m[i] - other[i])
+	}
+	return dist / 2
+}
+
+// savedLevelDrift is the saved learned level mix of one source
+type savedLevelDrift struct {
+	Learned map[string]float64 `json:"learned"`
+	Samples int                `json:"samples"`
+}
+
+// stateKey implements stateful
+func (d *levelDriftDetector) stateKey() string {
+	return "level_drift"
+}
+
+// saveState returns the learned level mix of every source
+func (d *levelDriftDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sources := make(map[string]savedLevelDrift, len(d.sources))
+	for source, s := range d.sources {
+		if s.samples == 0 {
+			continue
+		}
+		learned := make(map[string]float64, len(levelNames))
+		for i, name := range levelNames {
+			learned[name] = s.learned[i]
+		}
+		sources[source] = savedLevelDrift{Learned: learned, Samples: s.samples}
+	}
+	return sources
+}
+
+// restoreState reloads learned level mixes. The interval in progress
+// starts over.
+func (d *levelDriftDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var sources map[string]savedLevelDrift
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for source, saved := range sources {
+		s := &levelDriftSource{
+			samples: saved.Samples,
+			lastLog: parser.ParsedLog{Source: source},
+		}
+		for i, name := range levelNames {
+			s.learned[i] = saved.Learned[name]
+		}
+		d.sources[source] = s
+	}
+	d.lastRoll = now
+	return nil
+}
@@ -0,0 +1,344 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day
+// of month, month and day of week
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domAny and dowAny record unrestricted day fields; when both day
+	// fields are restricted, either may match, as in cron
+	domAny, dowAny bool
+}
+
+// parseCron parses a cron expression such as "0 2 * * 6" (02:00 every
+// Saturday). Fields take *, numbers, ranges (1-5), steps (*/15, 0-30/5) and
+// comma-separated lists; day of week 7 is Sunday like 0.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q needs 5 fields", expr)
+	}
+
+	s := &cronSchedule{}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField returns the set of values a cron field allows as bits
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+
+		start, end := lo, hi
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if stepped {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matches reports whether the schedule fires in the minute of t
+func (s *cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// maintenanceWindow mutes the alerts it covers while it is active
+type maintenanceWindow struct {
+	name     string
+	expr     string
+	schedule *cronSchedule
+	duration time.Duration
+	location *time.Location
+	start    time.Time
+	end      time.Time
+	rules    map[string]bool
+	sources  map[string]bool
+	tenants  map[string]bool
+
+	mu         sync.Mutex
+	lastMinute time.Time
+	lastActive bool
+	silenced   int64
+}
+
+// maintenanceSchedule is the set of configured maintenance windows
+type maintenanceSchedule struct {
+	windows []*maintenanceWindow
+}
+
+// MaintenanceStatus describes a maintenance window for the admin API
+type MaintenanceStatus struct {
+	Name     string   `json:"name"`
+	Active   bool     `json:"active"`
+	Schedule string   `json:"schedule,omitempty"`
+	Duration string   `json:"duration,omitempty"`
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Rules    []string `json:"rules,omitempty"`
+	Sources  []string `json:"sources,omitempty"`
+	Tenants  []string `json:"tenants,omitempty"`
+	Silenced int64    `json:"silenced"`
+}
+
+// SetMaintenance configures maintenance windows, during which the alerts
+// they cover are counted but not sent. It must be called before Start.
+func (a *Analyzer) SetMaintenance(windows []config.MaintenanceWindow) error {
+	if len(windows) == 0 {
+		a.maintenance = nil
+		return nil
+	}
+
+	m := &maintenanceSchedule{}
+	for i, cfg := range windows {
+		w, err := compileMaintenanceWindow(cfg)
+		if err != nil {
+			name := cfg.Name
+			if name == "" {
+				name = strconv.Itoa(i + 1)
+			}
+			return fmt.Errorf("maintenance window %s: %w", name, err)
+		}
+		m.windows = append(m.windows, w)
+	}
+	a.maintenance = m
+	return nil
+}
+
+// compileMaintenanceWindow validates a maintenance window, which is either
+// recurring, with a cron schedule and duration, or a one-off with a start
+// and end
+func compileMaintenanceWindow(cfg config.MaintenanceWindow) (*maintenanceWindow, error) {
+	w := &maintenanceWindow{
+		name:     cfg.Name,
+		expr:     cfg.Schedule,
+		duration: time.Duration(cfg.Duration),
+		location: time.UTC,
+		rules:    setOf(cfg.Rules),
+		sources:  setOf(cfg.Sources),
+		tenants:  setOf(cfg.Tenants),
+	}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		w.location = loc
+	}
+
+	switch {
+	case cfg.Schedule != "" && (cfg.Start != "" || cfg.End != ""):
+		return nil, fmt.Errorf("takes either a schedule or a start and end")
+	case cfg.Schedule != "":
+		schedule, err := parseCron(cfg.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		if w.duration <= 0 {
+			return nil, fmt.Errorf("schedule needs a duration")
+		}
+		w.schedule = schedule
+	case cfg.Start != "" && cfg.End != "":
+		var err error
+		if w.start, err = time.ParseInLocation(time.RFC3339, cfg.Start, w.location); err != nil {
+			return nil, fmt.Errorf("invalid start: %w", err)
+		}
+		if w.end, err = time.ParseInLocation(time.RFC3339, cfg.End, w.location); err != nil {
+			return nil, fmt.Errorf("invalid end: %w", err)
+		}
+		if !w.end.After(w.start) {
+			return nil, fmt.Errorf("ends before it starts")
+		}
+	default:
+		return nil, fmt.Errorf("needs a schedule or a start and end")
+	}
+	return w, nil
+}
+
+// setOf turns a list into a set, or nil for an empty list
+func setOf(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// active reports whether the window is in effect at now. Recurring windows
+// are in effect for their duration after each minute their schedule
+// matches; the answer is cached per minute.
+func (w *maintenanceWindow) active(now time.Time) bool {
+	if w.schedule == nil {
+		return !now.Before(w.start) && now.Before(w.end)
+	}
+
+	minute := now.In(w.location).Truncate(time.Minute)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if minute.Equal(w.lastMinute) {
+		return w.lastActive
+	}
+	w.lastMinute = minute
+	w.lastActive = false
+	for t := minute; now.Sub(t) < w.duration; t = t.Add(-time.Minute) {
+		if w.schedule.matches(t) {
+			w.lastActive = true
+			break
+		}
+	}
+	return w.lastActive
+}
+
+// covers reports whether an alert falls under the window's rules, sources
+// and tenants
+func (w *maintenanceWindow) covers(alert Alert) bool {
+	if w.rules != nil && !w.rules[alert.Reason] && !w.rules[RuleID(alert.Reason)] {
+		return false
+	}
+	if w.sources != nil && !w.sources[alert.Log.Source] {
+		return false
+	}
+	if w.tenants != nil && !w.tenants[alert.Log.Tenant] {
+		return false
+	}
+	return true
+}
+
+// silences reports whether an active window covers an alert, counting it
+// against the first such window
+func (m *maintenanceSchedule) silences(alert Alert, now time.Time) bool {
+	for _, w := range m.windows {
+		if w.covers(alert) && w.active(now) {
+			w.mu.Lock()
+			w.silenced++
+			w.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// Maintenance returns the configured maintenance windows and whether they
+// are in effect
+func (a *Analyzer) Maintenance() []MaintenanceStatus {
+	if a.maintenance == nil {
+		return []MaintenanceStatus{}
+	}
+
+	now := time.Now()
+	statuses := make([]MaintenanceStatus, 0, len(a.maintenance.windows))
+	for _, w := range a.maintenance.windows {
+		s := MaintenanceStatus{
+			Name:    w.name,
+			Active:  w.active(now),
+			Rules:   setKeys(w.rules),
+			Sources: setKeys(w.sources),
+			Tenants: setKeys(w.tenants),
+		}
+		if w.schedule != nil {
+			s.Schedule = w.expr
+			s.Duration = w.duration.String()
+		} else {
+			s.Start = w.start.Format(time.RFC3339)
+			s.End = w.end.Format(time.RFC3339)
+		}
+		w.mu.Lock()
+		s.Silenced = w.silenced
+		w.mu.Unlock()
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// setKeys returns the members of a set, sorted
+func setKeys(set map[string]bool) []string {
+	var keys []string
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// HandleMaintenance serves GET requests for the maintenance windows
+func (a *Analyzer) HandleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Maintenance())
+}
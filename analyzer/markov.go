@@ -0,0 +1,341 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Markov detector defaults
+const (
+	defaultMarkovField      = "template_id"
+	defaultMarkovWindow     = 20
+	defaultMarkovThreshold  = 5.0
+	defaultMarkovMinWindows = 50
+
+	// markovAlpha is the smoothing factor of the usual window likelihood,
+	// and markovMinStdDev keeps scores finite for perfectly regular flows
+	markovAlpha     = 0.05
+	markovMinStdDev = 0.1
+
+	// markovMaxStates bounds the states of a chain, beyond which new
+	// values share the markovOther state; counts are halved once a chain
+	// has seen markovMaxTransitions, so old habits fade
+	markovMaxStates      = 1000
+	markovOther          = "*"
+	markovMaxTransitions = 100000
+
+	// markovMaxChains bounds the keys followed, and chains without events
+	// for markovIdleTTL are forgotten
+	markovMaxChains = 10000
+	markovIdleTTL   = 24 * time.Hour
+
+	// markovReported is how many of the least likely transitions of a
+	// window are quoted in alerts
+	markovReported = 3
+)
+
+// markovStep is one scored transition of a window
+type markovStep struct {
+	from, to string
+	p        float64
+}
+
+// markovChain is the transition model and current window of one key
+type markovChain struct {
+	transitions map[string]map[string]float64
+	totals      map[string]float64
+	states      map[string]bool
+	total       float64
+	prev        string
+	sum         float64
+	steps       []markovStep
+	mean        float64
+	variance    float64
+	windows     int
+	alerting    bool
+	lastLog     parser.ParsedLog
+	lastSeen    time.Time
+}
+
+// newMarkovChain creates an empty chain
+func newMarkovChain() *markovChain {
+	return &markovChain{
+		transitions: make(map[string]map[string]float64),
+		totals:      make(map[string]float64),
+		states:      make(map[string]bool),
+	}
+}
+
+// state maps a value to a state of the chain
+func (c *markovChain) state(value string) string {
+	if c.states[value] || len(c.states) < markovMaxStates {
+		c.states[value] = true
+		return value
+	}
+	c.states[markovOther] = true
+	return markovOther
+}
+
+// probability returns the smoothed probability of a transition, leaving
+// some mass for transitions never seen
+func (c *markovChain) probability(from, to string) float64 {
+	return (c.transitions[from][to] + 1) / (c.totals[from] + float64(len(c.states)) + 1)
+}
+
+// learn counts a transition, halving every count once the chain is full
+func (c *markovChain) learn(from, to string) {
+	next, ok := c.transitions[from]
+	if !ok {
+		next = make(map[string]float64)
+		c.transitions[from] = next
+	}
+	next[to]++
+	c.totals[from]++
+	c.total++
+
+	if c.total < markovMaxTransitions {
+		return
+	}
+	c.total = 0
+	for from, next := range c.transitions {
+		c.totals[from] = 0
+		for to, n := range next {
+			if n /= 2; n < 0.5 {
+				delete(next, to)
+				continue
+			}
+			next[to] = n
+			c.totals[from] += n
+			c.total += n
+		}
+		if len(next) == 0 {
+			delete(c.transitions, from)
+			delete(c.totals, from)
+		}
+	}
+}
+
+// markovDetector learns, per source, how likely each event is to follow
+// the previous one and scores windows of transitions by their average log
+// likelihood. It alerts when a window is far less likely than usual,
+// catching failures where every log looks normal but their order is wrong.
+type markovDetector struct {
+	field      string
+	key        string
+	window     int
+	threshold  float64
+	minWindows int
+	severity   string
+	mu         sync.Mutex
+	chains     map[string]*markovChain
+	lastPrune  time.Time
+}
+
+// newMarkovDetector creates a Markov detector from its configuration
+func newMarkovDetector(cfg config.Markov) *markovDetector {
+	d := &markovDetector{
+		field:      cfg.Field,
+		key:        cfg.Key,
+		window:     cfg.Window,
+		threshold:  cfg.Threshold,
+		minWindows: cfg.MinWindows,
+		severity:   strings.ToUpper(cfg.Severity),
+		chains:     make(map[string]*markovChain),
+		lastPrune:  time.Now(),
+	}
+	if d.field == "" {
+		d.field = defaultMarkovField
+	}
+	if d.window <= 0 {
+		d.window = defaultMarkovWindow
+	}
+	if d.threshold <= 0 {
+		d.threshold = defaultMarkovThreshold
+	}
+	if d.minWindows <= 0 {
+		d.minWindows = defaultMarkovMinWindows
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	return d
+}
+
+// Observe scores the transition from the key's previous event to this one
+// before learning it, and judges the window once it is complete
+func (d *markovDetector) Observe(log parser.ParsedLog, now time.Time) []Alert {
+	value := keyValue(log, d.field)
+	if value == "" {
+		return nil
+	}
+	key := keyValue(log, d.key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.chains[key]
+	if !ok {
+		if len(d.chains) >= markovMaxChains {
+			return nil
+		}
+		c = newMarkovChain()
+		d.chains[key] = c
+	}
+	c.lastSeen = now
+	c.lastLog = log
+
+	to := c.state(value)
+	from := c.prev
+	c.prev = to
+	if from == "" {
+		return nil
+	}
+
+	p := c.probability(from, to)
+	c.learn(from, to)
+	c.sum += math.Log(p)
+	c.steps = append(c.steps, markovStep{from: from, to: to, p: p})
+	if len(c.steps) < d.window {
+		return nil
+	}
+	return d.judge(key, c, now)
+}
+
+// judge scores a complete window against the key's usual likelihood before
+// folding it in
+func (d *markovDetector) judge(key string, c *markovChain, now time.Time) []Alert {
+	score := c.sum / float64(len(c.steps))
+	steps := c.steps
+	c.sum, c.steps = 0, nil
+
+	var alerts []Alert
+	if c.windows >= d.minWindows {
+		stddev := math.Max(math.Sqrt(c.variance), markovMinStdDev)
+		z := (score - c.mean) / stddev
+		if z < -d.threshold && !c.alerting {
+			sort.Slice(steps, func(i, j int) bool { return steps[i].p < steps[j].p })
+			unlikely := make([]string, 0, markovReported)
+			for _, s := range steps[:min(markovReported, len(steps))] {
+				unlikely = append(unlikely, fmt.Sprintf("%s -> %s (p=%.4f)", s.from, s.to, s.p))
+			}
+			alerts = append(alerts, detectorAlert("Unusual Event Sequence", d.severity, c.lastLog, now, map[string]interface{}{
+				"detector":         "markov",
+				"key":              key,
+				"field":            d.field,
+				"likelihood":       math.Exp(score),
+				"usual_likelihood": math.Exp(c.mean),
+				"z_score":          math.Round(z*100) / 100,
+				"window":           len(steps),
+				"transitions":      unlikely,
+			}))
+		}
+		c.alerting = z < -d.threshold
+	}
+
+	if c.windows == 0 {
+		c.mean = score
+	} else {
+		diff := score - c.mean
+		incr := markovAlpha * diff
+		c.mean += incr
+		c.variance = (1 - markovAlpha) * (c.variance + diff*incr)
+	}
+	c.windows++
+	return alerts
+}
+
+// Tick forgets chains that have been idle for a day
+func (d *markovDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) < time.Minute {
+		return nil
+	}
+	d.lastPrune = now
+	for key, c := range d.chains {
+		if now.Sub(c.lastSeen) > markovIdleTTL {
+			delete(d.chains, key)
+		}
+	}
+	return nil
+}
+
+// savedChain is the saved model of one key
+type savedChain struct {
+	Transitions map[string]map[string]float64 `json:"transitions"`
+	States      []string                      `json:"states"`
+	Mean        float64                       `json:"mean"`
+	Variance    float64                       `json:"variance"`
+	Windows     int                           `json:"windows"`
+}
+
+// stateKey implements stateful
+func (d *markovDetector) stateKey() string {
+	return "markov"
+}
+
+// saveState returns the transition model of every key
+func (d *markovDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	chains := make(map[string]savedChain, len(d.chains))
+	for key, c := range d.chains {
+		saved := savedChain{
+			Transitions: make(map[string]map[string]float64, len(c.transitions)),
+			States:      make([]string, 0, len(c.states)),
+			Mean:        c.mean,
+			Variance:    c.variance,
+			Windows:     c.windows,
+		}
+		for from, next := range c.transitions {
+			saved.Transitions[from] = make(map[string]float64, len(next))
+			for to, n := range next {
+				saved.Transitions[from][to] = n
+			}
+		}
+		for state := range c.states {
+			saved.States = append(saved.States, state)
+		}
+		chains[key] = saved
+	}
+	return chains
+}
+
+// restoreState reloads transition models. Windows in progress start over.
+func (d *markovDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var chains map[string]savedChain
+	if err := json.Unmarshal(data, &chains); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, saved := range chains {
+		c := newMarkovChain()
+		for _, state := range saved.States {
+			c.states[state] = true
+		}
+		for from, next := range saved.Transitions {
+			c.transitions[from] = next
+			for _, n := range next {
+				c.totals[from] += n
+				c.total += n
+			}
+		}
+		c.mean, c.variance, c.windows = saved.Mean, saved.Variance, saved.Windows
+		c.lastSeen = now
+		d.chains[key] = c
+	}
+	return nil
+}
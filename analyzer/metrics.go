@@ -0,0 +1,98 @@
+package analyzer
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Analyzer metric names
+const (
+	metricProcessed = "processed"
+	metricAlerts    = "alerts"
+	metricDropped   = "dropped_alerts"
+	metricSilenced  = "silenced_alerts"
+	metricSampled   = "sampled_alerts"
+)
+
+// metrics holds analyzer counters, published at /debug/vars under
+// "analyzer"
+var metrics = expvar.NewMap("analyzer")
+
+// ruleMetrics counts the evaluations of one rule
+type ruleMetrics struct {
+	evaluations atomic.Int64
+	matches     atomic.Int64
+	alerts      atomic.Int64
+	errors      atomic.Int64
+	nanos       atomic.Int64
+}
+
+// ruleStats maps rule names to their metrics, published at /debug/vars
+// under "analyzer_rules"
+var ruleStats sync.Map
+
+// throughput measures the rate of processed logs between reads
+var throughput struct {
+	mu    sync.Mutex
+	at    time.Time
+	count int64
+	rate  float64
+}
+
+func init() {
+	throughput.at = time.Now()
+	metrics.Set("logs_per_second", expvar.Func(logsPerSecond))
+	expvar.Publish("analyzer_rules", expvar.Func(publishRuleStats))
+}
+
+// ruleMetricsFor returns the metrics of a rule, creating them on first use
+func ruleMetricsFor(name string) *ruleMetrics {
+	if m, ok := ruleStats.Load(name); ok {
+		return m.(*ruleMetrics)
+	}
+	m, _ := ruleStats.LoadOrStore(name, &ruleMetrics{})
+	return m.(*ruleMetrics)
+}
+
+// logsPerSecond returns the processing rate averaged since the previous
+// read at least a second ago, or since startup
+func logsPerSecond() interface{} {
+	throughput.mu.Lock()
+	defer throughput.mu.Unlock()
+
+	now := time.Now()
+	count := int64(0)
+	if v, ok := metrics.Get(metricProcessed).(*expvar.Int); ok {
+		count = v.Value()
+	}
+	if elapsed := now.Sub(throughput.at); elapsed >= time.Second {
+		throughput.rate = float64(count-throughput.count) / elapsed.Seconds()
+		throughput.at, throughput.count = now, count
+	}
+	return throughput.rate
+}
+
+// publishRuleStats returns the evaluation counts and average evaluation
+// time of every rule
+func publishRuleStats() interface{} {
+	stats := make(map[string]interface{})
+	ruleStats.Range(func(name, value interface{}) bool {
+		m := value.(*ruleMetrics)
+		evaluations := m.evaluations.Load()
+		avg := 0.0
+		if evaluations > 0 {
+			avg = float64(m.nanos.Load()) / float64(evaluations) / 1000
+		}
+		stats[name.(string)] = map[string]interface{}{
+			"evaluations":     evaluations,
+			"matches":         m.matches.Load(),
+			"alerts":          m.alerts.Load(),
+			"errors":          m.errors.Load(),
+			"avg_eval_micros": avg,
+		}
+		return true
+	})
+	return stats
+}
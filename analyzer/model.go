@@ -0,0 +1,197 @@
+package analyzer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Model scoring defaults
+const (
+	defaultModelBatch  = 64
+	defaultModelInput  = "input"
+	defaultModelOutput = "output"
+
+	// modelErrorInterval rate-limits logging of scoring failures
+	modelErrorInterval = time.Minute
+)
+
+// scoringModel scores batches of feature vectors
+type scoringModel interface {
+	// score returns one score per log of a batch whose feature vectors are
+	// laid out row after row
+	score(features []float32, logs []parser.ParsedLog) ([]float64, error)
+}
+
+// modelDetector feeds logs through a trained anomaly model in batches and
+// alerts on logs whose score crosses the threshold. Logs that fail to
+// score are dropped, so a broken model never holds up the pipeline. The
+// model itself is shared by the detectors of every analyzer.
+type modelDetector struct {
+	name      string
+	model     scoringModel
+	modelKey  string
+	features  *featureMap
+	op        string
+	threshold float64
+	batchSize int
+	severity  string
+	mu        sync.Mutex
+	pending   []float32
+	logs      []parser.ParsedLog
+	lastError time.Time
+}
+
+// newModelDetector loads a model, unless another analyzer already has, and
+// its feature mapping from configuration
+func newModelDetector(cfg config.Model, runtime string) (*modelDetector, error) {
+	features, err := compileFeatures(cfg.Features)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", cfg.Path, err)
+	}
+
+	d := &modelDetector{
+		name:      cfg.Name,
+		features:  features,
+		op:        strings.ToLower(cfg.Op),
+		threshold: cfg.Threshold,
+		batchSize: cfg.BatchSize,
+		severity:  strings.ToUpper(cfg.Severity),
+	}
+	if d.name == "" && cfg.Path != "" {
+		d.name = strings.TrimSuffix(filepath.Base(cfg.Path), filepath.Ext(cfg.Path))
+	}
+	if d.name == "" {
+		d.name = cfg.Endpoint
+	}
+	switch d.op {
+	case "":
+		d.op = "gt"
+	case "gt", "lt":
+	default:
+		return nil, fmt.Errorf("model %s: unknown op %q", d.name, cfg.Op)
+	}
+	if d.batchSize <= 0 {
+		d.batchSize = defaultModelBatch
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+
+	input, output := cfg.Input, cfg.Output
+	if input == "" {
+		input = defaultModelInput
+	}
+	if output == "" {
+		output = defaultModelOutput
+	}
+	d.modelKey = sharedKey("model", runtime, cfg)
+	shared, err := acquireShared(d.modelKey, func() (interface{}, error) {
+		var model scoringModel
+		var err error
+		if cfg.Endpoint != "" {
+			model, err = newRemoteModel(cfg, d.name, features.names)
+		} else {
+			model, err = loadONNXModel(cfg.Path, runtime, input, output, features.width)
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded model %s with %d features", d.name, features.width)
+		return model, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", d.name, err)
+	}
+	d.model = shared.(scoringModel)
+	return d, nil
+}
+
+// Observe queues a log for scoring, scoring the batch once it is full
+func (d *modelDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	d.pending = d.features.extract(d.pending, logEntry)
+	d.logs = append(d.logs, logEntry)
+	if len(d.logs) < d.batchSize {
+		d.mu.Unlock()
+		return nil
+	}
+	features, logs := d.take()
+	d.mu.Unlock()
+
+	return d.run(features, logs, now)
+}
+
+// Tick scores logs still waiting for a batch to fill
+func (d *modelDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	features, logs := d.take()
+	d.mu.Unlock()
+
+	return d.run(features, logs, now)
+}
+
+// Stop releases the model's runtime session or connection once no other
+// analyzer uses it
+func (d *modelDetector) Stop() {
+	c, ok := releaseShared(d.modelKey).(io.Closer)
+	if !ok {
+		return
+	}
+	if err := c.Close(); err != nil {
+		log.Printf("Failed to close model %s: %v", d.name, err)
+	}
+}
+
+// take removes the queued logs and their features. The caller must hold
+// the lock.
+func (d *modelDetector) take() ([]float32, []parser.ParsedLog) {
+	features, logs := d.pending, d.logs
+	d.pending, d.logs = nil, nil
+	return features, logs
+}
+
+// run scores a batch and returns alerts for anomalous logs
+func (d *modelDetector) run(features []float32, logs []parser.ParsedLog, now time.Time) []Alert {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	scores, err := d.model.score(features, logs)
+	if err == nil && len(scores) != len(logs) {
+		err = fmt.Errorf("got %d scores for %d logs", len(scores), len(logs))
+	}
+	if err != nil {
+		d.mu.Lock()
+		if now.Sub(d.lastError) >= modelErrorInterval {
+			log.Printf("Model %s failed to score %d logs: %v", d.name, len(logs), err)
+			d.lastError = now
+		}
+		d.mu.Unlock()
+		return nil
+	}
+
+	var alerts []Alert
+	for i, score := range scores {
+		if d.op == "gt" && score <= d.threshold || d.op == "lt" && score >= d.threshold {
+			continue
+		}
+		row := features[i*d.features.width : (i+1)*d.features.width]
+		alerts = append(alerts, detectorAlert("Model Anomaly", d.severity, logs[i], now, map[string]interface{}{
+			"detector":  "model",
+			"model":     d.name,
+			"score":     score,
+			"op":        d.op,
+			"threshold": d.threshold,
+			"features":  d.features.named(row),
+		}))
+	}
+	return alerts
+}
@@ -0,0 +1,74 @@
+//go:build onnx
+
+package analyzer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/davidharvith/argos/parser"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// onnxInit initializes the onnxruntime environment once per process
+var (
+	onnxInit    sync.Once
+	onnxInitErr error
+)
+
+// onnxModel runs an ONNX model with onnxruntime
+type onnxModel struct {
+	session *ort.DynamicAdvancedSession
+	width   int
+}
+
+// loadONNXModel opens a model taking a [batch, width] float32 input. The
+// onnxruntime shared library is loaded from runtime, or the system default
+// when empty.
+func loadONNXModel(path, runtime, input, output string, width int) (scoringModel, error) {
+	onnxInit.Do(func() {
+		if runtime != "" {
+			ort.SetSharedLibraryPath(runtime)
+		}
+		onnxInitErr = ort.InitializeEnvironment()
+	})
+	if onnxInitErr != nil {
+		return nil, fmt.Errorf("failed to initialize onnxruntime: %w", onnxInitErr)
+	}
+
+	session, err := ort.NewDynamicAdvancedSession(path, []string{input}, []string{output}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return &onnxModel{session: session, width: width}, nil
+}
+
+// Close releases the onnxruntime session
+func (m *onnxModel) Close() error {
+	return m.session.Destroy()
+}
+
+// score runs a batch through the model
+func (m *onnxModel) score(features []float32, logs []parser.ParsedLog) ([]float64, error) {
+	rows := len(logs)
+	in, err := ort.NewTensor(ort.NewShape(int64(rows), int64(m.width)), features)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Destroy()
+
+	out, err := ort.NewEmptyTensor[float32](ort.NewShape(int64(rows), 1))
+	if err != nil {
+		return nil, err
+	}
+	defer out.Destroy()
+
+	if err := m.session.Run([]ort.Value{in}, []ort.Value{out}); err != nil {
+		return nil, err
+	}
+	scores := make([]float64, rows)
+	for i, s := range out.GetData() {
+		scores[i] = float64(s)
+	}
+	return scores, nil
+}
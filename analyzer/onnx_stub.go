@@ -0,0 +1,10 @@
+//go:build !onnx
+
+package analyzer
+
+import "fmt"
+
+// loadONNXModel reports that ONNX support is not compiled in
+func loadONNXModel(path, runtime, input, output string, width int) (scoringModel, error) {
+	return nil, fmt.Errorf("argos was built without ONNX support, rebuild with -tags onnx")
+}
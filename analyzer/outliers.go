@@ -0,0 +1,259 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Outlier detector defaults
+const (
+	defaultOutlierThreshold  = 3.5
+	defaultOutlierWindow     = 200
+	defaultOutlierMinSamples = 30
+	defaultOutlierCooldown   = 5 * time.Minute
+
+	// outlierMaxKeys bounds the keys tracked per field, and keys without
+	// values for outlierIdleTTL are forgotten
+	outlierMaxKeys = 10000
+	outlierIdleTTL = time.Hour
+
+	// madScale converts a median absolute deviation into an estimate of
+	// the standard deviation of normally distributed values, and
+	// meanADScale does the same for a mean absolute deviation
+	madScale    = 1.4826
+	meanADScale = 1.2533
+
+	// outlierMinSpread keeps scores finite for keys whose values never vary
+	outlierMinSpread = 1e-9
+)
+
+// outlierSeries holds the recent values of one key and their cached median
+// and spread
+type outlierSeries struct {
+	values     []float64
+	next       int
+	seen       int
+	median     float64
+	spread     float64
+	stale      int
+	lastSeen   time.Time
+	quietUntil time.Time
+}
+
+// add records a value, overwriting the oldest once the window is full
+func (s *outlierSeries) add(x float64, window int) {
+	if len(s.values) < window {
+		s.values = append(s.values, x)
+	} else {
+		s.values[s.next] = x
+		s.next = (s.next + 1) % window
+	}
+	s.seen++
+	s.stale++
+}
+
+// refresh recomputes the median and the spread of the values, estimated
+// from the median absolute deviation, or from the mean absolute deviation
+// when more than half the values are equal
+func (s *outlierSeries) refresh() {
+	sorted := append([]float64(nil), s.values...)
+	sort.Float64s(sorted)
+	s.median = medianOf(sorted)
+
+	deviations := make([]float64, len(sorted))
+	sum := 0.0
+	for i, x := range sorted {
+		deviations[i] = math.Abs(x - s.median)
+		sum += deviations[i]
+	}
+	sort.Float64s(deviations)
+	s.spread = madScale * medianOf(deviations)
+	if s.spread == 0 {
+		s.spread = meanADScale * sum / float64(len(deviations))
+	}
+	s.spread = math.Max(s.spread, outlierMinSpread)
+	s.stale = 0
+}
+
+// medianOf returns the median of sorted values
+func medianOf(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// outlierTracker scores the values of one numeric field per key
+type outlierTracker struct {
+	field      string
+	key        string
+	threshold  float64
+	factor     float64
+	direction  string
+	window     int
+	minSamples int
+	cooldown   time.Duration
+	severity   string
+	series     map[string]*outlierSeries
+}
+
+// outlierDetector flags values of numeric fields that lie far from the
+// recent median of their key, using a robust z-score that a few extreme
+// values cannot skew, so no fixed threshold is needed per key
+type outlierDetector struct {
+	mu        sync.Mutex
+	trackers  []*outlierTracker
+	lastPrune time.Time
+}
+
+// newOutlierDetector creates an outlier detector from its configuration
+func newOutlierDetector(cfg config.Outliers) (*outlierDetector, error) {
+	d := &outlierDetector{lastPrune: time.Now()}
+	for _, fc := range cfg.Fields {
+		if fc.Field == "" {
+			return nil, fmt.Errorf("outlier field is required")
+		}
+		t := &outlierTracker{
+			field:      fc.Field,
+			key:        fc.Key,
+			threshold:  fc.Threshold,
+			factor:     fc.Factor,
+			direction:  strings.ToLower(fc.Direction),
+			window:     fc.Window,
+			minSamples: fc.MinSamples,
+			cooldown:   time.Duration(fc.Cooldown),
+			severity:   strings.ToUpper(fc.Severity),
+			series:     make(map[string]*outlierSeries),
+		}
+		switch t.direction {
+		case "":
+			t.direction = "both"
+		case "high", "low", "both":
+		default:
+			return nil, fmt.Errorf("outlier field %s: unknown direction %q", fc.Field, fc.Direction)
+		}
+		if t.threshold <= 0 {
+			t.threshold = defaultOutlierThreshold
+		}
+		if t.window <= 0 {
+			t.window = defaultOutlierWindow
+		}
+		if t.minSamples <= 0 {
+			t.minSamples = defaultOutlierMinSamples
+		}
+		if t.cooldown <= 0 {
+			t.cooldown = defaultOutlierCooldown
+		}
+		if t.severity == "" {
+			t.severity = "MEDIUM"
+		}
+		d.trackers = append(d.trackers, t)
+	}
+	return d, nil
+}
+
+// Observe scores the log's value of every tracked field against the recent
+// values of its key before recording it
+func (d *outlierDetector) Observe(log parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var alerts []Alert
+	for _, t := range d.trackers {
+		raw, ok := log.Lookup(t.field)
+		if !ok {
+			continue
+		}
+		x, ok := toFloat(raw)
+		if !ok || math.IsNaN(x) || math.IsInf(x, 0) {
+			continue
+		}
+		key := keyValue(log, t.key)
+		if key == "" {
+			continue
+		}
+
+		s, ok := t.series[key]
+		if !ok {
+			if len(t.series) >= outlierMaxKeys {
+				continue
+			}
+			s = &outlierSeries{}
+			t.series[key] = s
+		}
+		s.lastSeen = now
+
+		if s.seen >= t.minSamples && now.After(s.quietUntil) {
+			if s.spread == 0 || s.stale >= max(t.window/10, 1) {
+				s.refresh()
+			}
+			if metadata, ok := t.score(s, x); ok {
+				s.quietUntil = now.Add(t.cooldown)
+				metadata["key"] = key
+				alerts = append(alerts, detectorAlert("Numeric Outlier", t.severity, log, now, metadata))
+			}
+		}
+		s.add(x, t.window)
+	}
+	return alerts
+}
+
+// score reports whether x is an outlier of the series, with the details to
+// attach to the alert
+func (t *outlierTracker) score(s *outlierSeries, x float64) (map[string]interface{}, bool) {
+	z := (x - s.median) / s.spread
+	direction := "high"
+	if z < 0 {
+		direction = "low"
+	}
+	if math.Abs(z) <= t.threshold || (t.direction != "both" && t.direction != direction) {
+		return nil, false
+	}
+	if t.factor > 0 && s.median > 0 {
+		if direction == "high" && x < t.factor*s.median || direction == "low" && x > s.median/t.factor {
+			return nil, false
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"detector":  "outliers",
+		"field":     t.field,
+		"value":     x,
+		"median":    s.median,
+		"spread":    s.spread,
+		"z_score":   math.Round(z*100) / 100,
+		"direction": direction,
+		"samples":   len(s.values),
+	}
+	if s.median != 0 {
+		metadata["ratio"] = math.Round(x/s.median*100) / 100
+	}
+	return metadata, true
+}
+
+// Tick forgets keys that have had no values for a while
+func (d *outlierDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) < time.Minute {
+		return nil
+	}
+	d.lastPrune = now
+	for _, t := range d.trackers {
+		for key, s := range t.series {
+			if now.Sub(s.lastSeen) > outlierIdleTTL {
+				delete(t.series, key)
+			}
+		}
+	}
+	return nil
+}
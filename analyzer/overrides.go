@@ -0,0 +1,224 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RuleInfo describes an active rule and whether it is enabled
+type RuleInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Priority int    `json:"priority"`
+	Suppress bool   `json:"suppress"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// ruleOverrides is the on-disk format of runtime rule overrides
+type ruleOverrides struct {
+	Disabled []string `json:"disabled"`
+}
+
+// errRuleNotFound is returned for unknown rule IDs
+var errRuleNotFound = errors.New("rule not found")
+
+// RuleID derives a rule ID from its name, e.g. "Error Code 5xx" becomes
+// "error-code-5xx"
+func RuleID(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// LoadRuleOverrides reads the rules disabled at runtime from path, if it
+// exists, and persists later changes there. It must be called before Start.
+func (a *Analyzer) LoadRuleOverrides(path string) error {
+	a.overridesPath = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read rule overrides: %w", err)
+	}
+
+	var overrides ruleOverrides
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("failed to parse rule overrides %s: %w", path, err)
+	}
+
+	disabled := make(map[string]bool, len(overrides.Disabled))
+	for _, id := range overrides.Disabled {
+		disabled[id] = true
+	}
+	a.disabled.Store(&disabled)
+	if len(disabled) > 0 {
+		log.Printf("Rules disabled by overrides: %s", strings.Join(overrides.Disabled, ", "))
+	}
+	return nil
+}
+
+// isDisabled reports whether a rule has been disabled at runtime
+func (a *Analyzer) isDisabled(id string) bool {
+	disabled := a.disabled.Load()
+	return disabled != nil && (*disabled)[id]
+}
+
+// ListRules returns the active rules in evaluation order
+func (a *Analyzer) ListRules() []RuleInfo {
+	rules := a.Rules()
+	infos := make([]RuleInfo, len(rules))
+	for i, rule := range rules {
+		infos[i] = RuleInfo{
+			ID:       rule.ID,
+			Name:     rule.Name,
+			Severity: rule.Severity,
+			Priority: rule.Priority,
+			Suppress: rule.Suppress,
+			Enabled:  !a.isDisabled(rule.ID),
+		}
+	}
+	return infos
+}
+
+// SetRuleEnabled enables or disables an active rule by ID and persists the
+// change, which takes effect only once saved. Overrides outlive reloads, so
+// a rule stays muted until enabled.
+func (a *Analyzer) SetRuleEnabled(id string, enabled bool) error {
+	found := false
+	for _, rule := range a.Rules() {
+		if rule.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", errRuleNotFound, id)
+	}
+
+	a.overridesMu.Lock()
+	defer a.overridesMu.Unlock()
+
+	disabled := make(map[string]bool)
+	if current := a.disabled.Load(); current != nil {
+		for k := range *current {
+			disabled[k] = true
+		}
+	}
+	if enabled {
+		delete(disabled, id)
+	} else {
+		disabled[id] = true
+	}
+	if a.overridesPath != "" {
+		if err := saveRuleOverrides(a.overridesPath, disabled); err != nil {
+			return err
+		}
+	}
+	a.disabled.Store(&disabled)
+	return nil
+}
+
+// saveRuleOverrides atomically writes the disabled rule IDs to path
+func saveRuleOverrides(path string, disabled map[string]bool) error {
+	overrides := ruleOverrides{Disabled: make([]string, 0, len(disabled))}
+	for id := range disabled {
+		overrides.Disabled = append(overrides.Disabled, id)
+	}
+	sort.Strings(overrides.Disabled)
+
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save rule overrides: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file, so
+// readers never see a partial write
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// HandleListRules serves GET requests listing the active rules
+func (a *Analyzer) HandleListRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.ListRules())
+}
+
+// HandleToggleRule serves POST requests to /api/rules/{id}/enable and
+// /api/rules/{id}/disable
+func (a *Analyzer) HandleToggleRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var enabled bool
+	switch r.PathValue("action") {
+	case "enable":
+		enabled = true
+	case "disable":
+		enabled = false
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	id := r.PathValue("id")
+	err := a.SetRuleEnabled(id, enabled)
+	if errors.Is(err, errRuleNotFound) {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "Rule %s %sd\n", id, r.PathValue("action"))
+}
@@ -0,0 +1,57 @@
+package analyzer
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// rulePackFiles holds the curated rule packs shipped with Argos, one rules
+// file per pack
+//
+//go:embed packs/*.json
+var rulePackFiles embed.FS
+
+// RulePacks returns the names of the built-in rule packs, sorted
+func RulePacks() []string {
+	entries, _ := fs.ReadDir(rulePackFiles, "packs")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadRulePacks compiles the built-in rule packs of the given names, e.g.
+// "linux-auth" and "nginx", into one rule set
+func LoadRulePacks(names []string) ([]Rule, error) {
+	var specs []RuleSpec
+	loaded := make(map[string]bool, len(names))
+	for _, name := range names {
+		if loaded[name] {
+			continue
+		}
+		loaded[name] = true
+
+		data, err := rulePackFiles.ReadFile("packs/" + name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("unknown rule pack %q (available: %s)", name, strings.Join(RulePacks(), ", "))
+		}
+		var file RuleFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse rule pack %s: %w", name, err)
+		}
+		for i, spec := range file.Rules {
+			if err := resolveRuleRefs(&file.Rules[i], file.Conditions); err != nil {
+				return nil, fmt.Errorf("rule pack %s: rule %q: %w", name, spec.Name, err)
+			}
+		}
+		specs = append(specs, file.Rules...)
+	}
+	return CompileRules(specs)
+}
@@ -0,0 +1,410 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// Percentile rule defaults
+const (
+	defaultPercentileWindow   = time.Minute
+	defaultPercentileMinCount = 10
+
+	// percentileCheckInterval is how often windows that have ended are
+	// judged when no later value of their key arrives
+	percentileCheckInterval = 5 * time.Second
+)
+
+// percentileStatsQuantiles are the quantiles reported by the stats API
+var percentileStatsQuantiles = []float64{0.5, 0.9, 0.99}
+
+// PercentileSpec makes a rule compare a quantile of a numeric field per
+// window to a limit, e.g. p99 of latency_ms above 800 for 3 consecutive
+// windows
+type PercentileSpec struct {
+	Field    string  `json:"field"`
+	Quantile float64 `json:"quantile"`
+
+	// Op is gt (default), gte, lt or lte
+	Op    string  `json:"op"`
+	Value float64 `json:"value"`
+
+	// Consecutive is the number of windows in a row that must breach the
+	// limit before the rule fires, default 1
+	Consecutive int `json:"consecutive"`
+
+	// MinCount is the fewest values a window needs to be judged, default 10
+	MinCount int `json:"min_count"`
+
+	// Compression sets the size of the t-digest, default 100
+	Compression float64 `json:"compression"`
+}
+
+// PercentileStats is the last completed window of one key of a percentile
+// rule
+type PercentileStats struct {
+	Rule      string             `json:"rule"`
+	Field     string             `json:"field"`
+	Key       string             `json:"key"`
+	WindowEnd time.Time          `json:"window_end"`
+	Count     int                `json:"count"`
+	Quantiles map[string]float64 `json:"quantiles"`
+	Streak    int                `json:"streak"`
+}
+
+// percentileKey is the window in progress and recent history of one key
+type percentileKey struct {
+	digest   *tDigest
+	start    time.Time
+	lastLog  parser.ParsedLog
+	streak   int
+	breaches []float64
+	fired    bool
+	last     PercentileStats
+}
+
+// percentileRule tracks a t-digest of a numeric field per key over fixed
+// windows. When a window ends, the first log of the key after it or the
+// next periodic check judges the window's quantile, and the rule fires
+// once the limit has been breached for Consecutive windows in a row,
+// re-arming after a window within the limit.
+type percentileRule struct {
+	name        string
+	severity    string
+	keyField    string
+	check       func(parser.ParsedLog) bool
+	field       string
+	quantile    float64
+	op          string
+	value       float64
+	consecutive int
+	minCount    int
+	compression float64
+	window      time.Duration
+	mu          sync.Mutex
+	keys        map[string]*percentileKey
+	lastPrune   time.Time
+}
+
+// compilePercentileRule compiles a rule spec with a percentile condition
+func compilePercentileRule(spec RuleSpec) (Rule, error) {
+	p := spec.Percentile
+	if spec.Script != "" || len(spec.Sequence) > 0 || spec.Distinct != "" || spec.Threshold > 0 || spec.SpikeFactor > 0 || spec.Counter != "" || len(spec.Join) > 0 {
+		return Rule{}, fmt.Errorf("percentile rules only take match conditions, a key and a window")
+	}
+	if p.Field == "" {
+		return Rule{}, fmt.Errorf("percentile needs a field")
+	}
+	if p.Quantile <= 0 || p.Quantile >= 1 {
+		return Rule{}, fmt.Errorf("percentile quantile must be between 0 and 1, e.g. 0.99")
+	}
+
+	severity := strings.ToUpper(spec.Severity)
+	if severity == "" {
+		severity = "MEDIUM"
+	}
+
+	pr := &percentileRule{
+		name:        spec.Name,
+		severity:    severity,
+		keyField:    spec.Key,
+		field:       p.Field,
+		quantile:    p.Quantile,
+		op:          strings.ToLower(p.Op),
+		value:       p.Value,
+		consecutive: p.Consecutive,
+		minCount:    p.MinCount,
+		compression: p.Compression,
+		window:      time.Duration(spec.Window),
+		keys:        make(map[string]*percentileKey),
+	}
+	switch pr.op {
+	case "":
+		pr.op = "gt"
+	case "gt", "gte", "lt", "lte":
+	default:
+		return Rule{}, fmt.Errorf("unknown percentile operator %q", p.Op)
+	}
+	if pr.consecutive <= 0 {
+		pr.consecutive = 1
+	}
+	if pr.minCount <= 0 {
+		pr.minCount = defaultPercentileMinCount
+	}
+	if pr.window <= 0 {
+		pr.window = defaultPercentileWindow
+	}
+	if len(spec.Match) > 0 {
+		check, err := compileMatch(spec.Match)
+		if err != nil {
+			return Rule{}, err
+		}
+		pr.check = check
+	}
+
+	return Rule{
+		Name:       spec.Name,
+		Severity:   severity,
+		Window:     pr.window,
+		Weight:     spec.Weight,
+		Priority:   spec.Priority,
+		Stop:       spec.Stop,
+		KeyField:   spec.Key,
+		Evaluate:   pr.evaluate,
+		percentile: pr,
+	}, nil
+}
+
+// evaluate adds the log's value to its key's window, first judging the
+// previous window if it has ended
+func (pr *percentileRule) evaluate(logEntry parser.ParsedLog, now time.Time) (bool, []Alert) {
+	if pr.check != nil && !pr.check(logEntry) {
+		return false, nil
+	}
+	raw, ok := logEntry.Lookup(pr.field)
+	if !ok {
+		return false, nil
+	}
+	x, ok := toFloat(raw)
+	if !ok || math.IsNaN(x) || math.IsInf(x, 0) {
+		return false, nil
+	}
+	key := keyValue(logEntry, pr.keyField)
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	var alerts []Alert
+	if now.Sub(pr.lastPrune) >= pr.window {
+		alerts = pr.expire(now)
+	}
+
+	k, ok := pr.keys[key]
+	if !ok {
+		k = &percentileKey{digest: newTDigest(pr.compression), start: now.Truncate(pr.window)}
+		pr.keys[key] = k
+	}
+
+	if end := k.start.Add(pr.window); !now.Before(end) {
+		if alert, ok := pr.close(key, k, end); ok {
+			alert.Timestamp = now.Format(time.RFC3339)
+			alerts = append(alerts, alert)
+		}
+		// A gap of whole windows without values breaks the streak
+		if now.Sub(end) >= pr.window {
+			k.streak, k.breaches, k.fired = 0, nil, false
+		}
+		k.digest = newTDigest(pr.compression)
+		k.start = now.Truncate(pr.window)
+	}
+
+	for i := 0; i < logEntry.RepeatCount; i++ {
+		k.digest.add(x)
+	}
+	k.lastLog = logEntry
+	return false, alerts
+}
+
+// close judges a key's window ending at end and returns an alert if the
+// rule fires
+func (pr *percentileRule) close(key string, k *percentileKey, end time.Time) (Alert, bool) {
+	count := int(k.digest.count)
+	if count < pr.minCount {
+		k.streak, k.breaches, k.fired = 0, nil, false
+		return Alert{}, false
+	}
+
+	observed := k.digest.quantile(pr.quantile)
+	k.last = PercentileStats{
+		Rule:      pr.name,
+		Field:     pr.field,
+		Key:       key,
+		WindowEnd: end,
+		Count:     count,
+		Quantiles: make(map[string]float64, len(percentileStatsQuantiles)),
+	}
+	for _, q := range percentileStatsQuantiles {
+		k.last.Quantiles[quantileName(q)] = k.digest.quantile(q)
+	}
+	k.last.Quantiles[quantileName(pr.quantile)] = observed
+
+	if !pr.breached(observed) {
+		k.streak, k.breaches, k.fired = 0, nil, false
+		return Alert{}, false
+	}
+	k.streak++
+	k.breaches = append(k.breaches, observed)
+	if len(k.breaches) > pr.consecutive {
+		k.breaches = k.breaches[1:]
+	}
+	k.last.Streak = k.streak
+	if k.streak < pr.consecutive || k.fired {
+		return Alert{}, false
+	}
+	k.fired = true
+
+	return Alert{
+		Severity: pr.severity,
+		Reason:   pr.name,
+		Log:      k.lastLog,
+		Metadata: map[string]interface{}{
+			"rule_name":   pr.name,
+			"key":         key,
+			"field":       pr.field,
+			"quantile":    quantileName(pr.quantile),
+			"observed":    observed,
+			"op":          pr.op,
+			"limit":       pr.value,
+			"consecutive": pr.consecutive,
+			"windows":     append([]float64(nil), k.breaches...),
+			"count":       count,
+			"window":      pr.window.String(),
+		},
+	}, true
+}
+
+// breached reports whether an observed quantile is beyond the limit
+func (pr *percentileRule) breached(observed float64) bool {
+	switch pr.op {
+	case "gte":
+		return observed >= pr.value
+	case "lt":
+		return observed < pr.value
+	case "lte":
+		return observed <= pr.value
+	}
+	return observed > pr.value
+}
+
+// expire judges every window with values that has ended by now and drops
+// keys that have had no values for two windows, returning the alerts of
+// the rule firing; callers must hold mu
+func (pr *percentileRule) expire(now time.Time) []Alert {
+	var alerts []Alert
+	for key, k := range pr.keys {
+		if end := k.start.Add(pr.window); !now.Before(end) && k.digest.count > 0 {
+			if alert, ok := pr.close(key, k, end); ok {
+				alert.Timestamp = now.Format(time.RFC3339)
+				alerts = append(alerts, alert)
+			}
+			// A gap of whole windows without values breaks the streak
+			if now.Sub(end) >= pr.window {
+				k.streak, k.breaches, k.fired = 0, nil, false
+			}
+			k.digest = newTDigest(pr.compression)
+			k.start = end
+		}
+		if now.Sub(k.start) > 2*pr.window {
+			delete(pr.keys, key)
+		}
+	}
+	pr.lastPrune = now
+	return alerts
+}
+
+// due judges the windows that have ended by now, so a key whose values
+// stop is still judged on its last window
+func (pr *percentileRule) due(now time.Time) []Alert {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	return pr.expire(now)
+}
+
+// checkPercentiles periodically judges percentile windows that have ended
+func (a *Analyzer) checkPercentiles() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(percentileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if !a.percentilesDue(now) {
+				return
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
+
+// percentilesDue raises the alerts of percentile windows that have ended
+// by now, returning false on shutdown
+func (a *Analyzer) percentilesDue(now time.Time) bool {
+	rules := a.Rules()
+	for _, rule := range rules {
+		if rule.percentile == nil || a.isDisabled(rule.ID) {
+			continue
+		}
+		for _, alert := range rule.percentile.due(now) {
+			if rule.feeds != nil {
+				if !a.feed(rules, rule, alert, now) {
+					return false
+				}
+				continue
+			}
+			a.scorer.score(&alert, rule.weight())
+			a.enrich(rule, &alert, now)
+			ruleMetricsFor(rule.Name).alerts.Add(1)
+			if !a.send(alert, now) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// stats returns the last completed window of every key
+func (pr *percentileRule) stats() []PercentileStats {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	stats := make([]PercentileStats, 0, len(pr.keys))
+	for _, k := range pr.keys {
+		if k.last.Count > 0 {
+			stats = append(stats, k.last)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// quantileName formats a quantile as a percentile, e.g. 0.99 as p99
+func quantileName(q float64) string {
+	return "p" + strconv.FormatFloat(math.Round(q*100000)/1000, 'f', -1, 64)
+}
+
+// Percentiles returns the last completed window of every key of every
+// percentile rule
+func (a *Analyzer) Percentiles() []PercentileStats {
+	stats := []PercentileStats{}
+	for _, rule := range a.Rules() {
+		if rule.percentile != nil && !a.isDisabled(rule.ID) {
+			stats = append(stats, rule.percentile.stats()...)
+		}
+	}
+	return stats
+}
+
+// HandlePercentiles serves GET requests for the quantiles tracked by
+// percentile rules
+func (a *Analyzer) HandlePercentiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Percentiles())
+}
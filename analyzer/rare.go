@@ -0,0 +1,176 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Rare-event detector defaults
+const (
+	defaultRareLearning = 10 * time.Minute
+	defaultRareTTL      = 30 * 24 * time.Hour
+
+	// rareMaxValues bounds the values remembered per field, so that a high
+	// cardinality field cannot exhaust memory or flood alerts
+	rareMaxValues = 100000
+
+	// rarePruneInterval is how often expired values are forgotten
+	rarePruneInterval = time.Minute
+)
+
+// defaultRareFields are the fields tracked when none are configured
+var defaultRareFields = []string{"source", "template_id", "error_code", "country"}
+
+// rareDetector alerts the first time a value of a tracked field is seen.
+// Values are forgotten once unseen for the TTL, so a value returning after
+// a long absence counts as new again.
+type rareDetector struct {
+	fields     []string
+	ttl        time.Duration
+	learnUntil time.Time
+	severity   string
+	mu         sync.Mutex
+	seen       map[string]map[string]time.Time
+	lastPrune  time.Time
+}
+
+// newRareDetector creates a rare-event detector from its configuration
+func newRareDetector(cfg config.Rare) *rareDetector {
+	d := &rareDetector{
+		fields:   cfg.Fields,
+		ttl:      time.Duration(cfg.TTL),
+		severity: strings.ToUpper(cfg.Severity),
+		seen:     make(map[string]map[string]time.Time),
+	}
+	if len(d.fields) == 0 {
+		d.fields = defaultRareFields
+	}
+	if d.ttl <= 0 {
+		d.ttl = defaultRareTTL
+	}
+	learning := time.Duration(cfg.LearningPeriod)
+	if learning <= 0 {
+		learning = defaultRareLearning
+	}
+	if d.severity == "" {
+		d.severity = "LOW"
+	}
+
+	now := time.Now()
+	d.learnUntil = now.Add(learning)
+	d.lastPrune = now
+	for _, field := range d.fields {
+		d.seen[field] = make(map[string]time.Time)
+	}
+	return d
+}
+
+// Observe records the log's values and alerts on those never seen before
+func (d *rareDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	learning := now.Before(d.learnUntil)
+
+	var alerts []Alert
+	for _, field := range d.fields {
+		value := keyValue(logEntry, field)
+		if value == "" {
+			continue
+		}
+		values := d.seen[field]
+		if _, ok := values[value]; ok {
+			values[value] = now
+			continue
+		}
+		if len(values) >= rareMaxValues {
+			continue
+		}
+		values[value] = now
+
+		if !learning {
+			alerts = append(alerts, detectorAlert("First Seen Value", d.severity, logEntry, now, map[string]interface{}{
+				"detector": "rare",
+				"field":    field,
+				"value":    value,
+			}))
+		}
+	}
+	return alerts
+}
+
+// Tick forgets values that have not been seen within the TTL
+func (d *rareDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) < rarePruneInterval {
+		return nil
+	}
+	d.lastPrune = now
+
+	for _, values := range d.seen {
+		for value, last := range values {
+			if now.Sub(last) > d.ttl {
+				delete(values, value)
+			}
+		}
+	}
+	return nil
+}
+
+// rareState is the saved state of a rare-event detector
+type rareState struct {
+	LearnUntil time.Time                       `json:"learn_until"`
+	Seen       map[string]map[string]time.Time `json:"seen"`
+}
+
+// stateKey implements stateful
+func (d *rareDetector) stateKey() string {
+	return "rare"
+}
+
+// saveState returns the values seen per field and the end of learning
+func (d *rareDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := rareState{LearnUntil: d.learnUntil, Seen: make(map[string]map[string]time.Time)}
+	for field, values := range d.seen {
+		saved := make(map[string]time.Time, len(values))
+		for value, last := range values {
+			saved[value] = last
+		}
+		state.Seen[field] = saved
+	}
+	return state
+}
+
+// restoreState reloads the values seen for fields still tracked, and keeps
+// the original end of the learning period
+func (d *rareDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var state rareState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.learnUntil = state.LearnUntil
+	for field, values := range state.Seen {
+		seen, ok := d.seen[field]
+		if !ok {
+			continue
+		}
+		for value, last := range values {
+			seen[value] = last
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package analyzer
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// rulesPollInterval is how often the rules file is checked for changes
+const rulesPollInterval = 5 * time.Second
+
+// LoadRulesFile loads rules from path, activates them and remembers the path
+// for later reloads and file watching. It must be called before Start.
+func (a *Analyzer) LoadRulesFile(path string) error {
+	a.rulesPath = path
+	return a.ReloadRules()
+}
+
+// ReloadRules re-reads the rules file and atomically swaps the active rule
+// set. On error the current rules stay in effect.
+func (a *Analyzer) ReloadRules() error {
+	if a.rulesPath == "" {
+		return fmt.Errorf("no rules file configured")
+	}
+	rules, err := LoadRules(a.rulesPath)
+	if err != nil {
+		return err
+	}
+	rules, err = withConfigRules(rules, a.configRules)
+	if err != nil {
+		return err
+	}
+	a.SetRules(rules)
+	log.Printf("Loaded %d rules from %s", len(rules), a.rulesPath)
+	return nil
+}
+
+// SetConfigRules adds rules defined in the configuration to the built-in
+// rules, and to those of the rules file on every load. It must be called
+// before LoadRulesFile and Start.
+func (a *Analyzer) SetConfigRules(rules []Rule) error {
+	combined, err := withConfigRules(a.Rules(), rules)
+	if err != nil {
+		return err
+	}
+	a.configRules = rules
+	a.SetRules(combined)
+	return nil
+}
+
+// withConfigRules appends configured rules to a rule set, rejecting names
+// used by both
+func withConfigRules(rules, configured []Rule) ([]Rule, error) {
+	if len(configured) == 0 {
+		return rules, nil
+	}
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		names[rule.Name] = true
+	}
+	for _, rule := range configured {
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q is defined in both the configuration and the rules", rule.Name)
+		}
+	}
+	return append(append([]Rule(nil), rules...), configured...), nil
+}
+
+// watchRules polls the rules file and reloads it when its modification
+// time changes
+func (a *Analyzer) watchRules() {
+	defer a.wg.Done()
+
+	var lastMod time.Time
+	if info, err := os.Stat(a.rulesPath); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(rulesPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(a.rulesPath)
+			if err != nil || info.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			if err := a.ReloadRules(); err != nil {
+				log.Printf("Rules reload failed, keeping current rules: %v", err)
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
+
+// HandleReloadRules serves POST requests that reload the rules file
+func (a *Analyzer) HandleReloadRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := a.ReloadRules(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprintf(w, "Reloaded %d rules\n", len(a.Rules()))
+}
@@ -0,0 +1,231 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Remote scoring defaults
+const (
+	defaultRemoteTimeout   = time.Second
+	defaultRemoteFailures  = 5
+	defaultRemoteCooldown  = 30 * time.Second
+	remoteScoreMethod      = "/argos.scoring.v1.Scorer/Score"
+	remoteMaxMessageLength = 1024
+)
+
+// errCircuitOpen is returned while a failing scoring service is bypassed
+var errCircuitOpen = errors.New("scoring service bypassed after repeated failures")
+
+// remoteModel scores batches with an external service over gRPC. After a
+// run of consecutive failures the circuit opens and batches are skipped
+// without calling the service until the cooldown has passed; the next
+// failure then opens it again.
+type remoteModel struct {
+	name      string
+	features  []string
+	conn      *grpc.ClientConn
+	timeout   time.Duration
+	threshold int
+	cooldown  time.Duration
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// newRemoteModel connects to the scoring service of a model. The
+// connection is established lazily, so an unavailable service does not
+// prevent startup.
+func newRemoteModel(cfg config.Model, name string, features []string) (*remoteModel, error) {
+	creds := insecure.NewCredentials()
+	if cfg.TLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Endpoint, err)
+	}
+
+	m := &remoteModel{
+		name:      name,
+		features:  features,
+		conn:      conn,
+		timeout:   time.Duration(cfg.Timeout),
+		threshold: cfg.FailureThreshold,
+		cooldown:  time.Duration(cfg.Cooldown),
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultRemoteTimeout
+	}
+	if m.threshold <= 0 {
+		m.threshold = defaultRemoteFailures
+	}
+	if m.cooldown <= 0 {
+		m.cooldown = defaultRemoteCooldown
+	}
+	return m, nil
+}
+
+// Close closes the connection to the service
+func (m *remoteModel) Close() error {
+	return m.conn.Close()
+}
+
+// score sends a batch to the service, unless the circuit is open
+func (m *remoteModel) score(features []float32, logs []parser.ParsedLog) ([]float64, error) {
+	now := time.Now()
+	m.mu.Lock()
+	if now.Before(m.openUntil) {
+		m.mu.Unlock()
+		return nil, errCircuitOpen
+	}
+	m.mu.Unlock()
+
+	req := &scoreRequest{model: m.name, features: m.features, values: features, logs: logs}
+	resp := &scoreResponse{}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	err := m.conn.Invoke(ctx, remoteScoreMethod, req, resp, grpc.ForceCodec(scoringCodec{}))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.failures++
+		if m.failures >= m.threshold {
+			m.openUntil = now.Add(m.cooldown)
+		}
+		return nil, err
+	}
+	m.failures = 0
+	return resp.scores, nil
+}
+
+// scoreRequest is the ScoreRequest message of proto/scoring.proto
+type scoreRequest struct {
+	model    string
+	features []string
+	values   []float32
+	logs     []parser.ParsedLog
+}
+
+// scoreResponse is the ScoreResponse message of proto/scoring.proto
+type scoreResponse struct {
+	scores []float64
+}
+
+// marshal encodes the request in protobuf wire format
+func (r *scoreRequest) marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, r.model)
+	for _, name := range r.features {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, name)
+	}
+
+	width := len(r.features)
+	for i, log := range r.logs {
+		var values []byte
+		for _, x := range r.values[i*width : (i+1)*width] {
+			values = protowire.AppendFixed32(values, math.Float32bits(x))
+		}
+		message := parser.Truncate(log.Message, remoteMaxMessageLength)
+
+		var row []byte
+		row = protowire.AppendTag(row, 1, protowire.BytesType)
+		row = protowire.AppendBytes(row, values)
+		row = protowire.AppendTag(row, 2, protowire.BytesType)
+		row = protowire.AppendString(row, log.Source)
+		row = protowire.AppendTag(row, 3, protowire.BytesType)
+		row = protowire.AppendString(row, message)
+		row = protowire.AppendTag(row, 4, protowire.BytesType)
+		row = protowire.AppendString(row, log.TemplateID)
+
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, row)
+	}
+	return b
+}
+
+// unmarshal decodes a response in protobuf wire format, accepting scores
+// packed or not and skipping unknown fields
+func (r *scoreResponse) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			for len(packed) > 0 {
+				v, n := protowire.ConsumeFixed64(packed)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				packed = packed[n:]
+				r.scores = append(r.scores, math.Float64frombits(v))
+			}
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			r.scores = append(r.scores, math.Float64frombits(v))
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// scoringCodec encodes the messages of the scoring service without
+// generated code
+type scoringCodec struct{}
+
+// Marshal implements encoding.Codec
+func (scoringCodec) Marshal(v interface{}) ([]byte, error) {
+	req, ok := v.(*scoreRequest)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return req.marshal(), nil
+}
+
+// Unmarshal implements encoding.Codec
+func (scoringCodec) Unmarshal(data []byte, v interface{}) error {
+	resp, ok := v.(*scoreResponse)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	return resp.unmarshal(data)
+}
+
+// Name implements encoding.Codec
+func (scoringCodec) Name() string {
+	return "proto"
+}
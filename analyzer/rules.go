@@ -0,0 +1,665 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// RuleFile is the on-disk format of a rules file. Conditions declares
+// named conditions that rules refer to with a ref condition.
+type RuleFile struct {
+	Conditions map[string]ConditionSpec `json:"conditions"`
+	Rules      []RuleSpec               `json:"rules"`
+}
+
+// RuleSpec is a declarative rule definition. A log matches when every
+// condition in Match holds. Rules too complex for conditions can instead
+// name a Starlark Script, resolved relative to the rules file.
+type RuleSpec struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Severity string          `json:"severity"`
+	Match    []ConditionSpec `json:"match"`
+	Window   config.Duration `json:"window"`
+	Script   string          `json:"script"`
+
+	// Weight is the base score of the rule's alerts, by default derived
+	// from Severity
+	Weight float64 `json:"weight"`
+
+	// Priority orders evaluation, higher first, and Stop skips the rules
+	// after this one for logs it matches
+	Priority int  `json:"priority"`
+	Stop     bool `json:"stop"`
+
+	// Threshold makes the rule fire once per window when at least this
+	// many matches share the same Key field (default source)
+	Threshold int    `json:"threshold"`
+	Key       string `json:"key"`
+
+	// AutoThreshold makes a threshold rule tune its threshold from the
+	// history of its window counts, starting from Threshold
+	AutoThreshold *AutoThresholdSpec `json:"auto_threshold"`
+
+	// SpikeFactor makes the rule fire when a key's count in the current
+	// window exceeds the previous window's by this factor
+	SpikeFactor float64 `json:"spike_factor"`
+
+	// Counter selects how matches are counted per key: "exact" (default)
+	// keeps a counter per key, "sketch" a Count-Min Sketch of fixed size
+	// whose counts overestimate by at most SketchError times the window's
+	// matches with probability SketchConfidence (defaults 0.001 and 0.99)
+	Counter          string  `json:"counter"`
+	SketchError      float64 `json:"sketch_error"`
+	SketchConfidence float64 `json:"sketch_confidence"`
+
+	// Distinct makes the rule count distinct values of this field per Key,
+	// e.g. unique client IPs per source, and fire on Threshold or
+	// SpikeFactor like a counting rule
+	Distinct string `json:"distinct"`
+
+	// Sequence makes the rule fire when its steps match in order for the
+	// same Key within Window
+	Sequence []StepSpec `json:"sequence"`
+
+	// Percentile makes the rule judge a quantile of a numeric field per Key
+	// over each Window, firing when it breaches a limit for a number of
+	// consecutive windows
+	Percentile *PercentileSpec `json:"percentile"`
+
+	// Join makes the rule fire when each of its parts has matched within
+	// Window, in any order, typically across different sources
+	Join []JoinSpec `json:"join"`
+
+	// Heartbeat makes the rule expect a log matching it from each Key at
+	// least every period, and fire when one does not arrive
+	Heartbeat *HeartbeatSpec `json:"heartbeat"`
+
+	// Aggregator makes the rule an aggregator of other rules' detections,
+	// grouped by Key over Window, and Aggregate names the aggregator the
+	// rule's detections feed instead of raising alerts
+	Aggregator *AggregatorSpec `json:"aggregator"`
+	Aggregate  string          `json:"aggregate"`
+
+	// Enrich attaches context to the rule's alerts, such as recent logs
+	// from the source or the baseline the rate is judged against
+	Enrich []EnrichSpec `json:"enrich"`
+
+	// Labels are attached to the rule's alerts as the labels metadata, for
+	// the alerter to route them by, e.g. {"team": "security"}
+	Labels map[string]string `json:"labels"`
+
+	// Suppress turns the rule into an allow-list entry: logs matching it
+	// never raise alerts
+	Suppress bool `json:"suppress"`
+}
+
+// StepSpec is one step of a sequence rule. The step completes once Count
+// logs (default 1) for the key have matched every condition.
+type StepSpec struct {
+	Match []ConditionSpec `json:"match"`
+	Count int             `json:"count"`
+}
+
+// AutoThresholdSpec derives the threshold of a rule from the Quantile
+// (default 0.995) of its per-key window counts over History (default 7
+// days), recomputed every Recompute (default 1h) once MinSamples windows
+// (default 100) were seen. The threshold never drops below Min.
+type AutoThresholdSpec struct {
+	Quantile   float64         `json:"quantile"`
+	History    config.Duration `json:"history"`
+	Recompute  config.Duration `json:"recompute"`
+	Min        int             `json:"min"`
+	MinSamples int             `json:"min_samples"`
+}
+
+// HeartbeatSpec expects a matching log at least Every period. A heartbeat
+// is reported missing once Grace (default 1m) has passed after it was due;
+// after a restart, heartbeats that fell due while Argos was down are given
+// Grace to catch up.
+type HeartbeatSpec struct {
+	Every config.Duration `json:"every"`
+	Grace config.Duration `json:"grace"`
+}
+
+// JoinSpec is one part of a join rule, satisfied once Count logs (default
+// 1) within the window have matched every condition. Name labels the part
+// in alerts.
+type JoinSpec struct {
+	Name  string          `json:"name"`
+	Match []ConditionSpec `json:"match"`
+	Count int             `json:"count"`
+}
+
+// ConditionSpec tests one field of a parsed log. Field names are those
+// understood by parser.ParsedLog.Lookup. Supported operators are eq, ne,
+// in, not_in, contains, prefix, suffix, regex, gt, gte, lt, lte, exists and
+// in_list, which matches when a word of the field is on one of the keyword
+// lists named by the value; Regex is shorthand for the regex operator with
+// that pattern.
+// Alternatively Expr holds a full expression, e.g. "level == 'ERROR'".
+type ConditionSpec struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+	Regex string      `json:"regex"`
+	Expr  string      `json:"expr"`
+
+	// All, Any and Not combine nested conditions, and Ref stands for a
+	// named condition from the rules file
+	All []ConditionSpec `json:"all"`
+	Any []ConditionSpec `json:"any"`
+	Not *ConditionSpec  `json:"not"`
+	Ref string          `json:"ref"`
+}
+
+// LoadRules reads and compiles a JSON rules file
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+
+	var file RuleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules %s: %w", path, err)
+	}
+
+	for i, spec := range file.Rules {
+		if spec.Script != "" && !filepath.IsAbs(spec.Script) {
+			file.Rules[i].Script = filepath.Join(filepath.Dir(path), spec.Script)
+		}
+		if err := resolveRuleRefs(&file.Rules[i], file.Conditions); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", spec.Name, err)
+		}
+	}
+
+	return CompileRules(file.Rules)
+}
+
+// CompileRules turns rule specs into executable rules
+func CompileRules(specs []RuleSpec) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	seen := make(map[string]bool)
+	seenIDs := make(map[string]bool)
+
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("rule without a name")
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", spec.Name)
+		}
+		seen[spec.Name] = true
+
+		id := spec.ID
+		if id == "" {
+			id = RuleID(spec.Name)
+		}
+		if seenIDs[id] {
+			return nil, fmt.Errorf("duplicate rule id %q", id)
+		}
+		seenIDs[id] = true
+
+		rule, err := compileRule(spec)
+		if err == nil {
+			err = compileCounter(&rule, spec)
+		}
+		if err == nil {
+			err = compileEnrich(&rule, spec)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", spec.Name, err)
+		}
+		rule.ID = id
+		rules = append(rules, rule)
+	}
+
+	if err := linkAggregators(rules, specs); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CompileMatchRules turns the match rules of the configuration into
+// executable rules
+func CompileMatchRules(rules []config.MatchRule) ([]Rule, error) {
+	specs := make([]RuleSpec, 0, len(rules))
+	for _, r := range rules {
+		if r.Match.Regex == "" {
+			return nil, fmt.Errorf("rule %q: match needs a regex", r.Name)
+		}
+		field := r.Match.Field
+		if field == "" {
+			field = "message"
+		}
+		specs = append(specs, RuleSpec{
+			Name:      r.Name,
+			Severity:  r.Severity,
+			Match:     []ConditionSpec{{Field: field, Regex: r.Match.Regex}},
+			Threshold: r.Threshold,
+			Window:    r.Window,
+			Key:       r.Key,
+		})
+	}
+	return CompileRules(specs)
+}
+
+// compileRule compiles a single rule spec
+func compileRule(spec RuleSpec) (Rule, error) {
+	if spec.Suppress && (spec.Script != "" || len(spec.Sequence) > 0 || spec.Threshold > 0 || spec.SpikeFactor > 0 || spec.Distinct != "" || spec.Percentile != nil || len(spec.Join) > 0 || spec.Heartbeat != nil || spec.Aggregate != "") {
+		return Rule{}, fmt.Errorf("suppression rules only take match conditions")
+	}
+	if spec.Aggregator != nil {
+		return compileAggregatorRule(spec)
+	}
+	if spec.Distinct != "" && (spec.Script != "" || len(spec.Sequence) > 0 || spec.Counter != "") {
+		return Rule{}, fmt.Errorf("distinct rules only take match conditions, a threshold and a spike factor")
+	}
+	if spec.Distinct != "" && spec.Threshold <= 0 && spec.SpikeFactor <= 0 {
+		return Rule{}, fmt.Errorf("distinct rules need a threshold or a spike factor")
+	}
+	if spec.AutoThreshold != nil && (spec.Threshold <= 0 || spec.SpikeFactor > 0 || spec.Distinct != "" || spec.Script != "" || len(spec.Sequence) > 0 || spec.Percentile != nil || len(spec.Join) > 0 || spec.Suppress) {
+		return Rule{}, fmt.Errorf("auto thresholds only apply to threshold rules, starting from their threshold")
+	}
+	if spec.Heartbeat != nil && (spec.Script != "" || len(spec.Sequence) > 0 || spec.Threshold > 0 || spec.SpikeFactor > 0 || spec.Distinct != "" || spec.Counter != "" || spec.Percentile != nil || len(spec.Join) > 0) {
+		return Rule{}, fmt.Errorf("heartbeat rules only take match conditions and a key")
+	}
+	if spec.Heartbeat != nil {
+		return compileHeartbeatRule(spec)
+	}
+	if spec.Percentile != nil {
+		return compilePercentileRule(spec)
+	}
+	if len(spec.Join) > 0 {
+		return compileJoinRule(spec)
+	}
+	if spec.Script != "" {
+		return compileScriptRule(spec)
+	}
+	if len(spec.Sequence) > 0 {
+		return compileSequenceRule(spec)
+	}
+	if len(spec.Match) == 0 {
+		return Rule{}, fmt.Errorf("no match conditions")
+	}
+
+	check, err := compileMatch(spec.Match)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	severity := strings.ToUpper(spec.Severity)
+	if severity == "" {
+		severity = "MEDIUM"
+	}
+
+	var auto *autoThresholdConfig
+	if spec.AutoThreshold != nil {
+		if auto, err = compileAutoThreshold(spec.AutoThreshold); err != nil {
+			return Rule{}, err
+		}
+	}
+
+	return Rule{
+		Name:        spec.Name,
+		Severity:    severity,
+		Window:      time.Duration(spec.Window),
+		Weight:      spec.Weight,
+		Priority:    spec.Priority,
+		Stop:        spec.Stop,
+		Threshold:   spec.Threshold,
+		KeyField:    spec.Key,
+		SpikeFactor: spec.SpikeFactor,
+		Suppress:    spec.Suppress,
+		Check:       check,
+
+		DistinctField: spec.Distinct,
+		auto:          auto,
+	}, nil
+}
+
+// compileCounter applies the counter mode of a rule spec
+func compileCounter(rule *Rule, spec RuleSpec) error {
+	switch spec.Counter {
+	case "", "exact":
+		return nil
+	case "sketch":
+	default:
+		return fmt.Errorf("unknown counter %q", spec.Counter)
+	}
+	if spec.Threshold <= 0 || spec.Suppress || len(spec.Sequence) > 0 || spec.SpikeFactor > 0 {
+		return fmt.Errorf("sketch counters only apply to threshold rules")
+	}
+
+	rule.SketchError = spec.SketchError
+	if rule.SketchError <= 0 {
+		rule.SketchError = defaultSketchError
+	}
+	rule.SketchConfidence = spec.SketchConfidence
+	if rule.SketchConfidence <= 0 {
+		rule.SketchConfidence = defaultSketchConfidence
+	}
+	if rule.SketchError >= 1 || rule.SketchConfidence >= 1 {
+		return fmt.Errorf("sketch_error and sketch_confidence must be below 1")
+	}
+	return nil
+}
+
+// compileMatch compiles a list of conditions into a predicate that holds
+// when every condition does
+func compileMatch(conds []ConditionSpec) (func(parser.ParsedLog) bool, error) {
+	checks := make([]func(parser.ParsedLog) bool, 0, len(conds))
+	for _, cond := range conds {
+		check, err := compileCondition(cond)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+
+	return func(log parser.ParsedLog) bool {
+		for _, check := range checks {
+			if !check(log) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// resolveRuleRefs replaces references to named conditions in a rule with
+// their definitions
+func resolveRuleRefs(spec *RuleSpec, named map[string]ConditionSpec) error {
+	var err error
+	if spec.Match, err = resolveRefs(spec.Match, named, nil); err != nil {
+		return err
+	}
+	for i := range spec.Sequence {
+		if spec.Sequence[i].Match, err = resolveRefs(spec.Sequence[i].Match, named, nil); err != nil {
+			return err
+		}
+	}
+	for i := range spec.Join {
+		if spec.Join[i].Match, err = resolveRefs(spec.Join[i].Match, named, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRefs resolves named condition references in a list of conditions
+func resolveRefs(conds []ConditionSpec, named map[string]ConditionSpec, stack []string) ([]ConditionSpec, error) {
+	if len(conds) == 0 {
+		return conds, nil
+	}
+	resolved := make([]ConditionSpec, len(conds))
+	for i, cond := range conds {
+		var err error
+		if resolved[i], err = resolveRef(cond, named, stack); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// resolveRef resolves named condition references in one condition, using
+// stack to reject conditions that refer to themselves
+func resolveRef(cond ConditionSpec, named map[string]ConditionSpec, stack []string) (ConditionSpec, error) {
+	if cond.Ref != "" {
+		for _, name := range stack {
+			if name == cond.Ref {
+				return cond, fmt.Errorf("condition %q refers to itself", cond.Ref)
+			}
+		}
+		def, ok := named[cond.Ref]
+		if !ok {
+			return cond, fmt.Errorf("unknown condition %q", cond.Ref)
+		}
+		return resolveRef(def, named, append(stack, cond.Ref))
+	}
+
+	var err error
+	if cond.All, err = resolveRefs(cond.All, named, stack); err != nil {
+		return cond, err
+	}
+	if cond.Any, err = resolveRefs(cond.Any, named, stack); err != nil {
+		return cond, err
+	}
+	if cond.Not != nil {
+		not, err := resolveRef(*cond.Not, named, stack)
+		if err != nil {
+			return cond, err
+		}
+		cond.Not = &not
+	}
+	return cond, nil
+}
+
+// compileCondition compiles a single condition into a predicate
+func compileCondition(cond ConditionSpec) (func(parser.ParsedLog) bool, error) {
+	switch {
+	case cond.Ref != "":
+		return nil, fmt.Errorf("unknown condition %q", cond.Ref)
+
+	case len(cond.All) > 0:
+		return compileMatch(cond.All)
+
+	case len(cond.Any) > 0:
+		checks := make([]func(parser.ParsedLog) bool, 0, len(cond.Any))
+		for _, sub := range cond.Any {
+			check, err := compileCondition(sub)
+			if err != nil {
+				return nil, err
+			}
+			checks = append(checks, check)
+		}
+		return func(log parser.ParsedLog) bool {
+			for _, check := range checks {
+				if check(log) {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case cond.Not != nil:
+		check, err := compileCondition(*cond.Not)
+		if err != nil {
+			return nil, err
+		}
+		return func(log parser.ParsedLog) bool {
+			return !check(log)
+		}, nil
+	}
+
+	if cond.Expr != "" {
+		expr, err := parser.CompileExpr(cond.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(log parser.ParsedLog) bool {
+			value, err := expr.EvalLog(&log)
+			return err == nil && value == true
+		}, nil
+	}
+
+	if cond.Field == "" {
+		return nil, fmt.Errorf("condition needs a field, an expr, all, any, not or ref")
+	}
+	if cond.Regex != "" {
+		if cond.Op != "" || cond.Value != nil {
+			return nil, fmt.Errorf("condition on %s takes either a regex or an op and value", cond.Field)
+		}
+		cond.Op, cond.Value = "regex", cond.Regex
+	}
+
+	op := strings.ToLower(cond.Op)
+	if op == "" {
+		op = "eq"
+	}
+
+	field := cond.Field
+	lookup := func(log parser.ParsedLog) []string {
+		value, ok := log.Lookup(field)
+		if !ok || value == nil {
+			return nil
+		}
+		return valueStrings(value)
+	}
+
+	switch op {
+	case "exists":
+		return func(log parser.ParsedLog) bool {
+			values := lookup(log)
+			return len(values) > 0 && values[0] != ""
+		}, nil
+
+	case "eq", "ne", "in", "not_in", "contains", "prefix", "suffix":
+		wanted := valueStrings(cond.Value)
+		if len(wanted) == 0 {
+			return nil, fmt.Errorf("operator %s on %s needs a value", op, field)
+		}
+		var test func(have, want string) bool
+		switch op {
+		case "contains":
+			test = strings.Contains
+		case "prefix":
+			test = strings.HasPrefix
+		case "suffix":
+			test = strings.HasSuffix
+		default:
+			test = func(have, want string) bool { return have == want }
+		}
+		negate := op == "ne" || op == "not_in"
+		return func(log parser.ParsedLog) bool {
+			return anyMatch(lookup(log), wanted, test) != negate
+		}, nil
+
+	case "in_list":
+		names := valueStrings(cond.Value)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("in_list on %s needs a keyword list name", field)
+		}
+		lists := make([]*keywordList, 0, len(names))
+		for _, name := range names {
+			l, err := keywordListNamed(name)
+			if err != nil {
+				return nil, err
+			}
+			lists = append(lists, l)
+		}
+		return func(log parser.ParsedLog) bool {
+			values := lookup(log)
+			for _, l := range lists {
+				if l.matchesAny(values) {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case "regex":
+		pattern, ok := cond.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("regex on %s needs a string pattern", field)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("regex on %s: %w", field, err)
+		}
+		return func(log parser.ParsedLog) bool {
+			for _, have := range lookup(log) {
+				if re.MatchString(have) {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case "gt", "gte", "lt", "lte":
+		limit, ok := toFloat(cond.Value)
+		if !ok {
+			return nil, fmt.Errorf("operator %s on %s needs a numeric value", op, field)
+		}
+		return func(log parser.ParsedLog) bool {
+			value, ok := log.Lookup(field)
+			if !ok {
+				return false
+			}
+			n, ok := toFloat(value)
+			if !ok {
+				return false
+			}
+			switch op {
+			case "gt":
+				return n > limit
+			case "gte":
+				return n >= limit
+			case "lt":
+				return n < limit
+			}
+			return n <= limit
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %q", cond.Op)
+}
+
+// anyMatch reports whether any value satisfies test against any wanted value
+func anyMatch(values, wanted []string, test func(have, want string) bool) bool {
+	for _, have := range values {
+		for _, want := range wanted {
+			if test(have, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// valueStrings flattens a field or condition value into strings
+func valueStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, valueStrings(item)...)
+		}
+		return out
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+// toFloat converts a numeric or numeric-string value to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,139 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RuleStats reports how useful a rule has been since startup: how often it
+// fired, how often its output was withheld, and how responders judged its
+// alerts. Rules that never fire or are mostly dismissed are candidates for
+// removal.
+type RuleStats struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Enabled  bool   `json:"enabled"`
+
+	// Threshold is the current threshold of threshold rules, as tuned for
+	// rules with an auto threshold
+	Threshold int `json:"threshold,omitempty"`
+
+	// Fired counts alerts raised by the rule, and Suppressed those muted
+	// by a maintenance window or folded into an earlier alert by
+	// deduplication; for suppression rules it counts the logs they muted
+	Fired      int64 `json:"fired"`
+	Suppressed int64 `json:"suppressed"`
+
+	// Acknowledged and Dismissed count responder feedback on the rule's
+	// alerts
+	Acknowledged int64 `json:"acknowledged"`
+	Dismissed    int64 `json:"dismissed"`
+
+	LastFired string `json:"last_fired,omitempty"`
+}
+
+// ruleEffectiveness is the running tally behind RuleStats
+type ruleEffectiveness struct {
+	fired        int64
+	suppressed   int64
+	acknowledged int64
+	dismissed    int64
+	lastFired    time.Time
+}
+
+// ruleTally tracks the effectiveness of rules by name
+type ruleTally struct {
+	mu    sync.Mutex
+	rules map[string]*ruleEffectiveness
+}
+
+// get returns the tally of a rule, creating it on first use. The caller
+// must hold the lock.
+func (t *ruleTally) get(name string) *ruleEffectiveness {
+	e, ok := t.rules[name]
+	if !ok {
+		e = &ruleEffectiveness{}
+		t.rules[name] = e
+	}
+	return e
+}
+
+// fired records an alert of a rule at now, withheld or not
+func (t *ruleTally) fired(name string, now time.Time, withheld bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.get(name)
+	e.fired++
+	e.lastFired = now
+	if withheld {
+		e.suppressed++
+	}
+}
+
+// suppressed records a log muted by a suppression rule
+func (t *ruleTally) suppressed(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.get(name).suppressed++
+}
+
+// RecordFeedback records a responder acknowledging, or dismissing as
+// noise, an alert of the named rule
+func (a *Analyzer) RecordFeedback(rule string, dismissed bool) {
+	a.tally.mu.Lock()
+	defer a.tally.mu.Unlock()
+
+	e := a.tally.get(rule)
+	if dismissed {
+		e.dismissed++
+	} else {
+		e.acknowledged++
+	}
+}
+
+// RuleStats returns the effectiveness of every active rule, in evaluation
+// order
+func (a *Analyzer) RuleStats() []RuleStats {
+	a.tally.mu.Lock()
+	defer a.tally.mu.Unlock()
+
+	var stats []RuleStats
+	for _, rule := range a.Rules() {
+		s := RuleStats{
+			ID:       rule.ID,
+			Name:     rule.Name,
+			Severity: rule.Severity,
+			Enabled:  !a.isDisabled(rule.ID),
+
+			Threshold: a.currentThreshold(rule),
+		}
+		if e, ok := a.tally.rules[rule.Name]; ok {
+			s.Fired = e.fired
+			s.Suppressed = e.suppressed
+			s.Acknowledged = e.acknowledged
+			s.Dismissed = e.dismissed
+			if !e.lastFired.IsZero() {
+				s.LastFired = e.lastFired.Format(time.RFC3339)
+			}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// HandleRuleStats serves GET requests for the effectiveness of the active
+// rules
+func (a *Analyzer) HandleRuleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.RuleStats())
+}
@@ -0,0 +1,158 @@
+package analyzer
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+)
+
+// Sampling defaults
+const (
+	defaultSamplingRate = 10.0
+
+	// samplingQuiet is how long a rule's sampled-out alerts must have
+	// stopped before the last of them is sent with the final count
+	samplingQuiet = 5 * time.Second
+)
+
+// defaultSampledSeverities are the severities sampled when none are
+// configured
+var defaultSampledSeverities = []string{"MEDIUM", "LOW"}
+
+// sampledRule is the sampling state of the alerts of one rule
+type sampledRule struct {
+	skipped  int
+	latest   Alert
+	lastSkip time.Time
+}
+
+// alertSampler lets low-severity alerts through at up to a rate, with
+// bursts, and samples out the rest. Every alert let through carries how
+// many alerts of its rule were sampled out since the previous one, so
+// counts stay exact while an alert storm degrades gracefully instead of
+// blocking the pipeline behind the alert channel.
+type alertSampler struct {
+	rate       float64
+	burst      float64
+	severities map[string]bool
+	mu         sync.Mutex
+	tokens     float64
+	refilled   time.Time
+	rules      map[string]*sampledRule
+}
+
+// EnableSampling samples alerts of the configured severities once they
+// exceed the configured rate
+func (a *Analyzer) EnableSampling(cfg config.Sampling) {
+	s := &alertSampler{
+		rate:       cfg.Rate,
+		burst:      float64(cfg.Burst),
+		severities: make(map[string]bool),
+		refilled:   time.Now(),
+		rules:      make(map[string]*sampledRule),
+	}
+	if s.rate <= 0 {
+		s.rate = defaultSamplingRate
+	}
+	if s.burst <= 0 {
+		s.burst = math.Ceil(2 * s.rate)
+	}
+	s.tokens = s.burst
+	severities := cfg.Severities
+	if len(severities) == 0 {
+		severities = defaultSampledSeverities
+	}
+	for _, severity := range severities {
+		s.severities[strings.ToUpper(severity)] = true
+	}
+	a.sampler = s
+}
+
+// admit reports whether an alert should be sent, recording it as sampled
+// out otherwise
+func (s *alertSampler) admit(alert *Alert, now time.Time) bool {
+	if !s.severities[strings.ToUpper(alert.Severity)] {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = math.Min(s.burst, s.tokens+now.Sub(s.refilled).Seconds()*s.rate)
+	s.refilled = now
+
+	r := s.rules[alert.Reason]
+	if s.tokens < 1 {
+		if r == nil {
+			r = &sampledRule{}
+			s.rules[alert.Reason] = r
+		}
+		r.skipped++
+		r.latest = *alert
+		r.lastSkip = now
+		return false
+	}
+	s.tokens--
+
+	if r != nil {
+		markSampled(alert, r.skipped, s.rate)
+		delete(s.rules, alert.Reason)
+	}
+	return true
+}
+
+// due returns, for rules whose sampled-out alerts stopped a while ago, the
+// last of them carrying the count not yet reported
+func (s *alertSampler) due(now time.Time) []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var alerts []Alert
+	for reason, r := range s.rules {
+		if now.Sub(r.lastSkip) < samplingQuiet {
+			continue
+		}
+		alert := r.latest
+		alert.Metadata = make(map[string]interface{}, len(r.latest.Metadata)+3)
+		for k, v := range r.latest.Metadata {
+			alert.Metadata[k] = v
+		}
+		markSampled(&alert, r.skipped-1, s.rate)
+		alerts = append(alerts, alert)
+		delete(s.rules, reason)
+	}
+	return alerts
+}
+
+// markSampled records on an alert how many alerts of its rule were sampled
+// out before it
+func markSampled(alert *Alert, skipped int, rate float64) {
+	alert.Metadata["sampled"] = true
+	alert.Metadata["sampled_out"] = skipped
+	alert.Metadata["sampling_rate"] = rate
+}
+
+// flushSampling periodically sends the final counts of rules whose alerts
+// were sampled out
+func (a *Analyzer) flushSampling() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, alert := range a.sampler.due(now) {
+				if !a.deliver(alert, now) {
+					return
+				}
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
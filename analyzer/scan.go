@@ -0,0 +1,195 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Scan detector defaults
+const (
+	defaultScanWindow         = time.Minute
+	defaultScanPortThreshold  = 20
+	defaultScanPathThreshold  = 50
+	defaultScanFloodThreshold = 1000
+
+	// scanMaxDistinct bounds the ports or paths remembered per client
+	scanMaxDistinct = 10000
+
+	// scanPruneInterval is how often idle clients are dropped
+	scanPruneInterval = time.Minute
+)
+
+// Fields the client IP, port and path are taken from, in order of preference
+var (
+	clientIPFields = []string{"src_ip", "client_ip", "remote_addr", "source_ip"}
+	portFields     = []string{"dst_port", "dport", "dpt", "port"}
+	pathFields     = []string{"path", "uri", "url", "request_uri"}
+)
+
+// Patterns finding a port or request path in free text
+var (
+	portPattern = regexp.MustCompile(`(?i)\b(?:dst )?port[= :]+(\d{1,5})\b`)
+	pathPattern = regexp.MustCompile(`\b(?:GET|POST|PUT|DELETE|HEAD|OPTIONS|PATCH) (/\S*)`)
+)
+
+// scanClient is what is known about one client IP within the window
+type scanClient struct {
+	requests *slidingCounter
+	ports    *distinctSet
+	paths    *distinctSet
+	fired    map[string]bool
+}
+
+// scanDetector tracks distinct ports and paths and the request count per
+// client IP, alerting on port scans, path scans and request floods
+type scanDetector struct {
+	window     time.Duration
+	portLimit  int
+	pathLimit  int
+	floodLimit int
+	severity   string
+	mu         sync.Mutex
+	clients    map[string]*scanClient
+	lastPrune  time.Time
+}
+
+// newScanDetector creates a scan and flood detector from its configuration
+func newScanDetector(cfg config.Scan) *scanDetector {
+	d := &scanDetector{
+		window:     time.Duration(cfg.Window),
+		portLimit:  cfg.PortThreshold,
+		pathLimit:  cfg.PathThreshold,
+		floodLimit: cfg.FloodThreshold,
+		severity:   strings.ToUpper(cfg.Severity),
+		clients:    make(map[string]*scanClient),
+		lastPrune:  time.Now(),
+	}
+	if d.window <= 0 {
+		d.window = defaultScanWindow
+	}
+	if d.portLimit <= 0 {
+		d.portLimit = defaultScanPortThreshold
+	}
+	if d.pathLimit <= 0 {
+		d.pathLimit = defaultScanPathThreshold
+	}
+	if d.floodLimit <= 0 {
+		d.floodLimit = defaultScanFloodThreshold
+	}
+	if d.severity == "" {
+		d.severity = "HIGH"
+	}
+	return d
+}
+
+// Observe counts a log toward its client IP
+func (d *scanDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	ip := fieldString(logEntry, clientIPFields)
+	if ip == "" {
+		ip = logEntry.IP
+	}
+	if ip == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, ok := d.clients[ip]
+	if !ok {
+		c = &scanClient{
+			requests: newSlidingCounter(d.window, now),
+			ports:    newDistinctSet(d.window, now),
+			paths:    newDistinctSet(d.window, now),
+			fired:    make(map[string]bool),
+		}
+		d.clients[ip] = c
+	}
+
+	var alerts []Alert
+	check := func(name, metric string, count, limit int) {
+		if count < limit {
+			c.fired[name] = false
+			return
+		}
+		if c.fired[name] {
+			return
+		}
+		c.fired[name] = true
+		alerts = append(alerts, detectorAlert(name, d.severity, logEntry, now, map[string]interface{}{
+			"detector":  "scan",
+			"ip":        ip,
+			metric:      count,
+			"threshold": limit,
+			"window":    d.window.String(),
+		}))
+	}
+
+	check("Request Flood", "requests", c.requests.add(now, logEntry.RepeatCount), d.floodLimit)
+	if port := scanPort(logEntry); port != "" && len(c.ports.seen) < scanMaxDistinct {
+		check("Port Scan", "distinct_ports", c.ports.add(port, now), d.portLimit)
+	}
+	if path := scanPath(logEntry); path != "" && len(c.paths.seen) < scanMaxDistinct {
+		check("Path Scan", "distinct_paths", c.paths.add(path, now), d.pathLimit)
+	}
+	return alerts
+}
+
+// Tick drops clients that have been idle for the whole window
+func (d *scanDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) < scanPruneInterval {
+		return nil
+	}
+	d.lastPrune = now
+
+	for ip, c := range d.clients {
+		if c.requests.count(now) == 0 {
+			delete(d.clients, ip)
+		}
+	}
+	return nil
+}
+
+// scanPort returns the destination port of a log, if any
+func scanPort(logEntry parser.ParsedLog) string {
+	if port := fieldString(logEntry, portFields); port != "" {
+		return port
+	}
+	if m := portPattern.FindStringSubmatch(logEntry.Message); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// scanPath returns the request path of a log without its query, if any
+func scanPath(logEntry parser.ParsedLog) string {
+	path := fieldString(logEntry, pathFields)
+	if path == "" {
+		if m := pathPattern.FindStringSubmatch(logEntry.Message); m != nil {
+			path = m[1]
+		}
+	}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+// fieldString returns the first of the named fields present on a log as a
+// string
+func fieldString(logEntry parser.ParsedLog, fields []string) string {
+	for _, field := range fields {
+		if values := valueStrings(logEntry.Fields[field]); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"math"
+	"strings"
+
+	"github.com/davidharvith/argos/config"
+)
+
+// Score components: a rule's base weight is taken from its severity unless
+// set explicitly, frequency adds up to scoreMaxFrequency as matches pile up
+// in the window, and an alert for a pattern not seen before gains
+// scoreNovelty
+const (
+	scoreMaxFrequency = 20.0
+	scoreNovelty      = 10.0
+	scoreMax          = 100.0
+)
+
+// severityWeights are the base weights of rules without an explicit weight
+var severityWeights = map[string]float64{
+	"LOW":      20,
+	"MEDIUM":   40,
+	"HIGH":     60,
+	"CRITICAL": 80,
+}
+
+// scoreBands map a score to a severity, highest band first
+var scoreBands = []struct {
+	min      float64
+	severity string
+}{
+	{80, "CRITICAL"},
+	{60, "HIGH"},
+	{40, "MEDIUM"},
+	{0, "LOW"},
+}
+
+// scorer combines rule weight, frequency, novelty and source criticality
+// into a 0-100 score
+type scorer struct {
+	enabled     bool
+	criticality map[string]float64
+}
+
+// SetScoring configures alert scoring. Alerts are always scored; when
+// scoring is enabled their severity is also derived from the score.
+func (a *Analyzer) SetScoring(cfg config.Scoring) {
+	a.scorer = scorer{
+		enabled:     cfg.Enabled,
+		criticality: cfg.SourceCriticality,
+	}
+}
+
+// severityWeight returns the base weight of a severity
+func severityWeight(severity string) float64 {
+	if w, ok := severityWeights[strings.ToUpper(severity)]; ok {
+		return w
+	}
+	return severityWeights["MEDIUM"]
+}
+
+// score sets an alert's score from a base weight and, when enabled, maps
+// the score to a severity band
+func (s scorer) score(alert *Alert, weight float64) {
+	score := weight
+
+	if count, ok := toFloat(alert.Metadata["count_in_window"]); ok && count > 1 {
+		score += math.Min(scoreMaxFrequency, 5*math.Log2(count))
+	}
+	if known, ok := alert.Metadata["is_known_pattern"].(bool); ok && !known {
+		score += scoreNovelty
+	}
+
+	factor, ok := s.criticality[alert.Log.Source]
+	if !ok {
+		factor, ok = s.criticality["*"]
+	}
+	if ok {
+		score *= factor
+	}
+
+	alert.Score = math.Round(math.Max(0, math.Min(scoreMax, score))*10) / 10
+	if !s.enabled {
+		return
+	}
+	for _, band := range scoreBands {
+		if alert.Score >= band.min {
+			alert.Severity = band.severity
+			return
+		}
+	}
+}
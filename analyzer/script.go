@@ -0,0 +1,285 @@
+package analyzer
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	// scriptMaxSteps bounds the work a single script invocation may do
+	scriptMaxSteps = 1000000
+
+	// scriptLogInterval is the least time between logs of failures of one
+	// script
+	scriptLogInterval = 10 * time.Second
+)
+
+// scriptRule is a rule implemented in Starlark. The script must define
+//
+//	def check(log, state):
+//
+// where log is a struct of the parsed log fields and state is a dict that
+// persists between calls. A truthy return value fires the rule like any
+// other rule; emit(reason, severity=..., **metadata) raises extra alerts.
+type scriptRule struct {
+	name     string
+	severity string
+	check    *starlark.Function
+	state    *starlark.Dict
+	mu       sync.Mutex
+
+	// failed counts the failures since loggedAt, when they were last logged
+	failed   int
+	loggedAt time.Time
+}
+
+// compileScriptRule loads a Starlark script and returns it as a Rule
+func compileScriptRule(spec RuleSpec) (Rule, error) {
+	severity := strings.ToUpper(spec.Severity)
+	if severity == "" {
+		severity = "MEDIUM"
+	}
+
+	sr := &scriptRule{
+		name:     spec.Name,
+		severity: severity,
+		state:    starlark.NewDict(0),
+	}
+
+	thread := &starlark.Thread{
+		Name:  spec.Name,
+		Print: sr.print,
+	}
+	globals, err := starlark.ExecFile(thread, spec.Script, nil, sr.builtins())
+	if err != nil {
+		return Rule{}, fmt.Errorf("script %s: %w", spec.Script, err)
+	}
+
+	check, ok := globals["check"].(*starlark.Function)
+	if !ok {
+		return Rule{}, fmt.Errorf("script %s must define check(log, state)", spec.Script)
+	}
+	sr.check = check
+
+	return Rule{
+		Name:        spec.Name,
+		Severity:    severity,
+		Window:      time.Duration(spec.Window),
+		Weight:      spec.Weight,
+		Priority:    spec.Priority,
+		Stop:        spec.Stop,
+		Threshold:   spec.Threshold,
+		KeyField:    spec.Key,
+		SpikeFactor: spec.SpikeFactor,
+		Evaluate:    sr.evaluate,
+	}, nil
+}
+
+// builtins returns the predeclared names available to scripts
+func (sr *scriptRule) builtins() starlark.StringDict {
+	return starlark.StringDict{
+		"emit":   starlark.NewBuiltin("emit", sr.emit),
+		"now":    starlark.NewBuiltin("now", scriptNow),
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	}
+}
+
+// evaluate runs the script's check function against a log seen at now
+func (sr *scriptRule) evaluate(logEntry parser.ParsedLog, now time.Time) (bool, []Alert) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	var emitted []Alert
+	thread := &starlark.Thread{
+		Name:  sr.name,
+		Print: sr.print,
+	}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+	thread.SetLocal("log", logEntry)
+	thread.SetLocal("now", now)
+	thread.SetLocal("alerts", &emitted)
+
+	result, err := starlark.Call(thread, sr.check, starlark.Tuple{logValue(logEntry), sr.state}, nil)
+	if err != nil {
+		ruleMetricsFor(sr.name).errors.Add(1)
+		sr.failed++
+		if now := time.Now(); now.Sub(sr.loggedAt) >= scriptLogInterval {
+			log.Printf("Script rule %s failed %d times: %v", sr.name, sr.failed, err)
+			sr.failed = 0
+			sr.loggedAt = now
+		}
+		return false, emitted
+	}
+
+	return bool(result.Truth()), emitted
+}
+
+// emit implements emit(reason, severity=None, **metadata)
+func (sr *scriptRule) emit(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var reason string
+	severity := sr.severity
+	metadata := map[string]interface{}{"rule_name": sr.name}
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("emit: expected one positional argument (reason)")
+	}
+	reasonValue, ok := starlark.AsString(args[0])
+	if !ok {
+		return nil, fmt.Errorf("emit: reason must be a string")
+	}
+	reason = reasonValue
+
+	for _, kv := range kwargs {
+		key, _ := starlark.AsString(kv[0])
+		if key == "severity" {
+			s, ok := starlark.AsString(kv[1])
+			if !ok {
+				return nil, fmt.Errorf("emit: severity must be a string")
+			}
+			severity = strings.ToUpper(s)
+			continue
+		}
+		metadata[key] = fromStarlark(kv[1])
+	}
+
+	logEntry, _ := thread.Local("log").(parser.ParsedLog)
+	now, _ := thread.Local("now").(time.Time)
+	alerts, _ := thread.Local("alerts").(*[]Alert)
+	if alerts == nil {
+		return nil, fmt.Errorf("emit: only allowed inside check")
+	}
+
+	*alerts = append(*alerts, Alert{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  severity,
+		Reason:    reason,
+		Log:       logEntry,
+		Metadata:  metadata,
+	})
+	return starlark.None, nil
+}
+
+// print routes script print() output to the log
+func (sr *scriptRule) print(_ *starlark.Thread, msg string) {
+	log.Printf("Script rule %s: %s", sr.name, msg)
+}
+
+// scriptNow implements now(), returning the time the log is evaluated at in
+// Unix seconds
+func scriptNow(thread *starlark.Thread, _ *starlark.Builtin, _ starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	now, ok := thread.Local("now").(time.Time)
+	if !ok {
+		now = time.Now()
+	}
+	return starlark.Float(float64(now.UnixNano()) / float64(time.Second)), nil
+}
+
+// logValue exposes a parsed log to scripts as a struct
+func logValue(l parser.ParsedLog) starlark.Value {
+	return starlarkstruct.FromStringDict(starlark.String("log"), starlark.StringDict{
+		"timestamp":    starlark.String(l.Timestamp),
+		"level":        starlark.String(l.Level),
+		"source":       starlark.String(l.Source),
+		"message":      starlark.String(l.Message),
+		"ip":           starlark.String(l.IP),
+		"error_code":   starlark.String(l.ErrorCode),
+		"keywords":     toStarlark(l.Keywords),
+		"template_id":  starlark.String(l.TemplateID),
+		"template":     starlark.String(l.Template),
+		"trace_id":     starlark.String(l.TraceID),
+		"request_id":   starlark.String(l.RequestID),
+		"tenant":       starlark.String(l.Tenant),
+		"repeat_count": starlark.MakeInt(l.RepeatCount),
+		"fields":       toStarlark(l.Fields),
+	})
+}
+
+// toStarlark converts a Go value from ParsedLog.Fields into a Starlark value
+func toStarlark(value interface{}) starlark.Value {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None
+	case string:
+		return starlark.String(v)
+	case bool:
+		return starlark.Bool(v)
+	case int:
+		return starlark.MakeInt(v)
+	case float64:
+		return starlark.Float(v)
+	case []string:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			items[i] = starlark.String(item)
+		}
+		return starlark.NewList(items)
+	case []interface{}:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			items[i] = toStarlark(item)
+		}
+		return starlark.NewList(items)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			dict.SetKey(starlark.String(key), toStarlark(v[key]))
+		}
+		return dict
+	}
+	return starlark.String(fmt.Sprint(value))
+}
+
+// fromStarlark converts a Starlark value into a JSON-friendly Go value
+func fromStarlark(value starlark.Value) interface{} {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil
+	case starlark.String:
+		return string(v)
+	case starlark.Bool:
+		return bool(v)
+	case starlark.Int:
+		if n, ok := v.Int64(); ok {
+			return n
+		}
+		return v.String()
+	case starlark.Float:
+		return float64(v)
+	case *starlark.List:
+		items := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items[i] = fromStarlark(v.Index(i))
+		}
+		return items
+	case starlark.Tuple:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = fromStarlark(item)
+		}
+		return items
+	case *starlark.Dict:
+		out := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				key = item[0].String()
+			}
+			out[key] = fromStarlark(item[1])
+		}
+		return out
+	}
+	return value.String()
+}
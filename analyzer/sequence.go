@@ -0,0 +1,184 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// Sequence rule defaults
+const (
+	defaultSequenceWindow = time.Minute
+
+	// sequencePruneInterval is how often expired partial sequences are dropped
+	sequencePruneInterval = time.Minute
+)
+
+// sequenceStep is a compiled step of a sequence rule
+type sequenceStep struct {
+	check func(parser.ParsedLog) bool
+	count int
+}
+
+// sequenceState is the progress of one key through a sequence
+type sequenceState struct {
+	step    int
+	count   int
+	started time.Time
+}
+
+// sequenceRule fires when logs sharing a key match its steps in order
+// within the window, e.g. five failed logins followed by a successful one
+// from the same IP. Each key runs its own state machine, which is dropped
+// once the window since its first step has passed.
+type sequenceRule struct {
+	name      string
+	severity  string
+	keyField  string
+	window    time.Duration
+	steps     []sequenceStep
+	mu        sync.Mutex
+	states    map[string]*sequenceState
+	lastPrune time.Time
+}
+
+// compileSequenceRule compiles a rule spec with a sequence of steps
+func compileSequenceRule(spec RuleSpec) (Rule, error) {
+	severity := strings.ToUpper(spec.Severity)
+	if severity == "" {
+		severity = "MEDIUM"
+	}
+
+	sr := &sequenceRule{
+		name:     spec.Name,
+		severity: severity,
+		keyField: spec.Key,
+		window:   time.Duration(spec.Window),
+		states:   make(map[string]*sequenceState),
+	}
+	if sr.window <= 0 {
+		sr.window = defaultSequenceWindow
+	}
+
+	for i, step := range spec.Sequence {
+		if len(step.Match) == 0 {
+			return Rule{}, fmt.Errorf("sequence step %d has no match conditions", i+1)
+		}
+		check, err := compileMatch(step.Match)
+		if err != nil {
+			return Rule{}, fmt.Errorf("sequence step %d: %w", i+1, err)
+		}
+		count := step.Count
+		if count <= 0 {
+			count = 1
+		}
+		sr.steps = append(sr.steps, sequenceStep{check: check, count: count})
+	}
+
+	return Rule{
+		Name:     spec.Name,
+		Severity: severity,
+		Window:   sr.window,
+		Weight:   spec.Weight,
+		Priority: spec.Priority,
+		Stop:     spec.Stop,
+		KeyField: spec.Key,
+		Evaluate: sr.evaluate,
+		sequence: sr,
+	}, nil
+}
+
+// evaluate advances the log's key through the sequence at now, raising an
+// alert when the last step completes
+func (sr *sequenceRule) evaluate(logEntry parser.ParsedLog, now time.Time) (bool, []Alert) {
+	key := keyValue(logEntry, sr.keyField)
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if now.Sub(sr.lastPrune) >= sequencePruneInterval {
+		sr.prune(now)
+	}
+
+	state, ok := sr.states[key]
+	if ok && now.Sub(state.started) > sr.window {
+		delete(sr.states, key)
+		ok = false
+	}
+
+	step := 0
+	if ok {
+		step = state.step
+	}
+	if !sr.steps[step].check(logEntry) {
+		return false, nil
+	}
+
+	if !ok {
+		state = &sequenceState{started: now}
+		sr.states[key] = state
+	}
+	state.count += logEntry.RepeatCount
+	if state.count < sr.steps[state.step].count {
+		return false, nil
+	}
+	state.step++
+	state.count = 0
+	if state.step < len(sr.steps) {
+		return false, nil
+	}
+
+	delete(sr.states, key)
+	return false, []Alert{{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  sr.severity,
+		Reason:    sr.name,
+		Log:       logEntry,
+		Metadata: map[string]interface{}{
+			"rule_name": sr.name,
+			"key":       key,
+			"steps":     len(sr.steps),
+			"started":   state.started.Format(time.RFC3339),
+			"duration":  now.Sub(state.started).Round(time.Millisecond).String(),
+		},
+	}}
+}
+
+// prune drops partial sequences whose window has passed
+func (sr *sequenceRule) prune(now time.Time) {
+	for key, state := range sr.states {
+		if now.Sub(state.started) > sr.window {
+			delete(sr.states, key)
+		}
+	}
+	sr.lastPrune = now
+}
+
+// saveProgress returns the progress of every key through the sequence
+func (sr *sequenceRule) saveProgress() map[string]sequenceProgress {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	progress := make(map[string]sequenceProgress, len(sr.states))
+	for key, state := range sr.states {
+		progress[key] = sequenceProgress{Step: state.step, Count: state.count, Started: state.started}
+	}
+	return progress
+}
+
+// restoreProgress resumes saved sequences, skipping steps the rule no
+// longer has
+func (sr *sequenceRule) restoreProgress(progress map[string]sequenceProgress) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	for key, p := range progress {
+		if p.Step < 0 || p.Step >= len(sr.steps) {
+			continue
+		}
+		sr.states[key] = &sequenceState{step: p.Step, count: p.Count, started: p.Started}
+	}
+}
@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// sharedResource is a read-only resource used by the detectors of every
+// analyzer, built once by the first detector that needs it
+type sharedResource struct {
+	once  sync.Once
+	value interface{}
+	err   error
+	refs  int
+}
+
+// sharedResources holds the resources shared by all analyzers, such as
+// threat intel feeds and scoring models, keyed by their configuration, so
+// that each is loaded once however many analyzers use it
+var sharedResources = struct {
+	mu        sync.Mutex
+	resources map[string]*sharedResource
+}{resources: make(map[string]*sharedResource)}
+
+// sharedKey identifies a shared resource by its kind and configuration
+func sharedKey(kind string, cfg ...interface{}) string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		panic("analyzer: unencodable shared resource configuration: " + err.Error())
+	}
+	return kind + ":" + string(data)
+}
+
+// acquireShared returns the resource of key, building it on first use. A
+// resource that failed to build is not kept, so a later call retries it.
+// Every successful call must be matched by a call to releaseShared.
+func acquireShared(key string, build func() (interface{}, error)) (interface{}, error) {
+	sharedResources.mu.Lock()
+	r, ok := sharedResources.resources[key]
+	if !ok {
+		r = &sharedResource{}
+		sharedResources.resources[key] = r
+	}
+	r.refs++
+	sharedResources.mu.Unlock()
+
+	r.once.Do(func() {
+		r.value, r.err = build()
+	})
+	if r.err != nil {
+		releaseShared(key)
+		return nil, r.err
+	}
+	return r.value, nil
+}
+
+// releaseShared drops a reference to the resource of key and returns the
+// resource once no detector uses it any longer, for the caller to close
+func releaseShared(key string) interface{} {
+	sharedResources.mu.Lock()
+	defer sharedResources.mu.Unlock()
+
+	r, ok := sharedResources.resources[key]
+	if !ok {
+		return nil
+	}
+	r.refs--
+	if r.refs > 0 {
+		return nil
+	}
+	delete(sharedResources.resources, key)
+	return r.value
+}
@@ -0,0 +1,223 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Silence detector defaults
+const (
+	defaultSilenceFactor    = 10.0
+	defaultSilenceMin       = time.Minute
+	defaultSilenceMinEvents = 20
+
+	// silenceAlpha is the smoothing factor of the learned gap between logs
+	silenceAlpha = 0.1
+
+	// silenceMaxSources bounds the sources tracked, so that clients sending
+	// many source names cannot grow the detector without limit
+	silenceMaxSources = 10000
+
+	// silenceForget is how long a source still learning its gap may stay
+	// quiet before it is forgotten
+	silenceForget = 24 * time.Hour
+)
+
+// silenceState tracks when a source last logged and its usual gap
+type silenceState struct {
+	lastSeen time.Time
+	meanGap  float64
+	events   int
+	alerted  bool
+	lastLog  parser.ParsedLog
+}
+
+// silenceDetector alerts when a source that normally logs regularly goes
+// quiet. Expected intervals are configured per source or learned from the
+// average gap between its logs.
+type silenceDetector struct {
+	expected  map[string]time.Duration
+	factor    float64
+	minSilent time.Duration
+	minEvents int
+	severity  string
+	mu        sync.Mutex
+	sources   map[string]*silenceState
+}
+
+// newSilenceDetector creates a silence detector from its configuration.
+// Configured sources are expected from startup, even before their first log.
+func newSilenceDetector(cfg config.Silence) *silenceDetector {
+	d := &silenceDetector{
+		expected:  make(map[string]time.Duration),
+		factor:    cfg.Factor,
+		minSilent: time.Duration(cfg.MinSilence),
+		minEvents: cfg.MinEvents,
+		severity:  strings.ToUpper(cfg.Severity),
+		sources:   make(map[string]*silenceState),
+	}
+	if d.factor <= 1 {
+		d.factor = defaultSilenceFactor
+	}
+	if d.minSilent <= 0 {
+		d.minSilent = defaultSilenceMin
+	}
+	if d.minEvents <= 0 {
+		d.minEvents = defaultSilenceMinEvents
+	}
+	if d.severity == "" {
+		d.severity = "HIGH"
+	}
+
+	now := time.Now()
+	for source, interval := range cfg.Expected {
+		d.expected[source] = time.Duration(interval)
+		d.sources[source] = &silenceState{
+			lastSeen: now,
+			lastLog:  parser.ParsedLog{Source: source},
+		}
+	}
+	return d
+}
+
+// Observe records that a source logged and updates its usual gap
+func (d *silenceDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sources[logEntry.Source]
+	if !ok {
+		if len(d.sources) >= silenceMaxSources {
+			return nil
+		}
+		s = &silenceState{}
+		d.sources[logEntry.Source] = s
+	}
+	if s.events > 0 {
+		gap := float64(now.Sub(s.lastSeen))
+		s.meanGap += silenceAlpha * (gap - s.meanGap)
+	}
+	s.lastSeen = now
+	s.events++
+	s.alerted = false
+	s.lastLog = logEntry
+	return nil
+}
+
+// Tick alerts once for every source that has been quiet for longer than
+// expected. Sources without a configured interval are forgotten once
+// reported, or once quiet for long while still learning their gap, and
+// learn it anew should they come back.
+func (d *silenceDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var alerts []Alert
+	for source, s := range d.sources {
+		if s.alerted {
+			continue
+		}
+		_, configured := d.expected[source]
+		silent := now.Sub(s.lastSeen)
+		expected := d.expectedGap(source, s)
+		if expected <= 0 {
+			if !configured && silent > silenceForget {
+				delete(d.sources, source)
+			}
+			continue
+		}
+		if silent <= expected {
+			continue
+		}
+		s.alerted = true
+		if !configured {
+			delete(d.sources, source)
+		}
+		alerts = append(alerts, detectorAlert("Source Silent", d.severity, s.lastLog, now, map[string]interface{}{
+			"detector":   "silence",
+			"source":     source,
+			"last_seen":  s.lastSeen.Format(time.RFC3339),
+			"silent_for": silent.Round(time.Second).String(),
+			"expected":   expected.Round(time.Second).String(),
+		}))
+	}
+	return alerts
+}
+
+// expectedGap returns how long a source may stay quiet, or zero while too
+// little is known about it
+func (d *silenceDetector) expectedGap(source string, s *silenceState) time.Duration {
+	if expected, ok := d.expected[source]; ok {
+		return expected
+	}
+	if s.events < d.minEvents {
+		return 0
+	}
+	expected := time.Duration(d.factor * s.meanGap)
+	if expected < d.minSilent {
+		expected = d.minSilent
+	}
+	return expected
+}
+
+// silenceSource is the saved state of one source
+type silenceSource struct {
+	LastSeen time.Time `json:"last_seen"`
+	MeanGap  float64   `json:"mean_gap"`
+	Events   int       `json:"events"`
+	Alerted  bool      `json:"alerted"`
+}
+
+// stateKey implements stateful
+func (d *silenceDetector) stateKey() string {
+	return "silence"
+}
+
+// saveState returns the learned gaps of every source
+func (d *silenceDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sources := make(map[string]silenceSource, len(d.sources))
+	for source, s := range d.sources {
+		sources[source] = silenceSource{LastSeen: s.lastSeen, MeanGap: s.meanGap, Events: s.events, Alerted: s.alerted}
+	}
+	return sources
+}
+
+// restoreState reloads learned gaps. Sources that were logging are treated
+// as last seen now, so the downtime itself does not count as silence;
+// sources already reported silent stay that way.
+func (d *silenceDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var sources map[string]silenceSource
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for source, saved := range sources {
+		_, configured := d.expected[source]
+		if !configured && (saved.Alerted || len(d.sources) >= silenceMaxSources) {
+			continue
+		}
+		s := &silenceState{
+			lastSeen: now,
+			meanGap:  saved.MeanGap,
+			events:   saved.Events,
+			alerted:  saved.Alerted,
+			lastLog:  parser.ParsedLog{Source: source},
+		}
+		if saved.Alerted {
+			s.lastSeen = saved.LastSeen
+		}
+		d.sources[source] = s
+	}
+	return nil
+}
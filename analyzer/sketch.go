@@ -0,0 +1,129 @@
+package analyzer
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// Count-Min Sketch defaults
+const (
+	defaultSketchError      = 0.001
+	defaultSketchConfidence = 0.99
+)
+
+// countMinSketch estimates per-key counts in fixed memory. Estimates never
+// undercount and overcount by at most error times the total with the
+// configured confidence.
+type countMinSketch struct {
+	width  int
+	depth  int
+	counts []uint32
+}
+
+// newCountMinSketch creates an empty sketch of the given dimensions
+func newCountMinSketch(width, depth int) *countMinSketch {
+	return &countMinSketch{
+		width:  width,
+		depth:  depth,
+		counts: make([]uint32, width*depth),
+	}
+}
+
+// sketchDimensions returns the width and depth giving the error bound with
+// the confidence
+func sketchDimensions(errorRate, confidence float64) (width, depth int) {
+	width = int(math.Ceil(math.E / errorRate))
+	depth = int(math.Ceil(math.Log(1 / (1 - confidence))))
+	return width, max(depth, 1)
+}
+
+// cells returns the counter index of key in each row
+func (s *countMinSketch) cells(key string, cells []int) []int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+
+	cells = cells[:0]
+	for row := 0; row < s.depth; row++ {
+		col := (h1 + uint32(row)*h2) % uint32(s.width)
+		cells = append(cells, row*s.width+int(col))
+	}
+	return cells
+}
+
+// estimate returns the smallest counter of the given cells
+func (s *countMinSketch) estimate(cells []int) int {
+	estimate := uint32(math.MaxUint32)
+	for _, cell := range cells {
+		estimate = min(estimate, s.counts[cell])
+	}
+	return int(estimate)
+}
+
+// slidingSketch is a slidingCounter for many keys at once, keeping one
+// Count-Min Sketch per bucket plus their sum
+type slidingSketch struct {
+	window     time.Duration
+	bucketSize time.Duration
+	buckets    []*countMinSketch
+	sum        *countMinSketch
+	head       int
+	headStart  time.Time
+	cells      []int
+}
+
+// newSlidingSketch creates an empty sketch covering the given window
+func newSlidingSketch(window time.Duration, errorRate, confidence float64, now time.Time) *slidingSketch {
+	bucketSize := window / windowBuckets
+	if bucketSize <= 0 {
+		bucketSize = time.Millisecond
+	}
+	width, depth := sketchDimensions(errorRate, confidence)
+	s := &slidingSketch{
+		window:     window,
+		bucketSize: bucketSize,
+		buckets:    make([]*countMinSketch, windowBuckets),
+		sum:        newCountMinSketch(width, depth),
+		headStart:  now.Truncate(bucketSize),
+	}
+	for i := range s.buckets {
+		s.buckets[i] = newCountMinSketch(width, depth)
+	}
+	return s
+}
+
+// advance rotates the ring up to now, subtracting buckets that fell out of
+// the window from the sum
+func (s *slidingSketch) advance(now time.Time) {
+	steps := int(now.Sub(s.headStart) / s.bucketSize)
+	if steps <= 0 {
+		return
+	}
+	if steps > len(s.buckets) {
+		steps = len(s.buckets)
+	}
+	for i := 0; i < steps; i++ {
+		s.head = (s.head + 1) % len(s.buckets)
+		expired := s.buckets[s.head]
+		for cell, n := range expired.counts {
+			s.sum.counts[cell] -= n
+			expired.counts[cell] = 0
+		}
+	}
+	s.headStart = now.Truncate(s.bucketSize)
+}
+
+// add records n events for key at now and returns the estimated count of
+// key in the window
+func (s *slidingSketch) add(key string, now time.Time, n int) int {
+	s.advance(now)
+	s.cells = s.sum.cells(key, s.cells)
+	bucket := s.buckets[s.head]
+	for _, cell := range s.cells {
+		bucket.counts[cell] += uint32(n)
+		s.sum.counts[cell] += uint32(n)
+	}
+	return s.sum.estimate(s.cells)
+}
@@ -0,0 +1,367 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// stateVersion is bumped when the snapshot layout changes incompatibly;
+// snapshots of another version are ignored
+const stateVersion = 1
+
+// defaultStateInterval is how often state is saved when not configured
+const defaultStateInterval = time.Minute
+
+// stateful is implemented by detectors whose learned state is worth keeping
+// across restarts
+type stateful interface {
+	// stateKey names the detector's entry in a snapshot
+	stateKey() string
+
+	// saveState returns the detector's state for JSON encoding
+	saveState() interface{}
+
+	// restoreState loads state saved by saveState
+	restoreState(data json.RawMessage, now time.Time) error
+}
+
+// analyzerState is a snapshot of everything the analyzer has learned
+type analyzerState struct {
+	Version   int                                    `json:"version"`
+	SavedAt   time.Time                              `json:"saved_at"`
+	Bloom     []byte                                 `json:"bloom"`
+	Windows   map[string]map[string]counterState     `json:"windows"`
+	Spikes    map[string]map[string]spikeState       `json:"spikes"`
+	Sketches  map[string]sketchState                 `json:"sketches"`
+	Distincts map[string]map[string]distinctState    `json:"distincts"`
+	Sequences map[string]map[string]sequenceProgress `json:"sequences"`
+	Detectors map[string]json.RawMessage             `json:"detectors"`
+
+	// Thresholds holds the window count history of auto-tuned rules
+	Thresholds map[string]autoThresholdState `json:"thresholds"`
+
+	// Heartbeats holds when heartbeat rules last saw each key
+	Heartbeats map[string]heartbeatState `json:"heartbeats"`
+}
+
+// counterState is a saved slidingCounter
+type counterState struct {
+	Window    time.Duration `json:"window"`
+	Buckets   []int         `json:"buckets"`
+	Head      int           `json:"head"`
+	HeadStart time.Time     `json:"head_start"`
+	Total     int           `json:"total"`
+}
+
+// spikeState is a saved spikeCounter
+type spikeState struct {
+	Window   time.Duration `json:"window"`
+	Start    time.Time     `json:"start"`
+	Current  int           `json:"current"`
+	Previous int           `json:"previous"`
+}
+
+// sketchState is a saved slidingSketch
+type sketchState struct {
+	Window    time.Duration `json:"window"`
+	Width     int           `json:"width"`
+	Depth     int           `json:"depth"`
+	Buckets   [][]uint32    `json:"buckets"`
+	Head      int           `json:"head"`
+	HeadStart time.Time     `json:"head_start"`
+}
+
+// distinctState is a saved distinctCounter, with HyperLogLog registers
+type distinctState struct {
+	Window    time.Duration `json:"window"`
+	Buckets   [][]byte      `json:"buckets"`
+	Head      int           `json:"head"`
+	HeadStart time.Time     `json:"head_start"`
+	Previous  int           `json:"previous"`
+	Fired     bool          `json:"fired"`
+}
+
+// sequenceProgress is the saved progress of one key through a sequence
+type sequenceProgress struct {
+	Step    int       `json:"step"`
+	Count   int       `json:"count"`
+	Started time.Time `json:"started"`
+}
+
+// EnableState makes the analyzer save its window counters, bloom filter,
+// sequence progress and detector models to path every interval and on
+// Stop, and restores them from path if it exists. It must be called after
+// the rules and detectors are set up, before Start.
+func (a *Analyzer) EnableState(path string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultStateInterval
+	}
+	a.statePath = path
+	a.stateInterval = interval
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read analyzer state: %w", err)
+	}
+
+	var state analyzerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse analyzer state %s: %w", path, err)
+	}
+	if state.Version != stateVersion {
+		log.Printf("Ignoring analyzer state %s of version %d", path, state.Version)
+		return nil
+	}
+	return a.restoreState(&state, time.Now())
+}
+
+// saveState writes a snapshot of the analyzer's state
+func (a *Analyzer) saveState() error {
+	state := analyzerState{
+		Version:   stateVersion,
+		SavedAt:   time.Now(),
+		Windows:   make(map[string]map[string]counterState),
+		Spikes:    make(map[string]map[string]spikeState),
+		Sketches:  make(map[string]sketchState),
+		Distincts: make(map[string]map[string]distinctState),
+		Sequences: make(map[string]map[string]sequenceProgress),
+		Detectors: make(map[string]json.RawMessage),
+
+		Thresholds: make(map[string]autoThresholdState),
+		Heartbeats: make(map[string]heartbeatState),
+	}
+
+	a.bloomMutex.Lock()
+	bloom, err := a.bloomFilter.MarshalBinary()
+	a.bloomMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	state.Bloom = bloom
+
+	a.windowMutex.RLock()
+	for name, counters := range a.windows {
+		saved := make(map[string]counterState, len(counters))
+		for key, c := range counters {
+			saved[key] = counterState{
+				Window:    c.window,
+				Buckets:   append([]int(nil), c.buckets...),
+				Head:      c.head,
+				HeadStart: c.headStart,
+				Total:     c.total,
+			}
+		}
+		state.Windows[name] = saved
+	}
+	for name, counters := range a.spikes {
+		saved := make(map[string]spikeState, len(counters))
+		for key, c := range counters {
+			saved[key] = spikeState{
+				Window:   c.window,
+				Start:    c.start,
+				Current:  c.current,
+				Previous: c.previous,
+			}
+		}
+		state.Spikes[name] = saved
+	}
+	for name, sketch := range a.sketches {
+		saved := sketchState{
+			Window:    sketch.window,
+			Width:     sketch.sum.width,
+			Depth:     sketch.sum.depth,
+			Head:      sketch.head,
+			HeadStart: sketch.headStart,
+		}
+		for _, bucket := range sketch.buckets {
+			saved.Buckets = append(saved.Buckets, append([]uint32(nil), bucket.counts...))
+		}
+		state.Sketches[name] = saved
+	}
+	for name, counters := range a.distincts {
+		saved := make(map[string]distinctState, len(counters))
+		for key, c := range counters {
+			d := distinctState{
+				Window:    c.window,
+				Head:      c.head,
+				HeadStart: c.headStart,
+				Previous:  c.previous,
+				Fired:     c.fired,
+			}
+			for _, b := range c.buckets {
+				d.Buckets = append(d.Buckets, append([]byte(nil), b.registers...))
+			}
+			saved[key] = d
+		}
+		state.Distincts[name] = saved
+	}
+	for name, t := range a.thresholds {
+		state.Thresholds[name] = t.save()
+	}
+	a.windowMutex.RUnlock()
+
+	for _, rule := range a.Rules() {
+		if rule.sequence != nil {
+			state.Sequences[rule.Name] = rule.sequence.saveProgress()
+		}
+		if rule.heartbeat != nil {
+			state.Heartbeats[rule.Name] = rule.heartbeat.save()
+		}
+	}
+
+	for _, d := range a.detectors {
+		s, ok := d.(stateful)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(s.saveState())
+		if err != nil {
+			return fmt.Errorf("failed to save %s state: %w", s.stateKey(), err)
+		}
+		state.Detectors[s.stateKey()] = data
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(a.statePath, data); err != nil {
+		return fmt.Errorf("failed to save analyzer state: %w", err)
+	}
+	return nil
+}
+
+// restoreState loads a snapshot into the analyzer. Counters resume where
+// they left off and age by the time the analyzer was down.
+func (a *Analyzer) restoreState(state *analyzerState, now time.Time) error {
+	if len(state.Bloom) > 0 {
+		if err := a.bloomFilter.UnmarshalBinary(state.Bloom); err != nil {
+			log.Printf("Discarding saved bloom filter: %v", err)
+		}
+	}
+
+	a.windowMutex.Lock()
+	for name, saved := range state.Windows {
+		counters := make(map[string]*slidingCounter, len(saved))
+		for key, s := range saved {
+			if len(s.Buckets) != windowBuckets {
+				continue
+			}
+			c := newSlidingCounter(s.Window, s.HeadStart)
+			c.buckets = s.Buckets
+			c.head = s.Head % windowBuckets
+			c.total = s.Total
+			counters[key] = c
+		}
+		a.windows[name] = counters
+	}
+	for name, saved := range state.Spikes {
+		counters := make(map[string]*spikeCounter, len(saved))
+		for key, s := range saved {
+			counters[key] = &spikeCounter{
+				window:   s.Window,
+				start:    s.Start,
+				current:  s.Current,
+				previous: s.Previous,
+			}
+		}
+		a.spikes[name] = counters
+	}
+	for name, saved := range state.Sketches {
+		if sketch := restoreSketch(saved); sketch != nil {
+			a.sketches[name] = sketch
+		}
+	}
+	for name, saved := range state.Distincts {
+		counters := make(map[string]*distinctCounter, len(saved))
+		for key, d := range saved {
+			if c := restoreDistinct(d); c != nil {
+				counters[key] = c
+			}
+		}
+		a.distincts[name] = counters
+	}
+	a.windowMutex.Unlock()
+
+	for _, rule := range a.Rules() {
+		if rule.sequence != nil {
+			rule.sequence.restoreProgress(state.Sequences[rule.Name])
+		}
+		if saved, ok := state.Thresholds[rule.Name]; ok && rule.auto != nil {
+			a.autoThreshold(rule).restore(saved)
+		}
+		if saved, ok := state.Heartbeats[rule.Name]; ok && rule.heartbeat != nil {
+			rule.heartbeat.restore(saved, now)
+		}
+	}
+
+	for _, d := range a.detectors {
+		s, ok := d.(stateful)
+		if !ok {
+			continue
+		}
+		data, ok := state.Detectors[s.stateKey()]
+		if !ok {
+			continue
+		}
+		if err := s.restoreState(data, now); err != nil {
+			return fmt.Errorf("failed to restore %s state: %w", s.stateKey(), err)
+		}
+	}
+
+	log.Printf("Restored analyzer state saved at %s", state.SavedAt.Format(time.RFC3339))
+	return nil
+}
+
+// restoreSketch rebuilds a saved sliding sketch, or returns nil if the
+// saved data is inconsistent
+func restoreSketch(saved sketchState) *slidingSketch {
+	if len(saved.Buckets) != windowBuckets || saved.Width <= 0 || saved.Depth <= 0 {
+		return nil
+	}
+	sketch := &slidingSketch{
+		window:     saved.Window,
+		bucketSize: max(saved.Window/windowBuckets, time.Millisecond),
+		buckets:    make([]*countMinSketch, windowBuckets),
+		sum:        newCountMinSketch(saved.Width, saved.Depth),
+		head:       saved.Head % windowBuckets,
+		headStart:  saved.HeadStart,
+	}
+	for i, counts := range saved.Buckets {
+		if len(counts) != saved.Width*saved.Depth {
+			return nil
+		}
+		sketch.buckets[i] = &countMinSketch{width: saved.Width, depth: saved.Depth, counts: counts}
+		for cell, n := range counts {
+			sketch.sum.counts[cell] += n
+		}
+	}
+	return sketch
+}
+
+// restoreDistinct rebuilds a saved distinct counter, or returns nil if the
+// saved data is inconsistent
+func restoreDistinct(saved distinctState) *distinctCounter {
+	n := len(saved.Buckets)
+	if n != 1 && n != windowBuckets {
+		return nil
+	}
+	c := newDistinctCounter(saved.Window, n == 1, saved.HeadStart)
+	c.head = saved.Head % n
+	c.previous = saved.Previous
+	c.fired = saved.Fired
+	for i, registers := range saved.Buckets {
+		if len(registers) != hllRegisters {
+			return nil
+		}
+		copy(c.buckets[i].registers, registers)
+	}
+	return c
+}
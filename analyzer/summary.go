@@ -0,0 +1,231 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Summary defaults
+const (
+	defaultSummaryInterval = time.Hour
+	defaultSummaryTop      = 5
+
+	// summaryMaxSources bounds the sources counted per interval; logs of
+	// further sources are counted as other
+	summaryMaxSources = 10000
+
+	// summaryMaxTemplates bounds the templates remembered as known, and
+	// summaryTemplateMemory is how long a template stays known unseen
+	summaryMaxTemplates   = 100000
+	summaryTemplateMemory = 7 * 24 * time.Hour
+)
+
+// newTemplate is a template first seen in the current interval
+type newTemplate struct {
+	template string
+	source   string
+	first    time.Time
+	count    int
+}
+
+// summaryCollector tallies what the analyzer saw over each interval and
+// turns it into an INFO summary event, so that operators get a pulse of
+// the system even when nothing is paging
+type summaryCollector struct {
+	interval  time.Duration
+	top       int
+	mu        sync.Mutex
+	start     time.Time
+	logs      int
+	other     int
+	alerts    int
+	sources   map[string]int
+	rules     map[string]int
+	known     map[string]time.Time
+	fresh     map[string]*newTemplate
+	intervals int
+}
+
+// EnableSummary sends a summary event through the alert channel every
+// interval, listing the log volume, the busiest sources, the rules that
+// fired most and the templates seen for the first time
+func (a *Analyzer) EnableSummary(cfg config.Summary) {
+	c := &summaryCollector{
+		interval: time.Duration(cfg.Interval),
+		top:      cfg.Top,
+		start:    time.Now(),
+		sources:  make(map[string]int),
+		rules:    make(map[string]int),
+		known:    make(map[string]time.Time),
+		fresh:    make(map[string]*newTemplate),
+	}
+	if c.interval <= 0 {
+		c.interval = defaultSummaryInterval
+	}
+	if c.top <= 0 {
+		c.top = defaultSummaryTop
+	}
+	a.summary = c
+}
+
+// observe counts a log toward the current interval
+func (c *summaryCollector) observe(logEntry parser.ParsedLog, now time.Time) {
+	count := logEntry.RepeatCount
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.logs += count
+	if _, ok := c.sources[logEntry.Source]; ok || len(c.sources) < summaryMaxSources {
+		c.sources[logEntry.Source] += count
+	} else {
+		c.other += count
+	}
+
+	id := logEntry.TemplateID
+	if id == "" {
+		return
+	}
+	if _, ok := c.known[id]; !ok {
+		if len(c.known) >= summaryMaxTemplates {
+			return
+		}
+		c.fresh[id] = &newTemplate{template: logEntry.Template, source: logEntry.Source, first: now}
+	}
+	c.known[id] = now
+	if t, ok := c.fresh[id]; ok {
+		t.count += count
+	}
+}
+
+// fired counts an alert of a rule toward the current interval
+func (c *summaryCollector) fired(rule string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.alerts++
+	c.rules[rule]++
+}
+
+// flush closes the current interval at now and returns its summary. The
+// first interval reports no new templates, as every template is new then.
+func (c *summaryCollector) flush(now time.Time) Alert {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metadata := map[string]interface{}{
+		"summary":     true,
+		"from":        c.start.Format(time.RFC3339),
+		"to":          now.Format(time.RFC3339),
+		"interval":    c.interval.String(),
+		"logs":        c.logs,
+		"sources":     len(c.sources),
+		"alerts":      c.alerts,
+		"top_sources": topCounts(c.sources, c.top, "source"),
+		"top_rules":   topCounts(c.rules, c.top, "rule"),
+	}
+	if c.other > 0 {
+		metadata["other_source_logs"] = c.other
+	}
+	description := fmt.Sprintf("%d logs from %d sources and %d alerts since %s", c.logs, len(c.sources), c.alerts, c.start.Format(time.RFC3339))
+	if c.intervals > 0 {
+		metadata["new_templates"] = c.newTemplates()
+		description += fmt.Sprintf(", %d new templates", len(c.fresh))
+	}
+	metadata["description"] = description
+
+	for id, seen := range c.known {
+		if now.Sub(seen) > summaryTemplateMemory {
+			delete(c.known, id)
+		}
+	}
+	c.start = now
+	c.logs, c.other, c.alerts = 0, 0, 0
+	c.sources = make(map[string]int)
+	c.rules = make(map[string]int)
+	c.fresh = make(map[string]*newTemplate)
+	c.intervals++
+
+	return Alert{
+		Timestamp: now.Format(time.RFC3339),
+		Severity:  "INFO",
+		Reason:    "Summary",
+		Log:       parser.ParsedLog{Timestamp: now.Format(time.RFC3339), Level: "INFO", Source: "argos", Message: description},
+		Metadata:  metadata,
+	}
+}
+
+// newTemplates returns the most frequent templates first seen in the
+// current interval. The caller must hold the lock.
+func (c *summaryCollector) newTemplates() []map[string]interface{} {
+	templates := make([]*newTemplate, 0, len(c.fresh))
+	for _, t := range c.fresh {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].count != templates[j].count {
+			return templates[i].count > templates[j].count
+		}
+		return templates[i].first.Before(templates[j].first)
+	})
+
+	out := make([]map[string]interface{}, 0, min(len(templates), c.top))
+	for _, t := range templates[:min(len(templates), c.top)] {
+		out = append(out, map[string]interface{}{
+			"template":   t.template,
+			"source":     t.source,
+			"count":      t.count,
+			"first_seen": t.first.Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+// topCounts returns the n largest counts, each labeled with its name under
+// label
+func topCounts(counts map[string]int, n int, label string) []map[string]interface{} {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	out := make([]map[string]interface{}, 0, min(len(names), n))
+	for _, name := range names[:min(len(names), n)] {
+		out = append(out, map[string]interface{}{label: name, "count": counts[name]})
+	}
+	return out
+}
+
+// sendSummaries sends a summary every interval. Summaries go straight to
+// the alerter, bypassing maintenance windows, deduplication and incidents.
+func (a *Analyzer) sendSummaries() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.summary.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			select {
+			case a.alertChan <- a.summary.flush(now):
+				metrics.Add(metricAlerts, 1)
+			case <-a.shutdown:
+				return
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
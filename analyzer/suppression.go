@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"sync"
+	"time"
+)
+
+// Suppression bookkeeping
+const (
+	// suppressionPruneInterval is how often expired fingerprints are
+	// dropped
+	suppressionPruneInterval = time.Minute
+
+	// suppressionMemory is how long the count of a fingerprint's suppressed
+	// repeats is kept after its TTL expired, waiting for it to fire again
+	suppressionMemory = 24 * time.Hour
+)
+
+// suppressedAlert is the suppression state of one fingerprint
+type suppressedAlert struct {
+	fired      time.Time
+	until      time.Time
+	suppressed int
+	lastSeen   time.Time
+}
+
+// alertSuppressor mutes repeats of an alert fingerprint for a fixed TTL
+// after it fires. Unlike deduplication, the TTL does not extend while
+// repeats keep arriving; the first alert after it expires fires again,
+// carrying how many repeats were suppressed in between.
+type alertSuppressor struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	alerts    map[string]*suppressedAlert
+	lastPrune time.Time
+}
+
+// EnableSuppression mutes repeats of an alert of the same rule and key for
+// ttl after it fires
+func (a *Analyzer) EnableSuppression(ttl time.Duration) {
+	a.suppressor = &alertSuppressor{
+		ttl:    ttl,
+		alerts: make(map[string]*suppressedAlert),
+	}
+}
+
+// admit records an alert and reports whether it should be sent, which is
+// not the case while its fingerprint is suppressed
+func (s *alertSuppressor) admit(alert *Alert, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPrune) >= suppressionPruneInterval {
+		s.prune(now)
+	}
+
+	prev, ok := s.alerts[alert.Fingerprint]
+	if ok && now.Before(prev.until) {
+		prev.suppressed++
+		prev.lastSeen = now
+		return false
+	}
+
+	if ok && prev.suppressed > 0 {
+		alert.Metadata["suppressed_occurrences"] = prev.suppressed
+		alert.Metadata["suppressed_since"] = prev.fired.Format(time.RFC3339)
+		alert.Metadata["suppressed_last_seen"] = prev.lastSeen.Format(time.RFC3339)
+	}
+	s.alerts[alert.Fingerprint] = &suppressedAlert{fired: now, until: now.Add(s.ttl)}
+	return true
+}
+
+// prune drops fingerprints whose TTL expired, keeping those with
+// suppressed repeats to report for a while
+func (s *alertSuppressor) prune(now time.Time) {
+	for fp, a := range s.alerts {
+		if now.Before(a.until) {
+			continue
+		}
+		if a.suppressed == 0 || now.Sub(a.until) > suppressionMemory {
+			delete(s.alerts, fp)
+		}
+	}
+	s.lastPrune = now
+}
@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+)
+
+// defaultCompression bounds a t-digest to a few hundred centroids while
+// keeping tail quantiles such as p99 accurate to a fraction of a percent
+const defaultCompression = 100
+
+// centroid is a cluster of values summarized by their mean and count
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// tDigest estimates quantiles of a stream in bounded memory. Values are
+// buffered and periodically merged into centroids, which are kept small
+// near the tails so extreme quantiles stay accurate.
+type tDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	count       float64
+	min, max    float64
+}
+
+// newTDigest creates an empty digest
+func newTDigest(compression float64) *tDigest {
+	if compression <= 0 {
+		compression = defaultCompression
+	}
+	return &tDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// add records a value
+func (t *tDigest) add(x float64) {
+	t.buffer = append(t.buffer, centroid{mean: x, weight: 1})
+	t.count++
+	t.min = math.Min(t.min, x)
+	t.max = math.Max(t.max, x)
+	if len(t.buffer) >= int(5*t.compression) {
+		t.compress()
+	}
+}
+
+// compress merges buffered values into the centroids, combining neighbours
+// as long as the merged centroid stays within the size allowed at its
+// quantile
+func (t *tDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	sofar := 0.0
+	limit := t.quantileLimit(0)
+	for _, c := range all[1:] {
+		if (sofar+cur.weight+c.weight)/t.count <= limit {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		merged = append(merged, cur)
+		sofar += cur.weight
+		limit = t.quantileLimit(sofar / t.count)
+		cur = c
+	}
+	t.centroids = append(merged, cur)
+	t.buffer = t.buffer[:0]
+}
+
+// quantileLimit returns how far a centroid starting at quantile q may
+// extend, following the arcsine scale function
+func (t *tDigest) quantileLimit(q float64) float64 {
+	k := t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+	k++
+	if k >= t.compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/t.compression) + 1) / 2
+}
+
+// quantile returns the estimated value at quantile q, interpolating between
+// centroid centers, or NaN for an empty digest
+func (t *tDigest) quantile(q float64) float64 {
+	t.compress()
+	if t.count == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return t.min
+	}
+	if q >= 1 {
+		return t.max
+	}
+
+	target := q * t.count
+	cumulative := 0.0
+	for i, c := range t.centroids {
+		center := cumulative + c.weight/2
+		if target < center {
+			if i == 0 {
+				return t.min + (c.mean-t.min)*target/center
+			}
+			prev := t.centroids[i-1]
+			prevCenter := cumulative - prev.weight/2
+			return prev.mean + (c.mean-prev.mean)*(target-prevCenter)/(center-prevCenter)
+		}
+		cumulative += c.weight
+	}
+	last := t.centroids[len(t.centroids)-1]
+	lastCenter := t.count - last.weight/2
+	if t.count == lastCenter {
+		return t.max
+	}
+	return last.mean + (t.max-last.mean)*(target-lastCenter)/(t.count-lastCenter)
+}
+
+// merge adds the values summarized by another digest
+func (t *tDigest) merge(o *tDigest) {
+	if o.count == 0 {
+		return
+	}
+	t.buffer = append(t.buffer, o.centroids...)
+	t.buffer = append(t.buffer, o.buffer...)
+	t.count += o.count
+	t.min = math.Min(t.min, o.min)
+	t.max = math.Max(t.max, o.max)
+	t.compress()
+}
+
+// digestState is a saved tDigest, its centroids as mean and weight pairs
+type digestState struct {
+	Centroids [][2]float64 `json:"centroids"`
+	Min       float64      `json:"min"`
+	Max       float64      `json:"max"`
+}
+
+// save returns the digest's state
+func (t *tDigest) save() digestState {
+	t.compress()
+	s := digestState{Min: t.min, Max: t.max}
+	if t.count == 0 {
+		s.Min, s.Max = 0, 0
+	}
+	for _, c := range t.centroids {
+		s.Centroids = append(s.Centroids, [2]float64{c.mean, c.weight})
+	}
+	return s
+}
+
+// restoreTDigest rebuilds a digest saved by save
+func restoreTDigest(s digestState, compression float64) *tDigest {
+	t := newTDigest(compression)
+	for _, c := range s.Centroids {
+		t.centroids = append(t.centroids, centroid{mean: c[0], weight: c[1]})
+		t.count += c[1]
+	}
+	if t.count > 0 {
+		t.min, t.max = s.Min, s.Max
+	}
+	return t
+}
@@ -0,0 +1,257 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Template detector defaults
+const (
+	defaultTemplateStable     = time.Hour
+	defaultTemplateInterval   = time.Minute
+	defaultTemplateFactor     = 5.0
+	defaultTemplateMinSamples = 10
+
+	// templateAlpha is the smoothing factor of per-template rates
+	templateAlpha = 0.1
+
+	// templateMinDropRate is the mean rate below which drops are ignored
+	templateMinDropRate = 5.0
+
+	// templateMaxTracked bounds the number of templates tracked, and
+	// templateIdleIntervals is how many empty intervals a template may
+	// have before it is forgotten
+	templateMaxTracked    = 10000
+	templateIdleIntervals = 1440
+)
+
+// templateRate is the rate model of one template from one source
+type templateRate struct {
+	mean    float64
+	samples int
+	idle    int
+	count   int
+	lastLog parser.ParsedLog
+}
+
+// templateSource is what is known about the templates of one source
+type templateSource struct {
+	firstSeen time.Time
+	templates map[string]*templateRate
+}
+
+// templateDetector tracks the templates mined from each source. It alerts
+// when a source that has been logging for a while produces a template it
+// never produced before, and when a template's rate jumps or collapses
+// compared to its smoothed average.
+type templateDetector struct {
+	stable     time.Duration
+	interval   time.Duration
+	factor     float64
+	minSamples int
+	severity   string
+	mu         sync.Mutex
+	sources    map[string]*templateSource
+	tracked    int
+	lastRoll   time.Time
+}
+
+// newTemplateDetector creates a template detector from its configuration
+func newTemplateDetector(cfg config.Templates) *templateDetector {
+	d := &templateDetector{
+		stable:     time.Duration(cfg.StablePeriod),
+		interval:   time.Duration(cfg.Interval),
+		factor:     cfg.Factor,
+		minSamples: cfg.MinSamples,
+		severity:   strings.ToUpper(cfg.Severity),
+		sources:    make(map[string]*templateSource),
+		lastRoll:   time.Now(),
+	}
+	if d.stable <= 0 {
+		d.stable = defaultTemplateStable
+	}
+	if d.interval <= 0 {
+		d.interval = defaultTemplateInterval
+	}
+	if d.factor <= 1 {
+		d.factor = defaultTemplateFactor
+	}
+	if d.minSamples <= 0 {
+		d.minSamples = defaultTemplateMinSamples
+	}
+	if d.severity == "" {
+		d.severity = "MEDIUM"
+	}
+	return d
+}
+
+// Observe counts a log toward its template and alerts on templates new to
+// a stable source
+func (d *templateDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	if logEntry.TemplateID == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sources[logEntry.Source]
+	if !ok {
+		s = &templateSource{firstSeen: now, templates: make(map[string]*templateRate)}
+		d.sources[logEntry.Source] = s
+	}
+	t, ok := s.templates[logEntry.TemplateID]
+	if ok {
+		t.count += logEntry.RepeatCount
+		t.lastLog = logEntry
+		return nil
+	}
+	if d.tracked >= templateMaxTracked {
+		return nil
+	}
+	s.templates[logEntry.TemplateID] = &templateRate{count: logEntry.RepeatCount, lastLog: logEntry}
+	d.tracked++
+
+	if now.Sub(s.firstSeen) < d.stable {
+		return nil
+	}
+	return []Alert{d.alert("New Log Template", logEntry, now, map[string]interface{}{
+		"source":      logEntry.Source,
+		"template_id": logEntry.TemplateID,
+		"template":    logEntry.Template,
+		"templates":   len(s.templates),
+	})}
+}
+
+// Tick closes the current interval once it has elapsed, comparing each
+// template's count to its average before folding it in
+func (d *templateDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastRoll) < d.interval {
+		return nil
+	}
+	d.lastRoll = now
+
+	var alerts []Alert
+	for source, s := range d.sources {
+		for id, t := range s.templates {
+			x := float64(t.count)
+			if t.samples >= d.minSamples {
+				direction := ""
+				switch {
+				case x > d.factor*max(t.mean, 1):
+					direction = "spike"
+				case t.mean >= templateMinDropRate && x < t.mean/d.factor:
+					direction = "drop"
+				}
+				if direction != "" {
+					alerts = append(alerts, d.alert("Template Rate Shift", t.lastLog, now, map[string]interface{}{
+						"source":      source,
+						"template_id": id,
+						"template":    t.lastLog.Template,
+						"direction":   direction,
+						"count":       t.count,
+						"mean":        t.mean,
+						"interval":    d.interval.String(),
+					}))
+				}
+			}
+
+			if t.samples == 0 {
+				t.mean = x
+			} else {
+				t.mean += templateAlpha * (x - t.mean)
+			}
+			t.samples++
+			if t.count == 0 {
+				t.idle++
+			} else {
+				t.idle = 0
+			}
+			t.count = 0
+
+			if t.idle >= templateIdleIntervals {
+				delete(s.templates, id)
+				d.tracked--
+			}
+		}
+	}
+	return alerts
+}
+
+// alert builds a template alert
+func (d *templateDetector) alert(name string, logEntry parser.ParsedLog, now time.Time, metadata map[string]interface{}) Alert {
+	metadata["detector"] = "templates"
+	return detectorAlert(name, d.severity, logEntry, now, metadata)
+}
+
+// savedTemplates is the saved state of one source
+type savedTemplates struct {
+	FirstSeen time.Time                `json:"first_seen"`
+	Templates map[string]savedTemplate `json:"templates"`
+}
+
+// savedTemplate is the saved rate model of one template
+type savedTemplate struct {
+	Mean     float64 `json:"mean"`
+	Samples  int     `json:"samples"`
+	Template string  `json:"template"`
+}
+
+// stateKey implements stateful
+func (d *templateDetector) stateKey() string {
+	return "templates"
+}
+
+// saveState returns the known templates and rates of every source
+func (d *templateDetector) saveState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sources := make(map[string]savedTemplates, len(d.sources))
+	for source, s := range d.sources {
+		saved := savedTemplates{FirstSeen: s.firstSeen, Templates: make(map[string]savedTemplate, len(s.templates))}
+		for id, t := range s.templates {
+			saved.Templates[id] = savedTemplate{Mean: t.mean, Samples: t.samples, Template: t.lastLog.Template}
+		}
+		sources[source] = saved
+	}
+	return sources
+}
+
+// restoreState reloads known templates and their rates. The interval in
+// progress starts over.
+func (d *templateDetector) restoreState(data json.RawMessage, now time.Time) error {
+	var sources map[string]savedTemplates
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for source, saved := range sources {
+		s := &templateSource{firstSeen: saved.FirstSeen, templates: make(map[string]*templateRate)}
+		for id, t := range saved.Templates {
+			if d.tracked >= templateMaxTracked {
+				break
+			}
+			s.templates[id] = &templateRate{
+				mean:    t.Mean,
+				samples: t.Samples,
+				lastLog: parser.ParsedLog{Source: source, TemplateID: id, Template: t.Template},
+			}
+			d.tracked++
+		}
+		d.sources[source] = s
+	}
+	d.lastRoll = now
+	return nil
+}
@@ -0,0 +1,339 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Tenant isolation defaults
+const (
+	defaultMaxTenants = 100
+
+	// tenantBufferSize is the input buffer of each tenant's analyzer
+	tenantBufferSize = 100
+
+	// tenantPendingSize is the most logs held for a tenant while its
+	// analyzer is being created; later ones are analyzed as untagged
+	tenantPendingSize = 10000
+
+	// tenantLogInterval is the least time between logs of failures to
+	// create the analyzer of a tenant
+	tenantLogInterval = 10 * time.Second
+)
+
+// tenantNameRegex matches tenant names that may be used in file names.
+// Logs with other tenants are analyzed as untagged.
+var tenantNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// AnalyzerFactory builds the analyzer of a tenant, reading logs from input.
+// The analyzer of untagged logs has the empty tenant. It may be called for
+// several tenants at once.
+type AnalyzerFactory func(tenant string, input <-chan []parser.ParsedLog) (*Analyzer, error)
+
+// Tenants runs an analyzer per tenant, so that the windows, baselines,
+// bloom filter and rules of one tenant are never touched by the logs of
+// another. Analyzers are created in the background on the first log of a
+// tenant, holding its logs until the analyzer is ready, so that routing
+// for other tenants goes on meanwhile. With isolation disabled, a single
+// analyzer reads the pipeline directly.
+type Tenants struct {
+	input     <-chan []parser.ParsedLog
+	factory   AnalyzerFactory
+	enabled   bool
+	max       int
+	mu        sync.RWMutex
+	analyzers map[string]*Analyzer
+	shutdown  chan struct{}
+	wg        sync.WaitGroup
+
+	// inputs, pending, warned, failed and failLoggedAt belong to the
+	// router once started. pending holds the logs of tenants whose
+	// analyzer is being created, which report to built when done.
+	inputs  map[string]chan []parser.ParsedLog
+	pending map[string]*pendingTenant
+	built   chan builtTenant
+	warned  bool
+
+	// failed counts the analyzers that failed to be created since
+	// failLoggedAt, when failures were last logged
+	failed       int
+	failLoggedAt time.Time
+}
+
+// pendingTenant holds the logs of a tenant while its analyzer is created
+type pendingTenant struct {
+	batches [][]parser.ParsedLog
+	size    int
+}
+
+// builtTenant is the outcome of creating the analyzer of a tenant
+type builtTenant struct {
+	tenant   string
+	input    chan []parser.ParsedLog
+	analyzer *Analyzer
+	err      error
+}
+
+// NewTenants creates the analyzer of untagged logs, and of every tenant
+// once isolation is enabled
+func NewTenants(input <-chan []parser.ParsedLog, factory AnalyzerFactory, cfg config.Tenants) (*Tenants, error) {
+	t := &Tenants{
+		input:     input,
+		factory:   factory,
+		enabled:   cfg.Enabled,
+		max:       cfg.MaxTenants,
+		analyzers: make(map[string]*Analyzer),
+		shutdown:  make(chan struct{}),
+		inputs:    make(map[string]chan []parser.ParsedLog),
+		pending:   make(map[string]*pendingTenant),
+		built:     make(chan builtTenant),
+	}
+	if t.max <= 0 {
+		t.max = defaultMaxTenants
+	}
+
+	if !t.enabled {
+		a, err := factory("", input)
+		if err != nil {
+			return nil, err
+		}
+		t.analyzers[""] = a
+		return t, nil
+	}
+	untagged := make(chan []parser.ParsedLog, tenantBufferSize)
+	a, err := factory("", untagged)
+	if err != nil {
+		return nil, err
+	}
+	t.analyzers[""] = a
+	t.inputs[""] = untagged
+	return t, nil
+}
+
+// Start starts every analyzer and, with isolation enabled, routing of logs
+// to them
+func (t *Tenants) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, a := range t.analyzers {
+		a.Start()
+	}
+	if t.enabled {
+		t.wg.Add(1)
+		go t.route()
+	}
+}
+
+// route splits batches by tenant and hands them to the tenants' analyzers
+func (t *Tenants) route() {
+	defer t.wg.Done()
+
+	for {
+		select {
+		case batch, ok := <-t.input:
+			if !ok {
+				return
+			}
+			groups := make(map[string][]parser.ParsedLog)
+			for _, logEntry := range batch {
+				groups[logEntry.Tenant] = append(groups[logEntry.Tenant], logEntry)
+			}
+			for tenant, logs := range groups {
+				if !t.dispatch(tenant, logs) {
+					return
+				}
+			}
+		case b := <-t.built:
+			if !t.finish(b) {
+				return
+			}
+		case <-t.shutdown:
+			return
+		}
+	}
+}
+
+// dispatch hands the logs of a tenant to its analyzer, or holds them while
+// the analyzer is created, returning false on shutdown
+func (t *Tenants) dispatch(tenant string, logs []parser.ParsedLog) bool {
+	if !tenantNameRegex.MatchString(tenant) {
+		tenant = ""
+	}
+	if p, ok := t.pending[tenant]; ok {
+		if p.size+len(logs) <= tenantPendingSize {
+			p.batches = append(p.batches, logs)
+			p.size += len(logs)
+			return true
+		}
+		tenant = ""
+	}
+
+	input := t.inputFor(tenant)
+	if input == nil {
+		t.pending[tenant] = &pendingTenant{batches: [][]parser.ParsedLog{logs}, size: len(logs)}
+		return true
+	}
+	return t.deliver(input, logs)
+}
+
+// inputFor returns the input of a tenant's analyzer. Without one, it starts
+// creating it and returns nil unless too many tenants exist, in which case
+// the logs go to the analyzer of untagged logs. Only tenants with an
+// analyzer are kept, so the names sent by clients cannot grow memory past
+// the limit.
+func (t *Tenants) inputFor(tenant string) chan []parser.ParsedLog {
+	if input, ok := t.inputs[tenant]; ok {
+		return input
+	}
+	if len(t.inputs)-1+len(t.pending) >= t.max {
+		if !t.warned {
+			log.Printf("Tenant limit of %d reached, analyzing logs of new tenants such as %s as untagged", t.max, tenant)
+			t.warned = true
+		}
+		return t.inputs[""]
+	}
+
+	t.wg.Add(1)
+	go t.build(tenant)
+	return nil
+}
+
+// build creates the analyzer of a tenant off the routing path and reports
+// it to the router
+func (t *Tenants) build(tenant string) {
+	defer t.wg.Done()
+
+	input := make(chan []parser.ParsedLog, tenantBufferSize)
+	a, err := t.factory(tenant, input)
+	select {
+	case t.built <- builtTenant{tenant: tenant, input: input, analyzer: a, err: err}:
+	case <-t.shutdown:
+		if err == nil {
+			a.Stop()
+		}
+	}
+}
+
+// finish starts the analyzer created for a tenant and hands it the logs
+// held meanwhile, or hands them to the analyzer of untagged logs if it
+// failed to be created. It returns false on shutdown.
+func (t *Tenants) finish(b builtTenant) bool {
+	p := t.pending[b.tenant]
+	delete(t.pending, b.tenant)
+
+	input := b.input
+	if b.err != nil {
+		t.failed++
+		if now := time.Now(); now.Sub(t.failLoggedAt) >= tenantLogInterval {
+			log.Printf("Failed to create analyzer for tenant %s (%d failures), analyzing its logs as untagged: %v", b.tenant, t.failed, b.err)
+			t.failed = 0
+			t.failLoggedAt = now
+		}
+		input = t.inputs[""]
+	} else {
+		b.analyzer.Start()
+		t.mu.Lock()
+		t.analyzers[b.tenant] = b.analyzer
+		t.mu.Unlock()
+		t.inputs[b.tenant] = b.input
+		log.Printf("Created analyzer for tenant %s", b.tenant)
+	}
+
+	for _, logs := range p.batches {
+		if !t.deliver(input, logs) {
+			return false
+		}
+	}
+	return true
+}
+
+// deliver sends logs to an analyzer's input, returning false on shutdown
+func (t *Tenants) deliver(input chan []parser.ParsedLog, logs []parser.ParsedLog) bool {
+	select {
+	case input <- logs:
+		return true
+	case <-t.shutdown:
+		return false
+	}
+}
+
+// Analyzer returns the analyzer of a tenant, or nil if it has none
+func (t *Tenants) Analyzer(tenant string) *Analyzer {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.analyzers[tenant]
+}
+
+// Names returns the tenants that have an analyzer, sorted, the untagged
+// one first
+func (t *Tenants) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.analyzers))
+	for tenant := range t.analyzers {
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReloadRules reloads the rules of every tenant, returning the failures
+func (t *Tenants) ReloadRules() error {
+	var errs []error
+	for _, tenant := range t.Names() {
+		if err := t.Analyzer(tenant).ReloadRules(); err != nil {
+			if tenant != "" {
+				err = fmt.Errorf("tenant %s: %w", tenant, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RecordFeedback records a responder acknowledging, or dismissing as
+// noise, an alert of the named rule raised for a tenant
+func (t *Tenants) RecordFeedback(tenant, rule string, dismissed bool) {
+	if a := t.Analyzer(tenant); a != nil {
+		a.RecordFeedback(rule, dismissed)
+	}
+}
+
+// Handle adapts an analyzer handler to serve the tenant named by the
+// tenant query parameter, or untagged logs without one
+func (t *Tenants) Handle(h func(*Analyzer, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := t.Analyzer(r.URL.Query().Get("tenant"))
+		if a == nil {
+			http.Error(w, "Unknown tenant", http.StatusNotFound)
+			return
+		}
+		h(a, w, r)
+	}
+}
+
+// Stop stops routing, waits for analyzers being created, and stops every
+// analyzer
+func (t *Tenants) Stop() {
+	close(t.shutdown)
+	t.wg.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, a := range t.analyzers {
+		a.Stop()
+	}
+}
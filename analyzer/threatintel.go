@@ -0,0 +1,500 @@
+package analyzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Threat intel defaults
+const (
+	defaultIntelRefresh = time.Hour
+
+	// intelFetchTimeout bounds a single HTTP feed download
+	intelFetchTimeout = 30 * time.Second
+
+	// intelMaxFeedSize bounds the size of a downloaded feed, or of each
+	// page of a TAXII collection
+	intelMaxFeedSize = 64 << 20
+
+	// intelMaxPages bounds the pages read from a TAXII collection
+	intelMaxPages = 1000
+)
+
+// Patterns finding indicators in free text and in STIX patterns
+var (
+	intelIPPattern     = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	intelDomainPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\b`)
+	intelURLPattern    = regexp.MustCompile(`(?i)\bhttps?://[^\s"'<>]+`)
+	stixValuePattern   = regexp.MustCompile(`(ipv4-addr|ipv6-addr|domain-name|url):value\s*=\s*'([^']+)'`)
+)
+
+// Extracted fields checked against domain and URL lists
+var (
+	domainFields = []string{"domain", "host", "hostname", "email_domains"}
+	urlFields    = []string{"url", "referer"}
+)
+
+// intelSet is the compiled content of all feeds, mapping each indicator to
+// the names of the lists it appears on
+type intelSet struct {
+	ips      map[netip.Addr][]string
+	prefixes []intelPrefix
+	domains  map[string][]string
+	urls     map[string][]string
+}
+
+// intelPrefix is a CIDR block from a list
+type intelPrefix struct {
+	prefix netip.Prefix
+	list   string
+}
+
+// intelFeeds is the compiled content of the threat intel feeds, shared by
+// the detectors of every analyzer. Feeds are reloaded in the background
+// every refresh period, keeping a feed's previous content when it fails to
+// load.
+type intelFeeds struct {
+	feeds    []config.Feed
+	refresh  time.Duration
+	client   *http.Client
+	set      atomic.Pointer[intelSet]
+	loading  atomic.Bool
+	mu       sync.Mutex
+	feedData map[string][]string
+	lastLoad time.Time
+}
+
+// threatIntelDetector alerts when an IP or domain seen in a log appears on
+// a threat intel list
+type threatIntelDetector struct {
+	feeds    *intelFeeds
+	feedsKey string
+	refresh  time.Duration
+	severity string
+	mu       sync.Mutex
+	alerted  map[string]time.Time
+}
+
+// newThreatIntelDetector validates the feeds and loads them once, unless
+// another analyzer already has
+func newThreatIntelDetector(cfg config.ThreatIntel) (*threatIntelDetector, error) {
+	d := &threatIntelDetector{
+		feedsKey: sharedKey("threat_intel", cfg.Feeds, cfg.Refresh),
+		refresh:  time.Duration(cfg.Refresh),
+		severity: strings.ToUpper(cfg.Severity),
+		alerted:  make(map[string]time.Time),
+	}
+	if d.refresh <= 0 {
+		d.refresh = defaultIntelRefresh
+	}
+	if d.severity == "" {
+		d.severity = "HIGH"
+	}
+
+	for i, feed := range cfg.Feeds {
+		if feed.Name == "" {
+			return nil, fmt.Errorf("threat intel feed %d has no name", i+1)
+		}
+		if (feed.Path == "") == (feed.URL == "") {
+			return nil, fmt.Errorf("threat intel feed %s needs exactly one of path or url", feed.Name)
+		}
+		switch feed.Format {
+		case "", "text", "stix":
+		default:
+			return nil, fmt.Errorf("threat intel feed %s has unknown format %q", feed.Name, feed.Format)
+		}
+	}
+
+	feeds, err := acquireShared(d.feedsKey, func() (interface{}, error) {
+		f := &intelFeeds{
+			feeds:    cfg.Feeds,
+			refresh:  d.refresh,
+			client:   &http.Client{Timeout: intelFetchTimeout},
+			feedData: make(map[string][]string),
+		}
+		f.load(time.Now())
+		return f, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.feeds = feeds.(*intelFeeds)
+	return d, nil
+}
+
+// Stop releases the feeds once no other analyzer uses them
+func (d *threatIntelDetector) Stop() {
+	releaseShared(d.feedsKey)
+}
+
+// load fetches every feed and swaps in the compiled set
+func (f *intelFeeds) load(now time.Time) {
+	defer f.loading.Store(false)
+
+	for _, feed := range f.feeds {
+		indicators, err := f.fetch(feed)
+		if err != nil {
+			log.Printf("Failed to load threat intel feed %s: %v", feed.Name, err)
+			continue
+		}
+		f.mu.Lock()
+		f.feedData[feed.Name] = indicators
+		f.mu.Unlock()
+	}
+
+	set := &intelSet{
+		ips:     make(map[netip.Addr][]string),
+		domains: make(map[string][]string),
+		urls:    make(map[string][]string),
+	}
+	total := 0
+
+	f.mu.Lock()
+	for name, indicators := range f.feedData {
+		for _, indicator := range indicators {
+			if prefix, err := netip.ParsePrefix(indicator); err == nil {
+				set.prefixes = append(set.prefixes, intelPrefix{prefix: prefix.Masked(), list: name})
+			} else if addr, err := netip.ParseAddr(indicator); err == nil {
+				set.ips[addr.Unmap()] = append(set.ips[addr.Unmap()], name)
+			} else if u := normalizeURL(indicator); u != "" {
+				set.urls[u] = append(set.urls[u], name)
+			} else {
+				domain := strings.ToLower(strings.TrimSuffix(indicator, "."))
+				set.domains[domain] = append(set.domains[domain], name)
+			}
+			total++
+		}
+	}
+	f.lastLoad = now
+	f.mu.Unlock()
+
+	f.set.Store(set)
+	log.Printf("Loaded %d threat intel indicators from %d feeds", total, len(f.feeds))
+}
+
+// reload starts a background reload once the refresh period has passed,
+// unless one is already running
+func (f *intelFeeds) reload(now time.Time) {
+	f.mu.Lock()
+	due := now.Sub(f.lastLoad) >= f.refresh
+	f.mu.Unlock()
+
+	if due && f.loading.CompareAndSwap(false, true) {
+		go f.load(now)
+	}
+}
+
+// fetch reads a feed and returns its indicators, following the pages of a
+// TAXII collection
+func (f *intelFeeds) fetch(feed config.Feed) ([]string, error) {
+	if feed.Path != "" {
+		f, err := os.Open(feed.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r := io.LimitReader(f, intelMaxFeedSize)
+		if feed.Format == "stix" {
+			indicators, _, err := parseSTIX(r)
+			return indicators, err
+		}
+		return parseTextFeed(r)
+	}
+
+	var indicators []string
+	params := url.Values{}
+	for page := 0; page < intelMaxPages; page++ {
+		resp, err := f.get(feed, params)
+		if err != nil {
+			return nil, err
+		}
+		r := io.LimitReader(resp.Body, intelMaxFeedSize)
+		if feed.Format != "stix" {
+			defer resp.Body.Close()
+			return parseTextFeed(r)
+		}
+		found, more, err := parseSTIX(r)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		indicators = append(indicators, found...)
+		if more.Next == "" && !more.More {
+			return indicators, nil
+		}
+
+		// TAXII 2.1 servers page by next, or else by the time the last
+		// object of the page was added
+		params = url.Values{}
+		switch {
+		case more.Next != "":
+			params.Set("next", more.Next)
+		case resp.Header.Get("X-TAXII-Date-Added-Last") != "":
+			params.Set("added_after", resp.Header.Get("X-TAXII-Date-Added-Last"))
+		default:
+			return nil, errors.New("TAXII envelope has more objects but no next")
+		}
+	}
+	return nil, fmt.Errorf("TAXII collection has more than %d pages", intelMaxPages)
+}
+
+// get requests a page of an HTTP feed, adding params to its URL
+func (f *intelFeeds) get(feed config.Feed, params url.Values) (*http.Response, error) {
+	u, err := url.Parse(feed.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if feed.Format == "stix" {
+		req.Header.Set("Accept", "application/taxii+json;version=2.1, application/json")
+	}
+	for key, value := range feed.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// parseTextFeed reads one indicator per line: an IP, a CIDR block or a
+// domain. Comments starting with # or ; are ignored, as are the leading
+// addresses of hosts-file style lines such as "0.0.0.0 evil.example".
+func parseTextFeed(r io.Reader) ([]string, error) {
+	var indicators []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		indicators = append(indicators, fields[len(fields)-1])
+	}
+	return indicators, scanner.Err()
+}
+
+// taxiiMore is the paging of a TAXII 2.1 envelope
+type taxiiMore struct {
+	More bool   `json:"more"`
+	Next string `json:"next"`
+}
+
+// parseSTIX reads the indicators of a STIX 2.x bundle or a TAXII 2.1
+// envelope, both of which carry an objects array, and the paging of an
+// envelope
+func parseSTIX(r io.Reader) ([]string, taxiiMore, error) {
+	var doc struct {
+		taxiiMore
+		Objects []struct {
+			Type    string `json:"type"`
+			Pattern string `json:"pattern"`
+			Value   string `json:"value"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, taxiiMore{}, fmt.Errorf("invalid STIX document: %w", err)
+	}
+
+	var indicators []string
+	for _, obj := range doc.Objects {
+		switch obj.Type {
+		case "indicator":
+			for _, m := range stixValuePattern.FindAllStringSubmatch(obj.Pattern, -1) {
+				indicators = append(indicators, m[2])
+			}
+		case "ipv4-addr", "ipv6-addr", "domain-name", "url":
+			if obj.Value != "" {
+				indicators = append(indicators, obj.Value)
+			}
+		}
+	}
+	return indicators, doc.taxiiMore, nil
+}
+
+// normalizeURL returns a URL with its scheme and host lowercased and
+// without fragment or trailing slash, or "" if it is not a URL
+func normalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	i := strings.Index(rawURL, "://")
+	if i <= 0 || strings.ContainsAny(rawURL[:i], "/?#") {
+		return ""
+	}
+	if j := strings.IndexByte(rawURL, '#'); j >= 0 {
+		rawURL = rawURL[:j]
+	}
+	end := len(rawURL)
+	if j := strings.IndexAny(rawURL[i+3:], "/?"); j >= 0 {
+		end = i + 3 + j
+	}
+	return strings.TrimSuffix(strings.ToLower(rawURL[:end])+rawURL[end:], "/")
+}
+
+// Observe checks the IPs and domains of a log against the lists
+func (d *threatIntelDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	set := d.feeds.set.Load()
+	if set == nil {
+		return nil
+	}
+
+	var alerts []Alert
+	report := func(indicator, kind string, lists []string) {
+		d.mu.Lock()
+		last, seen := d.alerted[indicator]
+		if seen && now.Sub(last) < d.refresh {
+			d.mu.Unlock()
+			return
+		}
+		d.alerted[indicator] = now
+		d.mu.Unlock()
+
+		alerts = append(alerts, detectorAlert("Threat Intel Match", d.severity, logEntry, now, map[string]interface{}{
+			"detector":  "threatintel",
+			"indicator": indicator,
+			"type":      kind,
+			"lists":     lists,
+		}))
+	}
+
+	ips := intelIPPattern.FindAllString(logEntry.Message, -1)
+	if logEntry.IP != "" {
+		ips = append(ips, logEntry.IP)
+	}
+	for _, field := range clientIPFields {
+		ips = append(ips, valueStrings(logEntry.Fields[field])...)
+	}
+	checked := make(map[string]bool)
+	for _, ip := range ips {
+		if checked[ip] {
+			continue
+		}
+		checked[ip] = true
+		if lists := set.matchIP(ip); len(lists) > 0 {
+			report(ip, "ip", lists)
+		}
+	}
+
+	domains := intelDomainPattern.FindAllString(logEntry.Message, -1)
+	for _, field := range domainFields {
+		domains = append(domains, valueStrings(logEntry.Fields[field])...)
+	}
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if checked[domain] {
+			continue
+		}
+		checked[domain] = true
+		if lists := set.matchDomain(domain); len(lists) > 0 {
+			report(domain, "domain", lists)
+		}
+	}
+
+	if len(set.urls) > 0 {
+		urls := intelURLPattern.FindAllString(logEntry.Message, -1)
+		for _, field := range urlFields {
+			urls = append(urls, valueStrings(logEntry.Fields[field])...)
+		}
+		for _, u := range urls {
+			u = normalizeURL(strings.TrimRight(u, ".,;:!)]}"))
+			if u == "" || checked[u] {
+				continue
+			}
+			checked[u] = true
+			if lists := set.matchURL(u); len(lists) > 0 {
+				report(u, "url", lists)
+			}
+		}
+	}
+
+	return alerts
+}
+
+// matchIP returns the lists an IP appears on, directly or in a CIDR block
+func (s *intelSet) matchIP(ip string) []string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	lists := append([]string(nil), s.ips[addr]...)
+	for _, p := range s.prefixes {
+		if p.prefix.Contains(addr) {
+			lists = append(lists, p.list)
+		}
+	}
+	return lists
+}
+
+// matchDomain returns the lists a domain or any of its parents appear on
+func (s *intelSet) matchDomain(domain string) []string {
+	for {
+		if lists, ok := s.domains[domain]; ok {
+			return lists
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return nil
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// matchURL returns the lists a normalized URL appears on, with or without
+// its query string
+func (s *intelSet) matchURL(u string) []string {
+	if lists, ok := s.urls[u]; ok {
+		return lists
+	}
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		return s.urls[strings.TrimSuffix(u[:i], "/")]
+	}
+	return nil
+}
+
+// Tick starts a background reload of the feeds once the refresh period has
+// passed and forgets old alert suppressions
+func (d *threatIntelDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	for indicator, last := range d.alerted {
+		if now.Sub(last) >= d.refresh {
+			delete(d.alerted, indicator)
+		}
+	}
+	d.mu.Unlock()
+
+	d.feeds.reload(now)
+	return nil
+}
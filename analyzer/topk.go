@@ -0,0 +1,300 @@
+package analyzer
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Top-K tracking defaults
+const (
+	defaultTopK       = 10
+	defaultTopKWindow = 5 * time.Minute
+
+	// topKCapacityFactor is how many more counters than K the space-saving
+	// summary keeps, trading memory for accuracy of the top entries
+	topKCapacityFactor = 10
+)
+
+// defaultTopKFields are the fields tracked when no trackers are configured
+var defaultTopKFields = []string{"source", "template_id", "ip"}
+
+// TopKItem is one heavy hitter. Count may overestimate the true count by
+// up to Error.
+type TopKItem struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+	Error int    `json:"error"`
+}
+
+// TopKStats is the current and last completed top-K of one field
+type TopKStats struct {
+	Field       string     `json:"field"`
+	K           int        `json:"k"`
+	Window      string     `json:"window"`
+	WindowStart time.Time  `json:"window_start"`
+	Current     []TopKItem `json:"current"`
+	Previous    []TopKItem `json:"previous"`
+}
+
+// topKEntry is a monitored value of a space-saving summary
+type topKEntry struct {
+	value   string
+	count   int
+	err     int
+	index   int
+	lastLog parser.ParsedLog
+}
+
+// topKHeap orders entries by count, smallest first
+type topKHeap []*topKEntry
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *topKHeap) Push(x interface{}) {
+	e := x.(*topKEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// spaceSaving finds the most frequent values of a stream with a fixed
+// number of counters. A new value takes over the smallest counter, so
+// frequent values are never missed while rare ones come and go.
+type spaceSaving struct {
+	capacity int
+	entries  map[string]*topKEntry
+	heap     topKHeap
+}
+
+// newSpaceSaving creates an empty summary with the given number of counters
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{
+		capacity: capacity,
+		entries:  make(map[string]*topKEntry, capacity),
+	}
+}
+
+// add counts n occurrences of a value
+func (s *spaceSaving) add(value string, n int, log parser.ParsedLog) {
+	if e, ok := s.entries[value]; ok {
+		e.count += n
+		e.lastLog = log
+		heap.Fix(&s.heap, e.index)
+		return
+	}
+	if len(s.heap) < s.capacity {
+		e := &topKEntry{value: value, count: n, lastLog: log}
+		s.entries[value] = e
+		heap.Push(&s.heap, e)
+		return
+	}
+
+	e := s.heap[0]
+	delete(s.entries, e.value)
+	e.value = value
+	e.err = e.count
+	e.count += n
+	e.lastLog = log
+	s.entries[value] = e
+	heap.Fix(&s.heap, 0)
+}
+
+// top returns the k most frequent values, most frequent first
+func (s *spaceSaving) top(k int) []*topKEntry {
+	entries := append([]*topKEntry(nil), s.heap...)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].value < entries[j].value
+	})
+	if len(entries) > k {
+		entries = entries[:k]
+	}
+	return entries
+}
+
+// topKTracker keeps the heavy hitters of one field over fixed windows
+type topKTracker struct {
+	field    string
+	k        int
+	window   time.Duration
+	alert    bool
+	severity string
+	current  *spaceSaving
+	start    time.Time
+	previous []TopKItem
+	closed   int
+}
+
+// topKDetector tracks the most frequent values of configured fields, such
+// as the noisiest sources or top client IPs, and can alert when a value
+// enters a field's top K that was not in it the window before
+type topKDetector struct {
+	mu       sync.Mutex
+	trackers []*topKTracker
+}
+
+// newTopKDetector creates a top-K detector from its configuration
+func newTopKDetector(cfg config.TopK) *topKDetector {
+	trackers := cfg.Trackers
+	if len(trackers) == 0 {
+		for _, field := range defaultTopKFields {
+			trackers = append(trackers, config.TopKTracker{Field: field})
+		}
+	}
+
+	d := &topKDetector{}
+	now := time.Now()
+	for _, tc := range trackers {
+		t := &topKTracker{
+			field:    tc.Field,
+			k:        tc.K,
+			window:   time.Duration(tc.Window),
+			alert:    tc.AlertNewEntrants,
+			severity: strings.ToUpper(tc.Severity),
+			start:    now,
+			previous: []TopKItem{},
+		}
+		if t.k <= 0 {
+			t.k = defaultTopK
+		}
+		if t.window <= 0 {
+			t.window = defaultTopKWindow
+		}
+		if t.severity == "" {
+			t.severity = "LOW"
+		}
+		t.current = newSpaceSaving(t.k * topKCapacityFactor)
+		d.trackers = append(d.trackers, t)
+	}
+	return d
+}
+
+// Observe counts the log's value of every tracked field
+func (d *topKDetector) Observe(log parser.ParsedLog, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, t := range d.trackers {
+		if value := keyValue(log, t.field); value != "" {
+			t.current.add(value, log.RepeatCount, log)
+		}
+	}
+	return nil
+}
+
+// Tick closes windows that have elapsed, alerting on new entrants into
+// the top K when enabled
+func (d *topKDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var alerts []Alert
+	for _, t := range d.trackers {
+		if now.Sub(t.start) < t.window {
+			continue
+		}
+
+		top := t.current.top(t.k)
+		if t.alert && t.closed > 0 {
+			before := make(map[string]bool, len(t.previous))
+			for _, item := range t.previous {
+				before[item.Value] = true
+			}
+			for rank, e := range top {
+				if before[e.value] {
+					continue
+				}
+				alerts = append(alerts, detectorAlert("Top-K New Entrant", t.severity, e.lastLog, now, map[string]interface{}{
+					"detector": "topk",
+					"field":    t.field,
+					"value":    e.value,
+					"rank":     rank + 1,
+					"count":    e.count,
+					"k":        t.k,
+					"window":   t.window.String(),
+				}))
+			}
+		}
+
+		t.previous = topKItems(top)
+		t.closed++
+		t.current = newSpaceSaving(t.k * topKCapacityFactor)
+		t.start = now
+	}
+	return alerts
+}
+
+// stats returns the top K of every tracked field
+func (d *topKDetector) stats() []TopKStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make([]TopKStats, 0, len(d.trackers))
+	for _, t := range d.trackers {
+		stats = append(stats, TopKStats{
+			Field:       t.field,
+			K:           t.k,
+			Window:      t.window.String(),
+			WindowStart: t.start,
+			Current:     topKItems(t.current.top(t.k)),
+			Previous:    t.previous,
+		})
+	}
+	return stats
+}
+
+// topKItems converts summary entries for reporting
+func topKItems(entries []*topKEntry) []TopKItem {
+	items := make([]TopKItem, len(entries))
+	for i, e := range entries {
+		items[i] = TopKItem{Value: e.value, Count: e.count, Error: e.err}
+	}
+	return items
+}
+
+// TopK returns the heavy hitters of every tracked field, or nil when top-K
+// tracking is disabled
+func (a *Analyzer) TopK() []TopKStats {
+	for _, d := range a.detectors {
+		if t, ok := d.(*topKDetector); ok {
+			return t.stats()
+		}
+	}
+	return nil
+}
+
+// HandleTopK serves GET requests for the current heavy hitters
+func (a *Analyzer) HandleTopK(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := a.TopK()
+	if stats == nil {
+		http.Error(w, "Top-K tracking is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
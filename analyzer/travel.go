@@ -0,0 +1,171 @@
+package analyzer
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// Impossible-travel detector defaults
+const (
+	defaultTravelKey         = "user"
+	defaultTravelMaxSpeed    = 1000.0
+	defaultTravelMinDistance = 100.0
+
+	// travelMemory is how long a key's last location is remembered
+	travelMemory = 24 * time.Hour
+
+	// travelPruneInterval is how often forgotten locations are dropped
+	travelPruneInterval = time.Minute
+
+	// earthRadiusKm is the mean radius of the Earth
+	earthRadiusKm = 6371.0
+)
+
+// travelLocation is where and when a key was last seen
+type travelLocation struct {
+	lat     float64
+	lon     float64
+	country interface{}
+	city    interface{}
+	ip      string
+	seen    time.Time
+}
+
+// travelDetector remembers the last location of each key (a user by
+// default) from GeoIP enrichment and alerts when two successive events
+// imply travel faster than the configured speed
+type travelDetector struct {
+	key         string
+	maxSpeed    float64
+	minDistance float64
+	severity    string
+	mu          sync.Mutex
+	last        map[string]travelLocation
+	lastPrune   time.Time
+}
+
+// newTravelDetector creates an impossible-travel detector from its
+// configuration
+func newTravelDetector(cfg config.ImpossibleTravel) *travelDetector {
+	d := &travelDetector{
+		key:         cfg.Key,
+		maxSpeed:    cfg.MaxSpeed,
+		minDistance: cfg.MinDistance,
+		severity:    strings.ToUpper(cfg.Severity),
+		last:        make(map[string]travelLocation),
+		lastPrune:   time.Now(),
+	}
+	if d.key == "" {
+		d.key = defaultTravelKey
+	}
+	if d.maxSpeed <= 0 {
+		d.maxSpeed = defaultTravelMaxSpeed
+	}
+	if d.minDistance <= 0 {
+		d.minDistance = defaultTravelMinDistance
+	}
+	if d.severity == "" {
+		d.severity = "HIGH"
+	}
+	return d
+}
+
+// Observe compares a located log with the previous location of its key
+func (d *travelDetector) Observe(logEntry parser.ParsedLog, now time.Time) []Alert {
+	lat, ok1 := toFloat(logEntry.Fields["geo_lat"])
+	lon, ok2 := toFloat(logEntry.Fields["geo_lon"])
+	if !ok1 || !ok2 {
+		return nil
+	}
+
+	var key string
+	if d.key == "user" {
+		key = authUser(logEntry)
+	} else {
+		key = keyValue(logEntry, d.key)
+	}
+	if key == "" {
+		return nil
+	}
+
+	loc := travelLocation{
+		lat:     lat,
+		lon:     lon,
+		country: logEntry.Fields["country"],
+		city:    logEntry.Fields["city"],
+		ip:      logEntry.IP,
+		seen:    now,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, ok := d.last[key]
+	d.last[key] = loc
+	if !ok || now.Sub(prev.seen) > travelMemory {
+		return nil
+	}
+
+	distance := haversineKm(prev.lat, prev.lon, lat, lon)
+	if distance < d.minDistance {
+		return nil
+	}
+	elapsed := now.Sub(prev.seen)
+	speed := math.Inf(1)
+	if elapsed > 0 {
+		speed = distance / elapsed.Hours()
+	}
+	if speed <= d.maxSpeed {
+		return nil
+	}
+
+	metadata := map[string]interface{}{
+		"detector":     "travel",
+		"key":          key,
+		"distance_km":  math.Round(distance),
+		"elapsed":      elapsed.Round(time.Second).String(),
+		"from_ip":      prev.ip,
+		"from_country": prev.country,
+		"from_city":    prev.city,
+		"to_ip":        loc.ip,
+		"to_country":   loc.country,
+		"to_city":      loc.city,
+	}
+	if !math.IsInf(speed, 1) {
+		metadata["speed_kmh"] = math.Round(speed)
+	}
+	return []Alert{detectorAlert("Impossible Travel", d.severity, logEntry, now, metadata)}
+}
+
+// Tick forgets locations older than the memory period
+func (d *travelDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) < travelPruneInterval {
+		return nil
+	}
+	d.lastPrune = now
+
+	for key, loc := range d.last {
+		if now.Sub(loc.seen) > travelMemory {
+			delete(d.last, key)
+		}
+	}
+	return nil
+}
+
+// haversineKm returns the great-circle distance between two coordinates
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
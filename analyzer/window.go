@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"time"
+)
+
+// windowBuckets is the number of buckets each sliding window is split into
+const windowBuckets = 12
+
+// slidingCounter counts events over a sliding window using a ring of time
+// buckets. Old buckets expire one at a time, so counts decay continuously
+// instead of dropping to zero at a fixed reset boundary.
+type slidingCounter struct {
+	window     time.Duration
+	buckets    []int
+	bucketSize time.Duration
+	head       int
+	headStart  time.Time
+	total      int
+}
+
+// newSlidingCounter creates a counter covering the given window
+func newSlidingCounter(window time.Duration, now time.Time) *slidingCounter {
+	bucketSize := window / windowBuckets
+	if bucketSize <= 0 {
+		bucketSize = time.Millisecond
+	}
+	return &slidingCounter{
+		window:     window,
+		buckets:    make([]int, windowBuckets),
+		bucketSize: bucketSize,
+		headStart:  now.Truncate(bucketSize),
+	}
+}
+
+// advance rotates the ring up to now, clearing buckets that fell out of
+// the window
+func (c *slidingCounter) advance(now time.Time) {
+	steps := int(now.Sub(c.headStart) / c.bucketSize)
+	if steps <= 0 {
+		return
+	}
+	if steps > len(c.buckets) {
+		steps = len(c.buckets)
+	}
+	for i := 0; i < steps; i++ {
+		c.head = (c.head + 1) % len(c.buckets)
+		c.total -= c.buckets[c.head]
+		c.buckets[c.head] = 0
+	}
+	c.headStart = now.Truncate(c.bucketSize)
+}
+
+// add records n events at now and returns the count in the window
+func (c *slidingCounter) add(now time.Time, n int) int {
+	c.advance(now)
+	c.buckets[c.head] += n
+	c.total += n
+	return c.total
+}
+
+// count returns the number of events in the window ending at now
+func (c *slidingCounter) count(now time.Time) int {
+	c.advance(now)
+	return c.total
+}
+
+// spikeCounter counts events in consecutive fixed windows and remembers the
+// total of the previous window, for comparing one window against the last
+type spikeCounter struct {
+	window   time.Duration
+	start    time.Time
+	current  int
+	previous int
+}
+
+// newSpikeCounter creates a counter whose first window starts at now
+func newSpikeCounter(window time.Duration, now time.Time) *spikeCounter {
+	return &spikeCounter{
+		window: window,
+		start:  now,
+	}
+}
+
+// advance moves to the window containing now
+func (c *spikeCounter) advance(now time.Time) {
+	elapsed := now.Sub(c.start)
+	if elapsed < c.window {
+		return
+	}
+	if elapsed < 2*c.window {
+		c.previous = c.current
+	} else {
+		c.previous = 0
+	}
+	c.current = 0
+	c.start = c.start.Add(elapsed / c.window * c.window)
+}
+
+// add records n events at now and returns the counts of the current and
+// previous windows
+func (c *spikeCounter) add(now time.Time, n int) (current, previous int) {
+	c.advance(now)
+	c.current += n
+	return c.current, c.previous
+}
+
+// idle reports whether neither window holds any events at now
+func (c *spikeCounter) idle(now time.Time) bool {
+	c.advance(now)
+	return c.current == 0 && c.previous == 0
+}
+
+// distinctSet counts the distinct values seen within a sliding window.
+// Expired values are pruned at most once per bucket interval, so counts may
+// briefly include values slightly older than the window.
+type distinctSet struct {
+	window    time.Duration
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+// newDistinctSet creates an empty set covering the given window
+func newDistinctSet(window time.Duration, now time.Time) *distinctSet {
+	return &distinctSet{
+		window:    window,
+		seen:      make(map[string]time.Time),
+		lastPrune: now,
+	}
+}
+
+// add records a value at now and returns the number of distinct values
+func (s *distinctSet) add(value string, now time.Time) int {
+	s.seen[value] = now
+	return s.count(now)
+}
+
+// count returns the number of distinct values in the window ending at now
+func (s *distinctSet) count(now time.Time) int {
+	if now.Sub(s.lastPrune) >= s.window/windowBuckets {
+		for value, last := range s.seen {
+			if now.Sub(last) > s.window {
+				delete(s.seen, value)
+			}
+		}
+		s.lastPrune = now
+	}
+	return len(s.seen)
+}
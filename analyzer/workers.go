@@ -0,0 +1,72 @@
+package analyzer
+
+import (
+	"hash/fnv"
+
+	"github.com/davidharvith/argos/parser"
+)
+
+// shardBufferSize is the number of batches queued per shard worker
+const shardBufferSize = 16
+
+// SetWorkers spreads log processing over n workers. Logs are sharded by
+// the value of a field (default source), so logs sharing it are always
+// processed in order by the same worker and per-key detector state sees
+// them as a single goroutine would. It must be called before Start.
+func (a *Analyzer) SetWorkers(n int, shardKey string) {
+	if n <= 1 {
+		a.shards = nil
+		return
+	}
+	a.shardKey = shardKey
+	a.shards = make([]chan []parser.ParsedLog, n)
+	for i := range a.shards {
+		a.shards[i] = make(chan []parser.ParsedLog, shardBufferSize)
+	}
+}
+
+// process analyzes a batch, on the calling goroutine or spread over the
+// shard workers, returning false on shutdown
+func (a *Analyzer) process(batch []parser.ParsedLog) bool {
+	if a.shards == nil {
+		for _, logEntry := range batch {
+			a.processLog(logEntry)
+		}
+		return true
+	}
+
+	groups := make([][]parser.ParsedLog, len(a.shards))
+	for _, logEntry := range batch {
+		h := fnv.New32a()
+		h.Write([]byte(keyValue(logEntry, a.shardKey)))
+		i := h.Sum32() % uint32(len(a.shards))
+		groups[i] = append(groups[i], logEntry)
+	}
+	for i, logs := range groups {
+		if len(logs) == 0 {
+			continue
+		}
+		select {
+		case a.shards[i] <- logs:
+		case <-a.shutdown:
+			return false
+		}
+	}
+	return true
+}
+
+// work processes the batches of one shard
+func (a *Analyzer) work(shard <-chan []parser.ParsedLog) {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case batch := <-shard:
+			for _, logEntry := range batch {
+				a.processLog(logEntry)
+			}
+		case <-a.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
+	"github.com/davidharvith/argos/parser"
+)
+
+// cliTimeout bounds admin API calls made by CLI commands
+const cliTimeout = 10 * time.Second
+
+// rulesCommand implements "argos rules list|enable|disable", which manage
+// the rules of a running instance through its admin API
+func rulesCommand(args []string) int {
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	adminURL := fs.String("admin", "http://localhost:"+adminPort, "admin API base URL")
+	token := fs.String("token", os.Getenv("ARGOS_ADMIN_TOKEN"), "admin API bearer token, by default $ARGOS_ADMIN_TOKEN")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: argos rules [-admin URL] [-token TOKEN] list | enable <id> | disable <id>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	client := &http.Client{Timeout: cliTimeout}
+	base := strings.TrimSuffix(*adminURL, "/")
+
+	switch fs.Arg(0) {
+	case "list":
+		req, err := adminRequest(http.MethodGet, base+"/api/rules", *token)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list rules: %v\n", err)
+			return 1
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list rules: %v\n", err)
+			return 1
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			fmt.Fprintf(os.Stderr, "Failed to list rules: %s: %s", resp.Status, body)
+			return 1
+		}
+
+		var rules []analyzer.RuleInfo
+		if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to decode rules: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSEVERITY\tPRIORITY\tENABLED")
+		for _, rule := range rules {
+			severity := rule.Severity
+			if rule.Suppress {
+				severity = "SUPPRESS"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%t\n", rule.ID, rule.Name, severity, rule.Priority, rule.Enabled)
+		}
+		tw.Flush()
+		return 0
+
+	case "enable", "disable":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return 2
+		}
+		req, err := adminRequest(http.MethodPost, base+"/api/rules/"+fs.Arg(1)+"/"+fs.Arg(0), *token)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to %s rule: %v\n", fs.Arg(0), err)
+			return 1
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to %s rule: %v\n", fs.Arg(0), err)
+			return 1
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "Failed to %s rule: %s", fs.Arg(0), body)
+			return 1
+		}
+		fmt.Print(string(body))
+		return 0
+	}
+
+	fs.Usage()
+	return 2
+}
+
+// adminRequest builds a request to the admin API carrying the bearer token
+func adminRequest(method, url, token string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// testRulesCommand implements "argos test-rules", which runs a rules file
+// offline over sample logs and reports which rules would fire
+func testRulesCommand(args []string) int {
+	fs := flag.NewFlagSet("test-rules", flag.ExitOnError)
+	rulesPath := fs.String("rules", "", "rules file to test (default: the configured or built-in rules)")
+	inputPath := fs.String("input", "-", "NDJSON log file or glob, optionally gzipped, or - for stdin")
+	configPath := fs.String("config", "", "configuration file for parser settings and the rules file")
+	examples := fs.Int("examples", 3, "example matches to show per rule")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: argos test-rules [-rules FILE] [-input FILE] [-config FILE] [-examples N] [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	prs, rules, err := loadOffline(*configPath, *rulesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	input, err := openLogs(*inputPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer input.Close()
+
+	results, err := replay(prs, input, *examples, rules)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	result := results[0]
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return 0
+	}
+
+	fmt.Printf("Replayed %d logs", result.Logs)
+	if result.Invalid > 0 {
+		fmt.Printf(" (%d invalid lines skipped)", result.Invalid)
+	}
+	fmt.Printf(", %d alerts\n\n", result.Alerts)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tFIRED\tPER 1K LOGS")
+	for _, hits := range result.Rules {
+		rate := 0.0
+		if result.Logs > 0 {
+			rate = float64(hits.Count) * 1000 / float64(result.Logs)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\n", hits.Name, hits.Count, rate)
+	}
+	tw.Flush()
+
+	for _, hits := range result.Rules {
+		if len(hits.Examples) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", hits.Name)
+		for _, alert := range hits.Examples {
+			fmt.Printf("  %s %s [%s] %s\n", alert.Log.Timestamp, alert.Log.Source, alert.Log.Level, alert.Log.Message)
+		}
+	}
+	return 0
+}
+
+// loadOffline builds a parser and loads rules for the offline commands, as
+// offlineRules loads them
+func loadOffline(configPath, rulesPath string) (*parser.Parser, []analyzer.Rule, error) {
+	prs, cfg, err := offlineParser(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, err := offlineRules(cfg.Analyzer, rulesPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return prs, rules, nil
+}
+
+// offlineParser loads the configuration of the offline commands and builds
+// a parser from it
+func offlineParser(configPath string) (*parser.Parser, *config.Config, error) {
+	cfg := &config.Config{}
+	if configPath != "" {
+		var err error
+		cfg, err = config.Load(configPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+	}
+
+	prs := parser.NewParser(nil, nil, 1)
+	if err := configureParser(prs, cfg.Parser); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure parser: %w", err)
+	}
+
+	if err := analyzer.LoadKeywordLists(cfg.Analyzer.KeywordLists); err != nil {
+		return nil, nil, fmt.Errorf("failed to load keyword lists: %w", err)
+	}
+	return prs, cfg, nil
+}
+
+// offlineRules loads the rules of an offline run. They come from rulesPath,
+// else the configured rules file or the built-in rules unless rule packs
+// replace them, followed by the configured rule packs and the rules defined
+// in the configuration.
+func offlineRules(cfg config.Analyzer, rulesPath string) ([]analyzer.Rule, error) {
+	if rulesPath == "" {
+		rulesPath = cfg.RulesFile
+	}
+	var rules []analyzer.Rule
+	if len(cfg.RulePacks) == 0 {
+		rules = analyzer.BuiltinRules()
+	}
+	if rulesPath != "" {
+		var err error
+		if rules, err = analyzer.LoadRules(rulesPath); err != nil {
+			return nil, fmt.Errorf("failed to load rules: %w", err)
+		}
+	}
+	configured, err := configuredRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, configured...), nil
+}
+
+// backtestCommand implements "argos backtest", which replays an archive of
+// logs through the current and a candidate rule set and compares the
+// alert volume of each rule
+func backtestCommand(args []string) int {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	candidatePath := fs.String("candidate", "", "candidate rules file (required)")
+	currentPath := fs.String("current", "", "current rules file (default: the configured or built-in rules)")
+	inputPath := fs.String("input", "-", "NDJSON log file or glob, optionally gzipped, or - for stdin")
+	configPath := fs.String("config", "", "configuration file for parser settings and the rules file")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: argos backtest -candidate FILE [-current FILE] [-input GLOB] [-config FILE] [-json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *candidatePath == "" {
+		fs.Usage()
+		return 2
+	}
+
+	// Both sides share the configured rule packs and rules, so that only
+	// the rules files are compared
+	prs, cfg, err := offlineParser(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	current, err := offlineRules(cfg.Analyzer, *currentPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	candidate, err := offlineRules(cfg.Analyzer, *candidatePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load candidate rules: %v\n", err)
+		return 1
+	}
+
+	input, err := openLogs(*inputPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer input.Close()
+
+	results, err := replay(prs, input, 0, current, candidate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	before, after := results[0], results[1]
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]*replayResult{"current": before, "candidate": after})
+		return 0
+	}
+
+	fmt.Printf("Replayed %d logs", before.Logs)
+	if before.Invalid > 0 {
+		fmt.Printf(" (%d invalid lines skipped)", before.Invalid)
+	}
+	fmt.Printf("\n\n")
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tCURRENT\tCANDIDATE\tCHANGE")
+	for _, hits := range before.Rules {
+		if other := after.hits(hits.Name); other != nil {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", hits.Name, hits.Count, other.Count, volumeChange(hits.Count, other.Count))
+		} else {
+			fmt.Fprintf(tw, "%s\t%d\t-\tremoved\n", hits.Name, hits.Count)
+		}
+	}
+	for _, hits := range after.Rules {
+		if before.hits(hits.Name) == nil {
+			fmt.Fprintf(tw, "%s\t-\t%d\tnew\n", hits.Name, hits.Count)
+		}
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%s\n", before.Alerts, after.Alerts, volumeChange(before.Alerts, after.Alerts))
+	tw.Flush()
+	return 0
+}
+
+// volumeChange describes the change from one alert count to another
+func volumeChange(before, after int) string {
+	switch {
+	case before == after:
+		return "="
+	case before == 0:
+		return fmt.Sprintf("%+d", after)
+	}
+	return fmt.Sprintf("%+d (%+.0f%%)", after-before, float64(after-before)*100/float64(before))
+}
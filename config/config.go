@@ -0,0 +1,380 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config is the top-level Argos configuration loaded from a JSON file
+type Config struct {
+	Parser   Parser   `json:"parser"`
+	Analyzer Analyzer `json:"analyzer"`
+	Alerter  Alerter  `json:"alerter"`
+	Admin    Admin    `json:"admin"`
+}
+
+// Admin configures the admin server serving metrics and management APIs
+type Admin struct {
+	// Addr is the address the admin server listens on, by default
+	// 127.0.0.1:8081 so that only local clients can reach it
+	Addr string `json:"addr"`
+
+	// Token is the bearer token required of every admin request but the
+	// health check; without one, only the health check is served
+	Token string `json:"token"`
+}
+
+// Parser configures the parser workers
+type Parser struct {
+	Stages []Stage `json:"stages"`
+
+	// ComputedFields maps a field name to an expression evaluated per entry,
+	// e.g. "err_ratio": "errors / requests"
+	ComputedFields map[string]string `json:"computed_fields"`
+
+	// DedupWindow collapses identical messages from the same source seen
+	// within the window: the first passes at once and its repeats follow as
+	// one entry with a repeat count when the window closes; zero disables
+	DedupWindow Duration `json:"dedup_window"`
+
+	// BatchSize and BatchLinger control batched handoff to the analyzer; a
+	// batch is sent when full or when it has waited BatchLinger
+	BatchSize   int      `json:"batch_size"`
+	BatchLinger Duration `json:"batch_linger"`
+
+	// DecodePayloads decodes detected base64/hex blobs and re-scans them
+	// for keywords
+	DecodePayloads bool `json:"decode_payloads"`
+
+	// GeoIPFile is a CSV IP range database used to add the country, city
+	// and coordinates of extracted IPs
+	GeoIPFile string `json:"geoip_file"`
+}
+
+// Analyzer configures the anomaly detection engine
+type Analyzer struct {
+	// RulesFile is a JSON rules file replacing the built-in rules
+	RulesFile string `json:"rules_file"`
+
+	// Rules are simple match rules defined in the configuration itself,
+	// added to the built-in rules or those of RulesFile
+	Rules []MatchRule `json:"rules"`
+
+	// RulePacks enables curated built-in rule packs by name, such as
+	// linux-auth or nginx, in place of the built-in demo rules; they are
+	// added to the rules of RulesFile as well
+	RulePacks []string `json:"rule_packs"`
+
+	// KeywordLists maps keyword list names, such as security or payment,
+	// to files of one word per line that rules match with the in_list
+	// operator; the files are reloaded when they change
+	KeywordLists map[string]string `json:"keyword_lists"`
+
+	// OverridesFile persists rules enabled or disabled at runtime
+	OverridesFile string `json:"overrides_file"`
+
+	// DedupWindow folds repeats of an alert for the same rule and key into
+	// the first one while they keep arriving within the window; zero disables.
+	// DedupUpdate is how often a folded alert is re-sent with its counts.
+	DedupWindow Duration `json:"dedup_window"`
+	DedupUpdate Duration `json:"dedup_update_interval"`
+
+	// SuppressTTL mutes repeats of an alert of the same rule and key for
+	// this long after it fires; the next alert after it expires carries
+	// the number of repeats muted. Zero disables.
+	SuppressTTL Duration `json:"suppress_ttl"`
+
+	// Workers spreads log processing over this many goroutines, sharding
+	// logs by the ShardKey field (default source) so that logs sharing it
+	// stay in order; 0 or 1 processes every log on one goroutine
+	Workers  int    `json:"workers"`
+	ShardKey string `json:"shard_key"`
+
+	// StateFile persists window counters, the bloom filter, sequence
+	// progress and learned detector models across restarts, saved every
+	// StateInterval and on shutdown; empty disables
+	StateFile     string   `json:"state_file"`
+	StateInterval Duration `json:"state_interval"`
+
+	Scoring   Scoring   `json:"scoring"`
+	Incidents Incidents `json:"incidents"`
+	Summary   Summary   `json:"summary"`
+	Sampling  Sampling  `json:"sampling"`
+	Tenants   Tenants   `json:"tenants"`
+
+	// Maintenance mutes alerts during planned work such as deploys and
+	// load tests
+	Maintenance []MaintenanceWindow `json:"maintenance"`
+
+	EWMA         EWMA         `json:"ewma"`
+	Baseline     Baseline     `json:"baseline"`
+	ChangePoint  ChangePoint  `json:"change_point"`
+	Rare         Rare         `json:"rare"`
+	Silence      Silence      `json:"silence"`
+	BruteForce   BruteForce   `json:"brute_force"`
+	Scan         Scan         `json:"scan"`
+	Entropy      Entropy      `json:"entropy"`
+	Templates    Templates    `json:"templates"`
+	FormatDrift  FormatDrift  `json:"format_drift"`
+	LevelDrift   LevelDrift   `json:"level_drift"`
+	InterArrival InterArrival `json:"inter_arrival"`
+	Outliers     Outliers     `json:"outliers"`
+	Markov       Markov       `json:"markov"`
+
+	ImpossibleTravel ImpossibleTravel `json:"impossible_travel"`
+	ThreatIntel      ThreatIntel      `json:"threat_intel"`
+	TopK             TopK             `json:"top_k"`
+
+	// Models score logs with trained anomaly models; ONNXRuntime is the
+	// path of the onnxruntime shared library they are run with
+	Models      []Model `json:"models"`
+	ONNXRuntime string  `json:"onnx_runtime"`
+
+	// Detectors holds the settings of detectors registered by other
+	// packages, by their registered name
+	Detectors map[string]json.RawMessage `json:"detectors"`
+}
+
+// Alerter configures where alerts are delivered besides the console and
+// the output file
+type Alerter struct {
+	PagerDuty  PagerDuty  `json:"pagerduty"`
+	Webhooks   []Webhook  `json:"webhooks"`
+	Commands   []Command  `json:"commands"`
+	Files      []File     `json:"files"`
+	Email      Email      `json:"email"`
+	Discord    Discord    `json:"discord"`
+	Kafka      Kafka      `json:"kafka"`
+	NATS       NATS       `json:"nats"`
+	SQS        SQS        `json:"sqs"`
+	SNS        SNS        `json:"sns"`
+	SNMP       SNMP       `json:"snmp"`
+	Database   Database   `json:"database"`
+	ClickHouse ClickHouse `json:"clickhouse"`
+	S3         S3         `json:"s3"`
+
+	// Console is the format alerts are printed to the console in: pretty
+	// (the default), compact, line (one line of text) or none
+	Console string `json:"console"`
+
+	// ConsoleMinSeverity is the least severity printed to the console,
+	// default INFO
+	ConsoleMinSeverity string `json:"console_min_severity"`
+
+	// ConsoleColor colors severities on the console: auto (the default,
+	// when printing to a terminal and NO_COLOR is unset), always or never
+	ConsoleColor string `json:"console_color"`
+
+	// Output is the format of the alert output file: compact, JSON Lines
+	// (the default), pretty or none
+	Output string `json:"output"`
+
+	// Rotation rotates the alert output file
+	Rotation Rotation `json:"rotation"`
+
+	// Catalog is a service catalog file mapping alert sources to their
+	// team, Slack handle and runbooks, added to the metadata of alerts
+	Catalog string `json:"catalog"`
+
+	// QueueSize is how many alerts each sink holds while sending earlier
+	// ones, default 1000; further alerts for the sink are dropped
+	QueueSize int `json:"queue_size"`
+
+	// CircuitBreaker pauses sinks that keep failing
+	CircuitBreaker CircuitBreaker `json:"circuit_breaker"`
+
+	// Sinks holds the settings of sinks registered by other packages, by
+	// their registered name
+	Sinks map[string]json.RawMessage `json:"sinks"`
+
+	// Routes send alerts to sinks by severity, rule and label, in order,
+	// each matching route delivering to its sinks until one that sets stop
+	// matches; without routes, every sink receives every alert
+	Routes []Route `json:"routes"`
+
+	// Digests batch the alerts of sinks into grouped notifications
+	Digests []Digest `json:"digests"`
+
+	// Dedup collapses near-identical alerts, whichever rule raised them
+	Dedup AlertDedup `json:"dedup"`
+
+	// AutoResolve resolves alerts that stopped firing
+	AutoResolve AutoResolve `json:"auto_resolve"`
+
+	// Silences mute the alerts they match; more are added through the
+	// admin API
+	Silences []AlertSilence `json:"silences"`
+}
+
+// AlertDedup configures the collapsing of near-identical alerts in the
+// alerter. Repeats of a delivered alert are dropped for TTL, after which
+// the next one is delivered with how often it was seen since first seen.
+// Alerts are forgotten once not seen for an hour, or TTL if longer.
+type AlertDedup struct {
+	Enabled bool `json:"enabled"`
+
+	// TTL defaults to 10m
+	TTL Duration `json:"ttl"`
+
+	// Fields make up the fingerprint of an alert: source, rule, severity,
+	// message, template (the message template, or the message when the
+	// log has none) or key; default source and template
+	Fields []string `json:"fields"`
+}
+
+// CircuitBreaker pauses a sink for Cooldown once Failures sends to it fail
+// in a row, rather than retrying every alert against a sink that is down.
+// Its alerts wait in its queue meanwhile, or are appended to DeadLetter.
+// The first alert after the cooldown tries the sink again, closing the
+// circuit if it is delivered and opening it again if not.
+type CircuitBreaker struct {
+	Enabled bool `json:"enabled"`
+
+	// Failures defaults to 5 and Cooldown to 1m
+	Failures int      `json:"failures"`
+	Cooldown Duration `json:"cooldown"`
+
+	// DeadLetter is a file the alerts of sinks whose circuit is open are
+	// appended to as JSON Lines, with the sink and its last error
+	DeadLetter string `json:"dead_letter"`
+}
+
+// AutoResolve resolves the alerts of a fingerprint once none has been
+// delivered for TTL, announcing the resolution to sinks as an alert of the
+// fingerprint that resolves it
+type AutoResolve struct {
+	Enabled bool `json:"enabled"`
+
+	// TTL defaults to 30m
+	TTL Duration `json:"ttl"`
+}
+
+// AlertSilence mutes the alerts it matches at delivery until it expires.
+// Rules (names or IDs), Sources and Tenants list the values matched and
+// Metadata the values of metadata keys, as glob patterns such as db-*, and
+// Severities the severities matched. Empty matchers match every alert, but
+// a silence sets at least one.
+type AlertSilence struct {
+	Rules      []string          `json:"rules"`
+	Sources    []string          `json:"sources"`
+	Severities []string          `json:"severities"`
+	Tenants    []string          `json:"tenants"`
+	Metadata   map[string]string `json:"metadata"`
+
+	// Expires is when the silence ends, as an RFC 3339 time, or Duration
+	// after it is created; default never
+	Expires  string   `json:"expires"`
+	Duration Duration `json:"duration"`
+
+	// CreatedBy and Comment say who silenced the alerts and why
+	CreatedBy string `json:"created_by"`
+	Comment   string `json:"comment"`
+}
+
+// Tenants configures per-tenant isolation. Each tenant gets an analyzer of
+// its own, with separate windows, detector baselines, bloom filter, rules
+// and state files.
+type Tenants struct {
+	Enabled bool `json:"enabled"`
+
+	// Rules maps a tenant to its rules file; tenants not listed use
+	// RulesFile
+	Rules map[string]string `json:"rules"`
+
+	// MaxTenants bounds the tenants given an analyzer of their own, default
+	// 100; logs of further tenants are analyzed with untagged ones
+	MaxTenants int `json:"max_tenants"`
+}
+
+// MatchRule raises an alert when a field of a log, by default the
+// message, matches a regular expression. With a Threshold it fires once
+// that many logs sharing the Key field (default source) match within
+// Window instead.
+type MatchRule struct {
+	Name      string   `json:"name"`
+	Severity  string   `json:"severity"`
+	Match     Match    `json:"match"`
+	Threshold int      `json:"threshold"`
+	Window    Duration `json:"window"`
+	Key       string   `json:"key"`
+}
+
+// Match is the condition of a MatchRule
+type Match struct {
+	Field string `json:"field"`
+	Regex string `json:"regex"`
+}
+
+// MaintenanceWindow mutes alerts on a schedule. Recurring windows start
+// whenever the cron Schedule matches and last Duration; one-off windows run
+// from Start to End (RFC 3339). Times are in Timezone, default UTC. Only
+// alerts of the listed Rules (names or IDs), Sources and Tenants are muted;
+// empty lists match everything.
+type MaintenanceWindow struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"`
+	Duration Duration `json:"duration"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone"`
+	Rules    []string `json:"rules"`
+	Sources  []string `json:"sources"`
+	Tenants  []string `json:"tenants"`
+}
+
+// Stage declares a custom parsing stage loaded from a Go plugin. Its name
+// identifies the stage in logs.
+type Stage struct {
+	Name    string            `json:"name"`
+	Plugin  string            `json:"plugin"`
+	Options map[string]string `json:"options"`
+}
+
+// Load reads and decodes a JSON configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Duration is a time.Duration that decodes from JSON strings such as "30s"
+// or from a number of seconds
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %v", value)
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
@@ -0,0 +1,514 @@
+package config
+
+// EWMA configures the exponentially weighted rate anomaly detector
+type EWMA struct {
+	Enabled bool `json:"enabled"`
+
+	// Key is the field rates are tracked per, e.g. source or template_id
+	Key string `json:"key"`
+
+	// Interval is the rate measurement period
+	Interval Duration `json:"interval"`
+
+	// Alpha is the smoothing factor in (0, 1]; higher adapts faster
+	Alpha float64 `json:"alpha"`
+
+	// Threshold is the z-score beyond which an interval is anomalous
+	Threshold float64 `json:"threshold"`
+
+	// MinSamples is the number of intervals observed before alerting
+	MinSamples int `json:"min_samples"`
+
+	Severity string `json:"severity"`
+}
+
+// Baseline configures per-source baseline learning
+type Baseline struct {
+	Enabled bool `json:"enabled"`
+
+	// TrainingPeriod is how long traffic is observed before alerting
+	TrainingPeriod Duration `json:"training_period"`
+
+	// Interval is the rate measurement period
+	Interval Duration `json:"interval"`
+
+	// Tolerance is the factor by which an interval's rate may exceed, or
+	// fall short of, the learned rate
+	Tolerance float64 `json:"tolerance"`
+
+	Severity string `json:"severity"`
+}
+
+// ChangePoint configures Page-Hinkley change-point detection over
+// per-source volume and error ratio
+type ChangePoint struct {
+	Enabled bool `json:"enabled"`
+
+	// Interval is the measurement period
+	Interval Duration `json:"interval"`
+
+	// Delta is the relative drift tolerated per interval before deviations
+	// start to accumulate
+	Delta float64 `json:"delta"`
+
+	// Threshold is the accumulated relative deviation that signals a shift
+	Threshold float64 `json:"threshold"`
+
+	// MinSamples is the number of intervals observed before testing
+	MinSamples int `json:"min_samples"`
+
+	Severity string `json:"severity"`
+}
+
+// Rare configures alerting on never-before-seen field values
+type Rare struct {
+	Enabled bool `json:"enabled"`
+
+	// Fields are the fields whose new values are reported, by default
+	// source, template_id, error_code and country
+	Fields []string `json:"fields"`
+
+	// LearningPeriod is how long values are recorded silently after start
+	LearningPeriod Duration `json:"learning_period"`
+
+	// TTL is how long a value is remembered after it was last seen
+	TTL Duration `json:"ttl"`
+
+	Severity string `json:"severity"`
+}
+
+// Silence configures alerting when a source stops logging
+type Silence struct {
+	Enabled bool `json:"enabled"`
+
+	// Expected sets how long each named source may stay quiet; other sources
+	// have their usual gap between logs learned
+	Expected map[string]Duration `json:"expected"`
+
+	// Factor is how many usual gaps a learned source may stay quiet
+	Factor float64 `json:"factor"`
+
+	// MinSilence is the shortest silence reported for learned sources
+	MinSilence Duration `json:"min_silence"`
+
+	// MinEvents is the number of logs needed before a gap is learned
+	MinEvents int `json:"min_events"`
+
+	Severity string `json:"severity"`
+}
+
+// BruteForce configures brute-force and password-spraying detection
+type BruteForce struct {
+	Enabled bool `json:"enabled"`
+
+	// Window is the period failures are counted over
+	Window Duration `json:"window"`
+
+	// FailureThreshold is the number of failures for one IP and username
+	// that counts as a brute-force attempt
+	FailureThreshold int `json:"failure_threshold"`
+
+	// SprayThreshold is the number of distinct usernames failing from one
+	// IP that counts as password spraying
+	SprayThreshold int `json:"spray_threshold"`
+
+	// FailurePhrases and SuccessPhrases recognize auth outcomes in messages,
+	// case-insensitively; they replace the built-in lists
+	FailurePhrases []string `json:"failure_phrases"`
+	SuccessPhrases []string `json:"success_phrases"`
+
+	Severity string `json:"severity"`
+}
+
+// Scan configures port-scan, path-scan and request-flood detection per
+// client IP
+type Scan struct {
+	Enabled bool `json:"enabled"`
+
+	// Window is the period ports, paths and requests are counted over
+	Window Duration `json:"window"`
+
+	// PortThreshold and PathThreshold are the distinct destination ports
+	// and request paths from one client that count as a scan
+	PortThreshold int `json:"port_threshold"`
+	PathThreshold int `json:"path_threshold"`
+
+	// FloodThreshold is the number of requests from one client that counts
+	// as a flood
+	FloodThreshold int `json:"flood_threshold"`
+
+	Severity string `json:"severity"`
+}
+
+// ImpossibleTravel configures alerting on successive events whose GeoIP
+// locations are too far apart for the time between them
+type ImpossibleTravel struct {
+	Enabled bool `json:"enabled"`
+
+	// Key is the field locations are tracked per, by default the username
+	Key string `json:"key"`
+
+	// MaxSpeed is the fastest plausible travel speed in km/h
+	MaxSpeed float64 `json:"max_speed"`
+
+	// MinDistance ignores jumps shorter than this many km, which are
+	// usually GeoIP inaccuracy
+	MinDistance float64 `json:"min_distance"`
+
+	Severity string `json:"severity"`
+}
+
+// ThreatIntel configures matching of IPs and domains against threat intel
+// feeds
+type ThreatIntel struct {
+	Enabled bool   `json:"enabled"`
+	Feeds   []Feed `json:"feeds"`
+
+	// Refresh is how often feeds are reloaded; an indicator alerts at most
+	// once per refresh period
+	Refresh Duration `json:"refresh"`
+
+	Severity string `json:"severity"`
+}
+
+// Feed is a threat intel list read from a local file or an HTTP URL. The
+// text format has one IP, CIDR block or domain per line; the stix format
+// reads a STIX 2.x bundle or a TAXII 2.1 collection objects endpoint.
+type Feed struct {
+	Name    string            `json:"name"`
+	Path    string            `json:"path"`
+	URL     string            `json:"url"`
+	Format  string            `json:"format"`
+	Headers map[string]string `json:"headers"`
+}
+
+// Scoring configures composite alert scoring
+type Scoring struct {
+	// Enabled derives alert severities from their scores instead of the
+	// static severity of the rule
+	Enabled bool `json:"enabled"`
+
+	// SourceCriticality multiplies the score of alerts from a source; the
+	// "*" entry applies to sources not listed
+	SourceCriticality map[string]float64 `json:"source_criticality"`
+}
+
+// Incidents configures grouping of related alerts into incidents
+type Incidents struct {
+	Enabled bool `json:"enabled"`
+
+	// Window is how long an incident stays open without new alerts,
+	// default 10m
+	Window Duration `json:"window"`
+
+	// By are the fields alerts must share to join an incident, any one of
+	// them sufficing; default source, ip and template_id
+	By []string `json:"by"`
+
+	// Collapse delivers only the first alert of an incident and its
+	// resolution summary, folding the alerts in between into it
+	Collapse bool `json:"collapse"`
+
+	// MaxEvidence bounds the alerts kept per incident, default 100
+	MaxEvidence int `json:"max_evidence"`
+}
+
+// Sampling configures sampling of low-severity alerts during alert storms
+type Sampling struct {
+	Enabled bool `json:"enabled"`
+
+	// Rate is how many alerts per second are let through before the rest
+	// are sampled, with bursts of up to Burst alerts; defaults 10 and
+	// twice the rate
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+
+	// Severities are the severities sampled, default MEDIUM and LOW
+	Severities []string `json:"severities"`
+}
+
+// Summary configures periodic summary events giving a pulse of the system:
+// log volume, the busiest sources, the rules that fired most and templates
+// seen for the first time
+type Summary struct {
+	Enabled bool `json:"enabled"`
+
+	// Interval is how often a summary is sent, default 1h
+	Interval Duration `json:"interval"`
+
+	// Top bounds the sources, rules and new templates listed, default 5
+	Top int `json:"top"`
+}
+
+// TopK configures heavy-hitter tracking
+type TopK struct {
+	Enabled bool `json:"enabled"`
+
+	// Trackers are the fields to track, by default source, template_id
+	// and ip
+	Trackers []TopKTracker `json:"trackers"`
+}
+
+// TopKTracker tracks the most frequent values of one field
+type TopKTracker struct {
+	Field string `json:"field"`
+
+	// K is the number of values reported, default 10
+	K int `json:"k"`
+
+	// Window is the period each top K covers, default 5m
+	Window Duration `json:"window"`
+
+	// AlertNewEntrants raises an alert when a value enters the top K that
+	// was not in it the window before
+	AlertNewEntrants bool `json:"alert_new_entrants"`
+
+	Severity string `json:"severity"`
+}
+
+// Entropy configures detection of high-entropy strings such as DGA
+// domains, encoded payloads and random path tokens
+type Entropy struct {
+	Enabled bool `json:"enabled"`
+
+	// Fields are scanned for tokens, by default the message
+	Fields []string `json:"fields"`
+
+	// MinLength is the shortest token scored, default 16
+	MinLength int `json:"min_length"`
+
+	// Threshold is the entropy in bits per character above which a token
+	// is reported, default 4.2; Sources overrides it per source
+	Threshold float64            `json:"threshold"`
+	Sources   map[string]float64 `json:"sources"`
+
+	// Ignore holds regular expressions of tokens that are never reported,
+	// e.g. session IDs
+	Ignore []string `json:"ignore"`
+
+	Severity string `json:"severity"`
+}
+
+// Templates configures alerting on new log templates and on shifts in the
+// rate of known ones
+type Templates struct {
+	Enabled bool `json:"enabled"`
+
+	// StablePeriod is how long a source must have been logging before its
+	// new templates are reported, default 1h
+	StablePeriod Duration `json:"stable_period"`
+
+	// Interval is the rate measurement period, default 1m
+	Interval Duration `json:"interval"`
+
+	// Factor is how far an interval's count may rise above, or fall below,
+	// the template's average rate, default 5
+	Factor float64 `json:"factor"`
+
+	// MinSamples is the number of intervals observed before rates are
+	// compared, default 10
+	MinSamples int `json:"min_samples"`
+
+	Severity string `json:"severity"`
+}
+
+// FormatDrift configures alerting when the shape of a source's logs
+// changes: fields per log, message lengths or parse success rate
+type FormatDrift struct {
+	Enabled bool `json:"enabled"`
+
+	// Interval is the period over which shapes are measured, default 5m
+	Interval Duration `json:"interval"`
+
+	// MinLogs is the fewest logs an interval needs to be compared,
+	// default 20
+	MinLogs int `json:"min_logs"`
+
+	// MinSamples is the number of intervals learned before shapes are
+	// compared, default 5
+	MinSamples int `json:"min_samples"`
+
+	// Shift is the distance between the learned and current distributions
+	// of field counts or message lengths, from 0 to 1, above which they
+	// are reported, default 0.5
+	Shift float64 `json:"shift"`
+
+	// ParseDrop is the fall in the share of logs parsed without errors
+	// that is reported, default 0.2
+	ParseDrop float64 `json:"parse_drop"`
+
+	Severity string `json:"severity"`
+}
+
+// LevelDrift configures alerting when the mix of log levels of a source
+// shifts, e.g. the share of errors climbing while info logs dry up
+type LevelDrift struct {
+	Enabled bool `json:"enabled"`
+
+	// Interval is the period over which level mixes are measured, default
+	// 1m
+	Interval Duration `json:"interval"`
+
+	// MinLogs is the fewest logs an interval needs to be compared,
+	// default 20
+	MinLogs int `json:"min_logs"`
+
+	// MinSamples is the number of intervals learned before mixes are
+	// compared, default 10
+	MinSamples int `json:"min_samples"`
+
+	// Shift is the distance between the learned and current level mixes,
+	// from 0 to 1, above which they are reported, default 0.3
+	Shift float64 `json:"shift"`
+
+	Severity string `json:"severity"`
+}
+
+// InterArrival configures alerting when the time between consecutive logs
+// of a key departs from its usual distribution, catching retry storms as
+// bursts and stalled consumers as slowdowns
+type InterArrival struct {
+	Enabled bool `json:"enabled"`
+
+	// By are the fields logs are keyed by, default source and template_id
+	By []string `json:"by"`
+
+	// MinSamples is the number of gaps learned before a key is judged,
+	// default 50
+	MinSamples int `json:"min_samples"`
+
+	// Window is the number of recent gaps averaged to judge a key,
+	// default 10
+	Window int `json:"window"`
+
+	// Threshold is how many standard deviations of the learned log gap
+	// the recent gaps must depart by, default 3
+	Threshold float64 `json:"threshold"`
+
+	// MinStall is the shortest silence reported as a stall while no log
+	// arrives, default 1m
+	MinStall Duration `json:"min_stall"`
+
+	// MaxKeys bounds the keys tracked, default 10000
+	MaxKeys int `json:"max_keys"`
+
+	Severity string `json:"severity"`
+}
+
+// Outliers configures outlier detection on numeric fields
+type Outliers struct {
+	Enabled bool `json:"enabled"`
+
+	Fields []OutlierField `json:"fields"`
+}
+
+// OutlierField detects outlying values of one numeric field, such as a
+// latency or a byte count, per key
+type OutlierField struct {
+	Field string `json:"field"`
+
+	// Key is the field values are grouped by, e.g. path; empty groups by
+	// source
+	Key string `json:"key"`
+
+	// Threshold is the robust z-score, based on the median absolute
+	// deviation, beyond which a value is an outlier, default 3.5
+	Threshold float64 `json:"threshold"`
+
+	// Factor additionally requires the value to be this many times above,
+	// or below, the median; 0 disables
+	Factor float64 `json:"factor"`
+
+	// Direction is "high", "low" or "both", default both
+	Direction string `json:"direction"`
+
+	// Window is the number of recent values kept per key, default 200
+	Window int `json:"window"`
+
+	// MinSamples is the number of values seen for a key before it is
+	// scored, default 30
+	MinSamples int `json:"min_samples"`
+
+	// Cooldown is the quiet period of a key after an alert, default 5m
+	Cooldown Duration `json:"cooldown"`
+
+	Severity string `json:"severity"`
+}
+
+// Markov configures learning of the order in which each source's events
+// follow each other, alerting on runs of unlikely transitions
+type Markov struct {
+	Enabled bool `json:"enabled"`
+
+	// Field holds the event state, default template_id; level gives a
+	// coarser model
+	Field string `json:"field"`
+
+	// Key is the field sequences are followed per, default source
+	Key string `json:"key"`
+
+	// Window is the number of transitions scored together, default 20
+	Window int `json:"window"`
+
+	// Threshold is how many standard deviations below its usual
+	// likelihood a window must fall to be reported, default 5
+	Threshold float64 `json:"threshold"`
+
+	// MinWindows is the number of windows learned before scoring,
+	// default 50
+	MinWindows int `json:"min_windows"`
+
+	Severity string `json:"severity"`
+}
+
+// Model configures scoring of logs by a trained anomaly model, such as an
+// isolation forest or autoencoder exported to ONNX, or by an external
+// scoring service
+type Model struct {
+	Name string `json:"name"`
+
+	// Path is the ONNX file. The model takes a float32 tensor of shape
+	// [batch, features] named Input and returns one float32 score per row
+	// in the tensor named Output.
+	Path   string `json:"path"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+
+	// Endpoint, instead of Path, is the address of an external scoring
+	// service speaking the gRPC protocol in proto/scoring.proto. Calls time
+	// out after Timeout (default 2s); after FailureThreshold consecutive
+	// failures (default 5) the service is bypassed for Cooldown (default
+	// 30s).
+	Endpoint         string   `json:"endpoint"`
+	TLS              bool     `json:"tls"`
+	Timeout          Duration `json:"timeout"`
+	FailureThreshold int      `json:"failure_threshold"`
+	Cooldown         Duration `json:"cooldown"`
+
+	// Features map log fields to the columns of the input, in order
+	Features []Feature `json:"features"`
+
+	// Op (gt by default, or lt) and Threshold decide which scores are
+	// anomalous; isolation forests score anomalies low, autoencoders high
+	Op        string  `json:"op"`
+	Threshold float64 `json:"threshold"`
+
+	// BatchSize is the number of logs scored per call, default 64; logs
+	// wait at most a second for a batch to fill
+	BatchSize int `json:"batch_size"`
+
+	Severity string `json:"severity"`
+}
+
+// Feature maps a log field to one or more columns of a feature vector.
+// Transform is value (default), the field as a number; length, the length
+// of its text; one_hot, one column per entry of Values; or hash, Buckets
+// columns one-hot encoding a hash of the value. Default fills in missing
+// or non-numeric values.
+type Feature struct {
+	Field     string   `json:"field"`
+	Transform string   `json:"transform"`
+	Values    []string `json:"values"`
+	Buckets   int      `json:"buckets"`
+	Default   float64  `json:"default"`
+}
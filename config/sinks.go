@@ -0,0 +1,409 @@
+package config
+
+// AlertFormat sets how a sink renders alerts, in place of its built-in
+// format
+type AlertFormat struct {
+	// Template is a Go template executed with the alert, or TemplateFile
+	// a file holding one
+	Template     string `json:"template"`
+	TemplateFile string `json:"template_file"`
+
+	// HTML executes the template as an HTML template, escaping the alert
+	// fields it inserts
+	HTML bool `json:"html"`
+}
+
+// PagerDuty configures the PagerDuty Events API v2 sink
+type PagerDuty struct {
+	Enabled bool `json:"enabled"`
+
+	// RoutingKey is the integration key of the PagerDuty service
+	RoutingKey string `json:"routing_key"`
+
+	// URL is the Events API endpoint, e.g. the EU one; default the US one
+	URL string `json:"url"`
+
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders the summary of incidents
+	AlertFormat
+}
+
+// Route sends the alerts of some severities, rules and labels to a set of
+// sinks
+type Route struct {
+	// Severities lists the severities routed, or MinSeverity the lowest;
+	// default all
+	Severities  []string `json:"severities"`
+	MinSeverity string   `json:"min_severity"`
+
+	// Rules lists the rules routed, by name or ID, as glob patterns such as
+	// pci-*; default all
+	Rules []string `json:"rules"`
+
+	// Labels routes the alerts of rules with these labels, as glob
+	// patterns of their values; default all
+	Labels map[string]string `json:"labels"`
+
+	// Stop keeps alerts this route matches from the routes after it
+	Stop bool `json:"stop"`
+
+	// Sinks names the sinks alerts are delivered to: pagerduty, email,
+	// discord, kafka, nats, sqs, sns, snmp, file for the output file, or
+	// the name of a webhook, command or file
+	Sinks []string `json:"sinks"`
+}
+
+// Digest batches the alerts of some sinks into one grouped notification
+// per window
+type Digest struct {
+	// Sinks names the sinks receiving digests, as in routes
+	Sinks []string `json:"sinks"`
+
+	// Window is how often a digest is sent, default 15m, or earlier once
+	// MaxAlerts (default 100) alerts are collected
+	Window    Duration `json:"window"`
+	MaxAlerts int      `json:"max_alerts"`
+
+	// MaxSeverity is the highest severity collected; more severe alerts
+	// are sent on their own right away. Default all.
+	MaxSeverity string `json:"max_severity"`
+}
+
+// File configures a file alerts are appended to besides the output file
+type File struct {
+	// Name identifies the file in routes
+	Name string `json:"name"`
+
+	Path string `json:"path"`
+
+	// Format is compact, JSON Lines (the default), or pretty, indented
+	// JSON
+	Format string `json:"format"`
+
+	// AlertFormat renders the lines written instead
+	AlertFormat
+
+	Rotation Rotation `json:"rotation"`
+}
+
+// Rotation configures the rotation of an alert file. The file is rotated
+// once it reaches MaxSize or every Interval, whichever comes first; without
+// either it grows forever.
+type Rotation struct {
+	// MaxSize is the size in megabytes a file is rotated at
+	MaxSize int `json:"max_size"`
+
+	// Interval is how long a file is written to before it is rotated
+	Interval Duration `json:"interval"`
+
+	// MaxBackups is the number of rotated files kept and MaxAge how long
+	// they are kept; default all, forever
+	MaxBackups int      `json:"max_backups"`
+	MaxAge     Duration `json:"max_age"`
+
+	// Compress gzips rotated files
+	Compress bool `json:"compress"`
+}
+
+// Webhook configures a sink sending alerts to an HTTP endpoint
+type Webhook struct {
+	// Name identifies the webhook in logs, default its URL
+	Name string `json:"name"`
+
+	URL string `json:"url"`
+
+	// Method is the HTTP method, default POST
+	Method string `json:"method"`
+
+	Headers map[string]string `json:"headers"`
+
+	// Body is a Go template of the request body, executed with the alert;
+	// default the alert as JSON
+	Body string `json:"body"`
+
+	// Secret signs request bodies with HMAC-SHA256, sent in the
+	// X-Argos-Signature header as sha256=<hex digest>
+	Secret string `json:"secret"`
+
+	Timeout Duration `json:"timeout"`
+}
+
+// Command configures a sink running a command for every alert, with the
+// alert as JSON on its standard input
+type Command struct {
+	// Name identifies the command in logs, default the program
+	Name string `json:"name"`
+
+	// Command is the program and its arguments, run without a shell
+	Command []string `json:"command"`
+
+	// Env lists the environment variables passed on to the command besides
+	// PATH; no others are
+	Env []string `json:"env"`
+
+	// Concurrency bounds the commands running at once, default 4
+	Concurrency int `json:"concurrency"`
+
+	// Timeout bounds each run, default 30s, after which the command is
+	// killed
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders the standard input of the command, default JSON
+	AlertFormat
+}
+
+// Email configures a sink mailing alerts through an SMTP server
+type Email struct {
+	Enabled bool `json:"enabled"`
+
+	// Host and Port are the SMTP server, port default 587
+	Host string `json:"host"`
+	Port int    `json:"port"`
+
+	// TLS is starttls, tls for implicit TLS, or none; default starttls,
+	// or tls on port 465
+	TLS string `json:"tls"`
+
+	// Username and Password authenticate with PLAIN auth when set
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	From string   `json:"from"`
+	To   []string `json:"to"`
+
+	// BatchWindow collects the alerts of this long into one email, sent
+	// early once MaxBatch (default 100) alerts are collected; zero mails
+	// every alert on its own
+	BatchWindow Duration `json:"batch_window"`
+	MaxBatch    int      `json:"max_batch"`
+
+	// Template is a file holding an HTML template of the email body,
+	// executed with the alerts; default a table of them
+	Template string `json:"template"`
+
+	Timeout Duration `json:"timeout"`
+}
+
+// Discord configures a sink posting alerts to a Discord channel
+type Discord struct {
+	Enabled bool `json:"enabled"`
+
+	// WebhookURL is the webhook of the channel
+	WebhookURL string `json:"webhook_url"`
+
+	// Username is the name messages are posted under, default Argos
+	Username string `json:"username"`
+
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders the description of embeds, default the log
+	// message
+	AlertFormat
+}
+
+// Kafka configures a sink publishing alerts to a Kafka topic
+type Kafka struct {
+	Enabled bool `json:"enabled"`
+
+	// Brokers are the host:port addresses metadata is fetched from
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+
+	// Key is what records are keyed, and so partitioned, by: fingerprint
+	// (default), source, rule or none
+	Key string `json:"key"`
+
+	// Format is json (default) or avro
+	Format string `json:"format"`
+
+	// SchemaRegistry is the URL of a schema registry the Avro schema is
+	// registered with, framing records in the registry wire format
+	SchemaRegistry string `json:"schema_registry"`
+
+	// Acks is the acknowledgement waited for: leader (default), all in-sync
+	// replicas, or none
+	Acks string `json:"acks"`
+
+	// TLS connects to the brokers over TLS
+	TLS bool `json:"tls"`
+
+	ClientID string `json:"client_id"`
+
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders record values in place of Format
+	AlertFormat
+}
+
+// NATS configures a sink publishing alerts to NATS
+type NATS struct {
+	Enabled bool `json:"enabled"`
+
+	// URL is the server, or a comma separated list of servers, default
+	// nats://127.0.0.1:4222
+	URL string `json:"url"`
+
+	// Subject is a Go template of the subject an alert is published on,
+	// default argos.alerts.{{lower .Severity}}.{{token .Reason}}
+	Subject string `json:"subject"`
+
+	// Credentials is a credentials file; Token, or Username and Password,
+	// authenticate otherwise
+	Credentials string `json:"credentials"`
+	Token       string `json:"token"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders the messages published, default JSON
+	AlertFormat
+}
+
+// SQS configures a sink sending alerts to an SQS queue. Credentials come
+// from the default AWS credential chain: the environment, shared
+// configuration files, and instance or task roles.
+type SQS struct {
+	Enabled bool `json:"enabled"`
+
+	// QueueURL is the queue; queues whose URL ends in .fifo get alerts
+	// grouped by fingerprint
+	QueueURL string `json:"queue_url"`
+
+	// Region defaults to the one of the AWS configuration, and Endpoint
+	// overrides the service endpoint, e.g. for LocalStack
+	Region   string `json:"region"`
+	Endpoint string `json:"endpoint"`
+
+	// BatchSize (at most and by default 10) alerts are sent per request,
+	// at least every BatchWindow, default 1s
+	BatchSize   int      `json:"batch_size"`
+	BatchWindow Duration `json:"batch_window"`
+
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders message bodies, default JSON
+	AlertFormat
+}
+
+// SNS configures a sink publishing alerts to an SNS topic, with the same
+// credentials and batching as SQS
+type SNS struct {
+	Enabled bool `json:"enabled"`
+
+	TopicARN string `json:"topic_arn"`
+
+	Region   string `json:"region"`
+	Endpoint string `json:"endpoint"`
+
+	BatchSize   int      `json:"batch_size"`
+	BatchWindow Duration `json:"batch_window"`
+
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders messages, default JSON
+	AlertFormat
+}
+
+// SNMP configures a sink sending alerts as SNMP traps of the Argos MIB
+type SNMP struct {
+	Enabled bool `json:"enabled"`
+
+	// Target is the host and port of the trap receiver, port 162 by
+	// default
+	Target string `json:"target"`
+
+	// Version is 2c (the default) or 1, and Community defaults to public
+	Version   string `json:"version"`
+	Community string `json:"community"`
+
+	// Inform sends v2c informs, which the receiver acknowledges, instead of
+	// traps; unacknowledged informs are retried Retries times
+	Inform  bool `json:"inform"`
+	Retries int  `json:"retries"`
+
+	// OID is the root of the Argos MIB, to use when the MIB is placed
+	// under an enterprise of your own
+	OID string `json:"oid"`
+
+	// AgentAddress is the agent address of v1 traps, default the local
+	// address traps are sent from
+	AgentAddress string `json:"agent_address"`
+
+	Timeout Duration `json:"timeout"`
+
+	// AlertFormat renders the argosAlertMessage object, default the log
+	// message
+	AlertFormat
+}
+
+// Database configures a sink storing alerts in SQLite or PostgreSQL, for a
+// durable and queryable alert history
+type Database struct {
+	Enabled bool `json:"enabled"`
+
+	// Driver is sqlite (the default) or postgres
+	Driver string `json:"driver"`
+
+	// DSN is the path of the SQLite database, or the connection string of
+	// the PostgreSQL one
+	DSN string `json:"dsn"`
+
+	// BatchSize alerts, default 100, are written per transaction, at least
+	// every BatchWindow, default 1s
+	BatchSize   int      `json:"batch_size"`
+	BatchWindow Duration `json:"batch_window"`
+
+	Timeout Duration `json:"timeout"`
+}
+
+// ClickHouse configures a sink inserting alerts into a ClickHouse table in
+// large batches, for high-volume alert history
+type ClickHouse struct {
+	Enabled bool `json:"enabled"`
+
+	// URL is the HTTP interface of the server, default
+	// http://localhost:8123
+	URL string `json:"url"`
+
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Database defaults to default and Table to argos_alerts; the table is
+	// created if missing
+	Database string `json:"database"`
+	Table    string `json:"table"`
+
+	// BatchSize alerts, default 10000, are inserted per request, at least
+	// every BatchWindow, default 5s
+	BatchSize   int      `json:"batch_size"`
+	BatchWindow Duration `json:"batch_window"`
+
+	Timeout Duration `json:"timeout"`
+}
+
+// S3 configures a sink archiving alerts to S3 as gzipped JSON Lines
+// objects, partitioned by date and hour
+type S3 struct {
+	Enabled bool `json:"enabled"`
+
+	Bucket string `json:"bucket"`
+
+	// Prefix starts the keys of objects, default argos/alerts
+	Prefix string `json:"prefix"`
+
+	// Region defaults to the one of the AWS configuration, and Endpoint
+	// overrides the service endpoint, e.g. for MinIO; PathStyle puts the
+	// bucket in the path of URLs rather than the host name
+	Region    string `json:"region"`
+	Endpoint  string `json:"endpoint"`
+	PathStyle bool   `json:"path_style"`
+
+	// FlushInterval is how often collected alerts are written, default 5m,
+	// or as soon as MaxAlerts, default 10000, are collected
+	FlushInterval Duration `json:"flush_interval"`
+	MaxAlerts     int      `json:"max_alerts"`
+
+	Timeout Duration `json:"timeout"`
+}
@@ -16,8 +16,16 @@ type LogEntry struct {
 	Level     string `json:"level"`
 	Source    string `json:"source"`
 	Message   string `json:"message"`
+	
+	// Tenant is the team or customer the log belongs to, set by the sender
+	// or by the X-Argos-Tenant header of HTTP requests
+	Tenant string `json:"tenant,omitempty"`
 }
 
+// tenantHeader tags HTTP logs with a tenant, taking precedence over the
+// tenant in the body so that an authenticating proxy can enforce it
+const tenantHeader = "X-Argos-Tenant"
+
 // Ingestor handles incoming log data via HTTP and TCP
 type Ingestor struct {
 	logChan    chan<- LogEntry
@@ -85,6 +93,9 @@ func (i *Ingestor) handleHTTPLogs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if tenant := r.Header.Get(tenantHeader); tenant != "" {
+		entry.Tenant = tenant
+	}
 	
 	select {
 	case i.logChan <- entry:
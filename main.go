@@ -1,13 +1,21 @@
 package main
 
 import (
+	"expvar"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/davidharvith/argos/admin"
 	"github.com/davidharvith/argos/alerter"
 	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/config"
 	"github.com/davidharvith/argos/ingestor"
 	"github.com/davidharvith/argos/parser"
 )
@@ -19,31 +27,127 @@ const (
 	alertBufferSize   = 100
 	
 	// Server ports
-	httpPort = "8080"
-	tcpPort  = "9090"
+	httpPort  = "8080"
+	tcpPort   = "9090"
+	adminPort = "8081"
+	adminAddr = "127.0.0.1:" + adminPort
 	
 	// Worker configuration
 	parserWorkers = 4
 	
 	// Output configuration
 	alertOutputFile = "alerts.json"
+	
+	// Rules disabled at runtime, when not configured
+	defaultRuleOverridesFile = "rule_overrides.json"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rules":
+			os.Exit(rulesCommand(os.Args[2:]))
+		case "test-rules":
+			os.Exit(testRulesCommand(os.Args[2:]))
+		case "backtest":
+			os.Exit(backtestCommand(os.Args[2:]))
+		}
+	}
+	
+	configPath := flag.String("config", "", "path to JSON configuration file")
+	consoleFormat := flag.String("console", "", "console alert format: pretty, compact, line or none (overrides the configuration)")
+	consoleSeverity := flag.String("console-min-severity", "", "least severity of alerts printed to the console")
+	consoleColor := flag.String("color", "", "color severities on the console: auto, always or never")
+	quiet := flag.Bool("quiet", false, "print no alerts to the console, same as -console none")
+	flag.Parse()
+	
 	log.Println("Starting Argos - Real-time Log Anomaly Detector")
 	
+	cfg := &config.Config{}
+	if *configPath != "" {
+		var err error
+		cfg, err = config.Load(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+	}
+	if *consoleFormat != "" {
+		cfg.Alerter.Console = *consoleFormat
+	}
+	if *quiet {
+		cfg.Alerter.Console = "none"
+	}
+	if *consoleSeverity != "" {
+		cfg.Alerter.ConsoleMinSeverity = *consoleSeverity
+	}
+	if *consoleColor != "" {
+		cfg.Alerter.ConsoleColor = *consoleColor
+	}
+	
 	// Create buffered channels for data flow pipeline
 	ingestChan := make(chan ingestor.LogEntry, ingestBufferSize)
-	parseChan := make(chan parser.ParsedLog, parseBufferSize)
+	parseChan := make(chan []parser.ParsedLog, parseBufferSize)
 	alertChan := make(chan analyzer.Alert, alertBufferSize)
 	
+	publishQueues(ingestChan, parseChan, alertChan)
+	
 	// Initialize components
 	ing := ingestor.NewIngestor(ingestChan, httpPort, tcpPort)
 	prs := parser.NewParser(ingestChan, parseChan, parserWorkers)
-	anl := analyzer.NewAnalyzer(parseChan, alertChan)
+	if err := configureParser(prs, cfg.Parser); err != nil {
+		log.Fatalf("Failed to configure parser: %v", err)
+	}
+	if cfg.Parser.BatchSize > 1 {
+		prs.SetBatching(cfg.Parser.BatchSize, time.Duration(cfg.Parser.BatchLinger))
+	}
+	if cfg.Parser.DedupWindow > 0 {
+		prs.EnableDedup(time.Duration(cfg.Parser.DedupWindow))
+	}
+	if err := analyzer.LoadKeywordLists(cfg.Analyzer.KeywordLists); err != nil {
+		log.Fatalf("Failed to load keyword lists: %v", err)
+	}
+	anl, err := analyzer.NewTenants(parseChan, func(tenant string, input <-chan []parser.ParsedLog) (*analyzer.Analyzer, error) {
+		return newAnalyzer(cfg.Analyzer, tenant, input, alertChan)
+	}, cfg.Analyzer.Tenants)
+	if err != nil {
+		log.Fatalf("Failed to create analyzer: %v", err)
+	}
 	alt := alerter.NewAlerter(alertChan, alertOutputFile)
+	alt.SetFeedback(anl.RecordFeedback)
+	if err := alt.ConfigureSinks(cfg.Alerter); err != nil {
+		log.Fatalf("Failed to configure alerter: %v", err)
+	}
+	if cfg.Alerter.Dedup.Enabled {
+		if err := alt.SetDedup(cfg.Alerter.Dedup); err != nil {
+			log.Fatalf("Failed to configure alerter: %v", err)
+		}
+	}
+	if cfg.Admin.Addr == "" {
+		cfg.Admin.Addr = adminAddr
+	}
+	adm := admin.NewServer(cfg.Admin.Addr, cfg.Admin.Token)
+	adm.HandleFunc("/api/rules", anl.Handle((*analyzer.Analyzer).HandleListRules))
+	adm.HandleFunc("/api/rules/reload", anl.Handle((*analyzer.Analyzer).HandleReloadRules))
+	adm.HandleFunc("/api/rules/{id}/{action}", anl.Handle((*analyzer.Analyzer).HandleToggleRule))
+	adm.HandleFunc("/api/stats/topk", anl.Handle((*analyzer.Analyzer).HandleTopK))
+	adm.HandleFunc("/api/stats/percentiles", anl.Handle((*analyzer.Analyzer).HandlePercentiles))
+	adm.HandleFunc("/api/stats/rules", anl.Handle((*analyzer.Analyzer).HandleRuleStats))
+	adm.HandleFunc("/api/maintenance", anl.Handle((*analyzer.Analyzer).HandleMaintenance))
+	adm.HandleFunc("/api/incidents", anl.Handle((*analyzer.Analyzer).HandleIncidents))
+	adm.HandleFunc("/api/incidents/{id}", anl.Handle((*analyzer.Analyzer).HandleIncident))
+	adm.HandleFunc("/api/debug", anl.Handle((*analyzer.Analyzer).HandleDebug))
+	adm.HandleFunc("/api/alerts", alt.HandleAlerts)
+	adm.HandleFunc("/api/alerts/states", alt.HandleAlertStates)
+	adm.HandleFunc("/api/alerts/{id}", alt.HandleAlertState)
+	adm.HandleFunc("/api/alerts/{id}/{action}", alt.HandleAlertAction)
+	adm.HandleFunc("/api/silences", alt.HandleSilences)
+	adm.HandleFunc("/api/silences/{id}", alt.HandleSilence)
 	
 	// Start all components
+	if err := adm.Start(); err != nil {
+		log.Fatalf("Failed to start admin server: %v", err)
+	}
+	
 	if err := ing.Start(); err != nil {
 		log.Fatalf("Failed to start ingestor: %v", err)
 	}
@@ -51,6 +155,11 @@ func main() {
 	prs.Start()
 	anl.Start()
 	
+	stopKeywords := make(chan struct{})
+	if len(cfg.Analyzer.KeywordLists) > 0 {
+		go analyzer.WatchKeywordLists(stopKeywords)
+	}
+	
 	if err := alt.Start(); err != nil {
 		log.Fatalf("Failed to start alerter: %v", err)
 	}
@@ -58,16 +167,33 @@ func main() {
 	log.Println("Argos is running. Press Ctrl+C to stop.")
 	log.Printf("HTTP endpoint: http://localhost:%s/logs", httpPort)
 	log.Printf("TCP endpoint: localhost:%s", tcpPort)
-	log.Printf("Alerts output: %s", alertOutputFile)
+	if cfg.Alerter.Output != "none" {
+		log.Printf("Alerts output: %s", alertOutputFile)
+	}
+	log.Printf("Metrics: http://%s/debug/vars", cfg.Admin.Addr)
 	
-	// Wait for shutdown signal
+	// Wait for shutdown signal, reloading rules and the service catalog on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if err := analyzer.ReloadKeywordLists(); err != nil {
+			log.Printf("Keyword list reload failed, keeping current words: %v", err)
+		}
+		if err := anl.ReloadRules(); err != nil {
+			log.Printf("Rules reload failed, keeping current rules: %v", err)
+		}
+		if err := alt.ReloadCatalog(); err != nil {
+			log.Printf("Service catalog reload failed, keeping current services: %v", err)
+		}
+	}
 	
 	log.Println("\nShutting down gracefully...")
 	
 	// Stop components in reverse order
+	close(stopKeywords)
 	ing.Stop()
 	close(ingestChan)
 	
@@ -79,5 +205,134 @@ func main() {
 	
 	alt.Stop()
 	
+	adm.Stop()
+	
 	log.Println("Argos stopped successfully")
 }
+
+// configureParser applies the parsing settings shared by the pipeline and
+// the offline commands
+func configureParser(prs *parser.Parser, cfg config.Parser) error {
+	stages, err := parser.LoadStages(cfg.Stages)
+	if err != nil {
+		return fmt.Errorf("failed to load parser stages: %w", err)
+	}
+	for _, stage := range stages {
+		prs.AddStage(stage)
+	}
+	if err := prs.SetComputedFields(cfg.ComputedFields); err != nil {
+		return fmt.Errorf("failed to compile computed fields: %w", err)
+	}
+	prs.SetPayloadDecoding(cfg.DecodePayloads)
+	if cfg.GeoIPFile != "" {
+		geoip, err := parser.LoadGeoIP(cfg.GeoIPFile)
+		if err != nil {
+			return fmt.Errorf("failed to load GeoIP database: %w", err)
+		}
+		prs.SetGeoIP(geoip)
+	}
+	return nil
+}
+
+// newAnalyzer creates the analyzer of a tenant from configuration. Tenants
+// keep rule overrides and state in files of their own, named after the
+// configured ones with the tenant inserted before the extension.
+func newAnalyzer(cfg config.Analyzer, tenant string, input <-chan []parser.ParsedLog, alertChan chan<- analyzer.Alert) (*analyzer.Analyzer, error) {
+	anl := analyzer.NewAnalyzer(input, alertChan)
+	anl.SetScoring(cfg.Scoring)
+	anl.SetWorkers(cfg.Workers, cfg.ShardKey)
+	if err := anl.SetMaintenance(cfg.Maintenance); err != nil {
+		return nil, err
+	}
+	if cfg.DedupWindow > 0 {
+		anl.EnableDedup(time.Duration(cfg.DedupWindow), time.Duration(cfg.DedupUpdate))
+	}
+	if cfg.SuppressTTL > 0 {
+		anl.EnableSuppression(time.Duration(cfg.SuppressTTL))
+	}
+	if cfg.Sampling.Enabled {
+		anl.EnableSampling(cfg.Sampling)
+	}
+	if cfg.Incidents.Enabled {
+		anl.EnableIncidents(cfg.Incidents)
+	}
+	if cfg.Summary.Enabled {
+		anl.EnableSummary(cfg.Summary)
+	}
+	if err := anl.ConfigureDetectors(cfg); err != nil {
+		return nil, fmt.Errorf("failed to configure detectors: %w", err)
+	}
+	rules, err := configuredRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.RulePacks) > 0 {
+		anl.SetRules(nil)
+	}
+	if len(rules) > 0 {
+		if err := anl.SetConfigRules(rules); err != nil {
+			return nil, err
+		}
+	}
+	rulesFile := cfg.RulesFile
+	if file, ok := cfg.Tenants.Rules[tenant]; ok {
+		rulesFile = file
+	}
+	if rulesFile != "" {
+		if err := anl.LoadRulesFile(rulesFile); err != nil {
+			return nil, fmt.Errorf("failed to load rules: %w", err)
+		}
+	}
+	overridesFile := cfg.OverridesFile
+	if overridesFile == "" {
+		overridesFile = defaultRuleOverridesFile
+	}
+	if err := anl.LoadRuleOverrides(tenantFile(overridesFile, tenant)); err != nil {
+		return nil, fmt.Errorf("failed to load rule overrides: %w", err)
+	}
+	if cfg.StateFile != "" {
+		if err := anl.EnableState(tenantFile(cfg.StateFile, tenant), time.Duration(cfg.StateInterval)); err != nil {
+			return nil, fmt.Errorf("failed to restore analyzer state: %w", err)
+		}
+	}
+	return anl, nil
+}
+
+// configuredRules compiles the rule packs and match rules enabled in the
+// configuration
+func configuredRules(cfg config.Analyzer) ([]analyzer.Rule, error) {
+	rules, err := analyzer.LoadRulePacks(cfg.RulePacks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rule packs: %w", err)
+	}
+	if len(cfg.Rules) > 0 {
+		matchRules, err := analyzer.CompileMatchRules(cfg.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile configured rules: %w", err)
+		}
+		rules = append(rules, matchRules...)
+	}
+	return rules, nil
+}
+
+// tenantFile returns the file a tenant keeps in place of path, e.g.
+// state.acme.json for state.json
+func tenantFile(path, tenant string) string {
+	if tenant == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + tenant + ext
+}
+
+// publishQueues exposes the occupancy of the pipeline channels at
+// /debug/vars under "queues", showing which stage is falling behind
+func publishQueues(ingestChan chan ingestor.LogEntry, parseChan chan []parser.ParsedLog, alertChan chan analyzer.Alert) {
+	expvar.Publish("queues", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"ingest": map[string]int{"length": len(ingestChan), "capacity": cap(ingestChan)},
+			"parse":  map[string]int{"length": len(parseChan), "capacity": cap(parseChan)},
+			"alert":  map[string]int{"length": len(alertChan), "capacity": cap(alertChan)},
+		}
+	}))
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultBatchLinger is used when batching is enabled without a linger time,
+// so partial batches are still flushed
+const defaultBatchLinger = 50 * time.Millisecond
+
+// batcher groups parsed logs into slices so the analyzer receives one
+// channel operation per batch instead of per entry
+type batcher struct {
+	size     int
+	linger   time.Duration
+	out      chan<- []ParsedLog
+	shutdown <-chan struct{}
+	mu       sync.Mutex
+	batch    []ParsedLog
+}
+
+// newBatcher creates a new batcher
+func newBatcher(out chan<- []ParsedLog, shutdown <-chan struct{}, size int, linger time.Duration) *batcher {
+	if size < 1 {
+		size = 1
+	}
+	return &batcher{
+		size:     size,
+		linger:   linger,
+		out:      out,
+		shutdown: shutdown,
+		batch:    make([]ParsedLog, 0, size),
+	}
+}
+
+// add appends a log and sends the batch once it is full. It returns false
+// if the parser is shutting down.
+func (b *batcher) add(log ParsedLog) bool {
+	b.mu.Lock()
+	b.batch = append(b.batch, log)
+	if len(b.batch) < b.size {
+		b.mu.Unlock()
+		return true
+	}
+	batch := b.take()
+	b.mu.Unlock()
+
+	return b.send(batch)
+}
+
+// push appends a log without sending, for use during shutdown
+func (b *batcher) push(log ParsedLog) {
+	b.mu.Lock()
+	b.batch = append(b.batch, log)
+	b.mu.Unlock()
+}
+
+// flush sends the current partial batch, if any
+func (b *batcher) flush() bool {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return true
+	}
+	return b.send(batch)
+}
+
+// drain hands over the current partial batch without blocking
+func (b *batcher) drain() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	select {
+	case b.out <- batch:
+	default:
+	}
+}
+
+// take swaps out the current batch; callers must hold mu
+func (b *batcher) take() []ParsedLog {
+	batch := b.batch
+	b.batch = make([]ParsedLog, 0, b.size)
+	return batch
+}
+
+// send delivers a batch downstream, returning false on shutdown
+func (b *batcher) send(batch []ParsedLog) bool {
+	select {
+	case b.out <- batch:
+		return true
+	case <-b.shutdown:
+		return false
+	}
+}
+
+// SetBatching configures how parsed logs are grouped before being handed
+// to the analyzer: a batch is sent once it holds size entries or once
+// linger has passed. A size of 1 disables batching and a linger of zero or
+// less uses the default. It must be called before Start.
+func (p *Parser) SetBatching(size int, linger time.Duration) {
+	if linger <= 0 {
+		linger = defaultBatchLinger
+	}
+	p.batcher = newBatcher(p.outputChan, p.shutdown, size, linger)
+}
+
+// flushBatches periodically sends partial batches older than the linger time
+func (p *Parser) flushBatches() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.batcher.linger)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !p.batcher.flush() {
+				return
+			}
+		case <-p.shutdown:
+			p.batcher.drain()
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidharvith/argos/ingestor"
+)
+
+// batchSizes compares per-entry handoff (1) with batched handoff
+var batchSizes = []int{1, 64, 512}
+
+// BenchmarkBatcherHandoff measures the handoff of parsed logs to a
+// consumer alone, per entry and in batches
+func BenchmarkBatcherHandoff(b *testing.B) {
+	entry := ParsedLog{Level: "INFO", Source: "web-1", Message: "GET /index.html 200"}
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			out := make(chan []ParsedLog, 1000)
+			shutdown := make(chan struct{})
+			batcher := newBatcher(out, shutdown, size, 0)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for batch := range out {
+					_ = batch
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batcher.add(entry)
+			}
+			batcher.flush()
+			close(out)
+			wg.Wait()
+		})
+	}
+}
+
+// BenchmarkParserBatching measures the parser pipeline, from ingested
+// entries to batches received downstream, with each batch size
+func BenchmarkParserBatching(b *testing.B) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	entry := ingestor.LogEntry{
+		Timestamp: "2024-05-01T12:00:00Z",
+		Level:     "ERROR",
+		Source:    "web-1",
+		Message:   "request failed status=502 client=10.0.0.7 path=/api/orders latency_ms=412",
+	}
+	for _, size := range batchSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			in := make(chan ingestor.LogEntry, 1000)
+			out := make(chan []ParsedLog, 1000)
+			p := NewParser(in, out, 4)
+			p.SetBatching(size, 10*time.Millisecond)
+			p.Start()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				received := 0
+				for received < b.N {
+					received += len(<-out)
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				in <- entry
+			}
+			<-done
+			b.StopTimer()
+			p.Stop()
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// computedField is a derived field evaluated from an expression per entry
+type computedField struct {
+	name string
+	expr *Expr
+}
+
+// SetComputedFields compiles derived field definitions. Keys name the target
+// field (an optional "fields." prefix is ignored) and values are expressions.
+// Fields are evaluated after the computed fields they refer to, so their
+// definitions must not refer to each other in a cycle.
+func (p *Parser) SetComputedFields(defs map[string]string) error {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pending := make(map[string]computedField, len(names))
+	for _, name := range names {
+		expr, err := CompileExpr(defs[name])
+		if err != nil {
+			return fmt.Errorf("computed field %s: %w", name, err)
+		}
+		field := computedField{name: strings.TrimPrefix(name, "fields."), expr: expr}
+		pending[field.name] = field
+	}
+
+	// Place the fields whose computed references are all placed, in name
+	// order, until none are left or the rest depend on each other
+	computed := make([]computedField, 0, len(pending))
+	for len(pending) > 0 {
+		placed := false
+		for _, name := range names {
+			field, ok := pending[strings.TrimPrefix(name, "fields.")]
+			if !ok || !computedReady(field, pending) {
+				continue
+			}
+			computed = append(computed, field)
+			delete(pending, field.name)
+			placed = true
+		}
+		if !placed {
+			cycle := make([]string, 0, len(pending))
+			for name := range pending {
+				cycle = append(cycle, name)
+			}
+			sort.Strings(cycle)
+			return fmt.Errorf("computed fields %s refer to each other in a cycle", strings.Join(cycle, ", "))
+		}
+	}
+
+	p.computed = computed
+	return nil
+}
+
+// computedReady reports whether a computed field refers to none of the
+// pending ones but itself, which refers to the field's value before it
+// is computed
+func computedReady(field computedField, pending map[string]computedField) bool {
+	for _, ident := range field.expr.Identifiers() {
+		name, ok := computedRef(ident)
+		if !ok || name == field.name {
+			continue
+		}
+		if _, waiting := pending[name]; waiting {
+			return false
+		}
+	}
+	return true
+}
+
+// computedRef returns the field of Fields an identifier refers to, if it
+// does not name a built-in field
+func computedRef(ident string) (string, bool) {
+	if name, ok := strings.CutPrefix(ident, "fields."); ok {
+		return name, true
+	}
+	if _, builtin := (&ParsedLog{}).Lookup(ident); builtin {
+		return "", false
+	}
+	return ident, true
+}
+
+// applyComputedFields evaluates every computed field into Fields. Fields
+// whose expression has no value, such as when the fields it refers to are
+// missing, are left unset.
+func (p *Parser) applyComputedFields(parsed *ParsedLog) {
+	for _, field := range p.computed {
+		value, err := field.expr.EvalLog(parsed)
+		if err != nil {
+			p.parseError(parsed, errExtraction, fmt.Sprintf("computed field %s: %v", field.name, err))
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		parsed.Fields[field.name] = value
+	}
+}
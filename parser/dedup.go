@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxDedupPending bounds the messages the deduper tracks at once; when it
+// is full, the repeats folded so far are flushed early to make room
+const maxDedupPending = 100000
+
+// pendingLog is a message seen by the deduper within its window, with the
+// repeats folded into it since its first occurrence was emitted
+type pendingLog struct {
+	log      ParsedLog
+	first    time.Time
+	repeated bool
+}
+
+// deduper collapses identical messages from the same source and tenant
+// within a window: the first occurrence passes at once, and the repeats
+// that follow it are emitted as one entry when the window closes
+type deduper struct {
+	window  time.Duration
+	mu      sync.Mutex
+	pending map[uint64]*pendingLog
+}
+
+// newDeduper creates a new deduper
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{
+		window:  window,
+		pending: make(map[uint64]*pendingLog),
+	}
+}
+
+// add records a log and returns the logs to emit now: the log itself when
+// it is the first occurrence of its tenant, source and message, preceded by
+// the repeats flushed early when too many messages are tracked. A repeat is
+// folded into its pending entry and nothing is returned.
+func (d *deduper) add(log ParsedLog) []ParsedLog {
+	h := fnv.New64a()
+	h.Write([]byte(log.Tenant))
+	h.Write([]byte{0})
+	h.Write([]byte(log.Source))
+	h.Write([]byte{0})
+	h.Write([]byte(log.Message))
+	key := h.Sum64()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if p, ok := d.pending[key]; ok {
+		if p.repeated {
+			p.log.RepeatCount += log.RepeatCount
+		} else {
+			p.log, p.repeated = log, true
+		}
+		return nil
+	}
+
+	var logs []ParsedLog
+	if len(d.pending) >= maxDedupPending {
+		logs = d.take(time.Time{})
+	}
+	d.pending[key] = &pendingLog{log: log, first: time.Now()}
+	return append(logs, log)
+}
+
+// expired removes the entries whose window closed before now and returns
+// their folded repeats, oldest first. A zero time returns everything.
+func (d *deduper) expired(now time.Time) []ParsedLog {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.take(now)
+}
+
+// take removes the entries whose window closed before now, or all of them
+// for a zero time, and returns those that were repeated, oldest first;
+// callers must hold mu
+func (d *deduper) take(now time.Time) []ParsedLog {
+	var ready []*pendingLog
+	for key, p := range d.pending {
+		if now.IsZero() || now.Sub(p.first) >= d.window {
+			if p.repeated {
+				ready = append(ready, p)
+			}
+			delete(d.pending, key)
+		}
+	}
+
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].first.Before(ready[j].first)
+	})
+
+	logs := make([]ParsedLog, len(ready))
+	for i, p := range ready {
+		logs[i] = p.log
+	}
+	return logs
+}
+
+// EnableDedup turns on deduplication of identical messages per source
+// within the given window. It must be called before Start.
+func (p *Parser) EnableDedup(window time.Duration) {
+	p.dedup = newDeduper(window)
+}
+
+// flushDedup periodically emits the repeats of messages whose dedup window
+// has closed
+func (p *Parser) flushDedup() {
+	defer p.wg.Done()
+
+	// A window under 2ns would make the interval zero, which NewTicker rejects
+	ticker := time.NewTicker(max(p.dedup.window/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, log := range p.dedup.expired(now) {
+				if !p.emit(log) {
+					return
+				}
+			}
+		case <-p.shutdown:
+			// Best effort: hand over what is still pending without blocking
+			for _, log := range p.dedup.expired(time.Time{}) {
+				p.batcher.push(log)
+			}
+			p.batcher.drain()
+			return
+		}
+	}
+}
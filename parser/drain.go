@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// wildcard marks a variable position in a template
+	wildcard = "<*>"
+
+	// Drain tuning parameters
+	drainDepth       = 4
+	drainSimilarity  = 0.5
+	drainMaxChildren = 100
+)
+
+// logCluster is a group of messages sharing one template
+type logCluster struct {
+	id       string
+	template []string
+}
+
+// drainNode is a node in the fixed-depth Drain parse tree
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*logCluster
+}
+
+// Drain performs online log template extraction using the Drain algorithm.
+// Messages are routed through a fixed-depth tree keyed by token count and
+// leading tokens, then matched against the clusters at the leaf by token
+// similarity. Differing tokens are generalized to wildcards.
+type Drain struct {
+	root        *drainNode
+	depth       int
+	similarity  float64
+	maxChildren int
+	mu          sync.Mutex
+}
+
+// NewDrain creates a new Drain template miner
+func NewDrain(depth int, similarity float64, maxChildren int) *Drain {
+	return &Drain{
+		root:        &drainNode{children: make(map[string]*drainNode)},
+		depth:       depth,
+		similarity:  similarity,
+		maxChildren: maxChildren,
+	}
+}
+
+// Match assigns a message to a template, creating or generalizing clusters
+// as needed. It returns the template ID, the template text and the values
+// found at the template's wildcard positions.
+func (d *Drain) Match(message string) (string, string, []string) {
+	tokens := strings.Fields(message)
+	if len(tokens) == 0 {
+		return "", "", nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	leaf := d.leaf(tokens)
+	cluster := d.bestCluster(leaf, tokens)
+	if cluster == nil {
+		template := make([]string, len(tokens))
+		for i, token := range tokens {
+			if hasDigit(token) {
+				template[i] = wildcard
+			} else {
+				template[i] = token
+			}
+		}
+		cluster = &logCluster{
+			id:       templateID(template),
+			template: template,
+		}
+		leaf.clusters = append(leaf.clusters, cluster)
+	} else {
+		for i, token := range tokens {
+			if cluster.template[i] != token {
+				cluster.template[i] = wildcard
+			}
+		}
+	}
+
+	var variables []string
+	for i, token := range cluster.template {
+		if token == wildcard {
+			variables = append(variables, tokens[i])
+		}
+	}
+
+	return cluster.id, strings.Join(cluster.template, " "), variables
+}
+
+// leaf walks the parse tree for the given tokens, creating nodes on the way
+func (d *Drain) leaf(tokens []string) *drainNode {
+	node := d.child(d.root, fmt.Sprintf("len:%d", len(tokens)))
+
+	for i := 0; i < d.depth-2 && i < len(tokens); i++ {
+		key := tokens[i]
+		if hasDigit(key) {
+			key = wildcard
+		}
+		if _, ok := node.children[key]; !ok && len(node.children) >= d.maxChildren {
+			key = wildcard
+		}
+		node = d.child(node, key)
+	}
+
+	return node
+}
+
+// child returns the named child of a node, creating it if necessary
+func (d *Drain) child(node *drainNode, key string) *drainNode {
+	next, ok := node.children[key]
+	if !ok {
+		next = &drainNode{children: make(map[string]*drainNode)}
+		node.children[key] = next
+	}
+	return next
+}
+
+// bestCluster finds the most similar cluster above the similarity threshold
+func (d *Drain) bestCluster(leaf *drainNode, tokens []string) *logCluster {
+	var best *logCluster
+	bestScore := -1.0
+
+	for _, cluster := range leaf.clusters {
+		same := 0
+		for i, token := range cluster.template {
+			if token == tokens[i] || token == wildcard {
+				same++
+			}
+		}
+		score := float64(same) / float64(len(tokens))
+		if score >= d.similarity && score > bestScore {
+			best = cluster
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+// templateID derives a stable identifier from a cluster's initial template
+func templateID(template []string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(template, " ")))
+	return fmt.Sprintf("T%08x", h.Sum32())
+}
+
+// hasDigit reports whether a token contains a digit
+func hasDigit(token string) bool {
+	return strings.IndexFunc(token, unicode.IsDigit) >= 0
+}
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// emailRegex matches email addresses
+var emailRegex = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@([A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,})\b`)
+
+// extractEmails stores email addresses and their domains in Fields under
+// "emails" and "email_domains", each deduplicated in order of appearance
+func extractEmails(parsed *ParsedLog) {
+	matches := emailRegex.FindAllStringSubmatch(parsed.Message, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	var emails, domains []string
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		email := strings.ToLower(m[0])
+		domain := strings.ToLower(m[1])
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+		if !seen["@"+domain] {
+			seen["@"+domain] = true
+			domains = append(domains, domain)
+		}
+	}
+
+	parsed.Fields["emails"] = emails
+	parsed.Fields["email_domains"] = domains
+}
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	exprparser "github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Expr is a compiled expression evaluated against a single log entry.
+//
+// Expressions are written in the expr language (https://expr-lang.org):
+// identifiers name log fields, and "fields.name" or fields["name"] reach
+// entries of Fields whose names are keywords or otherwise no identifiers.
+// A field named like a built-in function, such as count or len, shadows
+// the function unless it is called.
+type Expr struct {
+	source  string
+	program *vm.Program
+	refs    []string
+}
+
+// Resolver looks up the value of an identifier during evaluation
+type Resolver func(name string) (interface{}, bool)
+
+// CompileExpr parses an expression
+func CompileExpr(source string) (*Expr, error) {
+	tree, err := exprparser.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", source, err)
+	}
+	refs := exprRefs(tree.Node)
+
+	options := []expr.Option{expr.AllowUndefinedVariables()}
+	for _, ref := range refs {
+		if _, ok := builtin.Index[ref]; ok {
+			options = append(options, expr.DisableBuiltin(ref))
+		}
+	}
+	program, err := expr.Compile(source, options...)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", source, err)
+	}
+
+	return &Expr{source: source, program: program, refs: refs}, nil
+}
+
+// String returns the expression source
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression, resolving identifiers through resolve.
+// Numeric results are float64. An expression that fails because a field it
+// refers to is missing has no value rather than an error.
+func (e *Expr) Eval(resolve Resolver) (interface{}, error) {
+	env := make(map[string]interface{}, len(e.refs)+1)
+	fields := make(map[string]interface{})
+	env["fields"] = fields
+	missing := false
+	for _, ref := range e.refs {
+		value, ok := resolve(ref)
+		if !ok {
+			missing = true
+			continue
+		}
+		if name, ok := strings.CutPrefix(ref, "fields."); ok {
+			fields[name] = value
+			continue
+		}
+		env[ref] = value
+	}
+
+	value, err := expr.Run(e.program, env)
+	if err != nil {
+		if missing {
+			return nil, nil
+		}
+		return nil, err
+	}
+	value = normalizeValue(value)
+	if f, ok := value.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		return nil, fmt.Errorf("result %v is not a finite number, e.g. after a division by zero", f)
+	}
+	return value, nil
+}
+
+// Identifiers returns the names the expression refers to, in order of
+// appearance, with entries of Fields reached through fields as
+// "fields.name"
+func (e *Expr) Identifiers() []string {
+	return append([]string(nil), e.refs...)
+}
+
+// EvalLog evaluates the expression against a parsed log
+func (e *Expr) EvalLog(log *ParsedLog) (interface{}, error) {
+	return e.Eval(log.Lookup)
+}
+
+// Lookup resolves a field name against a parsed log. Built-in names are
+// matched first; anything else, optionally prefixed with "fields.", is
+// looked up in Fields.
+func (l *ParsedLog) Lookup(name string) (interface{}, bool) {
+	switch name {
+	case "timestamp":
+		return l.Timestamp, true
+	case "level":
+		return l.Level, true
+	case "source":
+		return l.Source, true
+	case "message":
+		return l.Message, true
+	case "ip":
+		return l.IP, true
+	case "error_code":
+		return l.ErrorCode, true
+	case "template_id":
+		return l.TemplateID, true
+	case "template":
+		return l.Template, true
+	case "keywords":
+		return l.Keywords, true
+	case "trace_id":
+		return l.TraceID, true
+	case "span_id":
+		return l.SpanID, true
+	case "request_id":
+		return l.RequestID, true
+	case "tenant":
+		return l.Tenant, true
+	}
+
+	value, ok := l.Fields[strings.TrimPrefix(name, "fields.")]
+	return value, ok
+}
+
+// refCollector gathers the fields an expression refers to while its syntax
+// tree is walked, children before their parents
+type refCollector struct {
+	idents   []*ast.IdentifierNode
+	renamed  map[*ast.IdentifierNode]string
+	skipped  map[*ast.IdentifierNode]bool
+	declared map[string]bool
+}
+
+func (c *refCollector) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		c.idents = append(c.idents, n)
+	case *ast.MemberNode:
+		// fields.name and fields["name"] refer to one entry of Fields
+		base, ok := n.Node.(*ast.IdentifierNode)
+		if !ok || base.Value != "fields" {
+			return
+		}
+		if property, ok := n.Property.(*ast.StringNode); ok {
+			c.renamed[base] = "fields." + property.Value
+		} else {
+			c.skipped[base] = true
+		}
+	case *ast.CallNode:
+		// Functions called are no fields
+		if callee, ok := n.Callee.(*ast.IdentifierNode); ok {
+			c.skipped[callee] = true
+		}
+	case *ast.VariableDeclaratorNode:
+		c.declared[n.Name] = true
+	}
+}
+
+// exprRefs returns the fields an expression refers to, each once, in order
+// of appearance
+func exprRefs(root ast.Node) []string {
+	c := &refCollector{
+		renamed:  make(map[*ast.IdentifierNode]string),
+		skipped:  make(map[*ast.IdentifierNode]bool),
+		declared: make(map[string]bool),
+	}
+	ast.Walk(&root, c)
+
+	var refs []string
+	seen := make(map[string]bool)
+	for _, ident := range c.idents {
+		name, ok := c.renamed[ident]
+		if !ok {
+			name = ident.Value
+		}
+		if c.skipped[ident] || c.declared[name] || name == "fields" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		refs = append(refs, name)
+	}
+	return refs
+}
+
+// normalizeValue converts numeric results to float64
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
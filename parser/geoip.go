@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// geoRange maps an inclusive range of addresses to a location
+type geoRange struct {
+	start     netip.Addr
+	end       netip.Addr
+	country   string
+	city      string
+	latitude  float64
+	longitude float64
+}
+
+// GeoIP is an in-memory IP range to location database
+type GeoIP struct {
+	ranges []geoRange
+}
+
+// LoadGeoIP reads a CSV GeoIP database with one range per line:
+//
+//	start,end,country,city,latitude,longitude
+//
+// Addresses are IPv4 or IPv6 in text form or as integers, as in the free
+// DB-IP and IP2Location lite CSV downloads after trimming extra columns.
+// Lines starting with # are ignored.
+func LoadGeoIP(path string) (*GeoIP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	db := &GeoIP{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("GeoIP database %s: %w", path, err)
+		}
+		if len(record) < 6 {
+			return nil, fmt.Errorf("GeoIP database %s line %d: expected 6 columns", path, line)
+		}
+
+		start, err1 := parseGeoAddr(record[0])
+		end, err2 := parseGeoAddr(record[1])
+		lat, err3 := strconv.ParseFloat(record[4], 64)
+		lon, err4 := strconv.ParseFloat(record[5], 64)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("GeoIP database %s line %d: malformed range", path, line)
+		}
+
+		db.ranges = append(db.ranges, geoRange{
+			start:     start,
+			end:       end,
+			country:   record[2],
+			city:      record[3],
+			latitude:  lat,
+			longitude: lon,
+		})
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+	return db, nil
+}
+
+// parseGeoAddr parses an address in text or integer form
+func parseGeoAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), nil
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	if n.BitLen() <= 32 {
+		var b [4]byte
+		n.FillBytes(b[:])
+		return netip.AddrFrom4(b), nil
+	}
+	var b [16]byte
+	n.FillBytes(b[:])
+	return netip.AddrFrom16(b).Unmap(), nil
+}
+
+// lookup returns the range containing an address
+func (g *GeoIP) lookup(ip string) (geoRange, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return geoRange{}, false
+	}
+	addr = addr.Unmap()
+
+	// Find the last range starting at or before the address
+	i := sort.Search(len(g.ranges), func(i int) bool {
+		return addr.Less(g.ranges[i].start)
+	}) - 1
+	if i < 0 || g.ranges[i].end.Less(addr) || g.ranges[i].start.BitLen() != addr.BitLen() {
+		return geoRange{}, false
+	}
+	return g.ranges[i], true
+}
+
+// SetGeoIP enables enrichment of extracted IPs with their location
+func (p *Parser) SetGeoIP(db *GeoIP) {
+	p.geoip = db
+}
+
+// enrichGeoIP adds the country, city and coordinates of the log's IP
+func (p *Parser) enrichGeoIP(parsed *ParsedLog) {
+	if p.geoip == nil || parsed.IP == "" {
+		return
+	}
+	loc, ok := p.geoip.lookup(parsed.IP)
+	if !ok {
+		return
+	}
+	parsed.Fields["country"] = loc.country
+	if loc.city != "" {
+		parsed.Fields["city"] = loc.city
+	}
+	parsed.Fields["geo_lat"] = loc.latitude
+	parsed.Fields["geo_lon"] = loc.longitude
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxJWTLifetime is the longest token lifetime not considered absurd
+const maxJWTLifetime = 365 * 24 * time.Hour
+
+// jwtRegex matches compact JWS tokens; header and claims are base64url JSON
+// objects and therefore start with "eyJ"
+var jwtRegex = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// extractJWT decodes the first JWT in the message without verifying it and
+// stores its header and claims in Fields. Tokens using alg "none" or with
+// an absurd lifetime are flagged.
+func extractJWT(parsed *ParsedLog) {
+	token := jwtRegex.FindString(parsed.Message)
+	if token == "" {
+		return
+	}
+
+	parts := strings.Split(token, ".")
+	var header, claims map[string]interface{}
+	if decodeJWTPart(parts[0], &header) != nil || decodeJWTPart(parts[1], &claims) != nil {
+		return
+	}
+
+	parsed.Fields["jwt_header"] = header
+	parsed.Fields["jwt_claims"] = claims
+	if sub, ok := claims["sub"].(string); ok {
+		parsed.Fields["jwt_subject"] = sub
+	}
+	if iss, ok := claims["iss"].(string); ok {
+		parsed.Fields["jwt_issuer"] = iss
+	}
+
+	alg, _ := header["alg"].(string)
+	if strings.EqualFold(alg, "none") || parts[2] == "" {
+		parsed.Fields["jwt_alg_none"] = true
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		expires := time.Unix(int64(exp), 0)
+		issued := time.Now()
+		if iat, ok := claims["iat"].(float64); ok {
+			issued = time.Unix(int64(iat), 0)
+		}
+		if expires.Sub(issued) > maxJWTLifetime {
+			parsed.Fields["jwt_absurd_expiry"] = true
+		}
+	}
+}
+
+// decodeJWTPart decodes one base64url JSON segment of a JWT
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
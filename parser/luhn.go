@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cardRegex matches 13-19 digit runs optionally separated by spaces or dashes
+var cardRegex = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// maskCards replaces Luhn-valid payment card numbers in the message with a
+// masked form keeping only the last four digits, and sets pci_leak so
+// accidental PAN logging can be alerted on. It runs before any other
+// extraction so the number never reaches keywords, templates or fields.
+func maskCards(parsed *ParsedLog) {
+	found := false
+	parsed.Message = cardRegex.ReplaceAllStringFunc(parsed.Message, func(match string) string {
+		digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+		if !plausibleCard(digits) || !luhnValid(digits) {
+			return match
+		}
+		found = true
+
+		// Keep separators so the masked value lines up with the original
+		kept := 0
+		masked := []byte(match)
+		for i := len(masked) - 1; i >= 0; i-- {
+			if masked[i] < '0' || masked[i] > '9' {
+				continue
+			}
+			if kept < 4 {
+				kept++
+				continue
+			}
+			masked[i] = '*'
+		}
+		return string(masked)
+	})
+
+	if found {
+		parsed.Fields["pci_leak"] = true
+	}
+}
+
+// plausibleCard checks length and that the number starts with a major
+// network prefix (Amex, Visa, Mastercard, Discover, JCB, UnionPay, Diners)
+func plausibleCard(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	switch digits[0] {
+	case '3', '4', '5', '6', '2':
+		return true
+	}
+	return false
+}
+
+// luhnValid reports whether a digit string passes the Luhn checksum
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
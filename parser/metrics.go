@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"expvar"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMessageSize is the largest message parsed; longer ones are truncated
+	maxMessageSize = 64 * 1024
+
+	// sampleInterval is the minimum time between sampled error logs per kind
+	sampleInterval = 10 * time.Second
+
+	// sampleLineLength caps how much of an offending line is logged
+	sampleLineLength = 200
+)
+
+// Parse error kinds, also used as metric names
+const (
+	errExtraction = "extraction_failures"
+	errTimestamp  = "unparseable_timestamps"
+	errOversized  = "oversized_messages"
+	metricParsed  = "parsed"
+)
+
+// metrics holds parser counters, published at /debug/vars under "parser"
+var metrics = expvar.NewMap("parser")
+
+// timestampLayouts are the timestamp formats the parser accepts
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.Stamp,
+}
+
+// errorSampler logs offending lines at most once per interval per error kind
+type errorSampler struct {
+	mu         sync.Mutex
+	lastLogged map[string]time.Time
+	suppressed map[string]int
+}
+
+// newErrorSampler creates a new errorSampler
+func newErrorSampler() *errorSampler {
+	return &errorSampler{
+		lastLogged: make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// parseError records a problem with a log on the log itself and reports it
+// to the sampler
+func (p *Parser) parseError(parsed *ParsedLog, kind, detail string) {
+	parsed.ParseErrors++
+	p.sampler.report(kind, detail, parsed.Message)
+}
+
+// report counts a parse error and logs a sample of the offending line if
+// the kind has not been logged within the sample interval
+func (s *errorSampler) report(kind, detail, line string) {
+	metrics.Add(kind, 1)
+
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.lastLogged[kind]) < sampleInterval {
+		s.suppressed[kind]++
+		s.mu.Unlock()
+		return
+	}
+	suppressed := s.suppressed[kind]
+	s.lastLogged[kind] = now
+	s.suppressed[kind] = 0
+	s.mu.Unlock()
+
+	line = Clip(line, sampleLineLength)
+	log.Printf("Parse error (%s): %s [%d similar suppressed] line=%q", kind, detail, suppressed, line)
+}
+
+// validTimestamp reports whether a timestamp matches a known layout
+func validTimestamp(ts string) bool {
+	_, ok := ParseTimestamp(ts)
+	return ok
+}
+
+// ParseTimestamp parses a timestamp in any of the accepted formats
+func ParseTimestamp(ts string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"fmt"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -18,29 +20,75 @@ type ParsedLog struct {
 	IP        string
 	ErrorCode string
 	Keywords  []string
+	Fields    map[string]interface{}
+
+	// Tenant is the team or customer the log was tagged with on ingest
+	Tenant string
+
+	// Correlation identifiers
+	TraceID   string
+	SpanID    string
+	RequestID string
+
+	// RepeatCount is the number of identical messages this entry stands for
+	RepeatCount int
+
+	// ParseErrors counts problems met while parsing the entry, such as an
+	// unrecognized timestamp or a failing stage
+	ParseErrors int
+
+	// Template mining results
+	TemplateID string
+	Template   string
+	Variables  []string
 }
 
 // Parser processes raw log entries and extracts structured data
 type Parser struct {
 	inputChan  <-chan ingestor.LogEntry
-	outputChan chan<- ParsedLog
+	outputChan chan<- []ParsedLog
 	workers    int
 	wg         sync.WaitGroup
 	shutdown   chan struct{}
 	ipRegex    *regexp.Regexp
 	errorRegex *regexp.Regexp
+	kvRegex    *regexp.Regexp
+	drain      *Drain
+	stages     []Stage
+	computed   []computedField
+	sampler    *errorSampler
+	dedup      *deduper
+	batcher    *batcher
+	decode     bool
+	geoip      *GeoIP
 }
 
 // NewParser creates a new Parser instance
-func NewParser(inputChan <-chan ingestor.LogEntry, outputChan chan<- ParsedLog, workers int) *Parser {
-	return &Parser{
+func NewParser(inputChan <-chan ingestor.LogEntry, outputChan chan<- []ParsedLog, workers int) *Parser {
+	p := &Parser{
 		inputChan:  inputChan,
 		outputChan: outputChan,
 		workers:    workers,
 		shutdown:   make(chan struct{}),
 		ipRegex:    regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
 		errorRegex: regexp.MustCompile(`\b(?:ERROR|FATAL|CRITICAL|[45]\d{2})\b`),
+		kvRegex:    regexp.MustCompile(`\b([A-Za-z_][\w.]*)=("[^"]*"|[^\s,;]+)`),
+		drain:      NewDrain(drainDepth, drainSimilarity, drainMaxChildren),
+		sampler:    newErrorSampler(),
 	}
+	p.batcher = newBatcher(outputChan, p.shutdown, 1, 0)
+	return p
+}
+
+// AddStage appends a custom stage run after the built-in extraction
+func (p *Parser) AddStage(stage Stage) {
+	p.stages = append(p.stages, stage)
+}
+
+// SetPayloadDecoding enables decoding of detected base64/hex payloads so
+// their contents are re-scanned for keywords
+func (p *Parser) SetPayloadDecoding(enabled bool) {
+	p.decode = enabled
 }
 
 // Start begins the parser workers
@@ -49,6 +97,14 @@ func (p *Parser) Start() {
 		p.wg.Add(1)
 		go p.worker(i)
 	}
+	if p.dedup != nil {
+		p.wg.Add(1)
+		go p.flushDedup()
+	}
+	if p.batcher.size > 1 {
+		p.wg.Add(1)
+		go p.flushBatches()
+	}
 	log.Printf("Started %d parser workers", p.workers)
 }
 
@@ -63,9 +119,15 @@ func (p *Parser) worker(id int) {
 				return
 			}
 			parsed := p.parse(entry)
-			select {
-			case p.outputChan <- parsed:
-			case <-p.shutdown:
+			if p.dedup != nil {
+				for _, log := range p.dedup.add(parsed) {
+					if !p.emit(log) {
+						return
+					}
+				}
+				continue
+			}
+			if !p.emit(parsed) {
 				return
 			}
 		case <-p.shutdown:
@@ -74,28 +136,86 @@ func (p *Parser) worker(id int) {
 	}
 }
 
+// emit hands a parsed log to the batcher, returning false on shutdown
+func (p *Parser) emit(parsed ParsedLog) bool {
+	return p.batcher.add(parsed)
+}
+
+// Parse extracts structured data from a single entry outside the worker
+// pipeline, for offline tools. Batching and dedup do not apply.
+func (p *Parser) Parse(entry ingestor.LogEntry) ParsedLog {
+	return p.parse(entry)
+}
+
 // parse extracts structured data from a log entry
 func (p *Parser) parse(entry ingestor.LogEntry) ParsedLog {
+	metrics.Add(metricParsed, 1)
+	
+	// Truncate oversized messages before extraction
+	size := len(entry.Message)
+	if size > maxMessageSize {
+		entry.Message = Truncate(entry.Message, maxMessageSize)
+	}
+	
+	// Clean up terminal output and odd encodings before extraction
+	entry.Message = sanitize(entry.Message)
+	entry.Source = sanitize(entry.Source)
+	entry.Tenant = sanitize(entry.Tenant)
+	
 	parsed := ParsedLog{
-		Timestamp: entry.Timestamp,
-		Level:     entry.Level,
-		Source:    entry.Source,
-		Message:   entry.Message,
-		Keywords:  []string{},
+		Timestamp:   entry.Timestamp,
+		Level:       entry.Level,
+		Source:      entry.Source,
+		Message:     entry.Message,
+		Tenant:      entry.Tenant,
+		Keywords:    []string{},
+		Fields:      make(map[string]interface{}),
+		RepeatCount: 1,
+	}
+	
+	// Mask payment card numbers before anything else sees them
+	maskCards(&parsed)
+	
+	if size > maxMessageSize {
+		p.parseError(&parsed, errOversized, fmt.Sprintf("message of %d bytes from %s truncated", size, entry.Source))
+	}
+	
+	if entry.Timestamp != "" && !validTimestamp(entry.Timestamp) {
+		p.parseError(&parsed, errTimestamp, fmt.Sprintf("unrecognized timestamp %q from %s", entry.Timestamp, entry.Source))
+	}
+	
+	// Extract key=value pairs into fields, numeric values as float64. The
+	// extractors below run later, so their fields win over same-named keys.
+	for _, match := range p.kvRegex.FindAllStringSubmatch(parsed.Message, -1) {
+		value := strings.Trim(match[2], `"`)
+		if num, err := strconv.ParseFloat(value, 64); err == nil {
+			parsed.Fields[match[1]] = num
+		} else {
+			parsed.Fields[match[1]] = value
+		}
 	}
 	
 	// Extract IP address
-	if ip := p.ipRegex.FindString(entry.Message); ip != "" {
+	if ip := p.ipRegex.FindString(parsed.Message); ip != "" {
 		parsed.IP = ip
 	}
 	
+	// Locate the IP when a GeoIP database is loaded
+	p.enrichGeoIP(&parsed)
+	
 	// Extract error codes
-	if errCode := p.errorRegex.FindString(entry.Message); errCode != "" {
+	if errCode := p.errorRegex.FindString(parsed.Message); errCode != "" {
 		parsed.ErrorCode = errCode
 	}
 	
+	// Extract trace, span and request IDs for correlation
+	extractTraceIDs(&parsed)
+	
+	// Extract email addresses and domains
+	extractEmails(&parsed)
+	
 	// Extract keywords (simple tokenization)
-	words := strings.Fields(entry.Message)
+	words := strings.Fields(parsed.Message)
 	for _, word := range words {
 		word = strings.ToLower(strings.Trim(word, ".,;:!?"))
 		if len(word) > 3 {
@@ -103,6 +223,28 @@ func (p *Parser) parse(entry ingestor.LogEntry) ParsedLog {
 		}
 	}
 	
+	// Extract and fingerprint SQL statements
+	extractSQL(&parsed)
+	
+	// Decode JWTs and flag suspicious ones
+	extractJWT(&parsed)
+	
+	// Flag encoded payloads, optionally adding keywords from decoded text
+	detectPayloads(&parsed, p.decode)
+	
+	// Assign the message to a template
+	parsed.TemplateID, parsed.Template, parsed.Variables = p.drain.Match(parsed.Message)
+	
+	// Evaluate computed fields
+	p.applyComputedFields(&parsed)
+	
+	// Run custom stages
+	for _, stage := range p.stages {
+		if err := stage.Process(&parsed); err != nil {
+			p.parseError(&parsed, errExtraction, fmt.Sprintf("stage %s: %v", stage.Name(), err))
+		}
+	}
+	
 	return parsed
 }
 
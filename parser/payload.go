@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxDecodedPreview caps the decoded text stored in Fields
+	maxDecodedPreview = 256
+
+	// minPrintableRatio is the share of printable runes a decoded payload
+	// needs before it is re-scanned as text
+	minPrintableRatio = 0.9
+)
+
+var (
+	// base64Regex matches long standard or URL-safe base64 runs
+	base64Regex = regexp.MustCompile(`[A-Za-z0-9+/_-]{40,}={0,2}`)
+
+	// hexRegex matches long hex runs, longer than common hashes
+	hexRegex = regexp.MustCompile(`\b(?:0x)?[0-9a-fA-F]{80,}\b`)
+)
+
+// detectPayloads flags messages containing long base64 or hex blobs, a
+// common exfiltration and webshell indicator. When decode is set, payloads
+// that decode to text are re-scanned for keywords.
+func detectPayloads(parsed *ParsedLog, decode bool) {
+	var kind string
+	var decoded []byte
+
+	// JWT segments are base64 too but are handled by extractJWT
+	message := jwtRegex.ReplaceAllString(parsed.Message, "")
+
+	for _, candidate := range hexRegex.FindAllString(message, -1) {
+		raw, err := hex.DecodeString(strings.TrimPrefix(candidate, "0x"))
+		if err != nil {
+			continue
+		}
+		kind, decoded = "hex", raw
+		break
+	}
+
+	if kind == "" {
+		for _, candidate := range base64Regex.FindAllString(message, -1) {
+			if !looksEncoded(candidate) {
+				continue
+			}
+			raw, err := decodeBase64(candidate)
+			if err != nil {
+				continue
+			}
+			kind, decoded = "base64", raw
+			break
+		}
+	}
+
+	if kind == "" {
+		return
+	}
+
+	parsed.Fields["contains_encoded_payload"] = true
+	parsed.Fields["encoded_payload_kind"] = kind
+
+	if !decode || !printable(decoded) {
+		return
+	}
+
+	text := Truncate(string(decoded), maxDecodedPreview)
+	parsed.Fields["decoded_payload"] = text
+
+	for _, word := range strings.Fields(string(decoded)) {
+		word = strings.ToLower(strings.Trim(word, ".,;:!?\"'"))
+		if len(word) > 3 {
+			parsed.Keywords = append(parsed.Keywords, word)
+		}
+	}
+}
+
+// looksEncoded filters out long identifiers and paths by requiring a mix
+// of upper case, lower case and digits
+func looksEncoded(s string) bool {
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// decodeBase64 tries the standard and URL-safe alphabets, padded or not
+func decodeBase64(s string) ([]byte, error) {
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		var raw []byte
+		if raw, err = enc.DecodeString(s); err == nil {
+			return raw, nil
+		}
+	}
+	return nil, err
+}
+
+// printable reports whether decoded bytes are mostly printable UTF-8 text
+func printable(data []byte) bool {
+	if !utf8.Valid(data) || len(data) == 0 {
+		return false
+	}
+	total, ok := 0, 0
+	for _, r := range string(data) {
+		total++
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			ok++
+		}
+	}
+	return float64(ok)/float64(total) >= minPrintableRatio
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ansiRegex matches ANSI CSI sequences (colors, cursor movement) and OSC
+// sequences (terminal titles, hyperlinks)
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// sanitize normalizes text to NFC, strips ANSI escape sequences and replaces
+// control characters. Whitespace controls become spaces and other controls
+// and invalid UTF-8 become U+FFFD.
+func sanitize(s string) string {
+	s = strings.ToValidUTF8(s, "�")
+	if strings.ContainsRune(s, '\x1b') {
+		s = ansiRegex.ReplaceAllString(s, "")
+	}
+
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r):
+			return '�'
+		}
+		return r
+	}, s)
+
+	return norm.NFC.String(s)
+}
+
+// Truncate shortens s to at most n bytes without splitting a character
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Clip shortens s to at most n bytes, marking the cut, without splitting
+// a character
+func Clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return Truncate(s, n-3) + "..."
+}
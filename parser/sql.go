@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+var (
+	// sqlStartRegex finds the start of a SQL statement by its leading clause
+	sqlStartRegex = regexp.MustCompile(`(?i)\b(?:SELECT\s.+?\sFROM\s|INSERT\s+INTO\s|UPDATE\s+\S+\s+SET\s|DELETE\s+FROM\s|(?:CREATE|ALTER|DROP|TRUNCATE)\s+(?:TABLE|INDEX|VIEW|DATABASE|SCHEMA|USER)\s)`)
+
+	// sqlStringRegex matches single-quoted literals, including '' escapes
+	sqlStringRegex = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+	// sqlNumberRegex matches numeric literals not part of identifiers
+	sqlNumberRegex = regexp.MustCompile(`\b-?\d+(?:\.\d+)?\b`)
+
+	// sqlListRegex collapses placeholder lists such as IN (?, ?, ?)
+	sqlListRegex = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+
+	// sqlSpaceRegex collapses whitespace runs
+	sqlSpaceRegex = regexp.MustCompile(`\s+`)
+
+	// sqlInjectionRegex matches common injection payload shapes
+	sqlInjectionRegex = regexp.MustCompile(`(?i)'\s*or\s*'?\w*'?\s*=\s*'?\w*|\bor\s+1\s*=\s*1\b|\bunion\s+(?:all\s+)?select\b|--\s*$|/\*.*?\*/|;\s*(?:drop|delete|insert|update|shutdown)\b|\bsleep\s*\(|\bbenchmark\s*\(|\bxp_cmdshell\b|\binformation_schema\b|\bwaitfor\s+delay\b`)
+)
+
+// extractSQL finds a SQL statement in the message and stores it in Fields
+// together with a normalized form, where literals are replaced by ?, and a
+// fingerprint of the normalized form identifying the query shape
+func extractSQL(parsed *ParsedLog) {
+	loc := sqlStartRegex.FindStringIndex(parsed.Message)
+	if loc == nil {
+		return
+	}
+
+	statement := parsed.Message[loc[0]:]
+	if end := strings.IndexByte(sqlStringRegex.ReplaceAllStringFunc(statement, func(s string) string {
+		return strings.Repeat("x", len(s))
+	}), ';'); end >= 0 && strings.TrimSpace(statement[end+1:]) == "" {
+		statement = statement[:end]
+	}
+	statement = strings.TrimSpace(statement)
+
+	normalized := sqlStringRegex.ReplaceAllString(statement, "?")
+	normalized = sqlNumberRegex.ReplaceAllString(normalized, "?")
+	normalized = sqlListRegex.ReplaceAllString(normalized, "(?)")
+	normalized = strings.ToLower(sqlSpaceRegex.ReplaceAllString(normalized, " "))
+
+	h := fnv.New64a()
+	h.Write([]byte(normalized))
+
+	parsed.Fields["sql"] = statement
+	parsed.Fields["sql_verb"] = strings.ToUpper(strings.Fields(statement)[0])
+	parsed.Fields["sql_normalized"] = normalized
+	parsed.Fields["sql_fingerprint"] = fmt.Sprintf("%016x", h.Sum64())
+	if sqlInjectionRegex.MatchString(statement) {
+		parsed.Fields["sql_injection_suspect"] = true
+	}
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"plugin"
+
+	"github.com/davidharvith/argos/config"
+)
+
+// stageSymbol is the constructor a stage plugin must export
+const stageSymbol = "NewStage"
+
+// wasmMagic starts every WebAssembly module
+var wasmMagic = []byte("\x00asm")
+
+// Stage is a custom parsing or enrichment step applied to every log after
+// the built-in extraction. Stages typically add entries to ParsedLog.Fields.
+type Stage interface {
+	Name() string
+	Process(log *ParsedLog) error
+}
+
+// StageFactory builds a Stage from its configured options
+type StageFactory func(options map[string]string) (Stage, error)
+
+// configuredStage is a loaded stage under the name given in the config
+type configuredStage struct {
+	Stage
+	name string
+}
+
+// Name returns the configured name of the stage
+func (s configuredStage) Name() string {
+	return s.name
+}
+
+// LoadStage opens a Go plugin built with -buildmode=plugin and constructs
+// the stage through its exported NewStage function. WebAssembly modules
+// are rejected, as no WASM runtime is built in.
+func LoadStage(cfg config.Stage) (Stage, error) {
+	if cfg.Plugin == "" {
+		return nil, fmt.Errorf("stage %s: plugin is required", cfg.Name)
+	}
+	if isWASM(cfg.Plugin) {
+		return nil, fmt.Errorf("stage %s: %s is a WebAssembly module, which is not supported; build the stage as a Go plugin", cfg.Name, cfg.Plugin)
+	}
+
+	plug, err := plugin.Open(cfg.Plugin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin %s: %w", cfg.Plugin, err)
+	}
+
+	sym, err := plug.Lookup(stageSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", cfg.Plugin, err)
+	}
+
+	var factory StageFactory
+	switch fn := sym.(type) {
+	case func(map[string]string) (Stage, error):
+		factory = fn
+	case *StageFactory:
+		factory = *fn
+	default:
+		return nil, fmt.Errorf("plugin %s: %s has unexpected type %T", cfg.Plugin, stageSymbol, sym)
+	}
+
+	stage, err := factory(cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("stage %s: %w", cfg.Name, err)
+	}
+
+	if cfg.Name != "" {
+		stage = configuredStage{Stage: stage, name: cfg.Name}
+	}
+	return stage, nil
+}
+
+// isWASM reports whether the file at path is a WebAssembly module
+func isWASM(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(wasmMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, wasmMagic)
+}
+
+// LoadStages loads every configured stage in order
+func LoadStages(cfgs []config.Stage) ([]Stage, error) {
+	stages := make([]Stage, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		stage, err := LoadStage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
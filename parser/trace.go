@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"regexp"
+)
+
+var (
+	// traceparentRegex matches a W3C traceparent: version-traceid-spanid-flags
+	traceparentRegex = regexp.MustCompile(`\b[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}\b`)
+
+	// traceIDRegex matches trace_id=, traceId:, trace.id= and similar
+	traceIDRegex = regexp.MustCompile(`(?i)\btrace[._-]?id["']?\s*[:=]\s*["']?([0-9a-f-]{16,36})\b`)
+
+	// spanIDRegex matches span_id=, spanId:, span.id= and similar
+	spanIDRegex = regexp.MustCompile(`(?i)\bspan[._-]?id["']?\s*[:=]\s*["']?([0-9a-f]{8,16})\b`)
+
+	// requestIDRegex matches X-Request-ID and request_id style identifiers
+	requestIDRegex = regexp.MustCompile(`(?i)\b(?:x-)?(?:request|req|correlation)[._-]?id["']?\s*[:=]\s*["']?([\w-]{6,64})`)
+)
+
+// extractTraceIDs fills the trace, span and request IDs of a parsed log.
+// A W3C traceparent takes precedence over loosely named identifiers.
+func extractTraceIDs(parsed *ParsedLog) {
+	if m := traceparentRegex.FindStringSubmatch(parsed.Message); m != nil {
+		parsed.TraceID = m[1]
+		parsed.SpanID = m[2]
+	}
+
+	if parsed.TraceID == "" {
+		if m := traceIDRegex.FindStringSubmatch(parsed.Message); m != nil {
+			parsed.TraceID = m[1]
+		}
+	}
+
+	if parsed.SpanID == "" {
+		if m := spanIDRegex.FindStringSubmatch(parsed.Message); m != nil {
+			parsed.SpanID = m[1]
+		}
+	}
+
+	if m := requestIDRegex.FindStringSubmatch(parsed.Message); m != nil {
+		parsed.RequestID = m[1]
+	}
+}
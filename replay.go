@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidharvith/argos/analyzer"
+	"github.com/davidharvith/argos/ingestor"
+	"github.com/davidharvith/argos/parser"
+)
+
+// maxReplayLine bounds the length of one NDJSON line read during a replay
+const maxReplayLine = 1 << 20
+
+// ruleHits counts the alerts one rule raised during a replay
+type ruleHits struct {
+	Name     string           `json:"name"`
+	Count    int              `json:"count"`
+	Examples []analyzer.Alert `json:"examples,omitempty"`
+}
+
+// replayResult summarizes a replay of recorded logs through a rule set
+type replayResult struct {
+	Logs    int         `json:"logs"`
+	Invalid int         `json:"invalid"`
+	Alerts  int         `json:"alerts"`
+	Rules   []*ruleHits `json:"rules"`
+}
+
+// hits returns the counts of the named rule, or nil
+func (r *replayResult) hits(name string) *ruleHits {
+	for _, h := range r.Rules {
+		if h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// replayer runs one rule set during a replay and collects its alerts
+type replayer struct {
+	anl       *analyzer.Analyzer
+	alertChan chan analyzer.Alert
+	result    *replayResult
+	done      chan struct{}
+}
+
+// newReplayer starts collecting alerts for rules, or the built-in rules
+// when nil
+func newReplayer(rules []analyzer.Rule, examples int) *replayer {
+	rp := &replayer{
+		alertChan: make(chan analyzer.Alert, alertBufferSize),
+		result:    &replayResult{},
+		done:      make(chan struct{}),
+	}
+	rp.anl = analyzer.NewAnalyzer(nil, rp.alertChan)
+	if rules != nil {
+		rp.anl.SetRules(rules)
+	}
+
+	hits := make(map[string]*ruleHits)
+	for _, rule := range rp.anl.Rules() {
+		if rule.Suppress {
+			continue
+		}
+		h := &ruleHits{Name: rule.Name}
+		hits[rule.Name] = h
+		rp.result.Rules = append(rp.result.Rules, h)
+	}
+
+	go func() {
+		defer close(rp.done)
+		for alert := range rp.alertChan {
+			name, _ := alert.Metadata["rule_name"].(string)
+			if name == "" {
+				name = alert.Reason
+			}
+			h, ok := hits[name]
+			if !ok {
+				h = &ruleHits{Name: name}
+				hits[name] = h
+				rp.result.Rules = append(rp.result.Rules, h)
+			}
+			h.Count++
+			if len(h.Examples) < examples {
+				h.Examples = append(h.Examples, alert)
+			}
+			rp.result.Alerts++
+		}
+	}()
+	return rp
+}
+
+// finish waits for the collected alerts and returns the result
+func (rp *replayer) finish() *replayResult {
+	close(rp.alertChan)
+	<-rp.done
+	return rp.result
+}
+
+// replay parses NDJSON log entries from input and checks them against each
+// rule set, keeping up to examples alerts per rule. A nil rule set stands
+// for the built-in rules. Each log is evaluated at its own timestamp so
+// windowed rules behave as they would have live; logs without one reuse
+// the previous log's time. Detector ticks and missed heartbeats are checked
+// as the replayed time passes their interval, at the time of the next log.
+func replay(prs *parser.Parser, input io.Reader, examples int, ruleSets ...[]analyzer.Rule) ([]*replayResult, error) {
+	replayers := make([]*replayer, len(ruleSets))
+	for i, rules := range ruleSets {
+		replayers[i] = newReplayer(rules, examples)
+	}
+
+	logs, invalid := 0, 0
+	now := time.Now()
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry ingestor.LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			invalid++
+			continue
+		}
+		if ts, ok := parser.ParseTimestamp(entry.Timestamp); ok {
+			now = ts
+		}
+		parsed := prs.Parse(entry)
+		for _, rp := range replayers {
+			rp.anl.TickAt(now)
+			rp.anl.ProcessAt(parsed, now)
+		}
+		logs++
+	}
+
+	results := make([]*replayResult, len(replayers))
+	for i, rp := range replayers {
+		results[i] = rp.finish()
+		results[i].Logs = logs
+		results[i].Invalid = invalid
+	}
+
+	if err := scanner.Err(); err != nil {
+		return results, fmt.Errorf("failed to read logs: %w", err)
+	}
+	return results, nil
+}
+
+// openLogs opens the log files matching pattern, in name order, as one
+// stream; files ending in .gz are decompressed. A pattern of - reads stdin.
+func openLogs(pattern string) (io.ReadCloser, error) {
+	if pattern == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input pattern %q: %w", pattern, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no log files match %q", pattern)
+	}
+	sort.Strings(paths)
+
+	logs := &multiFile{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			logs.Close()
+			return nil, fmt.Errorf("failed to open logs: %w", err)
+		}
+		logs.closers = append(logs.closers, f)
+
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				logs.Close()
+				return nil, fmt.Errorf("failed to open %s: %w", path, err)
+			}
+			logs.closers = append(logs.closers, gz)
+			r = gz
+		}
+		// Keep the last line of one file from running into the next
+		logs.readers = append(logs.readers, r, strings.NewReader("\n"))
+	}
+	logs.Reader = io.MultiReader(logs.readers...)
+	return logs, nil
+}
+
+// multiFile reads several files in sequence and closes them together
+type multiFile struct {
+	io.Reader
+	readers []io.Reader
+	closers []io.Closer
+}
+
+// Close closes every underlying file
+func (m *multiFile) Close() error {
+	for _, c := range m.closers {
+		c.Close()
+	}
+	return nil
+}